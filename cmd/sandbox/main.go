@@ -0,0 +1,143 @@
+// sandbox 在与评测相同的沙箱容器中运行一条命令, 用于在本地复现提交的运行情况
+//
+// 用法:
+//
+//	sandbox --image gcc:13 --cmd ./main --timelimit 1000 --memlimit 256 --input 1.in
+//
+// 需要先将程序放入镜像或通过 --workdir-file 复制到容器的工作目录中.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	var (
+		image     = flag.String("image", "", "container image")
+		cmd       = flag.String("cmd", "", "command to run inside the container")
+		timeLimit = flag.Int64("timelimit", 1000, "time limit in milliseconds")
+		memLimit  = flag.Int64("memlimit", 256, "memory limit in MiB, 0 for unlimited")
+		input     = flag.String("input", "", "file used as stdin, empty for no input")
+		file      = flag.String("workdir-file", "", "file copied into the container workdir before running")
+		verbose   = flag.Bool("v", false, "print docker logs")
+	)
+	flag.Parse()
+
+	level := zerolog.WarnLevel
+	if *verbose {
+		level = zerolog.DebugLevel
+	}
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr}).Level(level)
+
+	if *image == "" || *cmd == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	code, err := run(*image, *cmd, *timeLimit, *memLimit<<20, *input, *file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+// run 启动沙箱容器并运行命令, 返回命令的退出码
+func run(image, cmd string, timeLimitMs, memoryLimit int64, inputFile, workdirFile string) (int, error) {
+	ctx := context.Background()
+
+	docker, err := file_transfer.NewDockerService()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create docker client")
+	}
+
+	var stdin io.Reader = bytes.NewReader(nil)
+	if inputFile != "" {
+		data, err := os.ReadFile(inputFile)
+		if err != nil {
+			return 0, err
+		}
+		stdin = bytes.NewReader(data)
+	}
+
+	// 与评测相同: 容器以 sleep 保持运行, 命令通过exec执行
+	cfg := file_transfer.DefaultRunConfig()
+	cfg.Name = "soj-sandbox-" + uuid.NewString()
+	cfg.Image = image
+	cfg.Cmd = []string{"sleep", "infinity"}
+	cfg.ReadonlyRootfs = false
+	if memoryLimit > 0 {
+		cfg.MemoryLimit = memoryLimit
+	}
+
+	err = docker.PullImageIfMissing(ctx, image)
+	if err != nil {
+		return 0, err
+	}
+
+	cid, err := docker.RunImage(ctx, cfg)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to start container")
+	}
+	defer docker.CleanContainer(ctx, cid, file_transfer.DefaultStopGrace)
+
+	if workdirFile != "" {
+		data, err := os.ReadFile(workdirFile)
+		if err != nil {
+			return 0, err
+		}
+		err = docker.CopyFileToContainer(ctx, cid, path.Join(cfg.Workdir, path.Base(workdirFile)), data)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// ExecContainer 的超时以秒为单位
+	timeout := int((timeLimitMs + 999) / 1000)
+	var stdout, stderr bytes.Buffer
+
+	start := time.Now()
+	ec, _, err := docker.ExecContainer(ctx, cid, cmd, timeout, stdin, &stdout, &stderr, nil, false, "", "")
+	elapsed := time.Since(start)
+	timedOut := errors.Is(err, file_transfer.ErrTimeLimitExceeded)
+	if err != nil && !timedOut {
+		return 0, errors.Wrap(err, "failed to run command")
+	}
+	_, mem, serr := docker.ContainerStats(ctx, cid)
+
+	fmt.Println("===== stdout =====")
+	os.Stdout.Write(stdout.Bytes())
+	fmt.Println("\n===== stderr =====")
+	os.Stdout.Write(stderr.Bytes())
+	fmt.Println("\n===== result =====")
+	fmt.Printf("exit code: %d\n", ec)
+	fmt.Printf("time used: %d ms (limit %d ms)\n", elapsed.Milliseconds(), timeLimitMs)
+	if serr == nil {
+		fmt.Printf("memory:    %d KiB\n", mem>>10)
+	}
+	switch {
+	case timedOut || elapsed.Milliseconds() > timeLimitMs:
+		fmt.Println("status:    time limit exceeded")
+	case ec == file_transfer.ExitCodeKilled:
+		fmt.Println("status:    killed (possibly memory limit exceeded)")
+	case ec != 0:
+		fmt.Println("status:    runtime error")
+	default:
+		fmt.Println("status:    ok")
+	}
+
+	return ec, nil
+}
@@ -0,0 +1,95 @@
+package contest
+
+import (
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 提交校验错误
+var (
+	ErrContestNotFound     = errors.New("contest not found")
+	ErrContestNotRunning   = errors.New("contest is not running")
+	ErrProblemNotInContest = errors.New("problem is not in the contest")
+	ErrNotParticipant      = errors.New("user is not a participant of the contest")
+	ErrContestNotEnded     = errors.New("contest has not ended yet")
+)
+
+// Contest 比赛
+//
+// 比赛定义文件为YAML格式, 时间使用RFC3339格式, 如 2024-05-01T09:00:00+08:00.
+type Contest struct {
+	Id        string    `yaml:"id" json:"id"`
+	Title     string    `yaml:"title" json:"title"`
+	StartTime time.Time `yaml:"starttime" json:"start_time"`
+	EndTime   time.Time `yaml:"endtime" json:"end_time"`
+
+	// FreezeTime 封榜时间, 之后的提交在排行榜中显示为待定, 直到比赛结束后解封. 为零值时不封榜
+	FreezeTime time.Time `yaml:"freezetime,omitempty" json:"freeze_time,omitempty"`
+	// Unfrozen 是否已经解封, 由 Manager.UnfreezeStandings 设置并写回比赛定义文件
+	Unfrozen bool `yaml:"unfrozen,omitempty" json:"unfrozen,omitempty"`
+
+	// TeamMode 团队赛, 队员的提交计入其提交时所在的队伍, 不在队伍中的用户以个人身份参赛
+	TeamMode bool `yaml:"teammode,omitempty" json:"team_mode,omitempty"`
+
+	ProblemIDs []string `yaml:"problems" json:"problems"`
+	// ParticipantIDs 允许参赛的用户, 为空时所有用户都可以参赛
+	ParticipantIDs []string `yaml:"participants" json:"-"`
+}
+
+// Validate 检查比赛定义是否合法
+func (c *Contest) Validate() error {
+	if c.Id == "" {
+		return errors.New("contest id is empty")
+	}
+	if c.StartTime.IsZero() || c.EndTime.IsZero() {
+		return errors.New("contest start or end time is not set")
+	}
+	if !c.EndTime.After(c.StartTime) {
+		return errors.New("contest ends before it starts")
+	}
+	if len(c.ProblemIDs) == 0 {
+		return errors.New("contest has no problems")
+	}
+	if !c.FreezeTime.IsZero() && (c.FreezeTime.Before(c.StartTime) || !c.FreezeTime.Before(c.EndTime)) {
+		return errors.New("contest freeze time is not within the contest")
+	}
+	return nil
+}
+
+// IsRunning 比赛在 t 时刻是否进行中
+func (c *Contest) IsRunning(t time.Time) bool {
+	return !t.Before(c.StartTime) && t.Before(c.EndTime)
+}
+
+// IsFrozen 排行榜在 t 时刻是否处于封榜状态
+//
+// 比赛结束后排行榜仍保持封榜, 直到被解封.
+func (c *Contest) IsFrozen(t time.Time) bool {
+	return !c.FreezeTime.IsZero() && !c.Unfrozen && !t.Before(c.FreezeTime)
+}
+
+// HasProblem 题目是否属于比赛
+func (c *Contest) HasProblem(problemID string) bool {
+	return slices.Contains(c.ProblemIDs, problemID)
+}
+
+// HasParticipant 用户是否可以参赛
+func (c *Contest) HasParticipant(userID string) bool {
+	return len(c.ParticipantIDs) == 0 || slices.Contains(c.ParticipantIDs, userID)
+}
+
+// CheckSubmission 检查用户能否在 t 时刻向比赛中的题目提交
+func (c *Contest) CheckSubmission(userID, problemID string, t time.Time) error {
+	if !c.IsRunning(t) {
+		return ErrContestNotRunning
+	}
+	if !c.HasProblem(problemID) {
+		return ErrProblemNotInContest
+	}
+	if !c.HasParticipant(userID) {
+		return ErrNotParticipant
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package contest
+
+// Result 导出的比赛成绩中的一行
+type Result struct {
+	Rank int `json:"rank"`
+	// UserID 用户ID, 团队赛中队伍的一行为队伍ID
+	UserID string `json:"user_id"`
+	// Username 显示的名称, 用户没有单独的用户名, 为用户ID; 队伍为队伍名称
+	Username string `json:"username"`
+	// TotalScore 各题得分之和
+	TotalScore float64 `json:"total_score"`
+	// PenaltyTime 罚时(分钟), 与排行榜相同
+	PenaltyTime int64 `json:"penalty_time"`
+	// Scores 题目ID到该题在比赛中最高得分的映射, 包含比赛的所有题目
+	Scores map[string]float64 `json:"scores"`
+}
+
+// Results 计算比赛成绩, 用于导出成绩册
+//
+// 名次和罚时与解封后的排行榜相同, 不受封榜影响. 每道题目的得分为比赛期间计入排行榜的提交中的最高分.
+func (m *Manager) Results(contestID string) ([]Result, error) {
+	c, ok := m.GetContest(contestID)
+	if !ok {
+		return nil, ErrContestNotFound
+	}
+
+	attempts, err := m.loadAttempts(c)
+	if err != nil {
+		return nil, err
+	}
+	standings := c.buildStandings(attempts, false)
+	m.fillTeamNames(standings)
+
+	results := make([]Result, 0, len(standings))
+	for _, st := range standings {
+		r := Result{
+			Rank:        st.Rank,
+			UserID:      st.UserID,
+			Username:    st.UserID,
+			PenaltyTime: st.Penalty,
+			Scores:      make(map[string]float64, len(c.ProblemIDs)),
+		}
+		if st.TeamID != "" {
+			r.UserID, r.Username = st.TeamID, st.TeamName
+		}
+
+		problems := attempts[participant{userID: st.UserID, teamID: st.TeamID}]
+		for _, pid := range c.ProblemIDs {
+			best := 0.0
+			for _, a := range problems[pid] {
+				best = max(best, a.score)
+			}
+			r.Scores[pid] = best
+			r.TotalScore += best
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
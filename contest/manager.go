@@ -0,0 +1,220 @@
+package contest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Manager 比赛管理器
+//
+// Manager 包装了 SubmissionStore, 创建比赛提交时检查比赛时间, 题目和参赛者,
+// 其余操作直接交给被包装的 SubmissionStore.
+type Manager struct {
+	types.SubmissionStore
+
+	mu       sync.RWMutex
+	contests map[string]*Contest
+	order    []string
+	// files 比赛ID到定义文件路径的映射, 用于写回解封状态
+	files map[string]string
+
+	// teams 团队赛使用的队伍存储, 为nil时团队赛按个人计分
+	teams types.TeamStore
+	// virtual 虚拟参赛存储, 为nil时不接受虚拟参赛的提交
+	virtual types.VirtualContestStore
+}
+
+var _ types.SubmissionStore = (*Manager)(nil)
+
+// NewManager 创建比赛管理器
+func NewManager(store types.SubmissionStore) *Manager {
+	return &Manager{
+		SubmissionStore: store,
+		contests:        make(map[string]*Contest),
+		files:           make(map[string]string),
+	}
+}
+
+// SetTeamStore 设置队伍存储, 设置后团队赛的提交记录提交者所在的队伍
+func (m *Manager) SetTeamStore(teams types.TeamStore) {
+	m.teams = teams
+}
+
+// LoadContest 加载单个比赛
+func (m *Manager) LoadContest(file string) (*Contest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Contest
+	err = yaml.Unmarshal(data, &c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal contest "+file)
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid contest "+file)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.contests[c.Id]; !ok {
+		m.order = append(m.order, c.Id)
+	}
+	m.contests[c.Id] = &c
+	m.files[c.Id] = file
+	return &c, nil
+}
+
+// LoadContestDir 从目录加载所有比赛
+func (m *Manager) LoadContestDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		c, err := m.LoadContest(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		log.Info().Str("contest", c.Id).Time("start", c.StartTime).Time("end", c.EndTime).Msg("loaded contest")
+	}
+	return nil
+}
+
+// GetContest 获取比赛
+func (m *Manager) GetContest(id string) (*Contest, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.contests[id]
+	return c, ok
+}
+
+// UnfreezeStandings 解封比赛排行榜, 只能在比赛结束后调用
+//
+// 解封状态会写回比赛定义文件, 重启后仍然有效. 比赛没有封榜或已经解封时什么都不做.
+func (m *Manager) UnfreezeStandings(contestID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.contests[contestID]
+	if !ok {
+		return ErrContestNotFound
+	}
+	if time.Now().Before(c.EndTime) {
+		return ErrContestNotEnded
+	}
+	if c.FreezeTime.IsZero() || c.Unfrozen {
+		return nil
+	}
+
+	// 其他goroutine可能持有原来的 *Contest, 替换而不是修改
+	unfrozen := *c
+	unfrozen.Unfrozen = true
+	if file, ok := m.files[contestID]; ok {
+		data, err := yaml.Marshal(&unfrozen)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(file, data, 0644)
+		if err != nil {
+			return errors.Wrap(err, "failed to write contest "+contestID)
+		}
+	}
+	m.contests[contestID] = &unfrozen
+	log.Info().Str("contest", contestID).Msg("standings unfrozen")
+	return nil
+}
+
+// Participants 返回比赛的参赛者: 设置了 ParticipantIDs 时为其中的用户, 否则为在比赛中提交过的用户
+func (m *Manager) Participants(contestID string) ([]string, error) {
+	c, ok := m.GetContest(contestID)
+	if !ok {
+		return nil, ErrContestNotFound
+	}
+	if len(c.ParticipantIDs) > 0 {
+		return slices.Clone(c.ParticipantIDs), nil
+	}
+
+	subs, err := m.ListByContest(contestID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var users []string
+	for _, sub := range subs {
+		if !seen[sub.UserID] {
+			seen[sub.UserID] = true
+			users = append(users, sub.UserID)
+		}
+	}
+	return users, nil
+}
+
+// ListOpenContests 列出 t 时刻进行中的比赛, 按加载顺序排列
+func (m *Manager) ListOpenContests(t time.Time) []*Contest {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var open []*Contest
+	for _, id := range m.order {
+		if c := m.contests[id]; c.IsRunning(t) {
+			open = append(open, c)
+		}
+	}
+	return open
+}
+
+// CreateSubmission 创建提交, 比赛或虚拟参赛的提交不满足要求时返回错误且不会创建
+func (m *Manager) CreateSubmission(sub *types.Submission) error {
+	if sub.VirtualContestID != "" {
+		if sub.ContestID != "" {
+			return errors.New("submission cannot belong to both a contest and a virtual contest")
+		}
+		err := m.checkVirtualSubmission(sub)
+		if err != nil {
+			return err
+		}
+	}
+
+	if sub.ContestID != "" {
+		c, ok := m.GetContest(sub.ContestID)
+		if !ok {
+			return ErrContestNotFound
+		}
+
+		t := time.Now()
+		if sub.SubmittedAt != 0 {
+			t = time.Unix(0, sub.SubmittedAt)
+		}
+		err := c.CheckSubmission(sub.UserID, sub.ProblemID, t)
+		if err != nil {
+			return err
+		}
+
+		if c.TeamMode && m.teams != nil {
+			team, err := m.teams.GetTeamByUser(sub.UserID)
+			switch {
+			case err == nil:
+				sub.TeamID = team.TeamID
+			case !errors.Is(err, types.ErrNotInTeam):
+				return errors.Wrap(err, "failed to get team")
+			}
+		}
+	}
+	return m.SubmissionStore.CreateSubmission(sub)
+}
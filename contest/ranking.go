@@ -0,0 +1,144 @@
+package contest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/rs/zerolog/log"
+)
+
+// RankingCache 缓存比赛排行榜
+//
+// 每个比赛在内存中保存每个用户每道题目的提交, 提交评测完成时通过 SubmissionStore 的回调增量更新,
+// 排行榜只在有新提交后被读取时重新排序, 不需要再查询数据库.
+// 比赛第一次被读取时从提交存储全量加载, 重启后也可以调用 Warm 预先加载.
+type RankingCache struct {
+	manager *Manager
+
+	mu       sync.Mutex
+	rankings map[string]*contestRanking
+}
+
+type contestRanking struct {
+	attempts  map[participant]map[string][]attempt
+	standings []Standing
+	stale     bool
+	// frozen 缓存的排行榜是否为封榜时的排行榜
+	frozen bool
+}
+
+// NewRankingCache 创建排行榜缓存, 并在 manager 的提交存储上注册回调
+func NewRankingCache(manager *Manager) *RankingCache {
+	rc := &RankingCache{
+		manager:  manager,
+		rankings: make(map[string]*contestRanking),
+	}
+	manager.OnCompleted(rc.record)
+	return rc
+}
+
+// record 记录评测完成的提交
+func (rc *RankingCache) record(sub *types.Submission) {
+	if sub.ContestID == "" {
+		return
+	}
+	c, ok := rc.manager.GetContest(sub.ContestID)
+	if !ok {
+		return
+	}
+	a, ok := c.attemptOf(sub)
+	if !ok {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	// 尚未加载的比赛在第一次读取时全量加载, 其中已包含该提交
+	r, ok := rc.rankings[c.Id]
+	if !ok {
+		return
+	}
+	p := c.participantOf(sub)
+	if r.attempts[p] == nil {
+		r.attempts[p] = make(map[string][]attempt)
+	}
+	// 全量加载与回调并发时提交可能已经被加载, 提交被重测或hack时结果会改变, 替换原来的记录
+	r.stale = true
+	for i, old := range r.attempts[p][sub.ProblemID] {
+		if old.id == a.id {
+			r.attempts[p][sub.ProblemID][i] = a
+			return
+		}
+	}
+	r.attempts[p][sub.ProblemID] = append(r.attempts[p][sub.ProblemID], a)
+}
+
+// Warm 从提交存储全量加载比赛的排行榜, 覆盖已有的缓存
+func (rc *RankingCache) Warm(contestID string) error {
+	c, ok := rc.manager.GetContest(contestID)
+	if !ok {
+		return ErrContestNotFound
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.load(c)
+}
+
+// WarmAll 加载所有比赛的排行榜
+func (rc *RankingCache) WarmAll() error {
+	rc.manager.mu.RLock()
+	ids := append([]string(nil), rc.manager.order...)
+	rc.manager.mu.RUnlock()
+
+	for _, id := range ids {
+		err := rc.Warm(id)
+		if err != nil {
+			return err
+		}
+	}
+	log.Info().Int("contests", len(ids)).Msg("ranking cache warmed")
+	return nil
+}
+
+// load 全量加载, 调用时需持有 rc.mu
+func (rc *RankingCache) load(c *Contest) error {
+	attempts, err := rc.manager.loadAttempts(c)
+	if err != nil {
+		return err
+	}
+	rc.rankings[c.Id] = &contestRanking{attempts: attempts, stale: true}
+	return nil
+}
+
+// GetStandings 获取比赛排行榜, 封榜期间返回封榜时的排行榜, 见 Manager.GetStandings
+//
+// 返回的切片在下次更新前被共享, 调用者不应修改.
+func (rc *RankingCache) GetStandings(contestID string) ([]Standing, error) {
+	c, ok := rc.manager.GetContest(contestID)
+	if !ok {
+		return nil, ErrContestNotFound
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	r, ok := rc.rankings[c.Id]
+	if !ok {
+		err := rc.load(c)
+		if err != nil {
+			return nil, err
+		}
+		r = rc.rankings[c.Id]
+	}
+	frozen := c.IsFrozen(time.Now())
+	if r.stale || r.frozen != frozen {
+		r.standings = c.buildStandings(r.attempts, frozen)
+		rc.manager.fillTeamNames(r.standings)
+		r.stale = false
+		r.frozen = frozen
+	}
+	return r.standings, nil
+}
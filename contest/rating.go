@@ -0,0 +1,100 @@
+package contest
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultRatingInterval 检查已结束比赛的默认间隔
+	DefaultRatingInterval = time.Minute
+	// RatingDelay 比赛结束后等待的时间, 留给比赛结束前的提交完成评测
+	RatingDelay = 10 * time.Minute
+)
+
+// RatingUpdater 在比赛结束后按最终排名更新参赛者的rating
+//
+// 排名不受封榜影响. 团队赛不计算rating.
+type RatingUpdater struct {
+	manager *Manager
+	store   types.RatingStore
+}
+
+// NewRatingUpdater 创建rating更新器
+func NewRatingUpdater(manager *Manager, store types.RatingStore) *RatingUpdater {
+	return &RatingUpdater{manager: manager, store: store}
+}
+
+// Update 为在 now 之前 RatingDelay 已经结束且尚未计算rating的比赛计算rating
+func (u *RatingUpdater) Update(now time.Time) error {
+	u.manager.mu.RLock()
+	var ended []*Contest
+	for _, id := range u.manager.order {
+		if c := u.manager.contests[id]; !c.TeamMode && !now.Before(c.EndTime.Add(RatingDelay)) {
+			ended = append(ended, c)
+		}
+	}
+	u.manager.mu.RUnlock()
+
+	for _, c := range ended {
+		rated, err := u.store.IsRated(c.Id)
+		if err != nil {
+			return err
+		}
+		if rated {
+			continue
+		}
+
+		attempts, err := u.manager.loadAttempts(c)
+		if err != nil {
+			return err
+		}
+		var results []types.ContestResult
+		for _, st := range c.buildStandings(attempts, false) {
+			results = append(results, types.ContestResult{UserID: st.UserID, Rank: st.Rank})
+		}
+
+		changes, err := u.store.ApplyContest(c.Id, results)
+		if errors.Is(err, types.ErrContestRated) {
+			// 其他实例已经计算过
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Info().Str("contest", c.Id).Int("participants", len(changes)).Msg("contest ratings updated")
+	}
+	return nil
+}
+
+// Start 立即检查一次, 之后每隔 interval 检查一次, 直到 ctx 结束
+func (u *RatingUpdater) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultRatingInterval
+	}
+
+	err := u.Update(time.Now())
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to update contest ratings")
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := u.Update(time.Now())
+				if err != nil {
+					log.Warn().Err(err).Msg("failed to update contest ratings")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,212 @@
+package contest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// PenaltyPerWrongAttempt 题目通过前每次错误提交的罚时
+const PenaltyPerWrongAttempt = 20 * time.Minute
+
+// ProblemStanding 用户在一道题目上的情况
+type ProblemStanding struct {
+	Solved bool `json:"solved"`
+	// Attempts 通过前(未通过时为全部)的错误提交次数, 不含编译错误
+	Attempts int `json:"attempts"`
+	// SolvedAt 第一次通过距比赛开始的分钟数
+	SolvedAt int64 `json:"solved_at,omitempty"`
+	// Pending 封榜后的提交数, 这些提交的结果在解封前不公开
+	Pending int `json:"pending,omitempty"`
+}
+
+// Standing 排行榜中的一行, 团队赛中队伍的一行 UserID 为空
+type Standing struct {
+	Rank     int                         `json:"rank"`
+	UserID   string                      `json:"user_id,omitempty"`
+	TeamID   string                      `json:"team_id,omitempty"`
+	TeamName string                      `json:"team_name,omitempty"`
+	Solved   int                         `json:"solved"`
+	Penalty  int64                       `json:"penalty"` // in minutes
+	Problems map[string]*ProblemStanding `json:"problems"`
+}
+
+// attempt 计入排行榜的一次提交
+type attempt struct {
+	id       string
+	at       time.Time
+	accepted bool
+	// score 提交的得分, 只用于导出成绩
+	score float64
+}
+
+// participant 排行榜中的参赛者, 团队赛中为队伍, 否则为用户
+type participant struct {
+	userID string
+	teamID string
+}
+
+// participantOf 返回提交计入的参赛者
+func (c *Contest) participantOf(sub *types.Submission) participant {
+	if c.TeamMode && sub.TeamID != "" {
+		return participant{teamID: sub.TeamID}
+	}
+	return participant{userID: sub.UserID}
+}
+
+// attemptOf 返回提交对应的 attempt, 不计入排行榜的提交返回 false
+func (c *Contest) attemptOf(sub *types.Submission) (attempt, bool) {
+	if sub.ContestID != c.Id || sub.Status != types.SubmissionCompleted || !c.HasProblem(sub.ProblemID) {
+		return attempt{}, false
+	}
+	if sub.JudgeResult.Verdict == types.VerdictCompileError {
+		return attempt{}, false
+	}
+	at := time.Unix(0, sub.SubmittedAt)
+	if !c.IsRunning(at) {
+		return attempt{}, false
+	}
+	return attempt{id: sub.ID, at: at, accepted: sub.JudgeResult.Verdict == types.VerdictAccepted, score: sub.JudgeResult.Score}, true
+}
+
+// scoreProblem 根据用户在一道题目上的所有提交计算该题的情况
+//
+// 提交的评测完成顺序可能与提交顺序不同, 这里总是按提交时间计算.
+// frozen 为 true 时封榜后的提交只计入 Pending.
+func (c *Contest) scoreProblem(attempts []attempt, frozen bool) *ProblemStanding {
+	sort.SliceStable(attempts, func(i, j int) bool { return attempts[i].at.Before(attempts[j].at) })
+
+	ps := &ProblemStanding{}
+	for _, a := range attempts {
+		if frozen && !a.at.Before(c.FreezeTime) {
+			ps.Pending++
+			continue
+		}
+		if a.accepted {
+			ps.Solved = true
+			ps.SolvedAt = int64(a.at.Sub(c.StartTime) / time.Minute)
+			break
+		}
+		ps.Attempts++
+	}
+	return ps
+}
+
+// penalty 题目计入的罚时(分钟), 未通过时为0
+func (ps *ProblemStanding) penalty() int64 {
+	if !ps.Solved {
+		return 0
+	}
+	return ps.SolvedAt + int64(ps.Attempts)*int64(PenaltyPerWrongAttempt/time.Minute)
+}
+
+// buildStandings 根据每个参赛者每道题目的提交计算排行榜, frozen 为 true 时返回封榜时的排行榜
+func (c *Contest) buildStandings(attempts map[participant]map[string][]attempt, frozen bool) []Standing {
+	standings := make([]Standing, 0, len(attempts))
+	for p, problems := range attempts {
+		st := Standing{UserID: p.userID, TeamID: p.teamID, Problems: make(map[string]*ProblemStanding, len(problems))}
+		for pid, as := range problems {
+			ps := c.scoreProblem(as, frozen)
+			st.Problems[pid] = ps
+			if ps.Solved {
+				st.Solved++
+				st.Penalty += ps.penalty()
+			}
+		}
+		standings = append(standings, st)
+	}
+	sortStandings(standings)
+	return standings
+}
+
+// GetStandings 计算比赛排行榜
+//
+// 按通过题数降序, 罚时升序排列. 罚时为每道通过的题目第一次通过的时间(分钟)
+// 加上之前每次错误提交 PenaltyPerWrongAttempt. 通过题数和罚时相同的用户排名相同.
+// 封榜期间(见 Contest.IsFrozen)返回封榜时的排行榜, 之后的提交显示为 Pending.
+// 团队赛中按队伍计算, 提交计入提交时所在的队伍.
+// 每次调用都会查询比赛的所有提交, 频繁访问时应使用 RankingCache.
+func (m *Manager) GetStandings(contestID string) ([]Standing, error) {
+	c, ok := m.GetContest(contestID)
+	if !ok {
+		return nil, ErrContestNotFound
+	}
+
+	attempts, err := m.loadAttempts(c)
+	if err != nil {
+		return nil, err
+	}
+	standings := c.buildStandings(attempts, c.IsFrozen(time.Now()))
+	m.fillTeamNames(standings)
+	return standings, nil
+}
+
+// fillTeamNames 填充排行榜中队伍的名称
+func (m *Manager) fillTeamNames(standings []Standing) {
+	if m.teams == nil {
+		return
+	}
+	for i := range standings {
+		if standings[i].TeamID == "" {
+			continue
+		}
+		team, err := m.teams.GetTeam(standings[i].TeamID)
+		if err != nil {
+			// 队伍解散后仍保留其成绩, 只是没有名称
+			if !errors.Is(err, types.ErrTeamNotFound) {
+				log.Warn().Err(err).Str("team", standings[i].TeamID).Msg("failed to get team")
+			}
+			continue
+		}
+		standings[i].TeamName = team.Name
+	}
+}
+
+// loadAttempts 从提交存储中读取比赛的所有计入排行榜的提交
+func (m *Manager) loadAttempts(c *Contest) (map[participant]map[string][]attempt, error) {
+	subs, err := m.ListByContest(c.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make(map[participant]map[string][]attempt)
+	for i := range subs {
+		a, ok := c.attemptOf(&subs[i])
+		if !ok {
+			continue
+		}
+		p := c.participantOf(&subs[i])
+		if attempts[p] == nil {
+			attempts[p] = make(map[string][]attempt)
+		}
+		attempts[p][subs[i].ProblemID] = append(attempts[p][subs[i].ProblemID], a)
+	}
+	return attempts, nil
+}
+
+// sortStandings 排序并计算名次
+func sortStandings(standings []Standing) {
+	sort.Slice(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Solved != b.Solved {
+			return a.Solved > b.Solved
+		}
+		if a.Penalty != b.Penalty {
+			return a.Penalty < b.Penalty
+		}
+		if a.TeamID != b.TeamID {
+			return a.TeamID < b.TeamID
+		}
+		return a.UserID < b.UserID
+	})
+	for i := range standings {
+		if i > 0 && standings[i].Solved == standings[i-1].Solved && standings[i].Penalty == standings[i-1].Penalty {
+			standings[i].Rank = standings[i-1].Rank
+		} else {
+			standings[i].Rank = i + 1
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package contest
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// ErrVirtualNotEnabled 未设置虚拟参赛存储
+var ErrVirtualNotEnabled = errors.New("virtual contests are not enabled")
+
+// VirtualResult 用户虚拟参赛的成绩
+type VirtualResult struct {
+	VirtualContest *types.VirtualContest `json:"virtual_contest"`
+	// Standing 在所有虚拟参赛者中的排行, 名次为虚拟参赛者中的名次
+	Standing Standing `json:"standing"`
+	// RealRank 以同样的成绩参加原比赛时的名次, 与解封后的原比赛排行榜比较
+	RealRank int `json:"real_rank"`
+}
+
+// SetVirtualContestStore 设置虚拟参赛存储, 设置后接受虚拟参赛的提交
+func (m *Manager) SetVirtualContestStore(store types.VirtualContestStore) {
+	m.virtual = store
+}
+
+// StartVirtual 开始用户对已结束比赛的虚拟参赛, 计时从 now 开始, 时长与原比赛相同
+//
+// 比赛未结束时返回 ErrContestNotEnded, 用户已经虚拟参加过该比赛时返回 types.ErrVirtualContestExists.
+func (m *Manager) StartVirtual(contestID, userID string, now time.Time) (*types.VirtualContest, error) {
+	if m.virtual == nil {
+		return nil, ErrVirtualNotEnabled
+	}
+	c, ok := m.GetContest(contestID)
+	if !ok {
+		return nil, ErrContestNotFound
+	}
+	if now.Before(c.EndTime) {
+		return nil, ErrContestNotEnded
+	}
+
+	vc := &types.VirtualContest{
+		ID:        uuid.NewString(),
+		ContestID: c.Id,
+		UserID:    userID,
+		StartTime: now,
+		EndTime:   now.Add(c.EndTime.Sub(c.StartTime)),
+	}
+	err := m.virtual.CreateVirtualContest(vc)
+	if err != nil {
+		return nil, err
+	}
+	return vc, nil
+}
+
+// checkVirtualSubmission 检查虚拟参赛的提交: 提交者为虚拟参赛者, 在虚拟参赛期间提交, 且题目属于比赛
+func (m *Manager) checkVirtualSubmission(sub *types.Submission) error {
+	if m.virtual == nil {
+		return ErrVirtualNotEnabled
+	}
+	vc, err := m.virtual.GetVirtualContest(sub.VirtualContestID)
+	if err != nil {
+		return err
+	}
+	if vc.UserID != sub.UserID {
+		return ErrNotParticipant
+	}
+	c, ok := m.GetContest(vc.ContestID)
+	if !ok {
+		return ErrContestNotFound
+	}
+
+	t := time.Now()
+	if sub.SubmittedAt != 0 {
+		t = time.Unix(0, sub.SubmittedAt)
+	}
+	if !vc.IsRunning(t) {
+		return ErrContestNotRunning
+	}
+	if !c.HasProblem(sub.ProblemID) {
+		return ErrProblemNotInContest
+	}
+	return nil
+}
+
+// virtualAttempts 读取虚拟参赛中计入排行榜的提交, 提交时间换算为原比赛中对应的时间
+func (m *Manager) virtualAttempts(c *Contest, vc *types.VirtualContest) (map[string][]attempt, error) {
+	subs, err := m.ListByVirtualContest(vc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make(map[string][]attempt)
+	for i := range subs {
+		sub := &subs[i]
+		at := time.Unix(0, sub.SubmittedAt)
+		if sub.Status != types.SubmissionCompleted || !c.HasProblem(sub.ProblemID) || !vc.IsRunning(at) {
+			continue
+		}
+		if sub.JudgeResult.Verdict == types.VerdictCompileError {
+			continue
+		}
+		attempts[sub.ProblemID] = append(attempts[sub.ProblemID], attempt{
+			id:       sub.ID,
+			at:       c.StartTime.Add(at.Sub(vc.StartTime)),
+			accepted: sub.JudgeResult.Verdict == types.VerdictAccepted,
+			score:    sub.JudgeResult.Score,
+		})
+	}
+	return attempts, nil
+}
+
+// VirtualStandings 计算比赛所有虚拟参赛者的排行榜, 规则与原比赛相同, 不封榜
+//
+// 进行中的虚拟参赛也会列出, 其成绩为目前的成绩.
+func (m *Manager) VirtualStandings(contestID string) ([]Standing, error) {
+	if m.virtual == nil {
+		return nil, ErrVirtualNotEnabled
+	}
+	c, ok := m.GetContest(contestID)
+	if !ok {
+		return nil, ErrContestNotFound
+	}
+	list, err := m.virtual.ListVirtualContests(contestID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make(map[participant]map[string][]attempt, len(list))
+	for i := range list {
+		as, err := m.virtualAttempts(c, &list[i])
+		if err != nil {
+			return nil, err
+		}
+		attempts[participant{userID: list[i].UserID}] = as
+	}
+	return c.buildStandings(attempts, false), nil
+}
+
+// VirtualResult 返回用户的虚拟参赛成绩, 用户没有虚拟参加该比赛时返回 types.ErrVirtualContestNotFound
+func (m *Manager) VirtualResult(contestID, userID string) (*VirtualResult, error) {
+	if m.virtual == nil {
+		return nil, ErrVirtualNotEnabled
+	}
+	c, ok := m.GetContest(contestID)
+	if !ok {
+		return nil, ErrContestNotFound
+	}
+	vc, err := m.virtual.FindVirtualContest(contestID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	standings, err := m.VirtualStandings(contestID)
+	if err != nil {
+		return nil, err
+	}
+	res := &VirtualResult{VirtualContest: vc}
+	for _, st := range standings {
+		if st.UserID == userID {
+			res.Standing = st
+			break
+		}
+	}
+
+	actual, err := m.loadAttempts(c)
+	if err != nil {
+		return nil, err
+	}
+	res.RealRank = 1
+	for _, st := range c.buildStandings(actual, false) {
+		if st.Solved > res.Standing.Solved || (st.Solved == res.Standing.Solved && st.Penalty < res.Standing.Penalty) {
+			res.RealRank++
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,93 @@
+package file_transfer
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/system"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// DetectCgroupVersion 检测本机挂载的cgroup版本, 返回 1 或 2
+//
+// cgroup v2 的统一层级在根目录下有 cgroup.controllers 文件, v1 没有.
+func DetectCgroupVersion() (int, error) {
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err == nil {
+		return 2, nil
+	}
+	if _, err := os.Stat("/sys/fs/cgroup"); err != nil {
+		return 0, errors.Wrap(err, "cgroup filesystem not found")
+	}
+	return 1, nil
+}
+
+// hostInfo 获取Docker宿主机的信息, 结果在首次成功调用后缓存, 获取失败时返回nil
+func (ds *DockerService) hostInfo(ctx context.Context) *system.Info {
+	ds.infoMu.Lock()
+	defer ds.infoMu.Unlock()
+
+	if ds.info != nil {
+		return ds.info
+	}
+
+	info, err := ds.client.Info(ctx)
+	if err != nil {
+		log.Err(err).Msg("docker info error")
+		return nil
+	}
+	ds.info = &info
+	return ds.info
+}
+
+// cgroupVersion 返回Docker宿主机的cgroup版本
+//
+// daemon与评测服务不一定在同一台机器上, 因此优先使用daemon报告的版本,
+// 仅在旧版本daemon不报告时回退到检测本机.
+func (ds *DockerService) cgroupVersion(ctx context.Context) int {
+	if info := ds.hostInfo(ctx); info != nil {
+		if v, err := strconv.Atoi(info.CgroupVersion); err == nil {
+			return v
+		}
+	}
+	v, err := DetectCgroupVersion()
+	if err != nil {
+		log.Err(err).Msg("failed to detect cgroup version")
+		return 0
+	}
+	return v
+}
+
+// adaptResources 根据宿主机的cgroup版本和能力调整资源限制
+//
+// cgroup v1 下额外关闭swappiness, 该参数在 v2 中不存在, 设置后daemon会拒绝创建容器.
+// 宿主机无法执行的限制会被记录警告, 此时容器仍会创建, 但该项限制不生效.
+func (ds *DockerService) adaptResources(ctx context.Context, cfg *RunConfig, resources *container.Resources) {
+	if ds.cgroupVersion(ctx) == 1 && resources.Memory > 0 {
+		swappiness := int64(0)
+		resources.MemorySwappiness = &swappiness
+	}
+
+	info := ds.hostInfo(ctx)
+	if info == nil {
+		return
+	}
+
+	unsupported := func(limit string) {
+		log.Warn().Str("name", cfg.Name).Str("limit", limit).Str("cgroup_driver", info.CgroupDriver).Str("cgroup_version", info.CgroupVersion).Msg("resource limit is not supported on the docker host")
+	}
+	if resources.Memory > 0 && !info.MemoryLimit {
+		unsupported("memory")
+	}
+	if resources.MemorySwap > 0 && !info.SwapLimit {
+		unsupported("swap")
+	}
+	if (resources.NanoCPUs > 0 || resources.CPUQuota > 0) && !info.CPUCfsQuota {
+		unsupported("cpu")
+	}
+	if resources.PidsLimit != nil && !info.PidsLimit {
+		unsupported("pids")
+	}
+}
@@ -1,119 +1,729 @@
 package file_transfer
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/blkiodev"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/system"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/uuid"
+	"github.com/mrhaoxx/SOJ/metrics"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 容器标签
+const (
+	// LabelManaged 所有由SOJ创建的容器都带有该标签(值为 "true"), 用于重启后清理遗留容器
+	LabelManaged = "soj.managed"
+	// LabelSubmission 容器所属的提交ID
+	LabelSubmission = "soj.submission"
+	// LabelProblem 容器所属的题目ID
+	LabelProblem = "soj.problem"
+	// LabelUser 容器所属的用户
+	LabelUser = "soj.user"
+)
+
+// execTokenEnv 注入到每个exec进程中的环境变量名, 超时后据此找到并结束该exec创建的所有进程
+const execTokenEnv = "SOJ_EXEC_TOKEN"
+
+// execInspectInterval 等待exec结束时轮询的间隔
+const execInspectInterval = 10 * time.Millisecond
+
+// 容器主进程的特殊退出码
+const (
+	// ExitCodeTimeout timeout(1) 命令超时时的退出码
+	ExitCodeTimeout = 124
+	// ExitCodeKilled 进程被 SIGKILL 结束时的退出码(128+9)
+	ExitCodeKilled = 137
+)
+
+// DefaultStopGrace 清理容器时默认等待容器自行退出的秒数
+const DefaultStopGrace = 1
+
+var (
+	// ErrImageNotFound 镜像在本地不存在, 调用方可以在拉取镜像后重试
+	ErrImageNotFound = errors.New("image not found")
+	// ErrNameConflict 同名容器已存在(例如 AutoRemove 尚未完成), 调用方可以换一个名字重试
+	ErrNameConflict = errors.New("container name conflict")
+	// ErrTimeLimitExceeded 命令执行超时, 进程已被强制结束
+	ErrTimeLimitExceeded = errors.New("time limit exceeded")
+	// ErrImageInUse 镜像正被容器使用, 无法删除
+	ErrImageInUse = errors.New("image is in use")
+	// ErrMemoryLimitExceeded 容器因超出内存限制被内核结束
+	ErrMemoryLimitExceeded = errors.New("memory limit exceeded")
+	// ErrContainerKilled 容器主进程被 SIGKILL 结束, 但不是因为内存不足
+	ErrContainerKilled = errors.New("container killed")
+	// ErrContainerRunning 容器仍在运行, 没有退出码
+	ErrContainerRunning = errors.New("container is still running")
 )
 
 // DockerService Docker容器服务
 type DockerService struct {
 	client *client.Client
+
+	// info Docker宿主机信息的缓存, 见 hostInfo
+	infoMu sync.Mutex
+	info   *system.Info
 }
 
-// NewDockerService 创建新的Docker服务
+// NewDockerService 使用环境变量中的配置创建新的Docker服务
 func NewDockerService() (*DockerService, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	return NewDockerServiceWithHost("")
+}
+
+// NewDockerServiceWithHost 创建连接到 host 的Docker服务, host 为空时与 NewDockerService 相同
+func NewDockerServiceWithHost(host string) (*DockerService, error) {
+	opts := []client.Opt{client.FromEnv}
+	if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+	cli, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &DockerService{client: cli}, nil
+	return NewDockerServiceWithClient(cli), nil
+}
+
+// NewDockerServiceWithClient 使用已有的Docker客户端创建Docker服务
+//
+// client.Client 内部维护HTTP连接池且可以安全地并发使用,
+// 多个 DockerService 应共享同一个客户端, 而不是各自创建.
+func NewDockerServiceWithClient(cli *client.Client) *DockerService {
+	return &DockerService{client: cli}
+}
+
+// Ping 检查Docker守护进程是否可以访问
+func (ds *DockerService) Ping(ctx context.Context) error {
+	_, err := ds.client.Ping(ctx)
+	return err
+}
+
+// Info 获取Docker宿主机的当前信息, 如版本和运行中的容器数
+func (ds *DockerService) Info(ctx context.Context) (*system.Info, error) {
+	info, err := ds.client.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// RunConfig 容器运行配置
+type RunConfig struct {
+	Name     string        // 容器名
+	Image    string        // 镜像
+	User     string        // 运行用户, 如 "1000" 或 "1000:1000"
+	Hostname string        // 主机名
+	Workdir  string        // 工作目录
+	Env      []string      // 环境变量, 形如 KEY=VALUE
+	Mounts   []mount.Mount // 挂载
+	Cmd      []string      // 容器主进程的命令, 为空时使用镜像的默认命令
+
+	// TmpfsMounts 容器内路径到tmpfs挂载选项的映射, 如 "/tmp": "size=64m,mode=1777".
+	// tmpfs 中的文件存放在内存里, 设置了 MemoryLimit 时计入容器的内存用量;
+	// 请在选项中用 size 限制大小, 否则写满tmpfs即可耗尽内存配额.
+	TmpfsMounts map[string]string
+
+	// Labels 附加到容器上的标签, 用于在 docker ps 和监控工具中定位容器的来源.
+	// LabelManaged 总是会被设置.
+	Labels map[string]string
+
+	MaskPaths       bool // 屏蔽 /etc, /sys 及 /proc 下的敏感路径
+	ReadonlyRootfs  bool // 只读根文件系统
+	NetworkDisabled bool // 禁用网络
+	NetworkHost     bool // 使用宿主机网络
+	Timeout         int  // 停止容器时等待的秒数
+
+	// CPUQuota/CPUPeriod 以微秒为单位限制CPU时间.
+	//
+	// NanoCPUs 以 1e-9 个CPU为单位限制CPU, 例如 500_000_000 表示 0.5 个CPU.
+	// 它等价于 CPUPeriod=100000, CPUQuota=NanoCPUs/10000, 由daemon换算成 CFS 配额,
+	// 因此不能与 CPUQuota/CPUPeriod 同时设置.
+	CPUQuota  int64
+	CPUPeriod int64
+	NanoCPUs  int64
+
+	MemoryLimit int64 // 内存上限(字节), 同时禁用swap
+	PidsLimit   int64 // 进程数上限, 用于防止fork炸弹
+
+	// SeccompProfile seccomp配置的JSON内容, 为空时使用Docker的默认配置,
+	// 为 "unconfined" 时不启用. 可使用 DefaultSeccompProfile 或 LoadSeccompProfile 读取的文件.
+	SeccompProfile string
+
+	// AppArmorProfile 容器使用的AppArmor配置名, 为空时使用Docker的默认行为.
+	// 自定义配置需要先在宿主机上加载, 如 apparmor_parser -r -W /etc/apparmor.d/soj-judge,
+	// 然后在这里填写配置文件中 profile 声明的名字. 宿主机未启用AppArmor时忽略此项并记录警告.
+	AppArmorProfile string
+
+	// OomScoreAdj 调整内核在内存不足时选择结束进程的倾向, 取值范围 -1000 到 1000, 越大越先被结束.
+	// 评测容器运行的是不可信代码, 应设为正值, 使宿主机内存紧张时内核优先结束容器而不是评测服务本身.
+	OomScoreAdj int
+
+	// BlkioWeight 容器块设备I/O的相对权重, 取值范围 10 到 1000, 0 表示使用daemon的默认值.
+	// 只在磁盘繁忙时按权重分配带宽, 默认的 DefaultBlkioWeight 使各评测容器平分磁盘I/O.
+	BlkioWeight uint16
+	// DeviceWriteBps 按设备限制每秒写入的字节数, 如 {Path: "/dev/sda", Rate: 10 << 20},
+	// 防止大量写盘的提交拖慢同一宿主机上的其他容器.
+	DeviceWriteBps []blkiodev.ThrottleDevice
+}
+
+// DefaultOomScoreAdj 沙箱容器默认的 OomScoreAdj
+const DefaultOomScoreAdj = 500
+
+// DefaultBlkioWeight 沙箱容器默认的 BlkioWeight
+const DefaultBlkioWeight = 500
+
+// DefaultAppArmorProfile Docker自带的AppArmor配置名
+const DefaultAppArmorProfile = "docker-default"
+
+// DefaultRunConfig 返回适用于运行不可信代码的沙箱默认配置
+//
+// 调用方需要自行填写 Name 和 Image.
+func DefaultRunConfig() *RunConfig {
+	return &RunConfig{
+		Hostname:        "soj-sandbox",
+		Workdir:         "/work",
+		MaskPaths:       true,
+		ReadonlyRootfs:  true,
+		NetworkDisabled: true,
+		Timeout:         10,
+		NanoCPUs:        1_000_000_000,
+		MemoryLimit:     512 << 20,
+		PidsLimit:       256,
+		SeccompProfile:  DefaultSeccompProfile,
+		AppArmorProfile: DefaultAppArmorProfile,
+		OomScoreAdj:     DefaultOomScoreAdj,
+		BlkioWeight:     DefaultBlkioWeight,
+	}
 }
 
-// RunImage 运行Docker镜像
-func (ds *DockerService) RunImage(name string, user string, hostname string, image string, workdir string, mounts []mount.Mount, mask bool, ReadonlyRootfs bool, networkdisabled bool, timeout int, networkhosted bool, env []string) (ok bool, id string) {
+// RunImage 按配置运行Docker镜像, 数值类限制为 0 表示不限制
+//
+// 镜像不存在时返回的错误满足 errors.Is(err, ErrImageNotFound),
+// 容器名已被占用时满足 errors.Is(err, ErrNameConflict).
+func (ds *DockerService) RunImage(ctx context.Context, cfg *RunConfig) (id string, err error) {
+	ctx, span := tracer.Start(ctx, "docker.RunImage", trace.WithAttributes(
+		attribute.String("container_name", cfg.Name),
+		attribute.String("image", cfg.Image),
+	))
+	defer func() {
+		span.SetAttributes(attribute.String("container_id", id))
+		endSpan(span, err)
+	}()
 
 	var masked []string
-	if mask {
+	if cfg.MaskPaths {
 		masked = []string{"/etc", "/sys", "/proc/tty", "/proc/sys", "/proc/sysrq-trigger", "/proc/cmdline", "/proc/config.gz", "/proc/mounts", "/proc/fs", "/proc/device-tree", "/proc/bus"}
 	}
 
 	network := ""
-	if networkhosted {
+	if cfg.NetworkHost {
 		network = "host"
 	}
 
-	resp, err := ds.client.ContainerCreate(context.Background(), &container.Config{
-		Image:           image,
-		User:            user,
-		Hostname:        hostname,
-		WorkingDir:      workdir,
-		NetworkDisabled: networkdisabled,
-		Env:             env,
-		StopTimeout:     &timeout,
-	}, &container.HostConfig{
-		MaskedPaths:    masked,
-		Mounts:         mounts,
-		ReadonlyRootfs: ReadonlyRootfs,
-		AutoRemove:     true,
-		NetworkMode:    container.NetworkMode(network),
-
-		Resources: container.Resources{Ulimits: []*container.Ulimit{
+	resources := container.Resources{
+		CPUQuota:  cfg.CPUQuota,
+		CPUPeriod: cfg.CPUPeriod,
+		NanoCPUs:  cfg.NanoCPUs,
+		Memory:    cfg.MemoryLimit,
+		Ulimits: []*container.Ulimit{
 			{Name: "memlock", Soft: -1, Hard: -1},
-		}},
-	}, nil, nil, name)
+		},
+		BlkioWeight: cfg.BlkioWeight,
+	}
+	for i := range cfg.DeviceWriteBps {
+		resources.BlkioDeviceWriteBps = append(resources.BlkioDeviceWriteBps, &cfg.DeviceWriteBps[i])
+	}
+	if cfg.MemoryLimit > 0 {
+		// 与内存限制相同表示禁止使用swap
+		resources.MemorySwap = cfg.MemoryLimit
+	}
+	if cfg.PidsLimit > 0 {
+		pids := cfg.PidsLimit
+		resources.PidsLimit = &pids
+	}
+
+	ds.adaptResources(ctx, cfg, &resources)
+
+	var securityOpt []string
+	if cfg.SeccompProfile != "" {
+		securityOpt = append(securityOpt, "seccomp="+cfg.SeccompProfile)
+	}
+	if cfg.AppArmorProfile != "" {
+		if ds.hasAppArmor(ctx) {
+			securityOpt = append(securityOpt, "apparmor="+cfg.AppArmorProfile)
+		} else {
+			log.Warn().Str("name", cfg.Name).Str("profile", cfg.AppArmorProfile).Msg("apparmor is not available on the docker host, profile ignored")
+		}
+	}
+
+	labels := make(map[string]string, len(cfg.Labels)+1)
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	labels[LabelManaged] = "true"
+
+	timeout := cfg.Timeout
+
+	// 请求在daemon创建容器后才失败时, 重试会因容器名已被占用返回 ErrNameConflict, 此时接管已创建的容器
+	var resp container.CreateResponse
+	attempt := 0
+	err = withRetry(ctx, dockerRetryAttempts, func() (err error) {
+		attempt++
+		resp, err = ds.client.ContainerCreate(ctx, &container.Config{
+			Image:           cfg.Image,
+			User:            cfg.User,
+			Hostname:        cfg.Hostname,
+			WorkingDir:      cfg.Workdir,
+			NetworkDisabled: cfg.NetworkDisabled,
+			Env:             cfg.Env,
+			Cmd:             cfg.Cmd,
+			StopTimeout:     &timeout,
+			Labels:          labels,
+		}, &container.HostConfig{
+			MaskedPaths:    masked,
+			Mounts:         cfg.Mounts,
+			Tmpfs:          cfg.TmpfsMounts,
+			ReadonlyRootfs: cfg.ReadonlyRootfs,
+			AutoRemove:     true,
+			NetworkMode:    container.NetworkMode(network),
+			Resources:      resources,
+			SecurityOpt:    securityOpt,
+			OomScoreAdj:    cfg.OomScoreAdj,
+		}, nil, nil, cfg.Name)
+		if err != nil && attempt > 1 && cfg.Name != "" && cerrdefs.IsConflict(err) {
+			if id, ok := ds.createdContainer(ctx, cfg.Name); ok {
+				resp = container.CreateResponse{ID: id}
+				return nil
+			}
+		}
+		return err
+	})
 
 	if err != nil {
-		log.Err(err).Str("name", name).Str("image", image).Msg("container create error")
-		return false, ""
+		log.Err(err).Str("name", cfg.Name).Str("image", cfg.Image).Msg("container create error")
+		metrics.ContainerStartErrors.Inc()
+		// ctx 被取消时daemon可能已经创建了容器, 按名称删除以免遗留
+		if ctx.Err() != nil && cfg.Name != "" {
+			ds.removeCreated(ctx, cfg.Name)
+		}
+		if cerrdefs.IsNotFound(err) {
+			return "", errors.Wrap(ErrImageNotFound, err.Error())
+		}
+		if cerrdefs.IsConflict(err) {
+			return "", errors.Wrap(ErrNameConflict, err.Error())
+		}
+		return "", errors.Wrap(err, "failed to create container")
 	}
 
 	id = resp.ID
 
-	log.Debug().Str("name", name).Str("image", image).Str("id", id).Msg("container created")
+	log.Debug().Str("name", cfg.Name).Str("image", cfg.Image).Str("id", id).Msg("container created")
+
+	// 高负载时启动可能因端口占用等原因偶发失败, 重试几次以免误报系统错误
+	err = withRetry(ctx, dockerRetryAttempts, func() error {
+		return ds.client.ContainerStart(ctx, id, container.StartOptions{})
+	})
+
+	if err != nil {
+		log.Err(err).Str("name", cfg.Name).Str("image", cfg.Image).Str("id", id).Msg("container start error")
+		metrics.ContainerStartErrors.Inc()
+		ds.removeCreated(ctx, id)
+		return "", errors.Wrap(err, "failed to start container")
+	}
 
-	err = ds.client.ContainerStart(context.Background(), id, container.StartOptions{})
+	log.Debug().Str("name", cfg.Name).Str("image", cfg.Image).Str("id", id).Msg("container started")
+
+	return id, nil
+}
 
+// createdContainer 返回名为 name, 由SOJ创建且尚未启动的容器的ID
+//
+// 用于创建请求的响应丢失后重试时接管上一次请求已经创建的容器.
+func (ds *DockerService) createdContainer(ctx context.Context, name string) (string, bool) {
+	info, err := ds.client.ContainerInspect(ctx, name)
 	if err != nil {
-		log.Err(err).Str("name", name).Str("image", image).Str("id", id).Msg("container start error")
-		return false, ""
+		log.Err(err).Str("name", name).Msg("container inspect error")
+		return "", false
 	}
+	if info.Config == nil || info.Config.Labels[LabelManaged] != "true" || info.State == nil || info.State.Status != container.StateCreated {
+		return "", false
+	}
+	log.Warn().Str("name", name).Str("id", info.ID).Msg("adopting container created by a failed request")
+	return info.ID, true
+}
 
-	log.Debug().Str("name", name).Str("image", image).Str("id", id).Msg("container started")
+// removeCreated 删除已创建但未能启动的容器, 未启动的容器不会被 AutoRemove 删除
+//
+// 启动失败可能是因为 ctx 已被取消, 因此删除使用不随 ctx 取消的上下文. id 也可以是容器名.
+func (ds *DockerService) removeCreated(ctx context.Context, id string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
 
-	return true, id
+	err := ds.client.ContainerRemove(ctx, id, container.RemoveOptions{Force: true})
+	if err != nil && !cerrdefs.IsNotFound(err) {
+		log.Err(err).Str("id", id).Msg("container remove error")
+		return
+	}
+	log.Debug().Str("id", id).Msg("container removed")
+}
+
+// hasAppArmor 检查Docker宿主机是否启用了AppArmor
+func (ds *DockerService) hasAppArmor(ctx context.Context) bool {
+	info := ds.hostInfo(ctx)
+	if info == nil {
+		return false
+	}
+	for _, opt := range info.SecurityOptions {
+		if strings.HasPrefix(opt, "name=apparmor") {
+			return true
+		}
+	}
+	return false
+}
+
+// RunImageArgs 以位置参数运行Docker镜像
+//
+// Deprecated: 参数过多且容易传错顺序, 请使用 RunImage 和 RunConfig.
+func (ds *DockerService) RunImageArgs(name string, user string, hostname string, image string, workdir string, mounts []mount.Mount, mask bool, ReadonlyRootfs bool, networkdisabled bool, timeout int, networkhosted bool, env []string, cpuQuota int64, cpuPeriod int64, memoryLimitBytes int64, pidsLimit int64, nanoCPUs int64) (id string, err error) {
+	return ds.RunImage(context.Background(), &RunConfig{
+		Name:            name,
+		Image:           image,
+		User:            user,
+		Hostname:        hostname,
+		Workdir:         workdir,
+		Env:             env,
+		Mounts:          mounts,
+		MaskPaths:       mask,
+		ReadonlyRootfs:  ReadonlyRootfs,
+		NetworkDisabled: networkdisabled,
+		NetworkHost:     networkhosted,
+		Timeout:         timeout,
+		CPUQuota:        cpuQuota,
+		CPUPeriod:       cpuPeriod,
+		NanoCPUs:        nanoCPUs,
+		MemoryLimit:     memoryLimitBytes,
+		PidsLimit:       pidsLimit,
+	})
 }
 
 // CleanContainer 清理容器
-func (ds *DockerService) CleanContainer(id string) {
-	var timeout = 1
-	err := ds.client.ContainerStop(context.Background(), id, container.StopOptions{Timeout: &timeout})
+//
+// 容器先收到 SIGTERM, 超过 grace 秒仍未退出时被强制结束; 由于容器以 AutoRemove 启动, 停止后即被删除.
+// ctx 被取消时停止等待并直接返回, 以便在关闭时遵守退出期限.
+func (ds *DockerService) CleanContainer(ctx context.Context, id string, grace int) {
+	ctx, span := tracer.Start(ctx, "docker.CleanContainer", trace.WithAttributes(attribute.String("container_id", id)))
+	defer span.End()
+
+	err := withRetry(ctx, dockerRetryAttempts, func() error {
+		return ds.client.ContainerStop(ctx, id, container.StopOptions{Timeout: &grace})
+	})
 	if err != nil {
+		// 容器已自行退出并被自动删除是正常情况, 不作为错误记录
+		if cerrdefs.IsNotFound(err) {
+			log.Debug().Str("id", id).Msg("container already removed")
+			return
+		}
 		log.Err(err).Str("id", id).Msg("container remove error")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return
 	}
 	log.Debug().Str("id", id).Msg("container removed")
 }
 
+// RemoveContainer 强制删除容器, 运行中的容器直接被结束
+//
+// 与 CleanContainer 不同, 不依赖 AutoRemove, 可用于删除已停止或未以 AutoRemove 启动的容器.
+// 容器不存在时返回 nil.
+func (ds *DockerService) RemoveContainer(ctx context.Context, id string) error {
+	err := withRetry(ctx, dockerRetryAttempts, func() error {
+		return ds.client.ContainerRemove(ctx, id, container.RemoveOptions{Force: true})
+	})
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			log.Debug().Str("id", id).Msg("container already removed")
+			return nil
+		}
+		log.Err(err).Str("id", id).Msg("container remove error")
+		return errors.Wrap(err, "failed to remove container")
+	}
+	log.Debug().Str("id", id).Msg("container removed")
+	return nil
+}
+
+// WaitContainer 阻塞直到容器退出, 返回容器主进程的退出码
+//
+// ctx 被取消时立即返回, 调用方可借此在更上层实现墙钟时间限制.
+func (ds *DockerService) WaitContainer(ctx context.Context, id string) (int, error) {
+	statusCh, errCh := ds.client.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+
+	select {
+	case status := <-statusCh:
+		if status.Error != nil {
+			log.Error().Str("id", id).Str("err", status.Error.Message).Msg("container wait error")
+			return int(status.StatusCode), errors.New(status.Error.Message)
+		}
+		log.Debug().Str("id", id).Int64("exitcode", status.StatusCode).Msg("container exited")
+		return int(status.StatusCode), nil
+	case err := <-errCh:
+		log.Err(err).Str("id", id).Msg("container wait error")
+		return -1, err
+	}
+}
+
+// ContainerStats 获取容器的CPU使用率(百分比, 按全部CPU累计)和内存峰值(字节)
+//
+// 应在容器退出前(或清理前)调用一次. 内存峰值取自 memory_stats.max_usage,
+// 在不提供该值的 cgroup v2 主机上退化为当前用量.
+func (ds *DockerService) ContainerStats(ctx context.Context, id string) (cpuPercent float64, memoryBytes uint64, err error) {
+	resp, err := ds.client.ContainerStats(ctx, id, false)
+	if err != nil {
+		log.Err(err).Str("id", id).Msg("container stats error")
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	var stats container.StatsResponse
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	if err != nil {
+		log.Err(err).Str("id", id).Msg("container stats decode error")
+		return 0, 0, err
+	}
+
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpuPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+
+	memoryBytes = stats.MemoryStats.MaxUsage
+	if memoryBytes == 0 {
+		memoryBytes = stats.MemoryStats.Usage
+	}
+
+	log.Debug().Str("id", id).Float64("cpu_percent", cpuPercent).Uint64("memory", memoryBytes).Msg("got container stats")
+
+	return cpuPercent, memoryBytes, nil
+}
+
+// ListContainersByLabel 列出带有指定标签的容器的ID, 包括已停止和暂停的容器
+func (ds *DockerService) ListContainersByLabel(ctx context.Context, label, value string) ([]string, error) {
+	containers, err := ds.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label+"="+value)),
+	})
+	if err != nil {
+		log.Err(err).Str("label", label).Str("value", value).Msg("container list error")
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(containers))
+	for _, c := range containers {
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
+// PauseContainer 冻结容器内的所有进程
+//
+// 被冻结的进程不会被调度, 不消耗CPU时间, 直到 UnpauseContainer 恢复.
+// 可用于交互题中在checker校验输出时暂停选手程序.
+func (ds *DockerService) PauseContainer(ctx context.Context, id string) error {
+	err := ds.client.ContainerPause(ctx, id)
+	if err != nil {
+		log.Err(err).Str("id", id).Msg("container pause error")
+		return errors.Wrap(err, "failed to pause container")
+	}
+	log.Debug().Str("id", id).Msg("container paused")
+	return nil
+}
+
+// UnpauseContainer 恢复被 PauseContainer 冻结的容器
+func (ds *DockerService) UnpauseContainer(ctx context.Context, id string) error {
+	err := ds.client.ContainerUnpause(ctx, id)
+	if err != nil {
+		log.Err(err).Str("id", id).Msg("container unpause error")
+		return errors.Wrap(err, "failed to unpause container")
+	}
+	log.Debug().Str("id", id).Msg("container unpaused")
+	return nil
+}
+
+// ContainerExists 检查容器是否仍然存在
+//
+// 容器不存在时返回 false 和 nil, 只有请求本身失败时才返回错误.
+func (ds *DockerService) ContainerExists(ctx context.Context, id string) (bool, error) {
+	_, err := ds.client.ContainerInspect(ctx, id)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return false, nil
+		}
+		log.Err(err).Str("id", id).Msg("container inspect error")
+		return false, errors.Wrap(err, "failed to inspect container")
+	}
+	return true, nil
+}
+
+// ContainerInfo 容器状态信息, 是 docker inspect 结果中评测需要关心的部分
+type ContainerInfo struct {
+	ID         string
+	Status     string // created, running, paused, restarting, removing, exited 或 dead
+	Running    bool
+	ExitCode   int
+	OOMKilled  bool      // 是否因超出内存限制被结束
+	StartedAt  time.Time // 未启动时为零值
+	FinishedAt time.Time // 未退出时为零值
+}
+
+// InspectContainer 获取容器的状态信息
+func (ds *DockerService) InspectContainer(ctx context.Context, id string) (*ContainerInfo, error) {
+	info, err := ds.client.ContainerInspect(ctx, id)
+	if err != nil {
+		log.Err(err).Str("id", id).Msg("container inspect error")
+		return nil, errors.Wrap(err, "failed to inspect container")
+	}
+
+	ci := &ContainerInfo{ID: info.ID}
+	if info.State != nil {
+		ci.Status = string(info.State.Status)
+		ci.Running = info.State.Running
+		ci.ExitCode = info.State.ExitCode
+		ci.OOMKilled = info.State.OOMKilled
+		// docker 以 RFC3339Nano 格式返回时间, 未设置时为 "0001-01-01T00:00:00Z"
+		ci.StartedAt, _ = time.Parse(time.RFC3339Nano, info.State.StartedAt)
+		ci.FinishedAt, _ = time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+	}
+	return ci, nil
+}
+
+// GetContainerExitCode 获取已退出容器主进程的退出码
+//
+// 除返回原始退出码外, 以下情况返回对应的错误, 以便评测据此给出 MLE/TLE/RE:
+// 因超出内存限制被结束时为 ErrMemoryLimitExceeded, 退出码为 ExitCodeTimeout 时为 ErrTimeLimitExceeded,
+// 被其他原因 SIGKILL 时为 ErrContainerKilled, 容器尚未退出时为 ErrContainerRunning.
+func (ds *DockerService) GetContainerExitCode(ctx context.Context, id string) (int, error) {
+	info, err := ds.InspectContainer(ctx, id)
+	if err != nil {
+		return -1, err
+	}
+
+	if info.Running {
+		return -1, ErrContainerRunning
+	}
+
+	// OOM 时退出码同样为 137, 需要先检查 OOMKilled 才能与其他 SIGKILL 区分
+	switch {
+	case info.OOMKilled:
+		return info.ExitCode, ErrMemoryLimitExceeded
+	case info.ExitCode == ExitCodeTimeout:
+		return info.ExitCode, ErrTimeLimitExceeded
+	case info.ExitCode == ExitCodeKilled:
+		return info.ExitCode, ErrContainerKilled
+	}
+
+	return info.ExitCode, nil
+}
+
 // GetContainerIP 获取容器IP
-func (ds *DockerService) GetContainerIP(id string) string {
-	info, err := ds.client.ContainerInspect(context.Background(), id)
+//
+// 优先返回默认bridge网络上的地址, 容器只接入了自定义网络时返回按网络名排序后第一个非空地址.
+// 使用宿主机网络的容器没有独立的IP, 返回空字符串.
+func (ds *DockerService) GetContainerIP(ctx context.Context, id string) string {
+	info, err := ds.client.ContainerInspect(ctx, id)
 	if err != nil {
 		log.Err(err).Str("id", id).Msg("failed to get ip: container inspect error")
 		return ""
 	}
 
-	return info.NetworkSettings.IPAddress
+	if info.NetworkSettings == nil {
+		return ""
+	}
+
+	if info.NetworkSettings.IPAddress != "" {
+		return info.NetworkSettings.IPAddress
+	}
+
+	names := make([]string, 0, len(info.NetworkSettings.Networks))
+	for name := range info.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ep := info.NetworkSettings.Networks[name]; ep != nil && ep.IPAddress != "" {
+			return ep.IPAddress
+		}
+	}
+
+	return ""
 }
 
 // ExecContainer 在容器中执行命令
-func (ds *DockerService) ExecContainer(id string, cmd string, timeout int, stdout, stderr io.Writer, env []string, privileged bool) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+//
+// stdin 不为nil时作为进程的标准输入, 读完后关闭输入以向进程发送EOF.
+// workdir 指定本次执行的工作目录, 为空时使用容器创建时的工作目录.
+// user 指定执行命令的用户, 如 "nobody" 或 "65534:65534", 为空时使用容器创建时的用户;
+// 以用户名指定时该用户必须存在于容器内的 /etc/passwd 中.
+//
+// 超过 timeout 秒后, 该exec创建的所有进程都会被 SIGKILL 结束, 并返回 ErrTimeLimitExceeded.
+// 仅取消请求并不能让daemon结束exec进程, 因此这里通过另一个exec在容器内结束它们,
+// 这要求镜像中带有 sh, grep 和 kill.
+// ctx 被取消时同样会结束exec进程, 此时返回 ctx.Err() 而不是 ErrTimeLimitExceeded.
+func (ds *DockerService) ExecContainer(ctx context.Context, id string, cmd string, timeout int, stdin io.Reader, stdout, stderr io.Writer, env []string, privileged bool, workdir string, user string) (exitCode int, logs string, err error) {
+	ctx, span := tracer.Start(ctx, "docker.ExecContainer", trace.WithAttributes(
+		attribute.String("container_id", id),
+		attribute.Int("timeout", timeout),
+	))
+	begin := time.Now()
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("exit_code", exitCode),
+			attribute.Int64("duration_ms", time.Since(begin).Milliseconds()),
+		)
+		endSpan(span, err)
+	}()
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	resp, err := ds.client.ContainerExecCreate(ctx, id, container.ExecOptions{
-		AttachStdout: true,
-		AttachStderr: true,
-		Cmd:          []string{"sh", "-c", cmd},
-		Env:          env,
-		Privileged:   privileged,
+	token := uuid.NewString()
+	env = append(env[:len(env):len(env)], execTokenEnv+"="+token)
+
+	var resp container.ExecCreateResponse
+	err = withRetry(ctx, dockerRetryAttempts, func() (err error) {
+		resp, err = ds.client.ContainerExecCreate(ctx, id, container.ExecOptions{
+			AttachStdin:  stdin != nil,
+			AttachStdout: true,
+			AttachStderr: true,
+			Cmd:          []string{"sh", "-c", cmd},
+			Env:          env,
+			Privileged:   privileged,
+			WorkingDir:   workdir,
+			User:         user,
+		})
+		return err
 	})
 
 	if err != nil {
@@ -122,6 +732,18 @@ func (ds *DockerService) ExecContainer(id string, cmd string, timeout int, stdou
 	}
 
 	log.Debug().Str("id", id).Str("exec_id", resp.ID).Msg("container exec created")
+	span.SetAttributes(attribute.String("exec_id", resp.ID))
+
+	// expired 返回exec被结束的原因: 调用方取消时为 ctx.Err(), 否则为超时
+	expired := func() error {
+		if err := parent.Err(); err != nil {
+			log.Info().Str("id", id).Str("exec_id", resp.ID).Err(err).Msg("container exec canceled")
+			return err
+		}
+		log.Info().Str("id", id).Str("exec_id", resp.ID).Int("timeout", timeout).Msg("container exec time limit exceeded")
+		metrics.ExecTimeouts.Inc()
+		return ErrTimeLimitExceeded
+	}
 
 	outresp, err := ds.client.ContainerExecAttach(ctx, resp.ID, container.ExecStartOptions{})
 	if err != nil {
@@ -131,46 +753,251 @@ func (ds *DockerService) ExecContainer(id string, cmd string, timeout int, stdou
 	defer outresp.Close()
 
 	log.Debug().Str("id", id).Str("exec_id", resp.ID).Msg("container exec started")
+	started := time.Now()
+
+	// 超时后结束exec进程并关闭连接, 使下面的输出读取立即返回
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			ds.killExec(id, token)
+			outresp.Close()
+		}
+	}()
+
+	if stdin != nil {
+		go func() {
+			_, err := io.Copy(outresp.Conn, stdin)
+			if err != nil {
+				log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec stdin copy error")
+			}
+			outresp.CloseWrite()
+		}()
+	}
+
+	if stdout == nil || stderr == nil {
+		stdout, stderr = io.Discard, io.Discard
+	}
+	stdoutCounter := &countingWriter{w: stdout}
+	stderrCounter := &countingWriter{w: stderr}
 
 	buf := bytes.NewBuffer(nil)
-	if stdout != nil && stderr != nil {
-		_, err := stdcopy.StdCopy(stdout, stderr, io.TeeReader(outresp.Reader, buf))
+	_, err = stdcopy.StdCopy(stdoutCounter, stderrCounter, io.TeeReader(outresp.Reader, buf))
+	if err != nil {
+		log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec copy error")
+	}
+
+	if ctx.Err() != nil {
+		return -1, buf.String(), expired()
+	}
+
+	// 输出流读完时daemon可能尚未把exec标记为结束, 此时的退出码不可信, 需轮询到 Running 为 false
+	var inspectResp container.ExecInspect
+	for {
+		inspectResp, err = ds.client.ContainerExecInspect(ctx, resp.ID)
+		if err != nil {
+			log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec inspect error")
+			return -1, "", err
+		}
+		if !inspectResp.Running {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return -1, buf.String(), expired()
+		case <-time.After(execInspectInterval):
+		}
+	}
+
+	log.Info().Str("id", id).Str("exec_id", resp.ID).
+		Int("exit_code", inspectResp.ExitCode).
+		Int64("duration_ms", time.Since(started).Milliseconds()).
+		Int64("stdout_bytes", stdoutCounter.n).
+		Int64("stderr_bytes", stderrCounter.n).
+		Msg("container exec finished")
+
+	return inspectResp.ExitCode, buf.String(), err
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ExecContainerStream 在容器中执行命令, 并在标准输出的每一行到达时将其发送到返回的通道
+//
+// 标准错误会被丢弃. 命令结束后两个通道都会被关闭; 若执行失败, 退出码非0
+// 或 ctx 被取消(此时exec进程会被结束), 错误通道中会先收到一个错误.
+func (ds *DockerService) ExecContainerStream(ctx context.Context, id string, cmd string, env []string, workdir string) (<-chan string, <-chan error) {
+	lines := make(chan string)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(lines)
+
+		token := uuid.NewString()
+		env = append(env[:len(env):len(env)], execTokenEnv+"="+token)
+
+		var resp container.ExecCreateResponse
+		err := withRetry(ctx, dockerRetryAttempts, func() (err error) {
+			resp, err = ds.client.ContainerExecCreate(ctx, id, container.ExecOptions{
+				AttachStdout: true,
+				AttachStderr: true,
+				Cmd:          []string{"sh", "-c", cmd},
+				Env:          env,
+				WorkingDir:   workdir,
+			})
+			return err
+		})
 		if err != nil {
-			log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec copy error")
+			log.Err(err).Str("id", id).Msg("container exec create error")
+			errc <- err
+			return
 		}
-	} else {
-		_, err = io.Copy(buf, outresp.Reader)
+
+		outresp, err := ds.client.ContainerExecAttach(ctx, resp.ID, container.ExecStartOptions{})
 		if err != nil {
-			log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec copy error")
+			log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec attach error")
+			errc <- err
+			return
+		}
+		defer outresp.Close()
+
+		log.Debug().Str("id", id).Str("exec_id", resp.ID).Msg("container exec stream started")
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-done:
+			case <-ctx.Done():
+				ds.killExec(id, token)
+				outresp.Close()
+			}
+		}()
+
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		go func() {
+			_, err := stdcopy.StdCopy(pw, io.Discard, outresp.Reader)
+			pw.CloseWithError(err)
+		}()
+
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
 		}
+		if ctx.Err() != nil {
+			errc <- ctx.Err()
+			return
+		}
+		if err := scanner.Err(); err != nil {
+			log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec stream read error")
+			errc <- err
+			return
+		}
+
+		for {
+			inspectResp, err := ds.client.ContainerExecInspect(ctx, resp.ID)
+			if err != nil {
+				log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec inspect error")
+				errc <- err
+				return
+			}
+			if !inspectResp.Running {
+				if inspectResp.ExitCode != 0 {
+					errc <- errors.Errorf("command exited with code %d", inspectResp.ExitCode)
+				}
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			case <-time.After(execInspectInterval):
+			}
+		}
+	}()
+
+	return lines, errc
+}
+
+// killExec 以root身份结束容器内环境变量中带有 token 的所有进程
+//
+// 调用时exec的上下文通常已被取消, 因此使用独立的带超时的上下文.
+func (ds *DockerService) killExec(id string, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	script := `for p in /proc/[0-9]*; do if grep -qsa "` + execTokenEnv + `=` + token + `" "$p/environ"; then kill -9 "${p#/proc/}"; fi; done`
+
+	var resp container.ExecCreateResponse
+	err := withRetry(ctx, dockerRetryAttempts, func() (err error) {
+		resp, err = ds.client.ContainerExecCreate(ctx, id, container.ExecOptions{
+			User: "0",
+			Cmd:  []string{"sh", "-c", script},
+		})
+		return err
+	})
+	if err != nil {
+		log.Err(err).Str("id", id).Msg("container exec kill create error")
+		return
 	}
 
-	inspectResp, err := ds.client.ContainerExecInspect(ctx, resp.ID)
+	err = ds.client.ContainerExecStart(ctx, resp.ID, container.ExecStartOptions{Detach: true})
 	if err != nil {
-		log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec inspect error")
-		return -1, "", err
+		log.Err(err).Str("id", id).Str("exec_id", resp.ID).Msg("container exec kill start error")
+		return
 	}
 
-	return inspectResp.ExitCode, buf.String(), err
+	log.Debug().Str("id", id).Str("exec_id", resp.ID).Msg("container exec killed")
 }
 
-// GetContainerLogs 获取容器日志
-func (ds *DockerService) GetContainerLogs(id string) (string, error) {
-	resp, err := ds.client.ContainerLogs(context.Background(), id, container.LogsOptions{
+// GetContainerLogs 获取容器日志, 分别将标准输出和标准错误写入 stdout 和 stderr
+func (ds *DockerService) GetContainerLogs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	resp, err := ds.client.ContainerLogs(ctx, id, container.LogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
 	})
 	if err != nil {
 		log.Err(err).Str("id", id).Msg("container logs error")
-		return "", err
+		return err
 	}
+	defer resp.Close()
 
-	res, err := io.ReadAll(resp)
-
+	_, err = stdcopy.StdCopy(stdout, stderr, resp)
 	if err != nil {
 		log.Err(err).Str("id", id).Msg("container logs read error")
-		return "", err
+		return err
 	}
 
-	return string(res), nil
+	return nil
+}
+
+// GetContainerLogsString 以字符串形式获取容器的标准输出和标准错误
+func (ds *DockerService) GetContainerLogsString(ctx context.Context, id string) (stdout, stderr string, err error) {
+	var outbuf, errbuf bytes.Buffer
+	err = ds.GetContainerLogs(ctx, id, &outbuf, &errbuf)
+	if err != nil {
+		return "", "", err
+	}
+	return outbuf.String(), errbuf.String(), nil
 }
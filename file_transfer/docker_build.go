@@ -0,0 +1,106 @@
+package file_transfer
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// buildDockerfileName 构建上下文中 Dockerfile 的文件名
+const buildDockerfileName = "Dockerfile"
+
+// dockerfileContext 创建只包含 Dockerfile 的内存构建上下文(tar)
+func dockerfileContext(dockerfile []byte) (io.Reader, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{
+		Name:    buildDockerfileName,
+		Mode:    0644,
+		Size:    int64(len(dockerfile)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = tw.Write(dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	err = tw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// BuildJudgeImage 用 Dockerfile 构建评测镜像并打上标签 tag, 构建日志写入 out (为nil时丢弃)
+//
+// 构建上下文只包含 Dockerfile, 其中不能 COPY 或 ADD 本地文件. 用于在不登录宿主机的情况下
+// 更新语言环境(添加库, 升级编译器等).
+//
+// secrets 为构建密钥ID到内容的映射, 如私有 npm/pip/Maven 仓库的凭据. 非空时使用 BuildKit 构建,
+// Dockerfile 中以 RUN --mount=type=secret,id=<ID> 在 /run/secrets/<ID> 读取, 密钥只在该步骤执行时可见,
+// 不会写入镜像层或构建缓存. 不要用 ARG 或 ENV 传递凭据, 它们会保留在镜像历史中.
+func (ds *DockerService) BuildJudgeImage(ctx context.Context, dockerfile []byte, tag string, secrets map[string]string, out io.Writer) error {
+	if out == nil {
+		out = io.Discard
+	}
+	if len(dockerfile) == 0 {
+		return errors.New("dockerfile is empty")
+	}
+
+	buildCtx, err := dockerfileContext(dockerfile)
+	if err != nil {
+		return errors.Wrap(err, "failed to create build context")
+	}
+
+	return ds.buildImage(ctx, buildCtx, tag, secrets, out)
+}
+
+// buildImage 用构建上下文 buildCtx(tar) 根目录下的 Dockerfile 构建镜像, 构建日志写入 out
+//
+// secrets 非空时使用 BuildKit 构建, 并通过会话向构建提供密钥.
+func (ds *DockerService) buildImage(ctx context.Context, buildCtx io.Reader, tag string, secrets map[string]string, out io.Writer) error {
+	log.Info().Str("image", tag).Msg("building image")
+
+	opts := build.ImageBuildOptions{
+		Tags:        []string{tag},
+		Dockerfile:  buildDockerfileName,
+		Remove:      true,
+		ForceRemove: true,
+		PullParent:  true,
+	}
+	if len(secrets) > 0 {
+		sess, err := ds.secretSession(ctx, secrets)
+		if err != nil {
+			return err
+		}
+		defer sess.Close()
+		opts.Version = build.BuilderBuildKit
+		opts.SessionID = sess.ID()
+	}
+
+	resp, err := ds.client.ImageBuild(ctx, buildCtx, opts)
+	if err != nil {
+		log.Err(err).Str("image", tag).Msg("image build error")
+		return errors.Wrap(err, "failed to build image")
+	}
+	defer resp.Body.Close()
+
+	// 构建失败的信息只会出现在返回的消息流中, 必须完整读取
+	err = jsonmessage.DisplayJSONMessagesStream(resp.Body, out, 0, false, buildkitLogs(out))
+	if err != nil {
+		log.Err(err).Str("image", tag).Msg("image build stream error")
+		return errors.Wrap(err, "failed to build image")
+	}
+
+	log.Info().Str("image", tag).Msg("image built")
+	return nil
+}
@@ -0,0 +1,162 @@
+package file_transfer
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrDockerfileMissing 仓库根目录下没有 Dockerfile
+var ErrDockerfileMissing = errors.New("dockerfile not found in repository root")
+
+// githubHost 允许构建的仓库所在的主机
+const githubHost = "github.com"
+
+// checkGitHubURL 检查仓库地址是否为 https://github.com/ 下的仓库
+func checkGitHubURL(repoURL string) error {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return errors.Wrap(err, "invalid repository url")
+	}
+	if u.Scheme != "https" || u.Host != githubHost || u.User != nil || strings.Trim(u.Path, "/") == "" {
+		return errors.New("repository url must be https://" + githubHost + "/{owner}/{repo}")
+	}
+	return nil
+}
+
+// shallowClone 将仓库的 ref(分支名, 标签名或完整的引用名)浅克隆到 dir
+//
+// 不带 refs/ 前缀的 ref 先作为分支查找, 找不到时再作为标签查找. ref 为空时克隆默认分支.
+func shallowClone(ctx context.Context, dir, repoURL, ref string) error {
+	clone := func(name plumbing.ReferenceName) error {
+		_, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+			URL:           repoURL,
+			ReferenceName: name,
+			SingleBranch:  true,
+			Depth:         1,
+			Tags:          git.NoTags,
+		})
+		return err
+	}
+
+	if ref == "" || strings.HasPrefix(ref, "refs/") {
+		return clone(plumbing.ReferenceName(ref))
+	}
+	err := clone(plumbing.NewBranchReferenceName(ref))
+	if !errors.Is(err, plumbing.ErrReferenceNotFound) && !isNoMatchingRef(err) {
+		return err
+	}
+	// 失败的克隆可能留下了部分文件
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	return clone(plumbing.NewTagReferenceName(ref))
+}
+
+// isNoMatchingRef 判断克隆是否因为远程仓库中没有该引用而失败
+func isNoMatchingRef(err error) bool {
+	var noMatch git.NoMatchingRefSpecError
+	return errors.As(err, &noMatch)
+}
+
+// dirContext 将目录打包为构建上下文(tar), 跳过 .git 目录, 边打包边读取
+func dirContext(dir string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil || rel == "." {
+				return err
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			link := ""
+			if info.Mode()&fs.ModeSymlink != 0 {
+				link, err = os.Readlink(path)
+				if err != nil {
+					return err
+				}
+			}
+			hdr, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(rel)
+			err = tw.WriteHeader(hdr)
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// BuildImageFromGitHub 浅克隆 GitHub 仓库的 ref, 以仓库根目录为构建上下文构建镜像并打上标签 tag
+//
+// 使用 go-git 克隆, 宿主机上不需要安装 git. 仓库根目录下必须有 Dockerfile, 否则返回 ErrDockerfileMissing.
+// 克隆使用的临时目录在返回前删除. 构建日志写入 out (为nil时丢弃).
+func (ds *DockerService) BuildImageFromGitHub(ctx context.Context, repoURL, ref, tag string, out io.Writer) error {
+	if out == nil {
+		out = io.Discard
+	}
+	err := checkGitHubURL(repoURL)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "soj-build-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary directory")
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "repo")
+
+	log.Info().Str("repo", repoURL).Str("ref", ref).Msg("cloning repository")
+	err = shallowClone(ctx, dir, repoURL, ref)
+	if err != nil {
+		log.Err(err).Str("repo", repoURL).Str("ref", ref).Msg("repository clone error")
+		return errors.Wrap(err, "failed to clone repository")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, buildDockerfileName))
+	if err != nil || !info.Mode().IsRegular() {
+		return ErrDockerfileMissing
+	}
+
+	buildCtx := dirContext(dir)
+	defer buildCtx.Close()
+	return ds.buildImage(ctx, buildCtx, tag, nil, out)
+}
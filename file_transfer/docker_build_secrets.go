@@ -0,0 +1,70 @@
+package file_transfer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// buildkitTraceID BuildKit 构建进度在消息流中的 aux 消息ID
+const buildkitTraceID = "moby.buildkit.trace"
+
+// secretSession 创建向 BuildKit 提供构建密钥的会话, 并在后台通过daemon的 /session 接口运行
+//
+// 调用方需要在构建结束后关闭会话.
+func (ds *DockerService) secretSession(ctx context.Context, secrets map[string]string) (*session.Session, error) {
+	sess, err := session.NewSession(ctx, "soj-build")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create build session")
+	}
+
+	values := make(map[string][]byte, len(secrets))
+	for id, v := range secrets {
+		values[id] = []byte(v)
+	}
+	sess.Allow(secretsprovider.FromMap(values))
+
+	dialer := func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+		return ds.client.DialHijack(ctx, "/session", proto, meta)
+	}
+	go func() {
+		err := sess.Run(ctx, dialer)
+		if err != nil {
+			log.Err(err).Str("session", sess.ID()).Msg("build session error")
+		}
+	}()
+	return sess, nil
+}
+
+// buildkitLogs 返回处理 BuildKit 进度消息的回调, 将各构建步骤的输出写入 out
+//
+// BuildKit 构建时RUN等步骤的输出不在普通的消息流中, 而是编码在 aux 消息里.
+func buildkitLogs(out io.Writer) func(jsonmessage.JSONMessage) {
+	return func(msg jsonmessage.JSONMessage) {
+		if msg.ID != buildkitTraceID || msg.Aux == nil {
+			return
+		}
+		var dt []byte
+		err := json.Unmarshal(*msg.Aux, &dt)
+		if err != nil {
+			return
+		}
+		var status controlapi.StatusResponse
+		err = proto.Unmarshal(dt, &status)
+		if err != nil {
+			return
+		}
+		for _, l := range status.Logs {
+			out.Write(l.Msg)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package file_transfer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+func TestListContainersByLabelIncludesStopped(t *testing.T) {
+	ds := newFakeDockerService(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/containers/json") {
+			http.NotFound(w, r)
+			return
+		}
+		if all := r.URL.Query().Get("all"); all != "1" {
+			t.Errorf("all = %q, want 1", all)
+		}
+		args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+		if err != nil {
+			t.Errorf("invalid filters: %v", err)
+		}
+		if !args.ExactMatch("label", LabelManaged+"=true") {
+			t.Errorf("label filters = %v, want %s=true", args.Get("label"), LabelManaged)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]container.Summary{
+			{ID: "running", State: container.StateRunning},
+			{ID: "exited", State: container.StateExited},
+		})
+	})
+
+	ids, err := ds.ListContainersByLabel(t.Context(), LabelManaged, "true")
+	if err != nil {
+		t.Fatalf("ListContainersByLabel error: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "running" || ids[1] != "exited" {
+		t.Errorf("ListContainersByLabel = %v, want [running exited]", ids)
+	}
+}
+
+func TestRemoveContainerForces(t *testing.T) {
+	var removed []string
+	ds := newFakeDockerService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || !strings.Contains(r.URL.Path, "/containers/") {
+			http.NotFound(w, r)
+			return
+		}
+		if force := r.URL.Query().Get("force"); force != "1" {
+			t.Errorf("force = %q, want 1", force)
+		}
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if id == "gone" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container: gone"}`))
+			return
+		}
+		removed = append(removed, id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	err := ds.RemoveContainer(t.Context(), "orphan")
+	if err != nil {
+		t.Fatalf("RemoveContainer(orphan) error: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "orphan" {
+		t.Errorf("removed = %v, want [orphan]", removed)
+	}
+
+	err = ds.RemoveContainer(t.Context(), "gone")
+	if err != nil {
+		t.Errorf("RemoveContainer(gone) error: %v, want nil for a missing container", err)
+	}
+}
+
+func TestRunImageAdoptsContainerCreatedByLostRequest(t *testing.T) {
+	var creates, starts int
+	ds := newFakeDockerService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/create"):
+			creates++
+			// 第一次请求在daemon创建容器后失败, 重试时名称已被占用
+			if creates == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"message":"connection reset"}`))
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message":"Conflict. The container name \"/soj-test\" is already in use"}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/soj-test/json"):
+			json.NewEncoder(w).Encode(container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					ID:    "created-id",
+					State: &container.State{Status: container.StateCreated},
+				},
+				Config: &container.Config{Labels: map[string]string{LabelManaged: "true"}},
+			})
+		case strings.HasSuffix(r.URL.Path, "/containers/created-id/start"):
+			starts++
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	id, err := ds.RunImage(t.Context(), &RunConfig{Name: "soj-test", Image: "busybox"})
+	if err != nil {
+		t.Fatalf("RunImage error: %v", err)
+	}
+	if id != "created-id" || creates != 2 || starts != 1 {
+		t.Errorf("RunImage = %q after %d creates and %d starts, want created-id after 2 creates and 1 start", id, creates, starts)
+	}
+}
+
+func TestRunImageRemovesContainerWhenCancelledDuringCreate(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	removed := make(chan string, 1)
+	ds := newFakeDockerService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(r.URL.Path, "/containers/create"):
+			// daemon创建了容器, 但调用方在响应返回前取消了请求
+			cancel()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"message":"connection reset"}`))
+		case r.Method == http.MethodDelete:
+			if force := r.URL.Query().Get("force"); force != "1" {
+				t.Errorf("force = %q, want 1", force)
+			}
+			removed <- r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	_, err := ds.RunImage(ctx, &RunConfig{Name: "soj-cancelled", Image: "busybox"})
+	if err == nil {
+		t.Fatal("RunImage returned no error for a cancelled context")
+	}
+	select {
+	case name := <-removed:
+		if name != "soj-cancelled" {
+			t.Errorf("removed %q, want soj-cancelled", name)
+		}
+	default:
+		t.Error("container was not removed after the create request was cancelled")
+	}
+}
@@ -0,0 +1,159 @@
+package file_transfer
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// CopyFileToContainer 将内容写入容器内的 dstPath
+//
+// dstPath 为完整的目标文件路径, 其所在目录必须已存在. 文件以 0755 权限写入, 以便直接执行.
+func (ds *DockerService) CopyFileToContainer(ctx context.Context, id, dstPath string, content []byte) error {
+	// docker API 接受的是目标目录和一个tar包, 包内的文件名即为目标文件名
+	dir, name := path.Split(path.Clean(dstPath))
+	if name == "" || name == "/" {
+		return errors.New("invalid destination path " + dstPath)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0755,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	})
+	if err == nil {
+		_, err = tw.Write(content)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to build tar archive")
+	}
+
+	err = ds.client.CopyToContainer(ctx, id, dir, &buf, container.CopyToContainerOptions{})
+	if err != nil {
+		log.Err(err).Str("id", id).Str("path", dstPath).Msg("container copy to error")
+		return errors.Wrap(err, "failed to copy file to container")
+	}
+
+	log.Debug().Str("id", id).Str("path", dstPath).Int("size", len(content)).Msg("copied file to container")
+	return nil
+}
+
+// CopyFilesToContainer 将多个文件写入容器内的 dstDir 目录
+//
+// files 的键为相对于 dstDir 的路径, 可以包含子目录, 缺少的子目录会被创建; 路径中不能包含 "..".
+// dstDir 必须已存在. 文件以 0755 权限写入.
+func (ds *DockerService) CopyFilesToContainer(ctx context.Context, id, dstDir string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	dirs := make(map[string]bool)
+	now := time.Now()
+	for _, name := range names {
+		clean := path.Clean(name)
+		if clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return errors.New("invalid file path " + name)
+		}
+
+		// 先写入各级父目录, 保证解包时目录存在
+		var parents []string
+		for dir := path.Dir(clean); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			parents = append(parents, dir)
+			dirs[dir] = true
+		}
+		for i := len(parents) - 1; i >= 0; i-- {
+			err := tw.WriteHeader(&tar.Header{
+				Name:     parents[i] + "/",
+				Typeflag: tar.TypeDir,
+				Mode:     0755,
+				ModTime:  now,
+			})
+			if err != nil {
+				return errors.Wrap(err, "failed to build tar archive")
+			}
+		}
+
+		content := files[name]
+		err := tw.WriteHeader(&tar.Header{
+			Name:    clean,
+			Mode:    0755,
+			Size:    int64(len(content)),
+			ModTime: now,
+		})
+		if err == nil {
+			_, err = tw.Write(content)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to build tar archive")
+		}
+	}
+	err := tw.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to build tar archive")
+	}
+
+	err = ds.client.CopyToContainer(ctx, id, dstDir, &buf, container.CopyToContainerOptions{})
+	if err != nil {
+		log.Err(err).Str("id", id).Str("path", dstDir).Msg("container copy to error")
+		return errors.Wrap(err, "failed to copy files to container")
+	}
+
+	log.Debug().Str("id", id).Str("path", dstDir).Int("files", len(files)).Msg("copied files to container")
+	return nil
+}
+
+// CopyFileFromContainer 读取容器内 srcPath 处的文件内容
+func (ds *DockerService) CopyFileFromContainer(ctx context.Context, id, srcPath string) ([]byte, error) {
+	rc, stat, err := ds.client.CopyFromContainer(ctx, id, srcPath)
+	if err != nil {
+		log.Err(err).Str("id", id).Str("path", srcPath).Msg("container copy from error")
+		return nil, errors.Wrap(err, "failed to copy file from container")
+	}
+	defer rc.Close()
+
+	if !stat.Mode.IsRegular() {
+		return nil, errors.New(srcPath + " is not a regular file")
+	}
+
+	// 返回的tar包中只有一个以 srcPath 的文件名命名的条目
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New(srcPath + " not found in archive")
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read tar archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read tar archive")
+		}
+
+		log.Debug().Str("id", id).Str("path", srcPath).Int("size", len(content)).Msg("copied file from container")
+		return content, nil
+	}
+}
@@ -0,0 +1,143 @@
+package file_transfer
+
+import (
+	"context"
+	"io"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// PullImage 拉取镜像, 拉取进度写入 out (为nil时丢弃)
+func (ds *DockerService) PullImage(ctx context.Context, ref string, out io.Writer) error {
+	if out == nil {
+		out = io.Discard
+	}
+
+	log.Info().Str("image", ref).Msg("pulling image")
+
+	resp, err := ds.client.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		log.Err(err).Str("image", ref).Msg("image pull error")
+		return errors.Wrap(err, "failed to pull image")
+	}
+	defer resp.Close()
+
+	// 拉取失败的信息只会出现在返回的消息流中, 必须完整读取
+	err = jsonmessage.DisplayJSONMessagesStream(resp, out, 0, false, nil)
+	if err != nil {
+		log.Err(err).Str("image", ref).Msg("image pull stream error")
+		return errors.Wrap(err, "failed to pull image")
+	}
+
+	log.Info().Str("image", ref).Msg("image pulled")
+	return nil
+}
+
+// ImageExists 检查镜像是否存在于本地
+func (ds *DockerService) ImageExists(ctx context.Context, ref string) (bool, error) {
+	images, err := ds.client.ImageList(ctx, image.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", ref)),
+	})
+	if err != nil {
+		log.Err(err).Str("image", ref).Msg("image list error")
+		return false, errors.Wrap(err, "failed to list images")
+	}
+
+	return len(images) > 0, nil
+}
+
+// PullImageIfMissing 本地不存在镜像时拉取镜像
+func (ds *DockerService) PullImageIfMissing(ctx context.Context, ref string) error {
+	exists, err := ds.ImageExists(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	return ds.PullImage(ctx, ref, nil)
+}
+
+// RemoveImage 删除本地镜像
+//
+// 镜像正被容器使用时返回的错误满足 errors.Is(err, ErrImageInUse), force 为 true 时会强制删除.
+func (ds *DockerService) RemoveImage(ctx context.Context, ref string, force bool) error {
+	_, err := ds.client.ImageRemove(ctx, ref, image.RemoveOptions{
+		Force:         force,
+		PruneChildren: true,
+	})
+	if err != nil {
+		log.Err(err).Str("image", ref).Bool("force", force).Msg("image remove error")
+		if cerrdefs.IsNotFound(err) {
+			return errors.Wrap(ErrImageNotFound, err.Error())
+		}
+		if cerrdefs.IsConflict(err) {
+			return errors.Wrap(ErrImageInUse, err.Error())
+		}
+		return errors.Wrap(err, "failed to remove image")
+	}
+
+	log.Info().Str("image", ref).Msg("image removed")
+	return nil
+}
+
+// TagImage 为本地镜像 imageID (镜像ID或已有的引用)添加引用 ref, 如 registry.example.com/soj/gcc:13
+//
+// 镜像不存在时返回的错误满足 errors.Is(err, ErrImageNotFound).
+func (ds *DockerService) TagImage(ctx context.Context, imageID, ref string) error {
+	err := ds.client.ImageTag(ctx, imageID, ref)
+	if err != nil {
+		log.Err(err).Str("image", imageID).Str("ref", ref).Msg("image tag error")
+		if cerrdefs.IsNotFound(err) {
+			return errors.Wrap(ErrImageNotFound, err.Error())
+		}
+		return errors.Wrap(err, "failed to tag image")
+	}
+
+	log.Info().Str("image", imageID).Str("ref", ref).Msg("image tagged")
+	return nil
+}
+
+// PushImage 使用凭据 authConfig 将本地镜像 ref 推送到其所在的镜像仓库, 推送进度写入 out (为nil时丢弃)
+//
+// 与 PullImageIfMissing 配合: 构建节点构建并推送镜像后, 其他评测节点在首次使用时拉取.
+func (ds *DockerService) PushImage(ctx context.Context, ref string, authConfig registry.AuthConfig, out io.Writer) error {
+	if out == nil {
+		out = io.Discard
+	}
+
+	auth, err := registry.EncodeAuthConfig(authConfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode registry auth")
+	}
+
+	log.Info().Str("image", ref).Msg("pushing image")
+
+	resp, err := ds.client.ImagePush(ctx, ref, image.PushOptions{RegistryAuth: auth})
+	if err != nil {
+		log.Err(err).Str("image", ref).Msg("image push error")
+		if cerrdefs.IsNotFound(err) {
+			return errors.Wrap(ErrImageNotFound, err.Error())
+		}
+		return errors.Wrap(err, "failed to push image")
+	}
+	defer resp.Close()
+
+	// 推送失败(如认证失败)的信息只会出现在返回的消息流中, 必须完整读取
+	err = jsonmessage.DisplayJSONMessagesStream(resp, out, 0, false, nil)
+	if err != nil {
+		log.Err(err).Str("image", ref).Msg("image push stream error")
+		return errors.Wrap(err, "failed to push image")
+	}
+
+	log.Info().Str("image", ref).Msg("image pushed")
+	return nil
+}
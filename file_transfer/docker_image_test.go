@@ -0,0 +1,94 @@
+package file_transfer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// newFakeDockerService 创建连接到 handler 模拟的Docker API的 DockerService
+func newFakeDockerService(t *testing.T, handler http.HandlerFunc) *DockerService {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cli, err := client.NewClientWithOpts(
+		client.WithHost("tcp://"+strings.TrimPrefix(srv.URL, "http://")),
+		client.WithVersion("1.47"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create docker client: %v", err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	return NewDockerServiceWithClient(cli)
+}
+
+// fakeImageList 模拟 GET /images/json, 返回引用在 local 中的镜像
+func fakeImageList(t *testing.T, local ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/images/json") {
+			http.NotFound(w, r)
+			return
+		}
+		args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+		if err != nil {
+			t.Errorf("invalid filters: %v", err)
+		}
+		refs := args.Get("reference")
+		if len(refs) != 1 {
+			t.Errorf("reference filters = %v, want exactly one", refs)
+		}
+
+		images := []image.Summary{}
+		for _, ref := range local {
+			if len(refs) > 0 && refs[0] == ref {
+				images = append(images, image.Summary{ID: "sha256:" + ref, RepoTags: []string{ref}})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(images)
+	}
+}
+
+func TestImageExists(t *testing.T) {
+	ds := newFakeDockerService(t, fakeImageList(t, "gcc:13"))
+
+	exists, err := ds.ImageExists(t.Context(), "gcc:13")
+	if err != nil {
+		t.Fatalf("ImageExists(gcc:13) error: %v", err)
+	}
+	if !exists {
+		t.Error("ImageExists(gcc:13) = false, want true")
+	}
+
+	exists, err = ds.ImageExists(t.Context(), "python:3.12")
+	if err != nil {
+		t.Fatalf("ImageExists(python:3.12) error: %v", err)
+	}
+	if exists {
+		t.Error("ImageExists(python:3.12) = true, want false")
+	}
+}
+
+func TestImageExistsDaemonError(t *testing.T) {
+	ds := newFakeDockerService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"daemon is broken"}`))
+	})
+
+	exists, err := ds.ImageExists(t.Context(), "gcc:13")
+	if err == nil {
+		t.Fatal("ImageExists returned no error for a failing daemon")
+	}
+	if exists {
+		t.Error("ImageExists = true on error, want false")
+	}
+}
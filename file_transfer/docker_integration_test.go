@@ -0,0 +1,165 @@
+//go:build docker
+
+// 需要可访问的Docker守护进程, 以 go test -tags docker ./file_transfer 运行.
+// 测试使用的镜像由环境变量 SOJ_TEST_IMAGE 指定, 默认为 busybox, 不存在时自动拉取.
+
+package file_transfer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testImage 测试容器使用的镜像, 需要提供 sh, sleep, tail 等 busybox 命令
+func testImage() string {
+	if image := os.Getenv("SOJ_TEST_IMAGE"); image != "" {
+		return image
+	}
+	return "busybox:latest"
+}
+
+// newTestDockerService 连接Docker守护进程并准备测试镜像, 守护进程不可访问时跳过测试
+func newTestDockerService(t *testing.T) *DockerService {
+	t.Helper()
+
+	ds, err := NewDockerService()
+	if err != nil {
+		t.Skipf("docker is not available: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = ds.Ping(ctx)
+	if err != nil {
+		t.Skipf("docker is not available: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	err = ds.PullImageIfMissing(ctx, testImage())
+	if err != nil {
+		t.Fatalf("failed to pull %s: %v", testImage(), err)
+	}
+	return ds
+}
+
+// testRunConfig 返回以 cmd 为主进程的测试容器的沙箱配置
+func testRunConfig(cmd ...string) *RunConfig {
+	cfg := DefaultRunConfig()
+	cfg.Name = "soj-test-" + uuid.NewString()
+	cfg.Image = testImage()
+	cfg.Workdir = "/"
+	cfg.Cmd = cmd
+	return cfg
+}
+
+// runTestContainer 按 cfg 启动容器, 并在测试结束时清理
+func runTestContainer(t *testing.T, ds *DockerService, cfg *RunConfig) string {
+	t.Helper()
+
+	id, err := ds.RunImage(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to run container: %v", err)
+	}
+	t.Cleanup(func() {
+		ds.CleanContainer(context.Background(), id, 0)
+	})
+	return id
+}
+
+func TestRunImageMemoryLimitOOMKill(t *testing.T) {
+	ds := newTestDockerService(t)
+
+	// tail 读取没有换行的 /dev/zero 时会一直缓存当前行, 内存用量持续增长.
+	// 先等待一秒, 以免容器在 WaitContainer 之前就已退出并被自动删除
+	cfg := testRunConfig("sh", "-c", "sleep 1; exec tail /dev/zero")
+	cfg.MemoryLimit = 32 << 20
+	id := runTestContainer(t, ds, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ec, err := ds.WaitContainer(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to wait for container: %v", err)
+	}
+	if ec != ExitCodeKilled {
+		t.Fatalf("exit code = %d, want %d (killed by the OOM killer)", ec, ExitCodeKilled)
+	}
+}
+
+func TestExecContainerCapturesAllOutput(t *testing.T) {
+	ds := newTestDockerService(t)
+	id := runTestContainer(t, ds, testRunConfig("sleep", "3600"))
+
+	const size = 1 << 20
+	line := "0123456789abcdef\n"
+	want := strings.Repeat(line, size/len(line)+1)[:size]
+
+	var stdout, stderr bytes.Buffer
+	ec, _, err := ds.ExecContainer(context.Background(), id, "yes 0123456789abcdef | head -c "+strconv.Itoa(size), 30, nil, &stdout, &stderr, nil, false, "", "")
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if ec != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", ec, stderr.String())
+	}
+	if stdout.Len() != size {
+		t.Fatalf("captured %d bytes of stdout, want %d", stdout.Len(), size)
+	}
+	if stdout.String() != want {
+		t.Fatal("captured stdout does not match the output of the exec")
+	}
+}
+
+func TestPausedContainerUsesNoCPU(t *testing.T) {
+	ds := newTestDockerService(t)
+	id := runTestContainer(t, ds, testRunConfig("sh", "-c", "while :; do :; done"))
+	ctx := context.Background()
+
+	// 单次的 ContainerStats 按约一秒内的两次采样计算CPU使用率
+	busy, _, err := ds.ContainerStats(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if busy < 50 {
+		t.Fatalf("busy loop uses %.1f%% cpu, want at least 50%%", busy)
+	}
+
+	err = ds.PauseContainer(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to pause container: %v", err)
+	}
+	info, err := ds.InspectContainer(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to inspect container: %v", err)
+	}
+	if info.Status != "paused" {
+		t.Fatalf("status = %s, want paused", info.Status)
+	}
+
+	paused, _, err := ds.ContainerStats(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if paused > 1 {
+		t.Errorf("paused container uses %.1f%% cpu, want none", paused)
+	}
+
+	err = ds.UnpauseContainer(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to unpause container: %v", err)
+	}
+	resumed, _, err := ds.ContainerStats(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if resumed < 50 {
+		t.Errorf("unpaused container uses %.1f%% cpu, want the busy loop to resume", resumed)
+	}
+}
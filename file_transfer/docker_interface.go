@@ -0,0 +1,58 @@
+package file_transfer
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/system"
+)
+
+// DockerServiceInterface DockerService 的全部公开方法(已废弃的 RunImageArgs 除外)
+//
+// 评测相关的代码应依赖此接口而不是 *DockerService, 以便在没有Docker daemon的环境中
+// 使用 internal/dockermock 中的 MockDockerService 替代.
+type DockerServiceInterface interface {
+	Ping(ctx context.Context) error
+	Info(ctx context.Context) (*system.Info, error)
+
+	RunImage(ctx context.Context, cfg *RunConfig) (id string, err error)
+	CleanContainer(ctx context.Context, id string, grace int)
+	RemoveContainer(ctx context.Context, id string) error
+	WaitContainer(ctx context.Context, id string) (int, error)
+	PauseContainer(ctx context.Context, id string) error
+	UnpauseContainer(ctx context.Context, id string) error
+	ContainerStats(ctx context.Context, id string) (cpuPercent float64, memoryBytes uint64, err error)
+	ListContainersByLabel(ctx context.Context, label, value string) ([]string, error)
+	ContainerExists(ctx context.Context, id string) (bool, error)
+	InspectContainer(ctx context.Context, id string) (*ContainerInfo, error)
+	GetContainerExitCode(ctx context.Context, id string) (int, error)
+	GetContainerIP(ctx context.Context, id string) string
+
+	ExecContainer(ctx context.Context, id string, cmd string, timeout int, stdin io.Reader, stdout, stderr io.Writer, env []string, privileged bool, workdir string, user string) (int, string, error)
+	ExecContainerWithLimits(ctx context.Context, id string, cmd string, limits ExecLimits, stdin io.Reader, stdout, stderr io.Writer, env []string, workdir string, user string) (int, string, error)
+	ExecContainerStream(ctx context.Context, id string, cmd string, env []string, workdir string) (<-chan string, <-chan error)
+
+	GetContainerLogs(ctx context.Context, id string, stdout, stderr io.Writer) error
+	GetContainerLogsString(ctx context.Context, id string) (stdout, stderr string, err error)
+	GetContainerLogsTimestamped(ctx context.Context, id string) ([]LogLine, error)
+
+	CreateNetwork(ctx context.Context, name string) (string, error)
+	ConnectContainerToNetwork(ctx context.Context, containerID, networkID string) error
+	RemoveNetwork(ctx context.Context, networkID string) error
+
+	CopyFileToContainer(ctx context.Context, id, dstPath string, content []byte) error
+	CopyFilesToContainer(ctx context.Context, id, dstDir string, files map[string][]byte) error
+	CopyFileFromContainer(ctx context.Context, id, srcPath string) ([]byte, error)
+
+	PullImage(ctx context.Context, ref string, out io.Writer) error
+	ImageExists(ctx context.Context, ref string) (bool, error)
+	PullImageIfMissing(ctx context.Context, ref string) error
+	RemoveImage(ctx context.Context, ref string, force bool) error
+	BuildJudgeImage(ctx context.Context, dockerfile []byte, tag string, secrets map[string]string, out io.Writer) error
+	BuildImageFromGitHub(ctx context.Context, repoURL, ref, tag string, out io.Writer) error
+	TagImage(ctx context.Context, imageID, ref string) error
+	PushImage(ctx context.Context, ref string, authConfig registry.AuthConfig, out io.Writer) error
+}
+
+var _ DockerServiceInterface = (*DockerService)(nil)
@@ -0,0 +1,72 @@
+package file_transfer
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// execLimitGrace ExecContainer 的超时在 timeout(1) 的基础上额外等待的秒数,
+// 用于兜底结束忽略了 SIGALRM 的进程
+const execLimitGrace = 1
+
+// ExitCodeAlarm 进程被 SIGALRM 结束时的退出码(128+14), busybox 的 timeout 超时时返回该值
+const ExitCodeAlarm = 142
+
+// ExecLimits 单次exec的资源限制
+type ExecLimits struct {
+	// MemoryKB 进程虚拟地址空间的上限(ulimit -v), 单位KB, 为0时不限制
+	MemoryKB int64
+	// TimeLimitMs 墙钟时间上限, 单位毫秒, 必须大于0
+	TimeLimitMs int64
+}
+
+// shellQuote 将字符串转义为单个 sh 参数
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// limitWrapper 生成在设置 ulimit 后以 timeout(1) 运行 cmd 的脚本
+func limitWrapper(cmd string, limits ExecLimits) string {
+	var b strings.Builder
+	if limits.MemoryKB > 0 {
+		b.WriteString("ulimit -v " + strconv.FormatInt(limits.MemoryKB, 10) + " || exit 126; ")
+	}
+	secs := strconv.FormatFloat(float64(limits.TimeLimitMs)/1000, 'f', 3, 64)
+	b.WriteString("exec timeout -s ALRM " + secs + " sh -c " + shellQuote(cmd))
+	return b.String()
+}
+
+// ExecContainerWithLimits 在容器中执行命令, 并单独限制本次exec的内存和时间
+//
+// docker exec 创建的进程与容器主进程处于同一个cgroup, 无法通过cgroup单独限制,
+// 因此这里用一个包装脚本先设置 ulimit -v, 再通过 timeout(1) 在超时后向进程发送 SIGALRM.
+// 超时返回 ErrTimeLimitExceeded; 忽略 SIGALRM 的进程会在额外 execLimitGrace 秒后被 ExecContainer 强制结束.
+//
+// 与按容器设置cgroup限制相比, 这种方式有以下局限:
+//   - ulimit -v 限制的是虚拟地址空间而不是实际使用的内存, 会误伤预留大量地址空间的运行时(如Go, JVM, ASan);
+//     超出时表现为分配失败而不是被内核结束, 无法可靠地区分 MLE 与 RE.
+//   - ulimit 只作用于单个进程, fork 出的多个子进程各自计算, 总量不受限制; 也不限制CPU份额和进程数.
+//   - 计时为墙钟时间, 包含进程等待CPU的时间, 且精度受 timeout(1) 实现影响.
+//   - 镜像中需要有 sh 和支持小数秒的 timeout(1)(coreutils 或较新的 busybox).
+//
+// 需要严格隔离时应为每次运行创建独立容器并使用 RunConfig 中的cgroup限制.
+func (ds *DockerService) ExecContainerWithLimits(ctx context.Context, id string, cmd string, limits ExecLimits, stdin io.Reader, stdout, stderr io.Writer, env []string, workdir string, user string) (int, string, error) {
+	if limits.TimeLimitMs <= 0 {
+		return -1, "", errors.New("exec time limit must be positive")
+	}
+	timeout := int((limits.TimeLimitMs+999)/1000) + execLimitGrace
+
+	ec, out, err := ds.ExecContainer(ctx, id, limitWrapper(cmd, limits), timeout, stdin, stdout, stderr, env, false, workdir, user)
+	if err != nil {
+		return ec, out, err
+	}
+
+	if ec == ExitCodeTimeout || ec == ExitCodeAlarm {
+		return ec, out, ErrTimeLimitExceeded
+	}
+	return ec, out, nil
+}
@@ -0,0 +1,135 @@
+package file_transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// 日志来源
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+)
+
+// LogLine 带时间戳的一行容器日志
+type LogLine struct {
+	Timestamp time.Time
+	Stream    string // LogStreamStdout 或 LogStreamStderr
+	Text      string // 不含末尾换行
+}
+
+// logFrameHeaderLen Docker多路复用日志流每帧的头部长度
+//
+// 头部第1字节为流类型(1为stdout, 2为stderr), 第5-8字节为大端序的负载长度.
+const logFrameHeaderLen = 8
+
+// GetContainerLogsTimestamped 获取带时间戳的容器日志
+//
+// 时间戳由Docker在日志产生时记录, 比读取日志的时间准确, 可用于判断程序在时限附近的输出.
+func (ds *DockerService) GetContainerLogsTimestamped(ctx context.Context, id string) ([]LogLine, error) {
+	resp, err := ds.client.ContainerLogs(ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+	})
+	if err != nil {
+		log.Err(err).Str("id", id).Msg("container logs error")
+		return nil, err
+	}
+	defer resp.Close()
+
+	lines, err := ParseTimestampedLogs(resp)
+	if err != nil {
+		log.Err(err).Str("id", id).Msg("container logs read error")
+		return nil, err
+	}
+	return lines, nil
+}
+
+// ParseTimestampedLogs 解析 Timestamps 为 true 时Docker返回的多路复用日志流
+//
+// 每帧的负载中每行以 RFC3339Nano 时间戳和一个空格开头. 一帧中可能有多行,
+// 一行也可能被拆分到同一个流的多帧中, 此时以第一部分的时间戳为准.
+func ParseTimestampedLogs(r io.Reader) ([]LogLine, error) {
+	var (
+		lines   []LogLine
+		header  [logFrameHeaderLen]byte
+		partial = map[string]*LogLine{}
+	)
+
+	br := bufio.NewReader(r)
+	for {
+		_, err := io.ReadFull(br, header[:])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read log frame header")
+		}
+
+		var stream string
+		switch header[0] {
+		case 0, 1:
+			stream = LogStreamStdout
+		case 2:
+			stream = LogStreamStderr
+		default:
+			return nil, errors.New("invalid log stream type " + strconv.Itoa(int(header[0])))
+		}
+
+		payload := make([]byte, binary.BigEndian.Uint32(header[4:]))
+		_, err = io.ReadFull(br, payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read log frame payload")
+		}
+
+		for len(payload) > 0 {
+			chunk := payload
+			complete := false
+			if i := bytes.IndexByte(payload, '\n'); i >= 0 {
+				chunk, payload = payload[:i], payload[i+1:]
+				complete = true
+			} else {
+				payload = nil
+			}
+
+			line := partial[stream]
+			if line == nil {
+				line = &LogLine{Stream: stream}
+				ts, text, ok := strings.Cut(string(chunk), " ")
+				t, perr := time.Parse(time.RFC3339Nano, ts)
+				if ok && perr == nil {
+					line.Timestamp, line.Text = t, text
+				} else {
+					line.Text = string(chunk)
+				}
+			} else {
+				line.Text += string(chunk)
+			}
+
+			if complete {
+				lines = append(lines, *line)
+				delete(partial, stream)
+			} else {
+				partial[stream] = line
+			}
+		}
+	}
+
+	for _, stream := range []string{LogStreamStdout, LogStreamStderr} {
+		if line := partial[stream]; line != nil {
+			lines = append(lines, *line)
+		}
+	}
+	return lines, nil
+}
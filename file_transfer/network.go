@@ -0,0 +1,71 @@
+package file_transfer
+
+import (
+	"context"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/network"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNetworkNotFound 网络不存在
+var ErrNetworkNotFound = errors.New("network not found")
+
+// CreateNetwork 创建隔离的bridge网络, 返回网络ID
+//
+// 网络为 internal, 连接到其中的容器之间可以互相访问, 但无法访问宿主机以外的网络,
+// 用于需要选手程序与评测程序通过网络通信的题目, 每个提交使用独立的网络.
+// 需要Docker守护进程支持用户自定义网络, rootless 或禁用了 bridge 驱动的环境下会失败.
+// 同名网络已存在时满足 errors.Is(err, ErrNameConflict).
+func (ds *DockerService) CreateNetwork(ctx context.Context, name string) (string, error) {
+	resp, err := ds.client.NetworkCreate(ctx, name, network.CreateOptions{
+		Driver:   "bridge",
+		Internal: true,
+		Labels:   map[string]string{LabelManaged: "true"},
+	})
+	if err != nil {
+		log.Err(err).Str("name", name).Msg("network create error")
+		if cerrdefs.IsConflict(err) {
+			return "", errors.Wrap(ErrNameConflict, name)
+		}
+		return "", err
+	}
+	if resp.Warning != "" {
+		log.Warn().Str("name", name).Str("warning", resp.Warning).Msg("network created with warning")
+	}
+
+	log.Debug().Str("name", name).Str("id", resp.ID).Msg("network created")
+	return resp.ID, nil
+}
+
+// ConnectContainerToNetwork 将容器连接到网络
+//
+// 容器可以通过容器名访问同一网络中的其他容器.
+func (ds *DockerService) ConnectContainerToNetwork(ctx context.Context, containerID, networkID string) error {
+	err := ds.client.NetworkConnect(ctx, networkID, containerID, nil)
+	if err != nil {
+		log.Err(err).Str("id", containerID).Str("network", networkID).Msg("network connect error")
+		if cerrdefs.IsNotFound(err) {
+			return errors.Wrap(ErrNetworkNotFound, networkID)
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveNetwork 删除网络, 网络不存在时不报错
+//
+// 仍有容器连接到网络时删除会失败, 应先清理容器.
+func (ds *DockerService) RemoveNetwork(ctx context.Context, networkID string) error {
+	err := ds.client.NetworkRemove(ctx, networkID)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			log.Debug().Str("network", networkID).Msg("network already removed")
+			return nil
+		}
+		log.Err(err).Str("network", networkID).Msg("network remove error")
+		return err
+	}
+	return nil
+}
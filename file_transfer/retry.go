@@ -0,0 +1,65 @@
+package file_transfer
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// dockerRetryAttempts Docker API 调用偶发失败时的最大尝试次数
+const dockerRetryAttempts = 3
+
+// retryInitialBackoff/retryMaxBackoff 首次重试前的等待时间和等待时间的上限, 每次重试翻倍
+const (
+	retryInitialBackoff = 50 * time.Millisecond
+	retryMaxBackoff     = 2 * time.Second
+)
+
+// isTransientError 判断 Docker API 调用的错误是否可能在重试后消失
+//
+// 连接被重置, 请求超时及daemon返回的 5xx 等错误视为暂时的; 容器或镜像不存在, 参数非法, 名称冲突,
+// 权限不足等由daemon根据状态码明确拒绝的请求, 以及调用方取消的请求, 重试也无济于事.
+func isTransientError(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case cerrdefs.IsNotFound(err),
+		cerrdefs.IsInvalidArgument(err),
+		cerrdefs.IsConflict(err),
+		cerrdefs.IsUnauthorized(err),
+		cerrdefs.IsPermissionDenied(err),
+		cerrdefs.IsNotImplemented(err):
+		return false
+	}
+	return true
+}
+
+// withRetry 调用 fn, 返回暂时的错误时以带随机抖动的指数退避重试, 至多调用 maxAttempts 次
+//
+// 返回最后一次调用的错误. 等待重试时 ctx 被取消则立即返回.
+func withRetry(ctx context.Context, maxAttempts int, fn func() error) error {
+	backoff := retryInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxAttempts || !isTransientError(err) {
+			return err
+		}
+
+		// 在 [backoff/2, backoff) 中随机等待, 避免同时失败的调用同时重试
+		wait := backoff/2 + rand.N(backoff/2)
+		log.Warn().Err(err).Int("attempt", attempt).Dur("backoff", wait).Msg("docker api call failed, retrying")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, retryMaxBackoff)
+	}
+}
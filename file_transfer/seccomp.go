@@ -0,0 +1,51 @@
+package file_transfer
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSeccompProfile 随程序分发的评测容器seccomp配置
+//
+// 它在默认放行的基础上禁止 ptrace, mount, 内核模块, 命名空间, 跨进程内存读写等
+// 可用于逃逸沙箱或进行侧信道攻击的系统调用. 注意自定义配置会整体替换Docker的默认配置.
+//
+//go:embed judge_seccomp.json
+var DefaultSeccompProfile string
+
+// LoadSeccompProfile 从文件读取seccomp配置, 返回可直接用于 RunConfig.SeccompProfile 的内容
+//
+// 与 docker run --security-opt seccomp=<file> 不同, Docker API 需要的是配置内容而不是路径.
+func LoadSeccompProfile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read seccomp profile")
+	}
+
+	var buf bytes.Buffer
+	err = json.Compact(&buf, content)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid seccomp profile "+path)
+	}
+
+	return buf.String(), nil
+}
+
+// ResolveSeccompProfile 解析工作流中的seccomp配置项
+//
+// "default" 表示 DefaultSeccompProfile, "unconfined" 表示不启用seccomp,
+// 空字符串表示使用Docker的默认配置, 其余值视为配置文件路径.
+func ResolveSeccompProfile(profile string) (string, error) {
+	switch profile {
+	case "", "unconfined":
+		return profile, nil
+	case "default":
+		return DefaultSeccompProfile, nil
+	default:
+		return LoadSeccompProfile(profile)
+	}
+}
@@ -12,11 +12,13 @@ import (
 
 	"github.com/docker/docker/api/types/mount"
 	ssh "github.com/gliderlabs/ssh"
+	"github.com/google/uuid"
 	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
 )
 
 // SftpHandler handler for SFTP subsystem
-func SftpHandler(sess ssh.Session, cfg *types.Config, dockerService *DockerService) {
+func SftpHandler(sess ssh.Session, cfg *types.Config, dockerService DockerServiceInterface) {
 	name := "soj-subsystem-sftp-" + sess.User() + "-" + time.Now().Format("20060102150405")
 	path := cfg.SubmitsDir + "/" + sess.User()
 	log.Println("new sftp session", sess.User(), name, path)
@@ -28,23 +30,43 @@ func SftpHandler(sess ssh.Session, cfg *types.Config, dockerService *DockerServi
 
 	os.Chown(path, cfg.SubmitUid, cfg.SubmitGid)
 
-	success, id := dockerService.RunImage(name, strconv.Itoa(cfg.SubmitUid), "soj-sftpd", "docker.io/mrhaoxx/soj-subsystem-sftp", "/", []mount.Mount{
-		{
-			Type:   mount.TypeBind,
-			Source: path,
-			Target: "/work",
+	runCfg := &RunConfig{
+		Name:     name,
+		Image:    "docker.io/mrhaoxx/soj-subsystem-sftp",
+		User:     strconv.Itoa(cfg.SubmitUid),
+		Hostname: "soj-sftpd",
+		Workdir:  "/",
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: path,
+				Target: "/work",
+			},
 		},
-	}, true, true, false, 120, false, nil)
+		Labels: map[string]string{
+			LabelUser: sess.User(),
+		},
+		MaskPaths:      true,
+		ReadonlyRootfs: true,
+		Timeout:        120,
+		OomScoreAdj:    DefaultOomScoreAdj,
+	}
 
-	if !success {
-		log.Println(name, "failed to run sftp container")
+	id, err := dockerService.RunImage(sess.Context(), runCfg)
+	if errors.Is(err, ErrNameConflict) {
+		// 同一用户在同一秒内打开了多个会话
+		runCfg.Name = name + "-" + uuid.NewString()[:8]
+		id, err = dockerService.RunImage(sess.Context(), runCfg)
+	}
+	if err != nil {
+		log.Println(name, "failed to run sftp container", err)
 		return
 	}
-	// defer dockerService.CleanContainer(id)
+	// defer dockerService.CleanContainer(context.Background(), id, DefaultStopGrace)
 
 	// time.Sleep(500 * time.Millisecond)
 
-	ip := dockerService.GetContainerIP(id)
+	ip := dockerService.GetContainerIP(sess.Context(), id)
 
 	log.Printf("ip: %s, %s", ip, "try to connect to container")
 
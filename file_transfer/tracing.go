@@ -0,0 +1,21 @@
+package file_transfer
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer 容器生命周期的追踪器
+//
+// 使用全局的 TracerProvider, 未设置时为空实现, 不产生额外开销.
+var tracer = otel.Tracer("github.com/mrhaoxx/SOJ/file_transfer")
+
+// endSpan 记录错误(如果有)并结束span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,385 @@
+// Package dockermock 提供 file_transfer.DockerServiceInterface 的内存实现, 只用于在没有Docker daemon时测试评测逻辑
+package dockermock
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/system"
+	"github.com/mrhaoxx/SOJ/file_transfer"
+)
+
+// Call 一次方法调用的记录
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// MockDockerService 记录所有调用并返回预先配置的结果
+//
+// 每个方法都有对应的 XxxFunc 字段, 设置后由其决定返回值; 未设置时表现为一切正常的daemon:
+// RunImage 返回 "mock-<容器名>" 作为容器ID, ContainerExists 和 ImageExists 返回 true, 其余返回零值.
+// 所有方法都可以并发调用.
+type MockDockerService struct {
+	PingFunc func(ctx context.Context) error
+	InfoFunc func(ctx context.Context) (*system.Info, error)
+
+	RunImageFunc              func(ctx context.Context, cfg *file_transfer.RunConfig) (string, error)
+	CleanContainerFunc        func(ctx context.Context, id string, grace int)
+	RemoveContainerFunc       func(ctx context.Context, id string) error
+	WaitContainerFunc         func(ctx context.Context, id string) (int, error)
+	PauseContainerFunc        func(ctx context.Context, id string) error
+	UnpauseContainerFunc      func(ctx context.Context, id string) error
+	ContainerStatsFunc        func(ctx context.Context, id string) (float64, uint64, error)
+	ListContainersByLabelFunc func(ctx context.Context, label, value string) ([]string, error)
+	ContainerExistsFunc       func(ctx context.Context, id string) (bool, error)
+	InspectContainerFunc      func(ctx context.Context, id string) (*file_transfer.ContainerInfo, error)
+	GetContainerExitCodeFunc  func(ctx context.Context, id string) (int, error)
+	GetContainerIPFunc        func(ctx context.Context, id string) string
+
+	ExecContainerFunc           func(ctx context.Context, id string, cmd string, timeout int, stdin io.Reader, stdout, stderr io.Writer, env []string, privileged bool, workdir string, user string) (int, string, error)
+	ExecContainerWithLimitsFunc func(ctx context.Context, id string, cmd string, limits file_transfer.ExecLimits, stdin io.Reader, stdout, stderr io.Writer, env []string, workdir string, user string) (int, string, error)
+	ExecContainerStreamFunc     func(ctx context.Context, id string, cmd string, env []string, workdir string) (<-chan string, <-chan error)
+
+	GetContainerLogsFunc            func(ctx context.Context, id string, stdout, stderr io.Writer) error
+	GetContainerLogsStringFunc      func(ctx context.Context, id string) (string, string, error)
+	GetContainerLogsTimestampedFunc func(ctx context.Context, id string) ([]file_transfer.LogLine, error)
+
+	CreateNetworkFunc             func(ctx context.Context, name string) (string, error)
+	ConnectContainerToNetworkFunc func(ctx context.Context, containerID, networkID string) error
+	RemoveNetworkFunc             func(ctx context.Context, networkID string) error
+
+	CopyFileToContainerFunc   func(ctx context.Context, id, dstPath string, content []byte) error
+	CopyFilesToContainerFunc  func(ctx context.Context, id, dstDir string, files map[string][]byte) error
+	CopyFileFromContainerFunc func(ctx context.Context, id, srcPath string) ([]byte, error)
+
+	PullImageFunc          func(ctx context.Context, ref string, out io.Writer) error
+	ImageExistsFunc        func(ctx context.Context, ref string) (bool, error)
+	PullImageIfMissingFunc func(ctx context.Context, ref string) error
+	RemoveImageFunc        func(ctx context.Context, ref string, force bool) error
+	BuildJudgeImageFunc    func(ctx context.Context, dockerfile []byte, tag string, secrets map[string]string, out io.Writer) error
+
+	BuildImageFromGitHubFunc func(ctx context.Context, repoURL, ref, tag string, out io.Writer) error
+	TagImageFunc             func(ctx context.Context, imageID, ref string) error
+	PushImageFunc            func(ctx context.Context, ref string, authConfig registry.AuthConfig, out io.Writer) error
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ file_transfer.DockerServiceInterface = (*MockDockerService)(nil)
+
+// New 创建新的 MockDockerService
+func New() *MockDockerService {
+	return &MockDockerService{}
+}
+
+func (m *MockDockerService) record(method string, args ...any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+}
+
+// Calls 返回到目前为止的所有调用记录
+func (m *MockDockerService) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallsTo 返回对指定方法的调用记录
+func (m *MockDockerService) CallsTo(method string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []Call
+	for _, c := range m.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset 清空调用记录
+func (m *MockDockerService) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+}
+
+func (m *MockDockerService) Ping(ctx context.Context) error {
+	m.record("Ping")
+	if m.PingFunc != nil {
+		return m.PingFunc(ctx)
+	}
+	return nil
+}
+
+func (m *MockDockerService) Info(ctx context.Context) (*system.Info, error) {
+	m.record("Info")
+	if m.InfoFunc != nil {
+		return m.InfoFunc(ctx)
+	}
+	return &system.Info{}, nil
+}
+
+func (m *MockDockerService) RunImage(ctx context.Context, cfg *file_transfer.RunConfig) (string, error) {
+	m.record("RunImage", cfg)
+	if m.RunImageFunc != nil {
+		return m.RunImageFunc(ctx, cfg)
+	}
+	return "mock-" + cfg.Name, nil
+}
+
+func (m *MockDockerService) CleanContainer(ctx context.Context, id string, grace int) {
+	m.record("CleanContainer", id, grace)
+	if m.CleanContainerFunc != nil {
+		m.CleanContainerFunc(ctx, id, grace)
+	}
+}
+
+func (m *MockDockerService) RemoveContainer(ctx context.Context, id string) error {
+	m.record("RemoveContainer", id)
+	if m.RemoveContainerFunc != nil {
+		return m.RemoveContainerFunc(ctx, id)
+	}
+	return nil
+}
+
+func (m *MockDockerService) WaitContainer(ctx context.Context, id string) (int, error) {
+	m.record("WaitContainer", id)
+	if m.WaitContainerFunc != nil {
+		return m.WaitContainerFunc(ctx, id)
+	}
+	return 0, nil
+}
+
+func (m *MockDockerService) PauseContainer(ctx context.Context, id string) error {
+	m.record("PauseContainer", id)
+	if m.PauseContainerFunc != nil {
+		return m.PauseContainerFunc(ctx, id)
+	}
+	return nil
+}
+
+func (m *MockDockerService) UnpauseContainer(ctx context.Context, id string) error {
+	m.record("UnpauseContainer", id)
+	if m.UnpauseContainerFunc != nil {
+		return m.UnpauseContainerFunc(ctx, id)
+	}
+	return nil
+}
+
+func (m *MockDockerService) ContainerStats(ctx context.Context, id string) (float64, uint64, error) {
+	m.record("ContainerStats", id)
+	if m.ContainerStatsFunc != nil {
+		return m.ContainerStatsFunc(ctx, id)
+	}
+	return 0, 0, nil
+}
+
+func (m *MockDockerService) ListContainersByLabel(ctx context.Context, label, value string) ([]string, error) {
+	m.record("ListContainersByLabel", label, value)
+	if m.ListContainersByLabelFunc != nil {
+		return m.ListContainersByLabelFunc(ctx, label, value)
+	}
+	return nil, nil
+}
+
+func (m *MockDockerService) ContainerExists(ctx context.Context, id string) (bool, error) {
+	m.record("ContainerExists", id)
+	if m.ContainerExistsFunc != nil {
+		return m.ContainerExistsFunc(ctx, id)
+	}
+	return true, nil
+}
+
+func (m *MockDockerService) InspectContainer(ctx context.Context, id string) (*file_transfer.ContainerInfo, error) {
+	m.record("InspectContainer", id)
+	if m.InspectContainerFunc != nil {
+		return m.InspectContainerFunc(ctx, id)
+	}
+	return &file_transfer.ContainerInfo{ID: id}, nil
+}
+
+func (m *MockDockerService) GetContainerExitCode(ctx context.Context, id string) (int, error) {
+	m.record("GetContainerExitCode", id)
+	if m.GetContainerExitCodeFunc != nil {
+		return m.GetContainerExitCodeFunc(ctx, id)
+	}
+	return 0, nil
+}
+
+func (m *MockDockerService) GetContainerIP(ctx context.Context, id string) string {
+	m.record("GetContainerIP", id)
+	if m.GetContainerIPFunc != nil {
+		return m.GetContainerIPFunc(ctx, id)
+	}
+	return ""
+}
+
+func (m *MockDockerService) ExecContainer(ctx context.Context, id string, cmd string, timeout int, stdin io.Reader, stdout, stderr io.Writer, env []string, privileged bool, workdir string, user string) (int, string, error) {
+	m.record("ExecContainer", id, cmd, timeout, env, privileged, workdir, user)
+	if m.ExecContainerFunc != nil {
+		return m.ExecContainerFunc(ctx, id, cmd, timeout, stdin, stdout, stderr, env, privileged, workdir, user)
+	}
+	return 0, "", nil
+}
+
+func (m *MockDockerService) ExecContainerWithLimits(ctx context.Context, id string, cmd string, limits file_transfer.ExecLimits, stdin io.Reader, stdout, stderr io.Writer, env []string, workdir string, user string) (int, string, error) {
+	m.record("ExecContainerWithLimits", id, cmd, limits, env, workdir, user)
+	if m.ExecContainerWithLimitsFunc != nil {
+		return m.ExecContainerWithLimitsFunc(ctx, id, cmd, limits, stdin, stdout, stderr, env, workdir, user)
+	}
+	return 0, "", nil
+}
+
+func (m *MockDockerService) ExecContainerStream(ctx context.Context, id string, cmd string, env []string, workdir string) (<-chan string, <-chan error) {
+	m.record("ExecContainerStream", id, cmd, env, workdir)
+	if m.ExecContainerStreamFunc != nil {
+		return m.ExecContainerStreamFunc(ctx, id, cmd, env, workdir)
+	}
+	lines := make(chan string)
+	errc := make(chan error)
+	close(lines)
+	close(errc)
+	return lines, errc
+}
+
+func (m *MockDockerService) GetContainerLogs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	m.record("GetContainerLogs", id)
+	if m.GetContainerLogsFunc != nil {
+		return m.GetContainerLogsFunc(ctx, id, stdout, stderr)
+	}
+	return nil
+}
+
+func (m *MockDockerService) GetContainerLogsString(ctx context.Context, id string) (string, string, error) {
+	m.record("GetContainerLogsString", id)
+	if m.GetContainerLogsStringFunc != nil {
+		return m.GetContainerLogsStringFunc(ctx, id)
+	}
+	return "", "", nil
+}
+
+func (m *MockDockerService) GetContainerLogsTimestamped(ctx context.Context, id string) ([]file_transfer.LogLine, error) {
+	m.record("GetContainerLogsTimestamped", id)
+	if m.GetContainerLogsTimestampedFunc != nil {
+		return m.GetContainerLogsTimestampedFunc(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *MockDockerService) CreateNetwork(ctx context.Context, name string) (string, error) {
+	m.record("CreateNetwork", name)
+	if m.CreateNetworkFunc != nil {
+		return m.CreateNetworkFunc(ctx, name)
+	}
+	return "mock-network-" + name, nil
+}
+
+func (m *MockDockerService) ConnectContainerToNetwork(ctx context.Context, containerID, networkID string) error {
+	m.record("ConnectContainerToNetwork", containerID, networkID)
+	if m.ConnectContainerToNetworkFunc != nil {
+		return m.ConnectContainerToNetworkFunc(ctx, containerID, networkID)
+	}
+	return nil
+}
+
+func (m *MockDockerService) RemoveNetwork(ctx context.Context, networkID string) error {
+	m.record("RemoveNetwork", networkID)
+	if m.RemoveNetworkFunc != nil {
+		return m.RemoveNetworkFunc(ctx, networkID)
+	}
+	return nil
+}
+
+func (m *MockDockerService) CopyFileToContainer(ctx context.Context, id, dstPath string, content []byte) error {
+	m.record("CopyFileToContainer", id, dstPath, content)
+	if m.CopyFileToContainerFunc != nil {
+		return m.CopyFileToContainerFunc(ctx, id, dstPath, content)
+	}
+	return nil
+}
+
+func (m *MockDockerService) CopyFilesToContainer(ctx context.Context, id, dstDir string, files map[string][]byte) error {
+	m.record("CopyFilesToContainer", id, dstDir, files)
+	if m.CopyFilesToContainerFunc != nil {
+		return m.CopyFilesToContainerFunc(ctx, id, dstDir, files)
+	}
+	return nil
+}
+
+func (m *MockDockerService) CopyFileFromContainer(ctx context.Context, id, srcPath string) ([]byte, error) {
+	m.record("CopyFileFromContainer", id, srcPath)
+	if m.CopyFileFromContainerFunc != nil {
+		return m.CopyFileFromContainerFunc(ctx, id, srcPath)
+	}
+	return nil, nil
+}
+
+func (m *MockDockerService) PullImage(ctx context.Context, ref string, out io.Writer) error {
+	m.record("PullImage", ref)
+	if m.PullImageFunc != nil {
+		return m.PullImageFunc(ctx, ref, out)
+	}
+	return nil
+}
+
+func (m *MockDockerService) ImageExists(ctx context.Context, ref string) (bool, error) {
+	m.record("ImageExists", ref)
+	if m.ImageExistsFunc != nil {
+		return m.ImageExistsFunc(ctx, ref)
+	}
+	return true, nil
+}
+
+func (m *MockDockerService) PullImageIfMissing(ctx context.Context, ref string) error {
+	m.record("PullImageIfMissing", ref)
+	if m.PullImageIfMissingFunc != nil {
+		return m.PullImageIfMissingFunc(ctx, ref)
+	}
+	return nil
+}
+
+func (m *MockDockerService) RemoveImage(ctx context.Context, ref string, force bool) error {
+	m.record("RemoveImage", ref, force)
+	if m.RemoveImageFunc != nil {
+		return m.RemoveImageFunc(ctx, ref, force)
+	}
+	return nil
+}
+
+func (m *MockDockerService) BuildJudgeImage(ctx context.Context, dockerfile []byte, tag string, secrets map[string]string, out io.Writer) error {
+	m.record("BuildJudgeImage", tag)
+	if m.BuildJudgeImageFunc != nil {
+		return m.BuildJudgeImageFunc(ctx, dockerfile, tag, secrets, out)
+	}
+	return nil
+}
+
+func (m *MockDockerService) BuildImageFromGitHub(ctx context.Context, repoURL, ref, tag string, out io.Writer) error {
+	m.record("BuildImageFromGitHub", repoURL, ref, tag)
+	if m.BuildImageFromGitHubFunc != nil {
+		return m.BuildImageFromGitHubFunc(ctx, repoURL, ref, tag, out)
+	}
+	return nil
+}
+
+func (m *MockDockerService) TagImage(ctx context.Context, imageID, ref string) error {
+	m.record("TagImage", imageID, ref)
+	if m.TagImageFunc != nil {
+		return m.TagImageFunc(ctx, imageID, ref)
+	}
+	return nil
+}
+
+func (m *MockDockerService) PushImage(ctx context.Context, ref string, authConfig registry.AuthConfig, out io.Writer) error {
+	m.record("PushImage", ref)
+	if m.PushImageFunc != nil {
+		return m.PushImageFunc(ctx, ref, authConfig, out)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package judge
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mrhaoxx/SOJ/types"
+)
+
+const (
+	// MaxDiffLines DiffCompare 返回的差异片段中最多列出的不同行(词)数
+	MaxDiffLines = 5
+	// maxDiffLineLen 差异片段中每行的最大长度(字符), 更长的行被截断
+	maxDiffLineLen = 80
+)
+
+// DiffCompare 按 mode 比较标准答案与选手输出, 不一致时返回可读的差异片段
+//
+// 差异片段列出前 MaxDiffLines 个不同的行, CompareTokens 模式下列出不同的词, 用于 WA 时的反馈.
+// mode 为空时与 CompareIgnoreTrailingWhitespace 相同.
+func DiffCompare(expected, actual string, mode types.CompareMode) (bool, string) {
+	switch mode {
+	case types.CompareExact:
+		if expected == actual {
+			return true, ""
+		}
+		return diffSequences(strings.Split(expected, "\n"), strings.Split(actual, "\n"), "line")
+	case types.CompareIgnoreAllWhitespace:
+		if stripWhitespace(expected) == stripWhitespace(actual) {
+			return true, ""
+		}
+		return diffSequences(trimmedLines(expected), trimmedLines(actual), "line")
+	case types.CompareTokens:
+		return diffSequences(strings.Fields(expected), strings.Fields(actual), "token")
+	default:
+		return diffSequences(trimmedLines(expected), trimmedLines(actual), "line")
+	}
+}
+
+// trimmedLines 按行切分, 去掉行末空白和末尾空行, 兼容 CRLF 换行
+func trimmedLines(s string) []string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func stripWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// diffSequences 逐项比较两个序列, unit 为差异片段中项的名称, 如 "line"
+func diffSequences(expected, actual []string, unit string) (bool, string) {
+	var b strings.Builder
+	differ := 0
+	for i := 0; i < max(len(expected), len(actual)); i++ {
+		e, a := "<EOF>", "<EOF>"
+		if i < len(expected) {
+			e = quoteDiffLine(expected[i])
+		}
+		if i < len(actual) {
+			a = quoteDiffLine(actual[i])
+		}
+		if e == a {
+			continue
+		}
+		differ++
+		if differ <= MaxDiffLines {
+			b.WriteString(unit + " " + strconv.Itoa(i+1) + ": expected " + e + ", got " + a + "\n")
+		}
+	}
+	if differ == 0 {
+		return true, ""
+	}
+	if differ > MaxDiffLines {
+		b.WriteString("... and " + strconv.Itoa(differ-MaxDiffLines) + " more differing " + unit + "s\n")
+	}
+	return false, b.String()
+}
+
+// quoteDiffLine 截断过长的行并加上引号, 使空白和不可见字符可见
+func quoteDiffLine(s string) string {
+	r := []rune(s)
+	if len(r) > maxDiffLineLen {
+		return strconv.Quote(string(r[:maxDiffLineLen])) + "..."
+	}
+	return strconv.Quote(s)
+}
+
+// DiffChecker 按 Mode 比较输出, 答案错误时 CheckerOutput 为差异片段
+type DiffChecker struct {
+	Mode types.CompareMode
+}
+
+// Check 比较输出
+func (c DiffChecker) Check(ctx context.Context, input, expected, actual []byte) (*types.JudgeResult, error) {
+	ok, diff := DiffCompare(string(expected), string(actual), c.Mode)
+	if ok {
+		return &types.JudgeResult{Success: true, Verdict: types.VerdictAccepted, Score: 100}, nil
+	}
+	return &types.JudgeResult{Success: true, Verdict: types.VerdictWrongAnswer, CheckerOutput: diff}, nil
+}
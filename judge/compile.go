@@ -0,0 +1,96 @@
+package judge
+
+import (
+	"context"
+	"path"
+	"strconv"
+
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultCompileTimeout 编译的时间上限(秒)
+const DefaultCompileTimeout = 30
+
+// CompileError 编译失败, 即编译命令的退出码非0或编译超时
+type CompileError struct {
+	ExitCode int
+	Stderr   string
+	Timeout  bool
+}
+
+func (e *CompileError) Error() string {
+	if e.Timeout {
+		return "compile time limit exceeded"
+	}
+	return "compile failed with exit code " + strconv.Itoa(e.ExitCode)
+}
+
+// Compile 在一次性的容器中编译源代码, 返回编译产物的内容和编译器的标准错误输出
+//
+// 不需要编译的语言直接返回源代码. 编译失败时返回 *CompileError, 其他错误说明评测系统本身出了问题.
+func (e *Evaluator) Compile(ctx context.Context, src []byte, lang LanguageConfig) (binary []byte, stderr string, err error) {
+	return e.CompileFiles(ctx, map[string][]byte{lang.SourceFile(): src}, lang)
+}
+
+// CompileFiles 与 Compile 相同, 但将 files 全部复制到编译容器的工作目录中后再编译
+//
+// files 中必须包含语言的源文件, 其余文件(如头文件)可以位于子目录中.
+// 不需要编译的语言只返回源文件, 其余文件不会在运行时出现.
+func (e *Evaluator) CompileFiles(ctx context.Context, files map[string][]byte, lang LanguageConfig) (binary []byte, stderr string, err error) {
+	src, ok := files[lang.SourceFile()]
+	if !ok {
+		return nil, "", errors.New("source file " + lang.SourceFile() + " is missing")
+	}
+	if !lang.NeedsCompile() {
+		return src, "", nil
+	}
+
+	cfg := sandboxConfig("soj-compile-", lang.Image)
+	cid, err := startSandbox(ctx, e.docker, cfg, files)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to start compile container")
+	}
+	defer e.docker.CleanContainer(context.WithoutCancel(ctx), cid, file_transfer.DefaultStopGrace)
+
+	res, err := runInSandbox(ctx, e.docker, cid, lang.CompileCommand(), DefaultCompileTimeout, 0, 0, nil, nil)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to run compiler")
+	}
+
+	// 编译器的诊断信息可能写到标准输出, 一并返回
+	stderr = res.Stdout + res.Stderr
+
+	if res.Verdict != "" {
+		log.Debug().Str("language", lang.ID).Int("exit_code", res.ExitCode).Str("verdict", string(res.Verdict)).Msg("compile failed")
+		return nil, stderr, &CompileError{
+			ExitCode: res.ExitCode,
+			Stderr:   stderr,
+			Timeout:  res.Verdict == types.VerdictTimeLimitExceeded,
+		}
+	}
+
+	binary, err = e.docker.CopyFileFromContainer(ctx, cid, path.Join(cfg.Workdir, lang.BinaryFile()))
+	if err != nil {
+		return nil, stderr, errors.Wrap(err, "failed to copy binary from compile container")
+	}
+
+	return binary, stderr, nil
+}
+
+// compileErrorResult 将编译错误转换为 CE 结论的评测结果
+func compileErrorResult(err *CompileError) *types.JudgeResult {
+	msg := "compile error"
+	if err.Timeout {
+		msg = "compile time limit exceeded"
+	}
+	return &types.JudgeResult{
+		Success:  true,
+		Verdict:  types.VerdictCompileError,
+		Msg:      msg,
+		ExitCode: err.ExitCode,
+		Stderr:   err.Stderr,
+	}
+}
@@ -0,0 +1,95 @@
+package judge
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// 自定义输入运行的限制
+const (
+	CustomRunTimeLimitMs   = 2000
+	CustomRunMemoryLimitKB = 256 << 10
+	// CustomRunMaxOutput 返回的标准输出和标准错误的最大长度, 超出部分在运行时即被丢弃, 标准输出超出时结论为 OLE
+	CustomRunMaxOutput = 64 << 10
+	// CustomRunMaxInputSize 自定义输入的大小上限(字节)
+	CustomRunMaxInputSize = 1 << 20
+)
+
+// CustomRun 以用户提供的输入运行源代码, 不与标准答案比较
+//
+// CustomRun 实现了 Submission, 通过评测队列运行以限制同时运行的容器数.
+// 结果的 Verdict 为 CE/TLE/MLE/RE 之一, 正常退出时为空.
+type CustomRun struct {
+	Evaluator *Evaluator
+	Language  *LanguageConfig
+	Source    []byte
+	Input     []byte
+
+	id     string
+	result *types.JudgeResult
+	err    error
+	done   chan struct{}
+}
+
+// NewCustomRun 创建自定义输入运行
+func NewCustomRun(evaluator *Evaluator, lang *LanguageConfig, src, input []byte) *CustomRun {
+	return &CustomRun{
+		Evaluator: evaluator,
+		Language:  lang,
+		Source:    src,
+		Input:     input,
+		id:        "run-" + uuid.NewString(),
+		done:      make(chan struct{}),
+	}
+}
+
+// ID 运行ID
+func (r *CustomRun) ID() string {
+	return r.id
+}
+
+// Judge 编译并运行
+func (r *CustomRun) Judge(ctx context.Context) {
+	defer close(r.done)
+
+	binary, _, err := r.Evaluator.Compile(ctx, r.Source, *r.Language)
+	if err != nil {
+		var ce *CompileError
+		if errors.As(err, &ce) {
+			r.result = compileErrorResult(ce)
+			truncateOutput(r.result)
+			return
+		}
+		r.err = err
+		return
+	}
+
+	r.result, r.err = r.Evaluator.runBinary(ctx, binary, r.Input, &RunConfig{
+		Language:      r.Language,
+		TimeLimitMs:   CustomRunTimeLimitMs,
+		MemoryLimitKB: CustomRunMemoryLimitKB,
+		OutputLimitKB: CustomRunMaxOutput / 1024,
+	})
+}
+
+// Wait 等待运行结束, ctx 结束时返回 ctx.Err()
+func (r *CustomRun) Wait(ctx context.Context) (*types.JudgeResult, error) {
+	select {
+	case <-r.done:
+		return r.result, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func truncateOutput(res *types.JudgeResult) {
+	if len(res.Stdout) > CustomRunMaxOutput {
+		res.Stdout = res.Stdout[:CustomRunMaxOutput]
+	}
+	if len(res.Stderr) > CustomRunMaxOutput {
+		res.Stderr = res.Stderr[:CustomRunMaxOutput]
+	}
+}
@@ -0,0 +1,144 @@
+package judge
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/rs/zerolog/log"
+)
+
+// 难度计算的默认配置
+const (
+	DefaultDifficultyRefresh = 10 * time.Minute
+	// TrendingWindow 统计近期提交速度的时间窗口
+	TrendingWindow = 24 * time.Hour
+	// minRatedSubmitters 提交人数少于该值时不计算难度
+	minRatedSubmitters = 3
+	// referenceSolveTime 中位解题时间达到该值时, 解题时间一项取满分
+	referenceSolveTime = 2 * time.Hour
+)
+
+// ProblemStatsSource 题目提交统计的来源, DatabaseService 实现了该接口
+type ProblemStatsSource interface {
+	GetProblemStats(since time.Time) (map[string]*types.ProblemStats, error)
+}
+
+// TrendingProblem 近期提交速度
+type TrendingProblem struct {
+	ProblemID         string  `json:"id"`
+	RecentSubmissions int     `json:"recent_submissions"`
+	Velocity          float64 `json:"velocity"` // 每小时提交数
+}
+
+// DifficultyTracker 定期根据提交历史计算题目难度和近期热度
+type DifficultyTracker struct {
+	source ProblemStatsSource
+
+	mu       sync.RWMutex
+	ratings  map[string]float64
+	trending []TrendingProblem
+}
+
+// NewDifficultyTracker 创建难度计算器
+func NewDifficultyTracker(source ProblemStatsSource) *DifficultyTracker {
+	return &DifficultyTracker{
+		source:  source,
+		ratings: make(map[string]float64),
+	}
+}
+
+// DifficultyRating 根据通过率和中位解题时间计算难度, 取值 1-10
+//
+// 通过率占70%, 解题时间占30%. 提交人数过少时返回0.
+func DifficultyRating(st *types.ProblemStats) float64 {
+	if st.Submitters < minRatedSubmitters {
+		return 0
+	}
+	timeFactor := math.Min(1, float64(st.MedianSolveTime)/float64(referenceSolveTime))
+	if st.Solvers == 0 {
+		timeFactor = 1
+	}
+	rating := 1 + 9*(0.7*(1-st.AcceptanceRate())+0.3*timeFactor)
+	return math.Round(rating*10) / 10
+}
+
+// Refresh 重新计算所有题目的难度和热度
+func (t *DifficultyTracker) Refresh() error {
+	stats, err := t.source.GetProblemStats(time.Now().Add(-TrendingWindow))
+	if err != nil {
+		return err
+	}
+
+	ratings := make(map[string]float64, len(stats))
+	trending := make([]TrendingProblem, 0, len(stats))
+	for id, st := range stats {
+		ratings[id] = DifficultyRating(st)
+		if st.RecentSubmissions > 0 {
+			trending = append(trending, TrendingProblem{
+				ProblemID:         id,
+				RecentSubmissions: st.RecentSubmissions,
+				Velocity:          float64(st.RecentSubmissions) / TrendingWindow.Hours(),
+			})
+		}
+	}
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].RecentSubmissions != trending[j].RecentSubmissions {
+			return trending[i].RecentSubmissions > trending[j].RecentSubmissions
+		}
+		return trending[i].ProblemID < trending[j].ProblemID
+	})
+
+	t.mu.Lock()
+	t.ratings = ratings
+	t.trending = trending
+	t.mu.Unlock()
+
+	log.Debug().Int("problems", len(stats)).Msg("difficulty ratings refreshed")
+	return nil
+}
+
+// Start 立即计算一次, 之后每隔 interval 重新计算, 直到 ctx 结束
+func (t *DifficultyTracker) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultDifficultyRefresh
+	}
+
+	err := t.Refresh()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to refresh difficulty ratings")
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := t.Refresh()
+				if err != nil {
+					log.Warn().Err(err).Msg("failed to refresh difficulty ratings")
+				}
+			}
+		}
+	}()
+}
+
+// Rating 题目的难度, 没有数据时为0
+func (t *DifficultyTracker) Rating(problemID string) float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.ratings[problemID]
+}
+
+// Trending 按近期提交数降序排列的题目, 不含近期没有提交的题目
+func (t *DifficultyTracker) Trending() []TrendingProblem {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.trending
+}
@@ -0,0 +1,536 @@
+package judge
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrhaoxx/SOJ/metrics"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// 分布式评测使用的Redis键和消费组
+const (
+	distributedJobStream    = "soj:judge:jobs"
+	distributedResultStream = "soj:judge:results"
+	distributedWorkerSet    = "soj:judge:workers"
+	distributedWorkerGroup  = "soj-judge-workers"
+	distributedResultGroup  = "soj-judge-dispatchers"
+)
+
+const (
+	// WorkerHeartbeatInterval worker 上报心跳的间隔
+	WorkerHeartbeatInterval = 10 * time.Second
+	// WorkerHeartbeatTimeout 超过该时间没有心跳的worker被视为离线
+	WorkerHeartbeatTimeout = 30 * time.Second
+
+	// distributedBlock 读取流时最长的阻塞时间
+	distributedBlock = 5 * time.Second
+	// distributedStreamMaxLen 流的近似长度上限, 超出后删除最早的消息
+	distributedStreamMaxLen = 100000
+
+	// resultRetryInitialBackoff/resultRetryMaxBackoff 最终结果写入失败时首次重试前的等待时间和上限, 每次重试翻倍
+	resultRetryInitialBackoff = 100 * time.Millisecond
+	resultRetryMaxBackoff     = 30 * time.Second
+)
+
+// ErrNoLiveWorkers 没有在线的评测节点, 调用方应改为在本地评测
+var ErrNoLiveWorkers = errors.New("no live judge workers")
+
+// distributedJob 通过任务流发送给评测节点的提交
+type distributedJob struct {
+	ID        string `json:"id"`
+	ProblemID string `json:"problem_id"`
+	Language  string `json:"language"`
+	Source    string `json:"source,omitempty"`
+	Archive   []byte `json:"archive,omitempty"`
+	MainFile  string `json:"main_file,omitempty"`
+}
+
+// distributedResult 评测节点通过结果流发回的状态更新
+type distributedResult struct {
+	ID     string             `json:"id"`
+	Status string             `json:"status"`
+	Result *types.JudgeResult `json:"result,omitempty"`
+}
+
+// ensureGroup 创建消费组, 已存在时忽略
+func ensureGroup(ctx context.Context, client redis.UniversalClient, stream, group string) error {
+	err := client.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrap(err, "failed to create consumer group "+group)
+	}
+	return nil
+}
+
+// liveWorkers 返回最近 WorkerHeartbeatTimeout 内有心跳的worker
+func liveWorkers(ctx context.Context, client redis.UniversalClient) ([]string, error) {
+	since := time.Now().Add(-WorkerHeartbeatTimeout).UnixMilli()
+	return client.ZRangeByScore(ctx, distributedWorkerSet, &redis.ZRangeBy{
+		Min: strconv.FormatInt(since, 10),
+		Max: "+inf",
+	}).Result()
+}
+
+// defaultNodeName 以主机名和进程号作为节点名
+func defaultNodeName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+// DistributedDispatcher 将提交写入Redis任务流, 由多个评测节点上的 DistributedWorker 评测
+//
+// 评测节点通过结果流发回状态更新, 由 Start 启动的协程写入 Store.
+// 离线worker(超过 WorkerHeartbeatTimeout 没有心跳)已领取但未完成的任务会被转移给在线的worker.
+type DistributedDispatcher struct {
+	client   redis.UniversalClient
+	store    types.SubmissionStore
+	progress *ProgressHub
+	name     string
+}
+
+// NewDistributedDispatcher 创建分布式评测调度器, progress 可以为nil
+func NewDistributedDispatcher(client redis.UniversalClient, store types.SubmissionStore, progress *ProgressHub) *DistributedDispatcher {
+	return &DistributedDispatcher{
+		client:   client,
+		store:    store,
+		progress: progress,
+		name:     defaultNodeName(),
+	}
+}
+
+// LiveWorkers 返回在线的worker
+func (d *DistributedDispatcher) LiveWorkers(ctx context.Context) ([]string, error) {
+	return liveWorkers(ctx, d.client)
+}
+
+// Dispatch 将提交写入任务流, 没有在线的worker时返回 ErrNoLiveWorkers
+func (d *DistributedDispatcher) Dispatch(ctx context.Context, sub *types.Submission) error {
+	live, err := d.LiveWorkers(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list judge workers")
+	}
+	if len(live) == 0 {
+		return ErrNoLiveWorkers
+	}
+
+	job, err := json.Marshal(distributedJob{
+		ID:        sub.ID,
+		ProblemID: sub.ProblemID,
+		Language:  sub.Language,
+		Source:    sub.SourceCode,
+		Archive:   sub.Archive,
+		MainFile:  sub.MainFile,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = d.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: distributedJobStream,
+		MaxLen: distributedStreamMaxLen,
+		Approx: true,
+		Values: map[string]any{"job": job},
+	}).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to dispatch submission")
+	}
+	log.Debug().Str("id", sub.ID).Int("workers", len(live)).Msg("submission dispatched")
+	return nil
+}
+
+// Start 创建消费组, 并启动处理结果和转移离线worker任务的协程, ctx 结束时停止
+func (d *DistributedDispatcher) Start(ctx context.Context) error {
+	err := ensureGroup(ctx, d.client, distributedJobStream, distributedWorkerGroup)
+	if err != nil {
+		return err
+	}
+	err = ensureGroup(ctx, d.client, distributedResultStream, distributedResultGroup)
+	if err != nil {
+		return err
+	}
+
+	go d.consumeResults(ctx)
+	go func() {
+		ticker := time.NewTicker(WorkerHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.reclaim(ctx)
+			}
+		}
+	}()
+	log.Info().Str("name", d.name).Msg("distributed dispatcher started")
+	return nil
+}
+
+// consumeResults 读取结果流并写入 Store
+func (d *DistributedDispatcher) consumeResults(ctx context.Context) {
+	for ctx.Err() == nil {
+		streams, err := d.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    distributedResultGroup,
+			Consumer: d.name,
+			Streams:  []string{distributedResultStream, ">"},
+			Count:    16,
+			Block:    distributedBlock,
+		}).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Err(err).Msg("failed to read judge results")
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				d.handleResult(msg)
+				d.client.XAck(ctx, distributedResultStream, distributedResultGroup, msg.ID)
+			}
+		}
+	}
+}
+
+func (d *DistributedDispatcher) handleResult(msg redis.XMessage) {
+	raw, _ := msg.Values["result"].(string)
+	var res distributedResult
+	err := json.Unmarshal([]byte(raw), &res)
+	if err != nil {
+		log.Err(err).Str("message", msg.ID).Msg("invalid judge result")
+		return
+	}
+
+	err = d.store.UpdateResult(res.ID, res.Status, res.Result)
+	if err != nil {
+		log.Err(err).Str("id", res.ID).Msg("failed to update submission")
+	}
+
+	if d.progress != nil && (res.Status == types.SubmissionCompleted || res.Status == types.SubmissionFailed) {
+		ev := ProgressEvent{Type: ProgressDone, Status: res.Status, Result: res.Result}
+		if ev.Result == nil {
+			ev.Result = &types.JudgeResult{}
+		}
+		d.progress.Publish(res.ID, ev)
+	}
+}
+
+// reclaim 将离线worker已领取但未确认的任务转移给在线的worker
+func (d *DistributedDispatcher) reclaim(ctx context.Context) {
+	live, err := d.LiveWorkers(ctx)
+	if err != nil || len(live) == 0 {
+		return
+	}
+	alive := make(map[string]bool, len(live))
+	for _, w := range live {
+		alive[w] = true
+	}
+
+	pending, err := d.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: distributedJobStream,
+		Group:  distributedWorkerGroup,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	if err != nil {
+		log.Err(err).Msg("failed to list pending judge jobs")
+		return
+	}
+
+	n := 0
+	for _, p := range pending {
+		if alive[p.Consumer] {
+			continue
+		}
+		target := live[n%len(live)]
+		n++
+		err = d.client.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   distributedJobStream,
+			Group:    distributedWorkerGroup,
+			Consumer: target,
+			Messages: []string{p.ID},
+		}).Err()
+		if err != nil {
+			log.Err(err).Str("message", p.ID).Msg("failed to reclaim judge job")
+			continue
+		}
+		log.Warn().Str("message", p.ID).Str("from", p.Consumer).Str("to", target).Msg("judge job reassigned from offline worker")
+	}
+}
+
+// DistributedWorker 从Redis任务流读取提交, 使用本地的Docker评测, 并将结果写入结果流
+//
+// 评测节点需要与调度器有相同的题目, 测试点和语言配置.
+type DistributedWorker struct {
+	Evaluator *Evaluator
+	Problems  ProblemStore
+	TestCases TestCaseStore
+	// MaxArchiveSize 多文件提交解压后的总大小上限, 见 ParseMultiFileSubmission
+	MaxArchiveSize int64
+
+	client redis.UniversalClient
+	name   string
+
+	// wg 等待所有消费者退出, cancelJobs 取消正在评测的任务, 见 Shutdown
+	wg         sync.WaitGroup
+	cancelJobs context.CancelFunc
+}
+
+// NewDistributedWorker 创建评测节点, name 为空时使用主机名和进程号
+func NewDistributedWorker(client redis.UniversalClient, name string, evaluator *Evaluator, problems ProblemStore, testCases TestCaseStore) *DistributedWorker {
+	if name == "" {
+		name = defaultNodeName()
+	}
+	return &DistributedWorker{
+		Evaluator: evaluator,
+		Problems:  problems,
+		TestCases: testCases,
+		client:    client,
+		name:      name,
+	}
+}
+
+// Start 启动 concurrency 个消费者和心跳协程, ctx 结束时注销并停止读取新任务
+//
+// 每个消费者同时只评测一个提交, 以 {name}-{序号} 作为消费者名和心跳的成员名.
+// ctx 结束时正在评测的任务不会被取消, 调用 Shutdown 等待其完成.
+func (w *DistributedWorker) Start(ctx context.Context, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = DefaultJudgeWorkers
+	}
+	err := ensureGroup(ctx, w.client, distributedJobStream, distributedWorkerGroup)
+	if err != nil {
+		return err
+	}
+
+	consumers := make([]string, concurrency)
+	for i := range consumers {
+		consumers[i] = w.name + "-" + strconv.Itoa(i)
+	}
+
+	w.heartbeat(ctx, consumers)
+	go func() {
+		ticker := time.NewTicker(WorkerHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				members := make([]any, len(consumers))
+				for i, c := range consumers {
+					members[i] = c
+				}
+				w.client.ZRem(context.Background(), distributedWorkerSet, members...)
+				return
+			case <-ticker.C:
+				w.heartbeat(ctx, consumers)
+			}
+		}
+	}()
+
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	w.cancelJobs = cancel
+	for _, c := range consumers {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.run(ctx, jobCtx, c)
+		}()
+	}
+	log.Info().Str("name", w.name).Int("concurrency", concurrency).Msg("distributed worker started")
+	return nil
+}
+
+// Shutdown 等待 Start 的 ctx 结束后正在评测的任务完成, 应在该 ctx 结束后调用
+//
+// ctx 结束时不再等待, 取消正在评测的任务并返回 ctx.Err(). 被取消的任务未被确认,
+// 由调度器在该worker离线后转移给其他worker.
+func (w *DistributedWorker) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info().Str("name", w.name).Msg("distributed worker drained")
+		return nil
+	case <-ctx.Done():
+		if w.cancelJobs != nil {
+			w.cancelJobs()
+		}
+		log.Warn().Str("name", w.name).Msg("distributed worker shutdown timed out")
+		return ctx.Err()
+	}
+}
+
+func (w *DistributedWorker) heartbeat(ctx context.Context, consumers []string) {
+	now := float64(time.Now().UnixMilli())
+	members := make([]redis.Z, len(consumers))
+	for i, c := range consumers {
+		members[i] = redis.Z{Score: now, Member: c}
+	}
+	err := w.client.ZAdd(ctx, distributedWorkerSet, members...).Err()
+	if err != nil && ctx.Err() == nil {
+		log.Err(err).Str("name", w.name).Msg("failed to send worker heartbeat")
+	}
+}
+
+// run 消费者的主循环, ctx 结束后不再读取新任务, 已读取的任务以 jobCtx 评测
+//
+// 先处理分配给自己但尚未确认的任务(上次运行遗留或从离线worker转移而来), 没有时再阻塞读取新任务.
+func (w *DistributedWorker) run(ctx, jobCtx context.Context, consumer string) {
+	for ctx.Err() == nil {
+		msgs, err := w.read(ctx, consumer, "0", -1)
+		if err == nil && len(msgs) == 0 {
+			msgs, err = w.read(ctx, consumer, ">", distributedBlock)
+		}
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Err(err).Str("consumer", consumer).Msg("failed to read judge jobs")
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			if w.handle(jobCtx, msg) {
+				w.client.XAck(jobCtx, distributedJobStream, distributedWorkerGroup, msg.ID)
+			}
+		}
+	}
+}
+
+func (w *DistributedWorker) read(ctx context.Context, consumer, id string, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := w.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    distributedWorkerGroup,
+		Consumer: consumer,
+		Streams:  []string{distributedJobStream, id},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	var msgs []redis.XMessage
+	for _, s := range streams {
+		msgs = append(msgs, s.Messages...)
+	}
+	return msgs, nil
+}
+
+// handle 评测一个任务, 返回是否可以确认该任务
+//
+// 最终结果的写入会一直重试, 只有 ctx 被取消导致结果未能写入时才不确认, 由重启后的worker重新评测.
+func (w *DistributedWorker) handle(ctx context.Context, msg redis.XMessage) bool {
+	raw, _ := msg.Values["job"].(string)
+	var job distributedJob
+	err := json.Unmarshal([]byte(raw), &job)
+	if err != nil {
+		log.Err(err).Str("message", msg.ID).Msg("invalid judge job")
+		return true
+	}
+
+	store := &streamResultStore{client: w.client, ctx: ctx}
+	problem, ok := w.Problems.GetProblem(job.ProblemID)
+	if !ok {
+		log.Error().Str("id", job.ID).Str("problem", job.ProblemID).Msg("problem not found on worker")
+		store.UpdateResult(job.ID, types.SubmissionFailed, &types.JudgeResult{Verdict: types.VerdictSystemError, Msg: "problem not found on judge worker"})
+		return store.err == nil
+	}
+	var lang *LanguageConfig
+	if langs := w.Evaluator.Languages(); langs != nil {
+		lang, ok = langs.GetByID(job.Language)
+	}
+	if lang == nil {
+		log.Error().Str("id", job.ID).Str("language", job.Language).Msg("language not found on worker")
+		store.UpdateResult(job.ID, types.SubmissionFailed, &types.JudgeResult{Verdict: types.VerdictSystemError, Msg: "language not found on judge worker"})
+		return store.err == nil
+	}
+
+	sub := &SourceSubmission{
+		Evaluator: w.Evaluator,
+		Store:     store,
+		TestCases: w.TestCases,
+		Submission: &types.Submission{
+			ID:         job.ID,
+			ProblemID:  job.ProblemID,
+			Language:   job.Language,
+			SourceCode: job.Source,
+			Archive:    job.Archive,
+			MainFile:   job.MainFile,
+		},
+		Problem:        &problem,
+		Language:       lang,
+		MaxArchiveSize: w.MaxArchiveSize,
+	}
+	sub.Judge(ctx)
+	metrics.SubmissionsTotal.WithLabelValues(string(sub.Verdict())).Inc()
+	return store.err == nil
+}
+
+// streamResultStore 将 SourceSubmission 的状态更新写入结果流
+//
+// 只实现了 UpdateResult, 其余方法不会被 SourceSubmission 调用.
+type streamResultStore struct {
+	types.SubmissionStore
+
+	client redis.UniversalClient
+	ctx    context.Context
+	// err 最后一次写入最终状态时的错误
+	err error
+}
+
+// UpdateResult 将状态更新写入结果流
+//
+// 中间状态只写入一次. 最终状态写入失败时以指数退避重试, 直到成功或 ctx 被取消,
+// 以免任务因未被确认而被重新读取并重复评测.
+func (s *streamResultStore) UpdateResult(id string, status string, result *types.JudgeResult) error {
+	payload, err := json.Marshal(distributedResult{ID: id, Status: status, Result: result})
+	if err != nil {
+		return err
+	}
+	add := func() error {
+		return s.client.XAdd(s.ctx, &redis.XAddArgs{
+			Stream: distributedResultStream,
+			MaxLen: distributedStreamMaxLen,
+			Approx: true,
+			Values: map[string]any{"result": payload},
+		}).Err()
+	}
+	if status != types.SubmissionCompleted && status != types.SubmissionFailed {
+		return add()
+	}
+
+	backoff := resultRetryInitialBackoff
+	for {
+		err = add()
+		if err == nil || s.ctx.Err() != nil {
+			break
+		}
+		log.Warn().Err(err).Str("id", id).Dur("backoff", backoff).Msg("failed to write judge result, retrying")
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, resultRetryMaxBackoff)
+	}
+	s.err = err
+	return err
+}
@@ -1,6 +1,7 @@
 package judge
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
@@ -12,6 +13,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/mrhaoxx/SOJ/file_transfer"
 	"github.com/mrhaoxx/SOJ/types"
 	"github.com/pkg/errors"
 
@@ -24,20 +26,18 @@ import (
 // Evaluator 评测器
 type Evaluator struct {
 	cfg       *types.Config
-	docker    DockerInterface
+	docker    file_transfer.DockerServiceInterface
 	dbService *types.DatabaseService
+	languages *LanguageRegistry
 }
 
 // DockerInterface Docker接口
-type DockerInterface interface {
-	RunImage(name string, user string, hostname string, image string, workdir string, mounts []mount.Mount, mask bool, ReadonlyRootfs bool, networkdisabled bool, timeout int, networkhosted bool, env []string) (ok bool, id string)
-	CleanContainer(id string)
-	ExecContainer(id string, cmd string, timeout int, stdout, stderr io.Writer, env []string, privileged bool) (int, string, error)
-	GetContainerLogs(id string) (string, error)
-}
+//
+// Deprecated: 使用 file_transfer.DockerServiceInterface
+type DockerInterface = file_transfer.DockerServiceInterface
 
 // NewEvaluator 创建新的评测器
-func NewEvaluator(cfg *types.Config, docker DockerInterface, dbService *types.DatabaseService) *Evaluator {
+func NewEvaluator(cfg *types.Config, docker file_transfer.DockerServiceInterface, dbService *types.DatabaseService) *Evaluator {
 	return &Evaluator{
 		cfg:       cfg,
 		docker:    docker,
@@ -45,32 +45,44 @@ func NewEvaluator(cfg *types.Config, docker DockerInterface, dbService *types.Da
 	}
 }
 
+// SetLanguages 设置按语言评测时使用的语言配置表
+func (e *Evaluator) SetLanguages(languages *LanguageRegistry) {
+	e.languages = languages
+}
+
+// Languages 返回语言配置表, 未设置时为nil
+func (e *Evaluator) Languages() *LanguageRegistry {
+	return e.languages
+}
+
 // RunJudge 运行评测
-func (e *Evaluator) RunJudge(ctx *types.SubmitCtx, problem *types.Problem) {
-	log.Debug().Timestamp().Str("id", ctx.ID).Str("user", ctx.User).Str("problem", ctx.Problem).Msg("run judge")
+//
+// ctx 被取消时正在运行的评测步骤被结束, 评测容器仍会被清理.
+func (e *Evaluator) RunJudge(ctx context.Context, sub *types.SubmitCtx, problem *types.Problem) {
+	log.Debug().Timestamp().Str("id", sub.ID).Str("user", sub.User).Str("problem", sub.Problem).Msg("run judge")
 
 	var start_time = time.Now()
 	var err error
 
 	defer func() {
-		log.Debug().Timestamp().Str("id", ctx.ID).Str("status", ctx.Status).Str("judgemsg", ctx.Msg).AnErr("err", err).Msg("judge finished")
-		ctx.Userface.Println(types.GetTime(start_time), "Submission", types.ColorizeStatus(ctx.Status))
-		close(ctx.Running)
-		e.dbService.UpdateSubmit(ctx)
+		log.Debug().Timestamp().Str("id", sub.ID).Str("status", sub.Status).Str("judgemsg", sub.Msg).AnErr("err", err).Msg("judge finished")
+		sub.Userface.Println(types.GetTime(start_time), "Submission", types.ColorizeStatus(sub.Status))
+		close(sub.Running)
+		e.dbService.UpdateSubmit(sub)
 	}()
 
-	ctx.Userface.Println("Submission ID:", aurora.Magenta(ctx.ID))
+	sub.Userface.Println("Submission ID:", aurora.Magenta(sub.ID))
 
-	ctx.SetStatus("prep_dirs")
-	e.dbService.UpdateSubmit(ctx)
+	sub.SetStatus("prep_dirs")
+	e.dbService.UpdateSubmit(sub)
 
-	var submits_dir = path.Join(ctx.Workdir, "submits")
-	var workflow_dir = path.Join(ctx.Workdir, "work")
+	var submits_dir = path.Join(sub.Workdir, "submits")
+	var workflow_dir = path.Join(sub.Workdir, "work")
 
-	var rsubmits_dir = path.Join(ctx.RealWorkdir, "submits")
-	var rworkflow_dir = path.Join(ctx.RealWorkdir, "work")
+	var rsubmits_dir = path.Join(sub.RealWorkdir, "submits")
+	var rworkflow_dir = path.Join(sub.RealWorkdir, "work")
 
-	err = os.Mkdir(ctx.Workdir, 0700)
+	err = os.Mkdir(sub.Workdir, 0700)
 	if err != nil {
 		goto workdir_creation_failed
 	}
@@ -82,7 +94,7 @@ func (e *Evaluator) RunJudge(ctx *types.SubmitCtx, problem *types.Problem) {
 	if err != nil {
 		goto workdir_creation_failed
 	}
-	err = os.Chown(ctx.Workdir, e.cfg.SubmitUid, e.cfg.SubmitGid)
+	err = os.Chown(sub.Workdir, e.cfg.SubmitUid, e.cfg.SubmitGid)
 	if err != nil {
 		goto workdir_creation_failed
 	}
@@ -98,29 +110,29 @@ func (e *Evaluator) RunJudge(ctx *types.SubmitCtx, problem *types.Problem) {
 	goto workdir_created
 
 workdir_creation_failed:
-	ctx.SetStatus("failed").SetMsg("failed to create submit workdir")
-	e.dbService.UpdateSubmit(ctx)
+	sub.SetStatus("failed").SetMsg("failed to create submit workdir")
+	e.dbService.UpdateSubmit(sub)
 	return
 
 workdir_created:
-	log.Debug().Timestamp().Str("id", ctx.ID).Str("submit_workdir", ctx.Workdir).Msg("created working dirs")
+	log.Debug().Timestamp().Str("id", sub.ID).Str("submit_workdir", sub.Workdir).Msg("created working dirs")
 
-	ctx.Userface.Println(types.GetTime(start_time), "Submitting files")
+	sub.Userface.Println(types.GetTime(start_time), "Submitting files")
 
-	ctx.SetStatus("prep_files")
-	e.dbService.UpdateSubmit(ctx)
+	sub.SetStatus("prep_files")
+	e.dbService.UpdateSubmit(sub)
 
 	for _, submit := range problem.Submits {
 		if !submit.IsDir {
-			err = e.submitFile(ctx, submits_dir, submit.Path)
+			err = e.submitFile(sub, submits_dir, submit.Path)
 			if err != nil {
-				ctx.SetStatus("failed").SetMsg("failed to copy submit file " + strconv.Quote(submit.Path))
-				e.dbService.UpdateSubmit(ctx)
-				ctx.Userface.Println("	*", aurora.Yellow(submit.Path), ":", aurora.Red("failed"))
+				sub.SetStatus("failed").SetMsg("failed to copy submit file " + strconv.Quote(submit.Path))
+				e.dbService.UpdateSubmit(sub)
+				sub.Userface.Println("	*", aurora.Yellow(submit.Path), ":", aurora.Red("failed"))
 				return
 			}
 		} else {
-			dir_path := ctx.SubmitDir + "/" + submit.Path
+			dir_path := sub.SubmitDir + "/" + submit.Path
 			err = filepath.WalkDir(dir_path, func(path string, info fs.DirEntry, err error) error {
 				if err != nil {
 					return errors.Wrap(err, "failed to execute filepath.WalkDir")
@@ -129,25 +141,28 @@ workdir_created:
 					if filepath.IsAbs(path) {
 						path, _ = filepath.Rel(dir_path, path)
 					}
-					return e.submitFile(ctx, submits_dir, submit.Path+"/"+path)
+					return e.submitFile(sub, submits_dir, submit.Path+"/"+path)
 				}
 				return nil
 			})
 			if err != nil {
-				ctx.SetStatus("failed").SetMsg("failed to copy submit directory " + strconv.Quote(submit.Path))
-				e.dbService.UpdateSubmit(ctx)
-				ctx.Userface.Println("	*", aurora.Yellow(submit.Path), ":", aurora.Red("failed"))
+				sub.SetStatus("failed").SetMsg("failed to copy submit directory " + strconv.Quote(submit.Path))
+				e.dbService.UpdateSubmit(sub)
+				sub.Userface.Println("	*", aurora.Yellow(submit.Path), ":", aurora.Red("failed"))
 				return
 			}
 		}
 	}
 
-	log.Debug().Timestamp().Str("id", ctx.ID).Msg("copied submit files")
+	log.Debug().Timestamp().Str("id", sub.ID).Msg("copied submit files")
+
+	sub.Userface.Println(types.GetTime(start_time), "Running Judge workflows")
 
-	ctx.Userface.Println(types.GetTime(start_time), "Running Judge workflows")
+	// 所有工作流容器中的内存峰值, 评测结果未给出内存用量时使用
+	var peak_memory uint64
 
-	ctx.SetStatus("run_workflow")
-	e.dbService.UpdateSubmit(ctx)
+	sub.SetStatus("run_workflow")
+	e.dbService.UpdateSubmit(sub)
 
 	for idx, workflow := range problem.Workflow {
 		var _mount = []mount.Mount{
@@ -169,8 +184,8 @@ workdir_created:
 			"SOJ_WORK_DIR=/work",
 			"SOJ_REAL_WORKDIR=" + rworkflow_dir,
 			"SOJ_REAL_SUBMITDIR=" + rsubmits_dir,
-			"SOJ_PROBLEM=" + ctx.Problem,
-			"SOJ_SUBMIT=" + ctx.ID,
+			"SOJ_PROBLEM=" + sub.Problem,
+			"SOJ_SUBMIT=" + sub.ID,
 			"SOJ_WORK_UID=" + strconv.Itoa(e.cfg.SubmitUid),
 			"SOJ_WORK_GID=" + strconv.Itoa(e.cfg.SubmitGid),
 		}
@@ -184,9 +199,9 @@ workdir_created:
 			})
 		}
 
-		ctx.SetStatus("run_workflow-" + strconv.Itoa(idx))
-		e.dbService.UpdateSubmit(ctx)
-		ctx.Userface.Println(types.GetTime(start_time), "running", "workflow", strconv.Itoa(idx+1), "/", len(problem.Workflow))
+		sub.SetStatus("run_workflow-" + strconv.Itoa(idx))
+		e.dbService.UpdateSubmit(sub)
+		sub.Userface.Println(types.GetTime(start_time), "running", "workflow", strconv.Itoa(idx+1), "/", len(problem.Workflow))
 
 		stepshows := map[int]struct{}{}
 		stepprivillege := map[int]struct{}{}
@@ -203,23 +218,77 @@ workdir_created:
 			usr = "0"
 		}
 
-		ok, cid := e.docker.RunImage("soj-judge-"+ctx.ID+"-"+strconv.Itoa(idx+1), usr, "soj-judgement", workflow.Image, "/work", _mount, false, false, workflow.DisableNetwork, workflow.Timeout, workflow.NetworkHostMode, envs)
+		var seccomp string
+		seccomp, err = file_transfer.ResolveSeccompProfile(workflow.Seccomp)
+		if err != nil {
+			log.Error().Timestamp().Str("id", sub.ID).Str("seccomp", workflow.Seccomp).Err(err).Msg("failed to load seccomp profile")
+			sub.SetStatus("failed").SetMsg("failed to load seccomp profile")
+			e.dbService.UpdateSubmit(sub)
+			return
+		}
+
+		runCfg := &file_transfer.RunConfig{
+			Name:     "soj-judge-" + sub.ID + "-" + strconv.Itoa(idx+1),
+			Image:    workflow.Image,
+			User:     usr,
+			Hostname: "soj-judgement",
+			Workdir:  "/work",
+			Env:      envs,
+			Mounts:   _mount,
+			Labels: map[string]string{
+				file_transfer.LabelSubmission: sub.ID,
+				file_transfer.LabelProblem:    sub.Problem,
+				file_transfer.LabelUser:       sub.User,
+			},
+			TmpfsMounts:     workflow.Tmpfs,
+			NetworkDisabled: workflow.DisableNetwork,
+			NetworkHost:     workflow.NetworkHostMode,
+			Timeout:         workflow.Timeout,
+			CPUQuota:        workflow.CPUQuota,
+			CPUPeriod:       workflow.CPUPeriod,
+			NanoCPUs:        int64(workflow.CPUs * 1e9),
+			MemoryLimit:     workflow.MemoryLimit,
+			PidsLimit:       workflow.PidsLimit,
+			SeccompProfile:  seccomp,
+			AppArmorProfile: workflow.AppArmor,
+			OomScoreAdj:     file_transfer.DefaultOomScoreAdj,
+			BlkioWeight:     file_transfer.DefaultBlkioWeight,
+		}
+
+		var cid string
+		cid, err = e.docker.RunImage(ctx, runCfg)
 
-		if !ok {
-			ctx.SetStatus("failed").SetMsg("failed to run judge container")
-			e.dbService.UpdateSubmit(ctx)
+		if errors.Is(err, file_transfer.ErrImageNotFound) {
+			// 新部署的评测镜像在本节点上尚不存在, 拉取后重试
+			sub.Userface.Println(types.GetTime(start_time), "pulling", "judge image", aurora.Yellow(workflow.Image))
+			if perr := e.docker.PullImageIfMissing(ctx, workflow.Image); perr != nil {
+				log.Info().Timestamp().Str("id", sub.ID).Str("image", workflow.Image).AnErr("err", perr).Msg("failed to pull judge image")
+			} else {
+				cid, err = e.docker.RunImage(ctx, runCfg)
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, file_transfer.ErrImageNotFound) {
+				sub.SetStatus("failed").SetMsg("judge image " + strconv.Quote(workflow.Image) + " not found")
+			} else if errors.Is(err, file_transfer.ErrNameConflict) {
+				sub.SetStatus("failed").SetMsg("judge container for workflow " + strconv.Itoa(idx+1) + " already exists")
+			} else {
+				sub.SetStatus("failed").SetMsg("failed to run judge container")
+			}
+			e.dbService.UpdateSubmit(sub)
 			return
 		}
 
-		defer e.docker.CleanContainer(cid)
+		defer e.docker.CleanContainer(context.WithoutCancel(ctx), cid, file_transfer.DefaultStopGrace)
 
 		steps := make([]types.WorkflowStepResult, len(workflow.Steps))
 
 		for sidx, step := range workflow.Steps {
-			ctx.SetStatus("run_workflow-" + strconv.Itoa(idx) + "_" + strconv.Itoa(sidx))
-			e.dbService.UpdateSubmit(ctx)
+			sub.SetStatus("run_workflow-" + strconv.Itoa(idx) + "_" + strconv.Itoa(sidx))
+			e.dbService.UpdateSubmit(sub)
 
-			ctx.Userface.Println(types.GetTime(start_time), "running", "workflow", strconv.Itoa(idx+1), "step", strconv.Itoa(sidx+1), "/", len(workflow.Steps))
+			sub.Userface.Println(types.GetTime(start_time), "running", "workflow", strconv.Itoa(idx+1), "step", strconv.Itoa(sidx+1), "/", len(workflow.Steps))
 
 			_, ok := stepshows[sidx+1]
 			_, priv := stepprivillege[sidx+1]
@@ -227,21 +296,29 @@ workdir_created:
 			var rr io.Writer = nil
 			var re io.Writer = nil
 			if ok {
-				ctx.Userface.Println("	$", aurora.Yellow(step))
-				rr = &ColoredIO{ctx.Userface, aurora.BlueFg}
-				re = &ColoredIO{ctx.Userface, aurora.RedFg}
+				sub.Userface.Println("	$", aurora.Yellow(step))
+				rr = &ColoredIO{sub.Userface, aurora.BlueFg}
+				re = &ColoredIO{sub.Userface, aurora.RedFg}
 			}
-			ec, logs, err := e.docker.ExecContainer(cid, step, workflow.Timeout, rr, re, envs, priv)
+			ec, logs, err := e.docker.ExecContainer(ctx, cid, step, workflow.Timeout, nil, rr, re, envs, priv, workflow.Workdir, "")
 
 			if ok {
-				ctx.Userface.Println(aurora.Gray(15, "exit code:"), aurora.Yellow(ec))
+				sub.Userface.Println(aurora.Gray(15, "exit code:"), aurora.Yellow(ec))
+			}
+
+			if errors.Is(err, file_transfer.ErrTimeLimitExceeded) {
+				sub.SetStatus("failed").SetMsg("time limit exceeded in judge " + strconv.Itoa(idx+1) + " step " + strconv.Itoa(sidx+1))
+				e.dbService.UpdateSubmit(sub)
+
+				log.Info().Timestamp().Str("id", sub.ID).Str("image", workflow.Image).Str("step", step).Int("timeout", workflow.Timeout).Str("logs", logs).Msg("judge step time limit exceeded")
+				return
 			}
 
 			if ec != 0 || err != nil {
-				ctx.SetStatus("failed").SetMsg("failed to run judge " + strconv.Itoa(idx+1) + " step " + strconv.Itoa(sidx+1))
-				e.dbService.UpdateSubmit(ctx)
+				sub.SetStatus("failed").SetMsg("failed to run judge " + strconv.Itoa(idx+1) + " step " + strconv.Itoa(sidx+1))
+				e.dbService.UpdateSubmit(sub)
 
-				log.Info().Timestamp().Str("id", ctx.ID).Str("image", workflow.Image).Str("step", step).Int("timeout", workflow.Timeout).AnErr("err", err).Str("logs", logs).Int("exitcode", ec).Msg("failed to run judge step")
+				log.Info().Timestamp().Str("id", sub.ID).Str("image", workflow.Image).Str("step", step).Int("timeout", workflow.Timeout).AnErr("err", err).Str("logs", logs).Int("exitcode", ec).Msg("failed to run judge step")
 				return
 			}
 
@@ -250,50 +327,60 @@ workdir_created:
 				ExitCode: ec,
 			}
 
-			e.dbService.UpdateSubmit(ctx)
-			log.Debug().Timestamp().Str("id", ctx.ID).Str("image", workflow.Image).Str("step", step).Int("timeout", workflow.Timeout).Str("logs", logs).Int("exitcode", ec).Msg("ran judge step")
+			e.dbService.UpdateSubmit(sub)
+			log.Debug().Timestamp().Str("id", sub.ID).Str("image", workflow.Image).Str("step", step).Int("timeout", workflow.Timeout).Str("logs", logs).Int("exitcode", ec).Msg("ran judge step")
+		}
+
+		if _, mem, serr := e.docker.ContainerStats(ctx, cid); serr == nil {
+			peak_memory = max(peak_memory, mem)
 		}
 
-		logs, err := e.docker.GetContainerLogs(cid)
+		stdout, stderr, err := e.docker.GetContainerLogsString(ctx, cid)
 		if err != nil {
-			ctx.SetStatus("failed").SetMsg("failed to get judge logs")
-			e.dbService.UpdateSubmit(ctx)
+			sub.SetStatus("failed").SetMsg("failed to get judge logs")
+			e.dbService.UpdateSubmit(sub)
 			return
 		}
 
-		ctx.WorkflowResults = append(ctx.WorkflowResults, types.WorkflowResult{
+		logs := stdout + stderr
+
+		sub.WorkflowResults = append(sub.WorkflowResults, types.WorkflowResult{
 			Success: true,
 			Logs:    logs,
 			Steps:   steps,
 		})
 
-		log.Debug().Timestamp().Any("mnt", _mount).Str("id", ctx.ID).Str("image", workflow.Image).Str("logs", logs).Msg("got judge logs")
+		log.Debug().Timestamp().Any("mnt", _mount).Str("id", sub.ID).Str("image", workflow.Image).Str("logs", logs).Msg("got judge logs")
 	}
 
-	ctx.SetStatus("collect_result")
-	e.dbService.UpdateSubmit(ctx)
+	sub.SetStatus("collect_result")
+	e.dbService.UpdateSubmit(sub)
 
 	var result_file = workflow_dir + "/result.json"
 
 	_result, err := os.ReadFile(result_file)
 
 	if err != nil {
-		log.Info().Timestamp().Str("id", ctx.ID).Str("result_file", result_file).AnErr("err", err).Msg("failed to read result file")
-		ctx.SetStatus("failed").SetMsg("failed to read result file")
-		e.dbService.UpdateSubmit(ctx)
+		log.Info().Timestamp().Str("id", sub.ID).Str("result_file", result_file).AnErr("err", err).Msg("failed to read result file")
+		sub.SetStatus("failed").SetMsg("failed to read result file")
+		e.dbService.UpdateSubmit(sub)
 		return
 	}
 
-	err = json.Unmarshal(_result, &ctx.JudgeResult)
+	err = json.Unmarshal(_result, &sub.JudgeResult)
 	if err != nil {
-		log.Info().Timestamp().Str("id", ctx.ID).Str("result_file", result_file).AnErr("err", err).Msg("failed to parse result file")
-		ctx.SetStatus("failed").SetMsg("failed to parse result file")
-		e.dbService.UpdateSubmit(ctx)
+		log.Info().Timestamp().Str("id", sub.ID).Str("result_file", result_file).AnErr("err", err).Msg("failed to parse result file")
+		sub.SetStatus("failed").SetMsg("failed to parse result file")
+		e.dbService.UpdateSubmit(sub)
 		return
 	}
 
-	ctx.SetStatus("completed").SetMsg("judge successfully finished")
-	e.dbService.UpdateSubmit(ctx)
+	if sub.JudgeResult.Memory == 0 {
+		sub.JudgeResult.Memory = peak_memory
+	}
+
+	sub.SetStatus("completed").SetMsg("judge successfully finished")
+	e.dbService.UpdateSubmit(sub)
 }
 
 // copyFile 复制文件并返回MD5哈希
@@ -0,0 +1,209 @@
+package judge
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultGeneratorDelimiter 生成器输出中分隔测试输入和标准答案的默认行
+	DefaultGeneratorDelimiter = "---"
+	// DefaultGeneratorTimeout 生成器每次运行的默认超时(秒)
+	DefaultGeneratorTimeout = 10
+	// generatorSeedPlaceholder 生成器命令中的种子占位符
+	generatorSeedPlaceholder = "{seed}"
+)
+
+// ErrNoGenerator 题目没有配置测试点生成器
+var ErrNoGenerator = errors.New("problem has no generator")
+
+// GeneratedTest 一个种子的生成结果
+type GeneratedTest struct {
+	Seed  int64  `json:"seed"`
+	ID    string `json:"id"`
+	Saved bool   `json:"saved"`
+	Error string `json:"error,omitempty"`
+	// TimeUsedMs 标准程序在该测试点上的运行时间, 未验证时为0
+	TimeUsedMs int64 `json:"time_used_ms,omitempty"`
+}
+
+// GenerateReport 一次生成测试点的结果
+type GenerateReport struct {
+	// Validated 是否用题目的标准程序验证了生成的测试点, 题目没有标准程序时为 false
+	Validated bool            `json:"validated"`
+	Saved     int             `json:"saved"`
+	Failed    int             `json:"failed"`
+	Tests     []GeneratedTest `json:"tests"`
+}
+
+// GeneratedTestID 种子 seed 生成的测试点的ID
+func GeneratedTestID(seed int64) string {
+	return strconv.FormatInt(seed, 10)
+}
+
+// generatorCommand 将种子代入生成器命令
+func generatorCommand(cmd string, seed int64) string {
+	s := strconv.FormatInt(seed, 10)
+	if strings.Contains(cmd, generatorSeedPlaceholder) {
+		return strings.ReplaceAll(cmd, generatorSeedPlaceholder, s)
+	}
+	return cmd + " " + s
+}
+
+// splitGeneratedOutput 以单独一行的 delim 将生成器输出分为测试输入和标准答案
+func splitGeneratedOutput(out, delim string) (input, expected []byte, ok bool) {
+	pos := 0
+	for pos <= len(out) {
+		end := strings.IndexByte(out[pos:], '\n')
+		next := len(out) + 1
+		line := out[pos:]
+		if end >= 0 {
+			line = out[pos : pos+end]
+			next = pos + end + 1
+		}
+		if strings.TrimRight(line, "\r") == delim {
+			rest := ""
+			if next <= len(out) {
+				rest = out[next:]
+			}
+			return []byte(out[:pos]), []byte(rest), true
+		}
+		pos = next
+	}
+	return nil, nil, false
+}
+
+// GenerateTests 用题目的生成器生成测试点并写入 store
+//
+// 对 SeedFrom 到 SeedTo 的每个种子在同一个生成器容器中运行一次命令, ID 为种子的测试点会被覆盖.
+// 题目设置了标准程序时, 每个测试点都要由标准程序在时间和内存限制内运行并通过检查才会写入,
+// 否则测试点不经验证直接写入. 单个种子失败不影响其他种子, 只有无法运行生成器时才返回错误.
+func (e *Evaluator) GenerateTests(ctx context.Context, p *types.Problem, store TestCaseWriter) (*GenerateReport, error) {
+	gen := p.Generator
+	if gen == nil {
+		return nil, ErrNoGenerator
+	}
+	delim := gen.Delimiter
+	if delim == "" {
+		delim = DefaultGeneratorDelimiter
+	}
+	timeout := gen.Timeout
+	if timeout <= 0 {
+		timeout = DefaultGeneratorTimeout
+	}
+
+	report := &GenerateReport{}
+	var (
+		jury []byte
+		cfg  RunConfig
+	)
+	if p.Solution != nil {
+		if e.languages == nil {
+			return nil, errors.New("languages are not loaded")
+		}
+		lang, ok := e.languages.GetByID(p.Solution.Language)
+		if !ok {
+			return nil, errors.New("jury language " + strconv.Quote(p.Solution.Language) + " not found")
+		}
+		cfg = RunConfig{
+			Language:      lang,
+			TimeLimitMs:   p.TimeLimitMs,
+			MemoryLimitKB: p.MemoryLimitKB,
+			OutputLimitKB: p.OutputLimitKB,
+			CompileFlags:  p.CompileFlags,
+			Checker:       e.problemChecker(p),
+			Interactor:    p.Interactor,
+		}
+		var err error
+		jury, _, err = e.Compile(ctx, []byte(p.Solution.Source), lang.WithCompileFlags(cfg.CompileFlags))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compile jury solution")
+		}
+		report.Validated = true
+	}
+
+	sandbox := sandboxConfig("soj-gen-", gen.Image)
+	cid, err := startSandbox(ctx, e.docker, sandbox, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start generator")
+	}
+	defer e.docker.CleanContainer(context.WithoutCancel(ctx), cid, file_transfer.DefaultStopGrace)
+
+	for seed := gen.SeedFrom; seed <= gen.SeedTo; seed++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		t := GeneratedTest{Seed: seed, ID: GeneratedTestID(seed)}
+
+		msg, err := e.generateTest(ctx, p, store, cid, generatorCommand(gen.Command, seed), timeout, sandbox.MemoryLimit, delim, jury, &cfg, &t)
+		if err != nil {
+			return nil, err
+		}
+		if msg != "" {
+			t.Error = msg
+			report.Failed++
+		} else {
+			t.Saved = true
+			report.Saved++
+		}
+		report.Tests = append(report.Tests, t)
+	}
+
+	log.Info().Str("problem", p.Id).Int("saved", report.Saved).Int("failed", report.Failed).Bool("validated", report.Validated).Msg("tests generated")
+	return report, nil
+}
+
+// generateTest 用一个种子生成, 验证并写入测试点, 测试点不合格时返回原因
+func (e *Evaluator) generateTest(ctx context.Context, p *types.Problem, store TestCaseWriter, cid, cmd string, timeout int, memoryLimit int64, delim string, jury []byte, cfg *RunConfig, t *GeneratedTest) (string, error) {
+	res, err := runInSandbox(ctx, e.docker, cid, cmd, timeout, memoryLimit, 0, nil, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to run generator")
+	}
+	if res.Verdict != "" {
+		return "generator failed: " + string(res.Verdict) + " (exit code " + strconv.Itoa(res.ExitCode) + ")", nil
+	}
+	input, expected, ok := splitGeneratedOutput(res.Stdout, delim)
+	if !ok {
+		return "generator output has no delimiter line " + strconv.Quote(delim), nil
+	}
+
+	if jury != nil && cfg.Interactor != nil {
+		// 交互题的标准程序与交互器交互, 由交互器判定
+		juryRes, err := e.runInteractive(ctx, jury, input, cfg)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to run jury solution")
+		}
+		t.TimeUsedMs = juryRes.TimeUsedMs
+		if juryRes.Verdict != types.VerdictAccepted {
+			return "jury solution got " + string(juryRes.Verdict) + " with the interactor", nil
+		}
+	} else if jury != nil {
+		juryRes, err := e.runBinary(ctx, jury, input, cfg)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to run jury solution")
+		}
+		t.TimeUsedMs = juryRes.TimeUsedMs
+		if juryRes.Verdict != "" {
+			return "jury solution got " + string(juryRes.Verdict), nil
+		}
+		checked, err := cfg.checker().Check(ctx, input, expected, []byte(juryRes.Stdout))
+		if err != nil {
+			return "", errors.Wrap(err, "failed to check jury output")
+		}
+		if checked.Verdict != types.VerdictAccepted {
+			return "jury solution got " + string(checked.Verdict) + " against the generated output", nil
+		}
+	}
+
+	err = store.SaveTestCase(p.Id, t.ID, input, expected)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to save test case")
+	}
+	return "", nil
+}
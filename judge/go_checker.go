@@ -0,0 +1,106 @@
+package judge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/rs/zerolog/log"
+)
+
+// CheckResult Go checker 的检查结果
+type CheckResult struct {
+	// Verdict 只能为 AC, WA 或 PE, 其他结论视为checker出错
+	Verdict types.Verdict
+	// Score 该测试点的得分(0-100), Verdict 为 AC 且 Score 为0时视为满分
+	Score float64
+	// Message 评测信息, 作为测试点的 CheckerOutput 展示给选手
+	Message string
+}
+
+// GoChecker 在评测进程内运行的checker, 不需要为每个测试点启动容器
+//
+// 适合"输出是否为合法的排列"这类简单的检查. Check 会被多个测试点并发调用, 实现必须是并发安全的.
+// Check 中的panic会被捕获并视为checker出错(SE).
+type GoChecker interface {
+	Check(input, expected, actual string) CheckResult
+}
+
+// GoCheckerFunc 将函数转换为 GoChecker
+type GoCheckerFunc func(input, expected, actual string) CheckResult
+
+// Check 调用 f
+func (f GoCheckerFunc) Check(input, expected, actual string) CheckResult {
+	return f(input, expected, actual)
+}
+
+var (
+	goCheckersMu sync.RWMutex
+	goCheckers   = make(map[string]GoChecker)
+)
+
+// RegisterGoChecker 为问题 problemID 注册 Go checker, 注册后该问题不再按 CompareMode 比较输出
+//
+// 通常在checker所在包的 init 中调用. 重复注册时后注册的checker覆盖之前的.
+func RegisterGoChecker(problemID string, c GoChecker) {
+	goCheckersMu.Lock()
+	defer goCheckersMu.Unlock()
+	goCheckers[problemID] = c
+	log.Debug().Str("problem", problemID).Msg("go checker registered")
+}
+
+// LookupGoChecker 获取为问题 problemID 注册的 Go checker
+func LookupGoChecker(problemID string) (GoChecker, bool) {
+	goCheckersMu.RLock()
+	defer goCheckersMu.RUnlock()
+	c, ok := goCheckers[problemID]
+	return c, ok
+}
+
+// problemChecker 返回问题使用的checker, 优先使用注册的 Go checker, 其次为题目配置的checker程序
+func (e *Evaluator) problemChecker(p *types.Problem) Checker {
+	if c, ok := LookupGoChecker(p.Id); ok {
+		return goCheckerAdapter{c}
+	}
+	if p.Checker != nil {
+		return NewSpecialJudge(e.docker, p.Checker.Image, p.Checker.Command)
+	}
+	return DiffChecker{Mode: p.CompareMode}
+}
+
+// goCheckerAdapter 将 GoChecker 适配为 Checker
+type goCheckerAdapter struct {
+	checker GoChecker
+}
+
+// Check 比较输出
+func (a goCheckerAdapter) Check(ctx context.Context, input, expected, actual []byte) (res *types.JudgeResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Interface("panic", r).Msg("go checker panicked")
+			res = &types.JudgeResult{Success: false, Verdict: types.VerdictSystemError, Msg: fmt.Sprint("checker panicked: ", r)}
+		}
+	}()
+
+	cr := a.checker.Check(string(input), string(expected), string(actual))
+	res = &types.JudgeResult{
+		Success:       true,
+		Verdict:       cr.Verdict,
+		Score:         cr.Score,
+		Msg:           cr.Message,
+		CheckerOutput: cr.Message,
+	}
+	switch cr.Verdict {
+	case types.VerdictAccepted:
+		if res.Score == 0 {
+			res.Score = 100
+		}
+	case types.VerdictWrongAnswer, types.VerdictPresentationError:
+	default:
+		res.Success = false
+		res.Verdict = types.VerdictSystemError
+		res.Msg = "checker returned invalid verdict " + string(cr.Verdict)
+	}
+	return res, nil
+}
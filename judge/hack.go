@@ -0,0 +1,174 @@
+package judge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// HackReward 比赛中成功hack获得的分数, 乘以题目权重后从被hack用户的 HackScore 转给hacker
+	HackReward = 10.0
+	// HackMaxInputSize hack输入的大小上限(字节)
+	HackMaxInputSize = 1 << 20
+)
+
+// hackMu 串行化hack结果的写入, 同一提交只能被成功hack一次
+var hackMu sync.Mutex
+
+// HackRun 用hack输入运行已通过的提交和标准程序, 比较两者的输出
+//
+// HackRun 实现了 Submission, 通过评测队列运行. 标准程序在hack输入上不能正常结束时hack无效;
+// 被hack的提交在hack输入上未通过时hack成功, 提交的 Verdict 改为其在hack输入上的结论, 得分清零,
+// 原来的得分记录在 JudgeResult.Hack 中. hack记录在重测后仍保留, 同一提交只能被成功hack一次.
+type HackRun struct {
+	Evaluator *Evaluator
+	// Store 被hack的提交所在的存储, 写入结果时会触发排行榜等回调
+	Store types.SubmissionStore
+	Hacks types.HackStore
+
+	Hack     *types.Hack
+	Target   *types.Submission
+	Problem  *types.Problem
+	Language *LanguageConfig
+	// JuryLanguage 标准程序的语言
+	JuryLanguage *LanguageConfig
+	// MaxArchiveSize 多文件提交解压后的总大小上限, 见 ParseMultiFileSubmission
+	MaxArchiveSize int64
+
+	// OnHacked hack成功后调用, 可以为nil
+	OnHacked func(h *types.Hack)
+
+	done chan struct{}
+}
+
+// NewHackRun 创建hack运行, hack 需要已经写入 hacks
+func NewHackRun(evaluator *Evaluator, store types.SubmissionStore, hacks types.HackStore, hack *types.Hack, target *types.Submission, problem *types.Problem, lang, juryLang *LanguageConfig) *HackRun {
+	return &HackRun{
+		Evaluator:    evaluator,
+		Store:        store,
+		Hacks:        hacks,
+		Hack:         hack,
+		Target:       target,
+		Problem:      problem,
+		Language:     lang,
+		JuryLanguage: juryLang,
+		done:         make(chan struct{}),
+	}
+}
+
+// ID hack ID
+func (r *HackRun) ID() string {
+	return r.Hack.ID
+}
+
+// Judge 运行hack并写入结果
+func (r *HackRun) Judge(ctx context.Context) {
+	defer close(r.done)
+
+	l := log.With().Str("hack", r.Hack.ID).Str("id", r.Target.ID).Str("hacker", r.Hack.HackerID).Logger()
+
+	status, msg, err := r.run(ctx)
+	if err != nil {
+		l.Err(err).Msg("hack failed")
+		status, msg = types.HackError, "judge failed"
+	}
+	r.Hack.Status, r.Hack.Msg = status, msg
+
+	err = r.Hacks.UpdateHack(r.Hack.ID, status, msg)
+	if err != nil {
+		l.Err(err).Msg("failed to update hack")
+	}
+	l.Info().Str("status", status).Msg("hack judged")
+}
+
+// Wait 等待hack运行结束, ctx 结束时返回 ctx.Err()
+func (r *HackRun) Wait(ctx context.Context) (*types.Hack, error) {
+	select {
+	case <-r.done:
+		return r.Hack, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *HackRun) run(ctx context.Context) (status, msg string, err error) {
+	input := []byte(r.Hack.Input)
+	cfg := RunConfig{
+		Language:      r.JuryLanguage,
+		TimeLimitMs:   r.Problem.TimeLimitMs,
+		MemoryLimitKB: r.Problem.MemoryLimitKB,
+		OutputLimitKB: r.Problem.OutputLimitKB,
+		CompileFlags:  r.Problem.CompileFlags,
+		Checker:       r.Evaluator.problemChecker(r.Problem),
+	}
+
+	jury, _, err := r.Evaluator.Compile(ctx, []byte(r.Problem.Solution.Source), r.JuryLanguage.WithCompileFlags(cfg.CompileFlags))
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to compile jury solution")
+	}
+	juryRes, err := r.Evaluator.runBinary(ctx, jury, input, &cfg)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to run jury solution")
+	}
+	if juryRes.Verdict != "" {
+		return types.HackInvalid, "jury solution failed on the input: " + string(juryRes.Verdict), nil
+	}
+
+	target := &SourceSubmission{Submission: r.Target, Language: r.Language, MaxArchiveSize: r.MaxArchiveSize}
+	files, err := target.files()
+	if err != nil {
+		return "", "", err
+	}
+	cfg.Language = r.Language
+	res, _, err := r.Evaluator.JudgeFiles(ctx, files, []TestCase{{ID: "hack", Input: input, Expected: []byte(juryRes.Stdout)}}, cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch res.Verdict {
+	case types.VerdictAccepted:
+		return types.HackFailed, "submission passed the input", nil
+	case types.VerdictSystemError:
+		return "", "", errors.New("system error: " + res.Msg)
+	}
+	return r.markHacked(res.Verdict)
+}
+
+// markHacked 将提交标记为被hack
+func (r *HackRun) markHacked(verdict types.Verdict) (status, msg string, err error) {
+	hackMu.Lock()
+	defer hackMu.Unlock()
+
+	cur, err := r.Store.GetByID(r.Target.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if cur.JudgeResult.Hack != nil || cur.JudgeResult.Verdict != types.VerdictAccepted {
+		return types.HackFailed, "submission has already been hacked or rejudged", nil
+	}
+
+	res := cur.JudgeResult
+	res.Hack = &types.HackResult{
+		HackID:   r.Hack.ID,
+		HackerID: r.Hack.HackerID,
+		Verdict:  verdict,
+		HackedAt: time.Now().UnixNano(),
+		Score:    res.Score,
+	}
+	res.Verdict = verdict
+	res.Score = 0
+	err = r.Store.UpdateResult(cur.ID, cur.Status, &res)
+	if err != nil {
+		return "", "", err
+	}
+
+	if r.OnHacked != nil {
+		r.OnHacked(r.Hack)
+	}
+	return types.HackSucceeded, "submission got " + string(verdict) + " on the input", nil
+}
@@ -0,0 +1,274 @@
+package judge
+
+import (
+	"archive/zip"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultMaxProblemArchiveSize 题目压缩包解压后的默认总大小上限
+const DefaultMaxProblemArchiveSize = 512 << 20
+
+// problemArchiveRoot 题目压缩包中存放题目的目录
+const problemArchiveRoot = "problems"
+
+// 题目压缩包中每个题目目录下的文件名
+const (
+	problemArchiveDefinition = "problem.yaml"
+	problemArchiveStatement  = "statement.md"
+	problemArchiveTests      = "tests"
+)
+
+// 导入题目的结果
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportFailed  = "failed"
+)
+
+// ImportResult 压缩包中一个题目的导入结果
+type ImportResult struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	TestCases int    `json:"test_cases"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportReport 导入题目压缩包的结果
+type ImportReport struct {
+	// Imported 新建和更新的题目数
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Problems []ImportResult `json:"problems"`
+}
+
+// archivedProblem 压缩包中一个题目目录的内容
+type archivedProblem struct {
+	definition []byte
+	statement  *string
+	inputs     map[string][]byte
+	outputs    map[string][]byte
+	err        error
+}
+
+// ProblemImporter 从zip压缩包批量导入题目
+//
+// 压缩包的结构为 problems/{ID}/problem.yaml(题目定义, 必须存在), problems/{ID}/statement.md(题目描述, 可选)
+// 和 problems/{ID}/tests/{n}.in, {n}.out(测试点). 已有的题目按ID更新: 压缩包中有测试点时替换原来的全部测试点,
+// 没有时保留原来的测试点. 每个题目单独导入, 一个题目失败不影响其他题目.
+type ProblemImporter struct {
+	Problems  ProblemEditor
+	TestCases TestCaseStore
+	// Statements 题面存储, 为nil时 statement.md 写入题目定义的 statement
+	Statements StatementWriter
+	// MaxSize 解压后的总大小上限, 不大于0时为 DefaultMaxProblemArchiveSize
+	MaxSize int64
+}
+
+// Import 导入压缩包中的所有题目, 压缩包本身无效时返回错误
+func (im *ProblemImporter) Import(r io.ReaderAt, size int64) (*ImportReport, error) {
+	writer, ok := im.TestCases.(TestCaseWriter)
+	if !ok {
+		return nil, errors.New("test case storage is not writable")
+	}
+
+	problems, err := im.readArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(problems))
+	for id := range problems {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	report := &ImportReport{Problems: make([]ImportResult, 0, len(ids))}
+	for _, id := range ids {
+		res := im.importProblem(writer, id, problems[id])
+		if res.Status == ImportFailed {
+			report.Failed++
+		} else {
+			report.Imported++
+		}
+		report.Problems = append(report.Problems, res)
+	}
+	return report, nil
+}
+
+// readArchive 解压压缩包, 按题目ID分组
+func (im *ProblemImporter) readArchive(r io.ReaderAt, size int64) (map[string]*archivedProblem, error) {
+	remaining := im.MaxSize
+	if remaining <= 0 {
+		remaining = DefaultMaxProblemArchiveSize
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid zip archive")
+	}
+
+	problems := make(map[string]*archivedProblem)
+	for _, f := range zr.File {
+		name, err := cleanArchivePath(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		// 只读取 problems 目录, 忽略压缩工具添加的其他文件
+		parts := strings.Split(name, "/")
+		if f.FileInfo().IsDir() || len(parts) < 3 || parts[0] != problemArchiveRoot {
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			return nil, errors.Wrap(ErrPathTraversal, f.Name+" is not a regular file")
+		}
+
+		id := parts[1]
+		ap, ok := problems[id]
+		if !ok {
+			ap = &archivedProblem{inputs: make(map[string][]byte), outputs: make(map[string][]byte)}
+			problems[id] = ap
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open "+name)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, remaining+1))
+		rc.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read "+name)
+		}
+		remaining -= int64(len(content))
+		if remaining < 0 {
+			return nil, ErrArchiveTooLarge
+		}
+
+		rel := strings.Join(parts[2:], "/")
+		switch {
+		case rel == problemArchiveDefinition:
+			ap.definition = content
+		case rel == problemArchiveStatement:
+			st := string(content)
+			ap.statement = &st
+		case len(parts) == 4 && parts[2] == problemArchiveTests && strings.HasSuffix(parts[3], ".in"):
+			ap.inputs[strings.TrimSuffix(parts[3], ".in")] = content
+		case len(parts) == 4 && parts[2] == problemArchiveTests && strings.HasSuffix(parts[3], ".out"):
+			ap.outputs[strings.TrimSuffix(parts[3], ".out")] = content
+		default:
+			if ap.err == nil {
+				ap.err = errors.New("unexpected file " + name)
+			}
+		}
+	}
+	return problems, nil
+}
+
+// importProblem 导入一个题目, 先写入测试点和题面, 再保存题目定义, 以便保存时检查测试点和子任务
+func (im *ProblemImporter) importProblem(writer TestCaseWriter, id string, ap *archivedProblem) ImportResult {
+	res := ImportResult{ID: id, TestCases: len(ap.inputs)}
+	fail := func(err error) ImportResult {
+		res.Status = ImportFailed
+		res.Error = err.Error()
+		return res
+	}
+
+	if ap.err != nil {
+		return fail(ap.err)
+	}
+	if ap.definition == nil {
+		return fail(errors.New(problemArchiveDefinition + " is missing"))
+	}
+	var p types.Problem
+	err := yaml.Unmarshal(ap.definition, &p)
+	if err != nil {
+		return fail(errors.Wrap(err, "invalid "+problemArchiveDefinition))
+	}
+	if p.Id == "" {
+		p.Id = id
+	}
+	if p.Id != id {
+		return fail(errors.New("problem id " + p.Id + " does not match directory " + id))
+	}
+	if !validProblemID(id) {
+		return fail(errors.New("invalid problem id"))
+	}
+	for tc := range ap.inputs {
+		if _, ok := ap.outputs[tc]; !ok {
+			return fail(errors.New("test case " + tc + " has no output"))
+		}
+	}
+	for tc := range ap.outputs {
+		if _, ok := ap.inputs[tc]; !ok {
+			return fail(errors.New("test case " + tc + " has no input"))
+		}
+	}
+	if ap.statement != nil && im.Statements == nil && p.Statement == "" {
+		p.Statement = *ap.statement
+	}
+	// 在写入任何文件之前检查题目定义, 测试点相关的检查在保存时进行
+	err = p.Validate()
+	if err != nil {
+		return fail(err)
+	}
+
+	_, exists := im.Problems.GetProblem(id)
+	res.Status = ImportCreated
+	if exists {
+		res.Status = ImportUpdated
+	}
+
+	if len(ap.inputs) > 0 {
+		var old []TestCase
+		if exists {
+			old, err = im.TestCases.ListTestCases(id)
+			if err != nil && !errors.Is(err, ErrNoTestCases) {
+				return fail(errors.Wrap(err, "failed to list test cases"))
+			}
+		}
+		for tc, input := range ap.inputs {
+			err = writer.SaveTestCase(id, tc, input, ap.outputs[tc])
+			if err != nil {
+				return fail(errors.Wrap(err, "failed to save test case "+tc))
+			}
+		}
+		for _, tc := range old {
+			if _, ok := ap.inputs[tc.ID]; ok {
+				continue
+			}
+			err = writer.RemoveTestCase(id, tc.ID)
+			if err != nil {
+				return fail(errors.Wrap(err, "failed to remove test case "+tc.ID))
+			}
+		}
+	} else if exists {
+		cases, err := im.TestCases.ListTestCases(id)
+		if err == nil {
+			res.TestCases = len(cases)
+		}
+	}
+
+	if ap.statement != nil && im.Statements != nil {
+		err = im.Statements.SaveStatement(id, *ap.statement)
+		if err != nil {
+			return fail(errors.Wrap(err, "failed to save statement"))
+		}
+	}
+
+	err = im.Problems.SaveProblem(p)
+	if err != nil {
+		// 新题目保存失败时不留下测试点
+		if !exists {
+			for tc := range ap.inputs {
+				writer.RemoveTestCase(id, tc)
+			}
+		}
+		return fail(err)
+	}
+	return res
+}
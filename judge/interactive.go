@@ -0,0 +1,135 @@
+package judge
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// InteractiveConfig 交互题评测配置
+type InteractiveConfig struct {
+	// ContestantImage/ContestantCmd 选手程序所在的镜像和运行命令
+	ContestantImage string
+	ContestantCmd   string
+	// ContestantFiles 运行前复制到选手容器工作目录中的文件, 如编译好的程序
+	ContestantFiles map[string][]byte
+	// ContestantMemoryLimit 选手容器的内存限制(字节), 不大于0时使用沙箱的默认值
+	ContestantMemoryLimit int64
+
+	// InteractorImage/InteractorCmd 交互器所在的镜像和命令,
+	// 按 testlib 的约定以 `<InteractorCmd> input.txt output.txt` 调用, 退出码含义与checker相同
+	InteractorImage string
+	InteractorCmd   string
+	// Input 交给交互器的测试输入
+	Input []byte
+
+	// Timeout 双方共同的运行时间上限(秒), 双方同时开始运行
+	Timeout int
+}
+
+// InteractiveResult 交互题评测结果
+type InteractiveResult struct {
+	// Verdict 综合双方结果得出的最终结论
+	Verdict types.Verdict
+	// Contestant/Interactor 双方各自的运行结果, Msg 为各自的标准错误输出
+	Contestant *types.JudgeResult
+	Interactor *types.JudgeResult
+}
+
+// InteractiveRun 运行交互题评测
+//
+// 选手程序和交互器分别运行在两个容器中, 选手的标准输出接到交互器的标准输入, 交互器的标准输出接到选手的标准输入.
+// 任意一方结束时, 另一方的输入会收到EOF, 输出会被丢弃.
+//
+// 最终结论的优先级为: 交互器出错(SE) > 交互器判定的 WA/PE > 选手超时(TLE) > 选手运行错误(RE) > 交互器超时(TLE) > AC.
+func InteractiveRun(ctx context.Context, docker file_transfer.DockerServiceInterface, cfg *InteractiveConfig) (*InteractiveResult, error) {
+	contestantSandbox := sandboxConfig("soj-interactive-contestant-", cfg.ContestantImage)
+	if cfg.ContestantMemoryLimit > 0 {
+		contestantSandbox.MemoryLimit = cfg.ContestantMemoryLimit
+	}
+	contestant, err := startSandbox(ctx, docker, contestantSandbox, cfg.ContestantFiles)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start contestant container")
+	}
+	defer docker.CleanContainer(context.WithoutCancel(ctx), contestant, file_transfer.DefaultStopGrace)
+
+	interactor, err := startSandbox(ctx, docker, sandboxConfig("soj-interactive-interactor-", cfg.InteractorImage), map[string][]byte{"input.txt": cfg.Input})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start interactor container")
+	}
+	defer docker.CleanContainer(context.WithoutCancel(ctx), interactor, file_transfer.DefaultStopGrace)
+
+	// toInteractor: 选手 -> 交互器, toContestant: 交互器 -> 选手
+	toInteractorR, toInteractorW := io.Pipe()
+	toContestantR, toContestantW := io.Pipe()
+
+	var (
+		wg                sync.WaitGroup
+		cRes, iRes        *types.JudgeResult
+		cErr, iErr        error
+		memoryLimit       = contestantSandbox.MemoryLimit
+		interactorCommand = cfg.InteractorCmd + " input.txt output.txt"
+		contestantCommand = cfg.ContestantCmd
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		cRes, cErr = runInSandbox(ctx, docker, contestant, contestantCommand, cfg.Timeout, memoryLimit, 0, toContestantR, toInteractorW)
+		// 选手结束后交互器读到EOF, 交互器继续写出的内容被丢弃
+		toInteractorW.Close()
+		toContestantR.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		iRes, iErr = runInSandbox(ctx, docker, interactor, interactorCommand, cfg.Timeout, 0, 0, toInteractorR, toContestantW)
+		toContestantW.Close()
+		toInteractorR.Close()
+	}()
+	wg.Wait()
+
+	if cErr != nil {
+		return nil, errors.Wrap(cErr, "failed to run contestant")
+	}
+	if iErr != nil {
+		return nil, errors.Wrap(iErr, "failed to run interactor")
+	}
+
+	cRes.Msg = strings.TrimSpace(cRes.Stderr)
+	if cRes.Verdict == "" {
+		cRes.Verdict = types.VerdictAccepted
+	}
+
+	iRes.Msg = strings.TrimSpace(iRes.Stderr)
+	iRes.CheckerOutput = iRes.Msg
+	// 交互器超时通常是在等待选手输出, 保留 TLE
+	if iRes.Verdict != types.VerdictTimeLimitExceeded {
+		iRes.Verdict = checkerVerdict(iRes.ExitCode)
+		iRes.Success = iRes.Verdict != types.VerdictSystemError
+	}
+	cRes.CheckerOutput = iRes.CheckerOutput
+
+	res := &InteractiveResult{Contestant: cRes, Interactor: iRes}
+
+	switch {
+	case iRes.Verdict == types.VerdictSystemError:
+		res.Verdict = types.VerdictSystemError
+	case iRes.Verdict == types.VerdictWrongAnswer, iRes.Verdict == types.VerdictPresentationError:
+		res.Verdict = iRes.Verdict
+	case cRes.Verdict != types.VerdictAccepted:
+		res.Verdict = cRes.Verdict
+	default:
+		res.Verdict = iRes.Verdict
+	}
+
+	if res.Verdict == types.VerdictAccepted {
+		res.Contestant.Score = 100
+	}
+
+	return res, nil
+}
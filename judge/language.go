@@ -0,0 +1,287 @@
+package judge
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// 评测命令中可以使用的占位符
+const (
+	PlaceholderSource = "{source}" // 源文件名
+	PlaceholderBinary = "{binary}" // 编译产物文件名
+)
+
+// LanguageConfig 编程语言配置
+//
+// CompileCmd 和 RunCmd 在容器的工作目录中执行, 可以使用 {source} 和 {binary} 占位符.
+// 解释型语言不需要 CompileCmd, 此时 {binary} 与 {source} 相同.
+type LanguageConfig struct {
+	ID            string `yaml:"id"`
+	Name          string `yaml:"name"`
+	Image         string `yaml:"image"`
+	CompileCmd    string `yaml:"compile"`
+	RunCmd        string `yaml:"run"`
+	FileExtension string `yaml:"extension"` // 源文件扩展名, 如 ".cpp"
+
+	// TimeMultiplier/MemoryMultiplier 相对于题目限制的倍数, 用于补偿解释型语言的开销, 未配置时为 1
+	TimeMultiplier   float64 `yaml:"timemultiplier"`
+	MemoryMultiplier float64 `yaml:"memorymultiplier"`
+
+	// Template 编辑器中预填的代码模板, 题目可以通过 Problem.LanguageTemplates 覆盖
+	Template CodeTemplate `yaml:"template"`
+}
+
+// CodeTemplate 代码模板, 如C++的标准输入输出样板代码
+type CodeTemplate struct {
+	Source string `yaml:"source"`
+}
+
+// TemplateFor 返回题目 p 在该语言下的代码模板, 题目没有覆盖该语言时使用语言的默认模板, p 可以为nil
+func (l *LanguageConfig) TemplateFor(p *types.Problem) string {
+	if p != nil {
+		if src, ok := p.LanguageTemplates[l.ID]; ok {
+			return src
+		}
+	}
+	return l.Template.Source
+}
+
+// SourceFile 源文件名
+func (l *LanguageConfig) SourceFile() string {
+	return "main" + l.FileExtension
+}
+
+// BinaryFile 编译产物文件名, 不需要编译时为源文件名
+func (l *LanguageConfig) BinaryFile() string {
+	if l.CompileCmd == "" {
+		return l.SourceFile()
+	}
+	return "main"
+}
+
+// NeedsCompile 是否需要编译
+func (l *LanguageConfig) NeedsCompile() bool {
+	return l.CompileCmd != ""
+}
+
+// CompileCommand 替换占位符后的编译命令
+func (l *LanguageConfig) CompileCommand() string {
+	return l.expand(l.CompileCmd)
+}
+
+// WithCompileFlags 返回在编译命令末尾追加 flags 的语言配置副本
+//
+// flags 必须已经通过 types.ValidateCompileFlag 检查. 不需要编译的语言忽略 flags.
+func (l LanguageConfig) WithCompileFlags(flags []string) LanguageConfig {
+	if len(flags) > 0 && l.NeedsCompile() {
+		l.CompileCmd += " " + strings.Join(flags, " ")
+	}
+	return l
+}
+
+// RunCommand 替换占位符后的运行命令
+func (l *LanguageConfig) RunCommand() string {
+	return l.expand(l.RunCmd)
+}
+
+func (l *LanguageConfig) expand(cmd string) string {
+	return strings.NewReplacer(PlaceholderSource, l.SourceFile(), PlaceholderBinary, l.BinaryFile()).Replace(cmd)
+}
+
+// TimeLimit 按倍数换算后的时间限制
+func (l *LanguageConfig) TimeLimit(base int64) int64 {
+	return int64(float64(base) * l.TimeMultiplier)
+}
+
+// MemoryLimit 按倍数换算后的内存限制
+func (l *LanguageConfig) MemoryLimit(base int64) int64 {
+	return int64(float64(base) * l.MemoryMultiplier)
+}
+
+// RunConfig 以该语言的镜像创建沙箱容器配置
+func (l *LanguageConfig) RunConfig(name string) *file_transfer.RunConfig {
+	cfg := file_transfer.DefaultRunConfig()
+	cfg.Name = name
+	cfg.Image = l.Image
+	return cfg
+}
+
+// ErrLanguageNotFound 语言配置不存在
+var ErrLanguageNotFound = errors.New("language not found")
+
+// LanguageRegistry 语言配置表
+type LanguageRegistry struct {
+	mu        sync.RWMutex
+	languages map[string]*LanguageConfig
+	// file 配置文件路径, 由 LoadLanguageRegistry 设置, 修改后写回该文件
+	file string
+}
+
+// normalizeLanguage 检查语言配置并填充默认值
+func normalizeLanguage(l *LanguageConfig) error {
+	if l.ID == "" {
+		return errors.New("language id is empty")
+	}
+	if l.Image == "" || l.RunCmd == "" {
+		return errors.New("language " + l.ID + " must have image and run command")
+	}
+	if l.Name == "" {
+		l.Name = l.ID
+	}
+	if l.TimeMultiplier == 0 {
+		l.TimeMultiplier = 1
+	}
+	if l.MemoryMultiplier == 0 {
+		l.MemoryMultiplier = 1
+	}
+	return nil
+}
+
+// NewLanguageRegistry 由语言配置列表创建配置表
+func NewLanguageRegistry(languages []LanguageConfig) (*LanguageRegistry, error) {
+	r := &LanguageRegistry{languages: make(map[string]*LanguageConfig, len(languages))}
+
+	for i := range languages {
+		l := languages[i]
+		err := normalizeLanguage(&l)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.languages[l.ID]; ok {
+			return nil, errors.New("duplicate language " + l.ID)
+		}
+		r.languages[l.ID] = &l
+	}
+
+	return r, nil
+}
+
+// LoadLanguageRegistry 从YAML文件加载语言配置表
+//
+// 文件格式为:
+//
+//	languages:
+//	  - id: cpp17
+//	    name: C++ 17
+//	    image: gcc:13
+//	    extension: .cpp
+//	    compile: g++ -std=c++17 -O2 -o {binary} {source}
+//	    run: ./{binary}
+func LoadLanguageRegistry(file string) (*LanguageRegistry, error) {
+	_f, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read language config")
+	}
+
+	var _c struct {
+		Languages []LanguageConfig `yaml:"languages"`
+	}
+	err = yaml.Unmarshal(_f, &_c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal language config "+file)
+	}
+
+	r, err := NewLanguageRegistry(_c.Languages)
+	if err != nil {
+		return nil, err
+	}
+	r.file = file
+	return r, nil
+}
+
+// GetByID 获取语言配置
+//
+// 返回的配置不会被修改, Put 替换配置时使用新的对象.
+func (r *LanguageRegistry) GetByID(id string) (*LanguageConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	l, ok := r.languages[id]
+	return l, ok
+}
+
+// ListAll 按ID排序返回所有语言配置
+func (r *LanguageRegistry) ListAll() []*LanguageConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.listLocked()
+}
+
+func (r *LanguageRegistry) listLocked() []*LanguageConfig {
+	list := make([]*LanguageConfig, 0, len(r.languages))
+	for _, l := range r.languages {
+		list = append(list, l)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Put 创建或替换语言配置, 配置表由文件加载时写回该文件
+func (r *LanguageRegistry) Put(l LanguageConfig) error {
+	err := normalizeLanguage(&l)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.languages[l.ID]
+	r.languages[l.ID] = &l
+	err = r.saveLocked()
+	if err != nil {
+		if ok {
+			r.languages[l.ID] = old
+		} else {
+			delete(r.languages, l.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete 删除语言配置, 不存在时返回 ErrLanguageNotFound
+func (r *LanguageRegistry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.languages[id]
+	if !ok {
+		return ErrLanguageNotFound
+	}
+	delete(r.languages, id)
+	err := r.saveLocked()
+	if err != nil {
+		r.languages[id] = old
+		return err
+	}
+	return nil
+}
+
+// saveLocked 将配置表写回配置文件, 调用方需持有写锁
+func (r *LanguageRegistry) saveLocked() error {
+	if r.file == "" {
+		return nil
+	}
+	var _c struct {
+		Languages []LanguageConfig `yaml:"languages"`
+	}
+	for _, l := range r.listLocked() {
+		_c.Languages = append(_c.Languages, *l)
+	}
+	data, err := yaml.Marshal(&_c)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(r.file, data, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write language config")
+	}
+	return nil
+}
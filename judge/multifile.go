@@ -0,0 +1,120 @@
+package judge
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxArchiveSize 多文件提交解压后的默认总大小上限
+const DefaultMaxArchiveSize = 10 << 20
+
+// 多文件提交的错误
+var (
+	ErrPathTraversal   = errors.New("archive contains an invalid path")
+	ErrArchiveTooLarge = errors.New("archive is too large")
+	ErrMainFileMissing = errors.New("main file is not in the archive")
+)
+
+// MultiFileSubmission 由多个文件组成的提交, 如带有头文件的C++程序
+type MultiFileSubmission struct {
+	// Files 文件路径(相对于工作目录, 使用 / 分隔)到内容的映射
+	Files map[string][]byte
+	// MainFile 主文件路径, 编译时会被放置为语言的源文件名
+	MainFile string
+}
+
+// cleanArchivePath 检查压缩包内的路径, 返回规范化后的路径
+func cleanArchivePath(name string) (string, error) {
+	if name == "" || strings.Contains(name, "\\") || path.IsAbs(name) {
+		return "", errors.Wrap(ErrPathTraversal, name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", errors.Wrap(ErrPathTraversal, name)
+		}
+	}
+	clean := path.Clean(name)
+	if clean == "." {
+		return "", errors.Wrap(ErrPathTraversal, name)
+	}
+	return clean, nil
+}
+
+// ParseMultiFileSubmission 解压zip格式的多文件提交
+//
+// 压缩包内的路径不能为绝对路径或包含 "..", 解压后的总大小不能超过 maxSize(不大于0时为 DefaultMaxArchiveSize).
+// 大小按实际解压出的字节数计算, 不信任压缩包中记录的大小.
+func ParseMultiFileSubmission(archive []byte, mainFile string, maxSize int64) (*MultiFileSubmission, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxArchiveSize
+	}
+
+	mainFile, err := cleanArchivePath(mainFile)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid zip archive")
+	}
+
+	sub := &MultiFileSubmission{Files: make(map[string][]byte), MainFile: mainFile}
+	remaining := maxSize
+	for _, f := range zr.File {
+		name, err := cleanArchivePath(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			return nil, errors.Wrap(ErrPathTraversal, f.Name+" is not a regular file")
+		}
+		if _, ok := sub.Files[name]; ok {
+			return nil, errors.New("duplicate file " + name + " in archive")
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open "+name)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, remaining+1))
+		rc.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read "+name)
+		}
+		remaining -= int64(len(content))
+		if remaining < 0 {
+			return nil, ErrArchiveTooLarge
+		}
+		sub.Files[name] = content
+	}
+
+	if _, ok := sub.Files[mainFile]; !ok {
+		return nil, errors.Wrap(ErrMainFileMissing, mainFile)
+	}
+	return sub, nil
+}
+
+// SandboxFiles 返回复制到编译容器中的文件, 主文件被重命名为语言的源文件名
+func (s *MultiFileSubmission) SandboxFiles(lang *LanguageConfig) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(s.Files))
+	for name, content := range s.Files {
+		if name == s.MainFile {
+			continue
+		}
+		if name == lang.SourceFile() || name == lang.BinaryFile() {
+			return nil, errors.New("file " + name + " conflicts with the main file name " + lang.SourceFile())
+		}
+		files[name] = content
+	}
+	files[lang.SourceFile()] = s.Files[s.MainFile]
+	return files, nil
+}
@@ -3,16 +3,66 @@ package judge
 import (
 	"log"
 	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/mrhaoxx/SOJ/types"
 	"github.com/pkg/errors"
+	zlog "github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultPidsLimit 未配置时评测容器的默认进程数上限
+const DefaultPidsLimit = 512
+
+// ProblemStore 问题存储
+type ProblemStore interface {
+	GetProblem(id string) (types.Problem, bool)
+	GetAllProblems() map[string]types.Problem
+	GetProblemList() []string
+}
+
+var _ ProblemStore = (*ProblemManager)(nil)
+
+// ErrProblemNotFound 问题不存在
+var ErrProblemNotFound = errors.New("problem not found")
+
+// ProblemEditor 可以在运行时修改的问题存储
+type ProblemEditor interface {
+	ProblemStore
+	// SaveProblem 创建或替换问题
+	SaveProblem(p types.Problem) error
+	// DeleteProblem 删除问题, 不存在时返回 ErrProblemNotFound
+	DeleteProblem(id string) error
+}
+
+var _ ProblemEditor = (*ProblemManager)(nil)
+
 // ProblemManager 问题管理器
+//
+// 问题定义文件为YAML格式, 由于JSON是YAML的子集, 也可以直接使用JSON文件.
+// 修改问题时整体替换内部的map, 已经通过 GetAllProblems 取得的map不会被修改.
 type ProblemManager struct {
+	mu       sync.RWMutex
 	problems map[string]types.Problem
 	pblms    []string
+	// dir 问题目录, files 问题ID到定义文件路径的映射, 用于保存修改
+	dir   string
+	files map[string]string
+
+	testCases TestCaseStore
+
+	difficulty *DifficultyTracker
+
+	// maxTimeLimitMs, maxMemoryLimitKB 题目限制的上限, 为0时不限制
+	maxTimeLimitMs   int64
+	maxMemoryLimitKB int64
+
+	// onUpdated 已有的问题被 SaveProblem 替换后调用
+	onUpdated []func(old, updated types.Problem)
 }
 
 // NewProblemManager 创建新的问题管理器
@@ -20,9 +70,92 @@ func NewProblemManager() *ProblemManager {
 	return &ProblemManager{
 		problems: make(map[string]types.Problem),
 		pblms:    make([]string, 0),
+		files:    make(map[string]string),
 	}
 }
 
+// SetTestCaseStore 设置测试点存储, 设置后加载按测试点评测的问题时会检查其是否有测试点
+func (pm *ProblemManager) SetTestCaseStore(store TestCaseStore) {
+	pm.testCases = store
+}
+
+// TestCases 返回测试点存储, 未设置时为nil
+func (pm *ProblemManager) TestCases() TestCaseStore {
+	return pm.testCases
+}
+
+// SetDifficultyTracker 设置难度计算器, 设置后 GetProblem 返回的问题带有 DifficultyRating
+func (pm *ProblemManager) SetDifficultyTracker(t *DifficultyTracker) {
+	pm.difficulty = t
+}
+
+// SetLimits 设置题目时间限制(毫秒)和内存限制(KB)的上限, 为0时不限制, 需要在加载问题之前调用
+//
+// 超过上限的问题在加载或保存时被拒绝, 而不是被静默地截断.
+func (pm *ProblemManager) SetLimits(maxTimeLimitMs, maxMemoryLimitKB int64) {
+	pm.maxTimeLimitMs = maxTimeLimitMs
+	pm.maxMemoryLimitKB = maxMemoryLimitKB
+}
+
+// OnProblemUpdated 注册已有的问题被 SaveProblem 替换后的回调, 回调在 SaveProblem 的调用方协程中执行
+func (pm *ProblemManager) OnProblemUpdated(fn func(old, updated types.Problem)) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.onUpdated = append(pm.onUpdated, fn)
+}
+
+// prepareProblem 填充问题的默认值并检查问题定义
+func (pm *ProblemManager) prepareProblem(p *types.Problem) error {
+	if p.Weight == 0 {
+		p.Weight = 1.0
+	}
+
+	for i := range p.Workflow {
+		if p.Workflow[i].PidsLimit == 0 {
+			p.Workflow[i].PidsLimit = DefaultPidsLimit
+		}
+	}
+
+	if p.ScoringMode == "" {
+		p.ScoringMode = types.ScoringMax
+	}
+
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+
+	if !p.IsWorkflow() {
+		if p.CompareMode == "" {
+			p.CompareMode = types.CompareIgnoreTrailingWhitespace
+		}
+		if pm.maxTimeLimitMs > 0 && p.TimeLimitMs > pm.maxTimeLimitMs {
+			return errors.New("timelimitms " + strconv.FormatInt(p.TimeLimitMs, 10) + " exceeds the maximum " + strconv.FormatInt(pm.maxTimeLimitMs, 10))
+		}
+		if pm.maxMemoryLimitKB > 0 && p.MemoryLimitKB > pm.maxMemoryLimitKB {
+			return errors.New("memorylimitkb " + strconv.FormatInt(p.MemoryLimitKB, 10) + " exceeds the maximum " + strconv.FormatInt(pm.maxMemoryLimitKB, 10))
+		}
+		if pm.testCases != nil {
+			cases, err := pm.testCases.ListTestCases(p.Id)
+			switch {
+			case errors.Is(err, ErrNoTestCases) && p.Generator != nil:
+				// 有生成器的题目可以在加载后再生成测试点
+			case err != nil:
+				return errors.Wrap(err, "failed to load test cases")
+			default:
+				err = checkSubtasks(p.Subtasks, cases)
+				if err != nil {
+					return errors.Wrap(err, "invalid subtasks")
+				}
+			}
+		}
+		if p.Statement == "" && p.Text == "" {
+			zlog.Warn().Str("problem", p.Id).Msg("problem has no statement")
+		}
+	}
+	return nil
+}
+
 // LoadProblem 加载单个问题
 func (pm *ProblemManager) LoadProblem(file string) types.Problem {
 	_f, err := os.ReadFile(file)
@@ -39,12 +172,16 @@ func (pm *ProblemManager) LoadProblem(file string) types.Problem {
 		panic(errors.Wrap(err, "failed to unmarshal problem "+file))
 	}
 
-	if _p.Weight == 0 {
-		_p.Weight = 1.0
+	err = pm.prepareProblem(&_p)
+	if err != nil {
+		panic(errors.Wrap(err, "invalid problem "+file))
 	}
 
+	pm.mu.Lock()
 	pm.pblms = append(pm.pblms, _p.Id)
 	pm.problems[_p.Id] = _p
+	pm.files[_p.Id] = file
+	pm.mu.Unlock()
 	return _p
 }
 
@@ -56,30 +193,150 @@ func (pm *ProblemManager) LoadProblemDir(dir string) map[string]types.Problem {
 		panic(err)
 	}
 
+	pm.mu.Lock()
+	pm.dir = dir
 	pm.problems = make(map[string]types.Problem)
 	pm.pblms = make([]string, 0)
+	pm.files = make(map[string]string)
+	pm.mu.Unlock()
 
 	for _, f := range _f {
 		var _pf = pm.LoadProblem(dir + "/" + f.Name())
-		pm.problems[_pf.Id] = _pf
 		log.Println("loaded problem", _pf.Id)
 	}
 
 	return pm.problems
 }
 
+// validProblemID 检查问题ID能否用作文件名
+func validProblemID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, "/\\")
+}
+
+// SaveProblem 创建或替换问题, 并写入问题目录
+//
+// 新问题保存为 {问题目录}/{ID}.yaml, 已有的问题覆盖其原来的定义文件.
+func (pm *ProblemManager) SaveProblem(p types.Problem) error {
+	if !validProblemID(p.Id) {
+		return errors.New("invalid problem id " + strconv.Quote(p.Id))
+	}
+	err := pm.prepareProblem(&p)
+	if err != nil {
+		return err
+	}
+
+	pm.mu.Lock()
+	old, ok := pm.problems[p.Id]
+	err = pm.saveLocked(p)
+	hooks := pm.onUpdated
+	pm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		for _, fn := range hooks {
+			fn(old, p)
+		}
+	}
+	return nil
+}
+
+// saveLocked 写入问题定义文件并替换内部的map, 调用方需持有写锁
+func (pm *ProblemManager) saveLocked(p types.Problem) error {
+	if pm.dir == "" {
+		return errors.New("problem directory is not set")
+	}
+	file, ok := pm.files[p.Id]
+	if !ok {
+		file = path.Join(pm.dir, p.Id+".yaml")
+	}
+	data, err := yaml.Marshal(&p)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(file, data, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write problem "+p.Id)
+	}
+
+	problems := make(map[string]types.Problem, len(pm.problems)+1)
+	for id, q := range pm.problems {
+		problems[id] = q
+	}
+	problems[p.Id] = p
+	pm.problems = problems
+	if !ok {
+		pm.pblms = append(pm.pblms[:len(pm.pblms):len(pm.pblms)], p.Id)
+		pm.files[p.Id] = file
+	}
+	zlog.Info().Str("problem", p.Id).Bool("created", !ok).Msg("problem saved")
+	return nil
+}
+
+// DeleteProblem 删除问题及其定义文件, 已有的提交记录不受影响
+func (pm *ProblemManager) DeleteProblem(id string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if _, ok := pm.problems[id]; !ok {
+		return ErrProblemNotFound
+	}
+	err := os.Remove(pm.files[id])
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove problem "+id)
+	}
+
+	problems := make(map[string]types.Problem, len(pm.problems))
+	for pid, q := range pm.problems {
+		if pid != id {
+			problems[pid] = q
+		}
+	}
+	pm.problems = problems
+	pm.pblms = slices.DeleteFunc(slices.Clone(pm.pblms), func(pid string) bool { return pid == id })
+	delete(pm.files, id)
+	zlog.Info().Str("problem", id).Msg("problem deleted")
+	return nil
+}
+
 // GetProblem 获取问题
 func (pm *ProblemManager) GetProblem(id string) (types.Problem, bool) {
+	pm.mu.RLock()
 	p, ok := pm.problems[id]
+	pm.mu.RUnlock()
+	if ok && pm.difficulty != nil {
+		p.DifficultyRating = pm.difficulty.Rating(id)
+	}
 	return p, ok
 }
 
-// GetAllProblems 获取所有问题
+// GetAllProblems 获取所有问题, 返回的map不能被修改
 func (pm *ProblemManager) GetAllProblems() map[string]types.Problem {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	return pm.problems
 }
 
 // GetProblemList 获取问题列表
 func (pm *ProblemManager) GetProblemList() []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	return pm.pblms
 }
+
+// checkSubtasks 检查子任务引用的测试点是否都存在
+func checkSubtasks(subtasks []types.Subtask, cases []TestCase) error {
+	ids := make(map[string]bool, len(cases))
+	for _, tc := range cases {
+		ids[tc.ID] = true
+	}
+	for _, st := range subtasks {
+		for _, id := range st.TestCases {
+			if !ids[id] {
+				return errors.New("subtask " + st.Name + " references unknown test case " + id)
+			}
+		}
+	}
+	return nil
+}
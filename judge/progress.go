@@ -0,0 +1,95 @@
+package judge
+
+import (
+	"sync"
+
+	"github.com/mrhaoxx/SOJ/types"
+)
+
+// 评测进度事件类型
+const (
+	ProgressTestCase = "testcase" // 一个测试点运行结束
+	ProgressDone     = "done"     // 评测结束, 之后不再有事件
+)
+
+// progressBuffer 每个订阅者缓冲的事件数, 订阅者读取过慢时丢弃测试点事件
+const progressBuffer = 64
+
+// ProgressEvent 评测进度事件
+type ProgressEvent struct {
+	Type     string             `json:"type"`
+	TestCase *TestCaseResult    `json:"testcase,omitempty"`
+	Status   string             `json:"status,omitempty"`
+	Result   *types.JudgeResult `json:"result,omitempty"`
+}
+
+// ProgressHub 按提交ID分发评测进度
+//
+// 评测过程中产生的事件只推送给当时已订阅的订阅者, 不会保存.
+// 订阅者应先订阅, 再查询提交的当前状态, 以免错过 done 事件.
+type ProgressHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan ProgressEvent]struct{}
+}
+
+// NewProgressHub 创建评测进度分发器
+func NewProgressHub() *ProgressHub {
+	return &ProgressHub{
+		subs: make(map[string]map[chan ProgressEvent]struct{}),
+	}
+}
+
+// Subscribe 订阅提交的评测进度
+//
+// 收到 done 事件后通道会被关闭. 返回的函数用于提前取消订阅, 可以重复调用.
+func (h *ProgressHub) Subscribe(id string) (<-chan ProgressEvent, func()) {
+	ch := make(chan ProgressEvent, progressBuffer)
+
+	h.mu.Lock()
+	if h.subs[id] == nil {
+		h.subs[id] = make(map[chan ProgressEvent]struct{})
+	}
+	h.subs[id][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[id][ch]; ok {
+			delete(h.subs[id], ch)
+			if len(h.subs[id]) == 0 {
+				delete(h.subs, id)
+			}
+			close(ch)
+		}
+	}
+}
+
+// Publish 推送评测进度
+//
+// done 事件会关闭该提交的所有订阅.
+func (h *ProgressHub) Publish(id string, ev ProgressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[id] {
+		if ev.Type == ProgressDone {
+			// done 事件必须送达, 缓冲区满时丢弃最早的事件
+			select {
+			case ch <- ev:
+			default:
+				<-ch
+				ch <- ev
+			}
+			close(ch)
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	if ev.Type == ProgressDone {
+		delete(h.subs, id)
+	}
+}
@@ -0,0 +1,353 @@
+package judge
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mrhaoxx/SOJ/metrics"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// 评测队列的默认配置
+const (
+	DefaultJudgeWorkers   = 4
+	DefaultJudgeQueueSize = 256
+)
+
+// ErrQueueClosed 队列已关闭, 不再接受新的提交
+var ErrQueueClosed = errors.New("submission queue is closed")
+
+// Submission 排队等待评测的提交
+type Submission interface {
+	// ID 提交ID, 用于日志
+	ID() string
+	// Judge 执行评测, 返回时评测必须已经结束. ctx 在队列关闭时被取消.
+	Judge(ctx context.Context)
+}
+
+// WorkflowSubmission 使用 Evaluator.RunJudge 评测的提交
+type WorkflowSubmission struct {
+	Evaluator *Evaluator
+	Ctx       *types.SubmitCtx
+	Problem   *types.Problem
+}
+
+// ID 提交ID
+func (s *WorkflowSubmission) ID() string {
+	return s.Ctx.ID
+}
+
+// Judge 执行评测
+func (s *WorkflowSubmission) Judge(ctx context.Context) {
+	s.Evaluator.RunJudge(ctx, s.Ctx, s.Problem)
+}
+
+// Verdict 评测结论, 工作流评测没有结论时按分数推断
+func (s *WorkflowSubmission) Verdict() types.Verdict {
+	res := s.Ctx.JudgeResult
+	switch {
+	case s.Ctx.Status != "completed" || !res.Success:
+		return types.VerdictSystemError
+	case res.Verdict != "":
+		return res.Verdict
+	case res.Score >= types.FullScore:
+		return types.VerdictAccepted
+	}
+	return types.VerdictWrongAnswer
+}
+
+// verdictReporter 评测结束后可以给出结论的提交, 用于统计指标
+type verdictReporter interface {
+	Verdict() types.Verdict
+}
+
+// SubmissionQueue 评测队列
+//
+// 提交先进入固定容量的缓冲区, 再由固定数量的worker依次取出评测,
+// 以此限制同时运行的评测容器数量, 避免比赛高峰时压垮Docker.
+// 通过 EnqueueLow 加入的提交(如重测)只在没有新提交排队时才被评测.
+type SubmissionQueue struct {
+	workers  int
+	queue    chan Submission
+	low      chan Submission
+	onResult func(Submission)
+
+	// busy 正在评测的worker数
+	busy atomic.Int32
+
+	mu     sync.RWMutex
+	closed bool
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSubmissionQueue 创建评测队列
+//
+// workers 为同时评测的提交数, size 为排队的提交数上限, 不大于0时使用默认值.
+// onResult 在每个提交评测结束后由worker调用, 可以为nil.
+func NewSubmissionQueue(workers, size int, onResult func(Submission)) *SubmissionQueue {
+	if workers <= 0 {
+		workers = DefaultJudgeWorkers
+	}
+	if size <= 0 {
+		size = DefaultJudgeQueueSize
+	}
+	return &SubmissionQueue{
+		workers:  workers,
+		queue:    make(chan Submission, size),
+		low:      make(chan Submission, size),
+		onResult: onResult,
+	}
+}
+
+// Start 启动worker, ctx 会传递给每个提交的 Judge
+func (q *SubmissionQueue) Start(ctx context.Context) {
+	ctx, q.cancel = context.WithCancel(ctx)
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx, i)
+	}
+	log.Info().Int("workers", q.workers).Int("size", cap(q.queue)).Msg("submission queue started")
+}
+
+func (q *SubmissionQueue) worker(ctx context.Context, idx int) {
+	defer q.wg.Done()
+	for {
+		sub, ok := q.next()
+		if !ok {
+			return
+		}
+		metrics.QueueDepth.Set(float64(q.Len()))
+		log.Debug().Int("worker", idx).Str("id", sub.ID()).Msg("judging submission")
+		q.busy.Add(1)
+		sub.Judge(ctx)
+		q.busy.Add(-1)
+		if v, ok := sub.(verdictReporter); ok {
+			metrics.SubmissionsTotal.WithLabelValues(string(v.Verdict())).Inc()
+		}
+		if q.onResult != nil {
+			q.onResult(sub)
+		}
+	}
+}
+
+// next 取出下一个待评测的提交, 优先取普通优先级的提交; 队列关闭且为空时返回 false
+func (q *SubmissionQueue) next() (Submission, bool) {
+	select {
+	case sub, ok := <-q.queue:
+		if ok {
+			return sub, true
+		}
+		sub, ok = <-q.low
+		return sub, ok
+	default:
+	}
+
+	select {
+	case sub, ok := <-q.queue:
+		if ok {
+			return sub, true
+		}
+		sub, ok = <-q.low
+		return sub, ok
+	case sub, ok := <-q.low:
+		if ok {
+			return sub, true
+		}
+		sub, ok = <-q.queue
+		return sub, ok
+	}
+}
+
+// Enqueue 将提交加入队列, 队列已满时阻塞直到有空位
+func (q *SubmissionQueue) Enqueue(sub Submission) error {
+	return q.enqueue(q.queue, sub)
+}
+
+// EnqueueLow 以低优先级将提交加入队列, 用于重测等不紧急的评测
+func (q *SubmissionQueue) EnqueueLow(sub Submission) error {
+	return q.enqueue(q.low, sub)
+}
+
+func (q *SubmissionQueue) enqueue(ch chan Submission, sub Submission) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	ch <- sub
+	metrics.QueueDepth.Set(float64(q.Len()))
+	log.Debug().Str("id", sub.ID()).Int("pending", q.Len()).Bool("low", ch == q.low).Msg("submission enqueued")
+	return nil
+}
+
+// Len 返回排队中(尚未开始评测)的提交数, 包括低优先级的提交
+func (q *SubmissionQueue) Len() int {
+	return len(q.queue) + len(q.low)
+}
+
+// Workers 返回worker总数
+func (q *SubmissionQueue) Workers() int {
+	return q.workers
+}
+
+// IdleWorkers 返回当前空闲的worker数
+func (q *SubmissionQueue) IdleWorkers() int {
+	return q.workers - int(q.busy.Load())
+}
+
+// Shutdown 停止接受新的提交, 并等待已入队的提交全部评测完成
+//
+// ctx 结束时不再等待, 取消传给 Judge 的 ctx 并返回 ctx.Err().
+func (q *SubmissionQueue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+		close(q.low)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info().Msg("submission queue drained")
+		return nil
+	case <-ctx.Done():
+		if q.cancel != nil {
+			q.cancel()
+		}
+		log.Warn().Int("pending", q.Len()).Msg("submission queue shutdown timed out")
+		return ctx.Err()
+	}
+}
+
+// SourceSubmission 按测试点评测的源代码提交, 评测结果写回 Store
+type SourceSubmission struct {
+	Evaluator  *Evaluator
+	Store      types.SubmissionStore
+	TestCases  TestCaseStore
+	Submission *types.Submission
+	Problem    *types.Problem
+	Language   *LanguageConfig
+	// Progress 推送评测进度, 可以为nil
+	Progress *ProgressHub
+	// MaxArchiveSize 多文件提交解压后的总大小上限, 见 ParseMultiFileSubmission
+	MaxArchiveSize int64
+}
+
+// ID 提交ID
+func (s *SourceSubmission) ID() string {
+	return s.Submission.ID
+}
+
+// Judge 执行评测
+func (s *SourceSubmission) Judge(ctx context.Context) {
+	l := log.With().Str("id", s.Submission.ID).Str("problem", s.Problem.Id).Str("language", s.Language.ID).Logger()
+	// 重测被hack的提交时保留hack记录
+	hack := s.Submission.JudgeResult.Hack
+
+	fail := func(err error, msg string) {
+		l.Err(err).Msg(msg)
+		s.Submission.Status = types.SubmissionFailed
+		s.Submission.JudgeResult = types.JudgeResult{Verdict: types.VerdictSystemError, Msg: msg}
+		s.Submission.JudgeResult.KeepHack(hack)
+		err = s.Store.UpdateResult(s.Submission.ID, s.Submission.Status, &s.Submission.JudgeResult)
+		if err != nil {
+			l.Err(err).Msg("failed to update submission")
+		}
+		s.publishDone()
+	}
+
+	s.Submission.Status = types.SubmissionJudging
+	err := s.Store.UpdateResult(s.Submission.ID, s.Submission.Status, nil)
+	if err != nil {
+		l.Err(err).Msg("failed to update submission")
+	}
+
+	cases, err := s.TestCases.ListTestCases(s.Problem.Id)
+	if err != nil {
+		fail(err, "failed to load test cases")
+		return
+	}
+
+	files, err := s.files()
+	if err != nil {
+		fail(err, "invalid archive")
+		return
+	}
+
+	cfg := s.runConfig()
+	cfg.OnTestCase = func(r TestCaseResult) {
+		if s.Progress != nil {
+			s.Progress.Publish(s.Submission.ID, ProgressEvent{Type: ProgressTestCase, TestCase: &r})
+		}
+	}
+	res, _, err := s.Evaluator.JudgeFiles(ctx, files, cases, cfg)
+	if err != nil {
+		fail(err, "judge failed")
+		return
+	}
+
+	res.KeepHack(hack)
+	s.Submission.Status = types.SubmissionCompleted
+	s.Submission.JudgeResult = *res
+	err = s.Store.UpdateResult(s.Submission.ID, s.Submission.Status, res)
+	if err != nil {
+		l.Err(err).Msg("failed to update submission")
+	}
+	s.publishDone()
+	l.Info().Str("verdict", string(res.Verdict)).Float64("score", res.Score).Msg("submission judged")
+}
+
+// Verdict 评测结论, 评测失败时为 SE
+func (s *SourceSubmission) Verdict() types.Verdict {
+	if s.Submission.Status != types.SubmissionCompleted {
+		return types.VerdictSystemError
+	}
+	return s.Submission.JudgeResult.Verdict
+}
+
+// runConfig 返回按题目限制评测提交的配置
+func (s *SourceSubmission) runConfig() RunConfig {
+	return RunConfig{
+		Language:      s.Language,
+		TimeLimitMs:   s.Problem.TimeLimitMs,
+		MemoryLimitKB: s.Problem.MemoryLimitKB,
+		OutputLimitKB: s.Problem.OutputLimitKB,
+		CompileFlags:  s.Problem.CompileFlags,
+		Checker:       s.Evaluator.problemChecker(s.Problem),
+		Interactor:    s.Problem.Interactor,
+		Subtasks:      s.Problem.Subtasks,
+	}
+}
+
+// files 返回编译时使用的文件
+func (s *SourceSubmission) files() (map[string][]byte, error) {
+	if s.Submission.Archive == nil {
+		return map[string][]byte{s.Language.SourceFile(): []byte(s.Submission.SourceCode)}, nil
+	}
+	mf, err := ParseMultiFileSubmission(s.Submission.Archive, s.Submission.MainFile, s.MaxArchiveSize)
+	if err != nil {
+		return nil, err
+	}
+	return mf.SandboxFiles(s.Language)
+}
+
+func (s *SourceSubmission) publishDone() {
+	if s.Progress == nil {
+		return
+	}
+	res := s.Submission.JudgeResult
+	s.Progress.Publish(s.Submission.ID, ProgressEvent{Type: ProgressDone, Status: s.Submission.Status, Result: &res})
+}
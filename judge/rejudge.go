@@ -0,0 +1,232 @@
+package judge
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// RejudgeStatus 一次重测的进度
+type RejudgeStatus struct {
+	ProblemID string    `json:"problem_id"`
+	Reason    string    `json:"reason"`
+	StartedAt time.Time `json:"started_at"`
+	// FinishedAt 全部提交重测结束的时间, 未结束时为nil
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	Total int `json:"total"`
+	Done  int `json:"done"`
+	// Changed 结论发生变化的提交数
+	Changed int `json:"changed"`
+	// Superseded 是否已被同一题目更新的重测取代, 被取代后剩余的提交不再评测
+	Superseded bool `json:"superseded,omitempty"`
+}
+
+// RejudgeQueue 在题目的测试点或限制变化后重测已完成的提交
+//
+// 重测以低优先级加入评测队列, 只有在没有新提交排队时才会被评测.
+// 同一题目同时只有一次重测, 新的重测开始时, 旧的重测中尚未评测的提交会被跳过.
+type RejudgeQueue struct {
+	queue     *SubmissionQueue
+	evaluator *Evaluator
+	store     types.SubmissionStore
+	problems  ProblemStore
+	testCases TestCaseStore
+	// MaxArchiveSize 多文件提交解压后的总大小上限, 见 ParseMultiFileSubmission
+	MaxArchiveSize int64
+
+	mu     sync.Mutex
+	status map[string]*RejudgeStatus
+}
+
+// NewRejudgeQueue 创建重测队列
+func NewRejudgeQueue(queue *SubmissionQueue, evaluator *Evaluator, store types.SubmissionStore, problems ProblemStore, testCases TestCaseStore) *RejudgeQueue {
+	return &RejudgeQueue{
+		queue:     queue,
+		evaluator: evaluator,
+		store:     store,
+		problems:  problems,
+		testCases: testCases,
+		status:    make(map[string]*RejudgeStatus),
+	}
+}
+
+// judgingChanged 判断题目的修改是否影响评测结果
+func judgingChanged(old, updated types.Problem) bool {
+	return old.TimeLimitMs != updated.TimeLimitMs ||
+		old.MemoryLimitKB != updated.MemoryLimitKB ||
+		old.OutputLimitKB != updated.OutputLimitKB ||
+		old.CompareMode != updated.CompareMode ||
+		!equalPtr(old.Checker, updated.Checker) ||
+		!equalPtr(old.Interactor, updated.Interactor) ||
+		!slices.EqualFunc(old.Subtasks, updated.Subtasks, func(a, b types.Subtask) bool {
+			return a.Name == b.Name && a.Points == b.Points && slices.Equal(a.TestCases, b.TestCases)
+		})
+}
+
+// equalPtr 两个指针都为nil或指向相等的值
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Watch 在题目的时间, 内存, 输出限制, 比较方式或子任务变化时自动重测
+//
+// 测试点数据的变化不经过 ProblemManager, 写入测试点的调用方应自行调用 Rejudge.
+func (r *RejudgeQueue) Watch(pm *ProblemManager) {
+	pm.OnProblemUpdated(func(old, updated types.Problem) {
+		if updated.IsWorkflow() || !judgingChanged(old, updated) {
+			return
+		}
+		_, err := r.Rejudge(updated.Id, "problem updated")
+		if err != nil {
+			log.Err(err).Str("problem", updated.Id).Msg("failed to start rejudge")
+		}
+	})
+}
+
+// Rejudge 重测题目所有评测完成的源代码提交, 返回本次重测的进度
+//
+// 提交在后台加入队列, 本方法不会阻塞. 测试点数据在每个提交评测时读取, 因此更新测试点后调用即可.
+func (r *RejudgeQueue) Rejudge(problemID, reason string) (RejudgeStatus, error) {
+	problem, ok := r.problems.GetProblem(problemID)
+	if !ok {
+		return RejudgeStatus{}, ErrProblemNotFound
+	}
+	if r.evaluator.Languages() == nil {
+		return RejudgeStatus{}, errors.New("source submissions are not enabled")
+	}
+
+	all, err := r.store.ListByProblem(problemID)
+	if err != nil {
+		return RejudgeStatus{}, err
+	}
+	var subs []types.Submission
+	for _, sub := range all {
+		if sub.Status == types.SubmissionCompleted {
+			subs = append(subs, sub)
+		}
+	}
+
+	st := &RejudgeStatus{
+		ProblemID: problemID,
+		Reason:    reason,
+		StartedAt: time.Now(),
+		Total:     len(subs),
+	}
+
+	r.mu.Lock()
+	if prev, ok := r.status[problemID]; ok && prev.FinishedAt == nil {
+		prev.Superseded = true
+	}
+	r.status[problemID] = st
+	if st.Total == 0 {
+		now := time.Now()
+		st.FinishedAt = &now
+	}
+	snapshot := *st
+	r.mu.Unlock()
+
+	log.Info().Str("problem", problemID).Str("reason", reason).Int("total", len(subs)).Msg("rejudge started")
+
+	go func() {
+		for i := range subs {
+			sub := &subs[i]
+			lang, ok := r.evaluator.Languages().GetByID(sub.Language)
+			if !ok {
+				log.Warn().Str("id", sub.ID).Str("language", sub.Language).Msg("language of rejudged submission not found")
+				r.finish(st, false)
+				continue
+			}
+			err := r.queue.EnqueueLow(&rejudgeSubmission{
+				source: SourceSubmission{
+					Evaluator:      r.evaluator,
+					Store:          r.store,
+					TestCases:      r.testCases,
+					Submission:     sub,
+					Problem:        &problem,
+					Language:       lang,
+					MaxArchiveSize: r.MaxArchiveSize,
+				},
+				rq:     r,
+				status: st,
+				before: sub.JudgeResult.Verdict,
+			})
+			if err != nil {
+				log.Err(err).Str("problem", problemID).Msg("failed to enqueue rejudge")
+				return
+			}
+		}
+	}()
+
+	return snapshot, nil
+}
+
+// Status 返回题目最近一次重测的进度
+func (r *RejudgeQueue) Status(problemID string) (RejudgeStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st, ok := r.status[problemID]
+	if !ok {
+		return RejudgeStatus{}, false
+	}
+	return *st, true
+}
+
+// superseded 重测是否已被取代
+func (r *RejudgeQueue) superseded(st *RejudgeStatus) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return st.Superseded
+}
+
+// finish 记录一个提交重测结束
+func (r *RejudgeQueue) finish(st *RejudgeStatus, changed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st.Done++
+	if changed {
+		st.Changed++
+	}
+	if st.Done == st.Total {
+		now := time.Now()
+		st.FinishedAt = &now
+		log.Info().Str("problem", st.ProblemID).Int("total", st.Total).Int("changed", st.Changed).Msg("rejudge finished")
+	}
+}
+
+// rejudgeSubmission 重测中的一个提交
+//
+// 不实现 verdictReporter, 重测不计入 judge_submissions_total.
+type rejudgeSubmission struct {
+	source SourceSubmission
+	rq     *RejudgeQueue
+	status *RejudgeStatus
+	before types.Verdict
+}
+
+// ID 提交ID
+func (s *rejudgeSubmission) ID() string {
+	return s.source.ID()
+}
+
+// Judge 重新评测, 所属的重测已被取代时跳过
+func (s *rejudgeSubmission) Judge(ctx context.Context) {
+	if s.rq.superseded(s.status) {
+		s.rq.finish(s.status, false)
+		return
+	}
+	s.source.Judge(ctx)
+	after := s.source.Verdict()
+	if after != s.before {
+		log.Info().Str("id", s.source.ID()).Str("before", string(s.before)).Str("after", string(after)).Msg("rejudge changed verdict")
+	}
+	s.rq.finish(s.status, after != s.before)
+}
@@ -0,0 +1,110 @@
+package judge
+
+import (
+	"context"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/rs/zerolog/log"
+)
+
+// ReplayReport 重放提交的结果
+type ReplayReport struct {
+	SubmissionID string `json:"submission_id"`
+	// Original 重放前提交的评测结果
+	Original types.JudgeResult `json:"original"`
+	// Result 使用当前的测试点和评测配置得到的评测结果, 评测失败时为nil
+	Result    *types.JudgeResult `json:"result,omitempty"`
+	TestCases []TestCaseResult   `json:"test_cases"`
+	// Changed 结论或得分是否与原来的结果不同
+	Changed bool `json:"changed"`
+	// Overwritten 新的结果是否已写回提交
+	Overwritten bool   `json:"overwritten"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ReplayRun 使用当前的测试点和评测配置重新评测已保存的提交, 用于核查成绩争议
+//
+// 与重测不同, 重放默认不修改提交, 只返回新的评测结果; Confirm 为true且评测成功时才用新的结果覆盖原来的结果.
+// ReplayRun 实现了 Submission, 通过评测队列运行.
+type ReplayRun struct {
+	// Source 被重放的提交, 其 Store 只在 Confirm 为true时写入
+	Source SourceSubmission
+	// Confirm 是否用新的结果覆盖提交原来的结果
+	Confirm bool
+
+	report ReplayReport
+	done   chan struct{}
+}
+
+// NewReplayRun 创建提交的重放
+func NewReplayRun(source SourceSubmission, confirm bool) *ReplayRun {
+	return &ReplayRun{
+		Source:  source,
+		Confirm: confirm,
+		report: ReplayReport{
+			SubmissionID: source.Submission.ID,
+			Original:     source.Submission.JudgeResult,
+			TestCases:    []TestCaseResult{},
+		},
+		done: make(chan struct{}),
+	}
+}
+
+// ID 重放ID, 用于日志
+func (r *ReplayRun) ID() string {
+	return "replay-" + r.Source.Submission.ID
+}
+
+// Judge 重新评测提交, Confirm 为true时写回结果
+func (r *ReplayRun) Judge(ctx context.Context) {
+	defer close(r.done)
+
+	s := &r.Source
+	l := log.With().Str("id", s.Submission.ID).Str("problem", s.Problem.Id).Bool("confirm", r.Confirm).Logger()
+
+	cases, err := s.TestCases.ListTestCases(s.Problem.Id)
+	if err != nil {
+		l.Err(err).Msg("failed to load test cases for replay")
+		r.report.Error = "failed to load test cases"
+		return
+	}
+	files, err := s.files()
+	if err != nil {
+		l.Err(err).Msg("invalid archive in replay")
+		r.report.Error = "invalid archive"
+		return
+	}
+	res, results, err := s.Evaluator.JudgeFiles(ctx, files, cases, s.runConfig())
+	if err != nil {
+		l.Err(err).Msg("replay failed")
+		r.report.Error = "judge failed"
+		return
+	}
+
+	r.report.Result = res
+	if results != nil {
+		r.report.TestCases = results
+	}
+	r.report.Changed = res.Verdict != r.report.Original.Verdict || res.Score != r.report.Original.Score
+
+	if r.Confirm {
+		err = s.Store.UpdateResult(s.Submission.ID, types.SubmissionCompleted, res)
+		if err != nil {
+			l.Err(err).Msg("failed to overwrite replayed submission")
+			r.report.Error = "failed to save result"
+			return
+		}
+		r.report.Overwritten = true
+	}
+	l.Info().Str("before", string(r.report.Original.Verdict)).Str("after", string(res.Verdict)).Bool("overwritten", r.report.Overwritten).Msg("submission replayed")
+}
+
+// Wait 等待重放结束, ctx 结束时返回 ctx.Err()
+func (r *ReplayRun) Wait(ctx context.Context) (*ReplayReport, error) {
+	select {
+	case <-r.done:
+		return &r.report, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
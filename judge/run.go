@@ -0,0 +1,140 @@
+package judge
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// mleThreshold 被 SIGKILL 结束时, 内存峰值达到限制的该比例即视为超出内存限制
+const mleThreshold = 0.95
+
+// DefaultOutputLimit 沙箱中运行的命令的标准输出和标准错误各自的默认大小上限(字节)
+const DefaultOutputLimit = 64 << 20
+
+// limitedWriter 至多向 w 写入 n 字节, 其余数据被丢弃并记录为超出限制
+//
+// 超出限制后仍然返回成功, 以便继续读取并丢弃输出, 而不是让exec因写入失败而出错.
+type limitedWriter struct {
+	w        io.Writer
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		l.exceeded = true
+		if l.n > 0 {
+			l.w.Write(p[:l.n])
+			l.n = 0
+		}
+		return len(p), nil
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
+
+// sandboxCmd 让容器保持运行的主进程, 实际的命令通过exec执行
+var sandboxCmd = []string{"sleep", "infinity"}
+
+// sandboxConfig 返回以 image 运行的沙箱容器的默认配置, 容器名以 prefix 开头
+//
+// 容器以 sleep 保持运行, 实际的命令通过exec执行. 为了能将文件复制到工作目录中, 根文件系统是可写的.
+func sandboxConfig(prefix, image string) *file_transfer.RunConfig {
+	cfg := file_transfer.DefaultRunConfig()
+	cfg.Name = prefix + uuid.NewString()
+	cfg.Image = image
+	cfg.Cmd = sandboxCmd
+	cfg.ReadonlyRootfs = false
+	return cfg
+}
+
+// startSandbox 按 cfg 启动沙箱容器, 并将 files 复制到其工作目录中, files 的键可以包含子目录
+func startSandbox(ctx context.Context, docker file_transfer.DockerServiceInterface, cfg *file_transfer.RunConfig, files map[string][]byte) (string, error) {
+	cid, err := docker.RunImage(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	if len(files) > 0 {
+		err = docker.CopyFilesToContainer(ctx, cid, cfg.Workdir, files)
+		if err != nil {
+			docker.CleanContainer(context.WithoutCancel(ctx), cid, file_transfer.DefaultStopGrace)
+			return "", err
+		}
+	}
+
+	return cid, nil
+}
+
+// runInSandbox 在沙箱容器 cid 中运行一次命令, 并将运行情况整理为 JudgeResult
+//
+// stdout 为nil时标准输出保存在结果的 Stdout 中, 标准错误总是保存在 Stderr 中, 二者各自至多保存
+// outputLimit 字节(不大于0时为 DefaultOutputLimit), 超出部分被丢弃.
+// 超时为 TLE, 被 SIGKILL 且内存峰值接近 memoryLimit 为 MLE, 其他非0退出码为 RE, 标准输出超出限制为 OLE;
+// 正常退出时 Verdict 为空, 由调用方比较输出后决定.
+// 只有无法运行命令时才返回错误.
+func runInSandbox(ctx context.Context, docker file_transfer.DockerServiceInterface, cid, cmd string, timeout int, memoryLimit, outputLimit int64, stdin io.Reader, stdout io.Writer) (*types.JudgeResult, error) {
+	if outputLimit <= 0 {
+		outputLimit = DefaultOutputLimit
+	}
+	var outBuf, errBuf bytes.Buffer
+	limitedOut := &limitedWriter{w: &outBuf, n: outputLimit}
+	if stdout == nil {
+		stdout = limitedOut
+	}
+
+	start := time.Now()
+	ec, _, err := docker.ExecContainer(ctx, cid, cmd, timeout, stdin, stdout, &limitedWriter{w: &errBuf, n: outputLimit}, nil, false, "", "")
+	elapsed := time.Since(start)
+	if err != nil && !errors.Is(err, file_transfer.ErrTimeLimitExceeded) {
+		return nil, err
+	}
+
+	res := &types.JudgeResult{
+		Success:    true,
+		ExitCode:   ec,
+		Time:       uint64(elapsed),
+		TimeUsedMs: elapsed.Milliseconds(),
+		Stdout:     outBuf.String(),
+		Stderr:     errBuf.String(),
+	}
+
+	if _, mem, serr := docker.ContainerStats(ctx, cid); serr == nil {
+		res.Memory = mem
+		res.MemoryUsedKB = int64(mem / 1024)
+	}
+
+	switch {
+	case err != nil:
+		res.Verdict = types.VerdictTimeLimitExceeded
+	case ec == file_transfer.ExitCodeKilled && memoryLimit > 0 && float64(res.Memory) >= float64(memoryLimit)*mleThreshold:
+		res.Verdict = types.VerdictMemoryLimitExceeded
+	case ec != 0:
+		res.Verdict = types.VerdictRuntimeError
+	case limitedOut.exceeded:
+		res.Verdict = types.VerdictOutputLimitExceeded
+	}
+
+	return res, nil
+}
+
+// checkerVerdict 按 testlib 的约定将checker或交互器的退出码转换为评测结论
+func checkerVerdict(ec int) types.Verdict {
+	switch ec {
+	case CheckerExitAccepted:
+		return types.VerdictAccepted
+	case CheckerExitWrongAnswer:
+		return types.VerdictWrongAnswer
+	case CheckerExitPresentationError:
+		return types.VerdictPresentationError
+	default:
+		return types.VerdictSystemError
+	}
+}
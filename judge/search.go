@@ -0,0 +1,161 @@
+package judge
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/mrhaoxx/SOJ/types"
+)
+
+// SearchSummaryLength 建立索引时使用的题面摘要长度(字符)
+const SearchSummaryLength = 1000
+
+// searchTitleWeight 标题中的检索词相对于题面中的检索词的权重
+const searchTitleWeight = 3
+
+// SearchTokens 将文本切分为小写的检索词
+//
+// 字母和数字的连续序列为一个检索词, 汉字等没有分词的文字每个字为一个检索词.
+func SearchTokens(text string) []string {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			cur.WriteRune(unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// indexedProblem 已加入索引的题目
+type indexedProblem struct {
+	// key 题目定义中影响索引内容的部分, 用于判断是否需要重建索引
+	key    string
+	tokens map[string]float64
+}
+
+// ProblemIndex 题目标题和题面摘要的内存倒排索引
+type ProblemIndex struct {
+	mu sync.RWMutex
+	// postings 检索词到题目ID到权重的映射
+	postings map[string]map[string]float64
+	docs     map[string]indexedProblem
+}
+
+// NewProblemIndex 创建空的题目索引
+func NewProblemIndex() *ProblemIndex {
+	return &ProblemIndex{
+		postings: make(map[string]map[string]float64),
+		docs:     make(map[string]indexedProblem),
+	}
+}
+
+// Sync 使索引与 problems 一致
+//
+// 只有新增或标题, 题面被修改的题目才会调用 summary 读取题面摘要并重建索引, 不在 problems 中的题目被移出索引.
+func (idx *ProblemIndex) Sync(problems map[string]types.Problem, summary func(p *types.Problem) string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for id := range idx.docs {
+		if _, ok := problems[id]; !ok {
+			idx.removeLocked(id)
+		}
+	}
+	for id, p := range problems {
+		key := p.Title + "\x00" + p.Statement + "\x00" + p.Text
+		if doc, ok := idx.docs[id]; ok && doc.key == key {
+			continue
+		}
+		idx.removeLocked(id)
+
+		tokens := make(map[string]float64)
+		for _, t := range SearchTokens(p.Title) {
+			tokens[t] += searchTitleWeight
+		}
+		text := []rune(summary(&p))
+		if len(text) > SearchSummaryLength {
+			text = text[:SearchSummaryLength]
+		}
+		for _, t := range SearchTokens(string(text)) {
+			tokens[t]++
+		}
+
+		idx.docs[id] = indexedProblem{key: key, tokens: tokens}
+		for t, w := range tokens {
+			if idx.postings[t] == nil {
+				idx.postings[t] = make(map[string]float64)
+			}
+			idx.postings[t][id] = w
+		}
+	}
+}
+
+// removeLocked 将题目移出索引, 调用方需持有写锁
+func (idx *ProblemIndex) removeLocked(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for t := range doc.tokens {
+		delete(idx.postings[t], id)
+		if len(idx.postings[t]) == 0 {
+			delete(idx.postings, t)
+		}
+	}
+	delete(idx.docs, id)
+}
+
+// Search 返回包含查询中所有检索词的题目及其相关度, 相关度为各检索词权重之和
+//
+// 查询中没有检索词时返回nil.
+func (idx *ProblemIndex) Search(query string) map[string]float64 {
+	terms := SearchTokens(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var scores map[string]float64
+	seen := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		posting := idx.postings[t]
+		if scores == nil {
+			scores = make(map[string]float64, len(posting))
+			for id, w := range posting {
+				scores[id] = w
+			}
+			continue
+		}
+		for id := range scores {
+			w, ok := posting[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += w
+		}
+	}
+	return scores
+}
@@ -0,0 +1,89 @@
+package judge
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// testlib 约定的checker退出码
+const (
+	CheckerExitAccepted          = 0
+	CheckerExitWrongAnswer       = 1
+	CheckerExitPresentationError = 2
+)
+
+// DefaultCheckerTimeout checker的默认运行时间上限(秒)
+const DefaultCheckerTimeout = 10
+
+// SpecialJudge 使用checker程序比较选手输出与标准答案的评测器
+//
+// checker 遵循 Codeforces testlib 的约定, 以 `<Command> input.txt output.txt answer.txt` 调用,
+// 分别为测试输入, 选手输出和标准答案. 退出码 0 为正确, 1 为答案错误, 2 为格式错误,
+// 其他退出码视为checker自身出错. checker写到标准错误的内容作为评测信息.
+type SpecialJudge struct {
+	docker file_transfer.DockerServiceInterface
+
+	Image   string // checker所在的镜像
+	Command string // checker命令, 如 "/checker/check"
+	Timeout int    // 运行时间上限(秒)
+}
+
+// NewSpecialJudge 创建新的special judge
+func NewSpecialJudge(docker file_transfer.DockerServiceInterface, image, command string) *SpecialJudge {
+	return &SpecialJudge{
+		docker:  docker,
+		Image:   image,
+		Command: command,
+		Timeout: DefaultCheckerTimeout,
+	}
+}
+
+// Check 运行checker比较选手输出 actual 与标准答案 expected
+//
+// 只有无法运行checker时才返回错误; checker运行后的任何结果, 包括checker出错, 都以 JudgeResult 返回.
+func (sj *SpecialJudge) Check(ctx context.Context, input, expected, actual []byte) (*types.JudgeResult, error) {
+	cid, err := startSandbox(ctx, sj.docker, sandboxConfig("soj-checker-", sj.Image), map[string][]byte{
+		"input.txt":  input,
+		"output.txt": actual,
+		"answer.txt": expected,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to run checker container")
+	}
+	defer sj.docker.CleanContainer(context.WithoutCancel(ctx), cid, file_transfer.DefaultStopGrace)
+
+	run, err := runInSandbox(ctx, sj.docker, cid, sj.Command+" input.txt output.txt answer.txt", sj.Timeout, 0, 0, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to run checker")
+	}
+
+	output := strings.TrimSpace(run.Stderr)
+	if output == "" {
+		output = strings.TrimSpace(run.Stdout)
+	}
+
+	res := &types.JudgeResult{
+		Success:       true,
+		Msg:           output,
+		Verdict:       checkerVerdict(run.ExitCode),
+		CheckerOutput: output,
+	}
+	switch {
+	case run.Verdict == types.VerdictTimeLimitExceeded:
+		res.Success = false
+		res.Verdict = types.VerdictSystemError
+		res.Msg = "checker time limit exceeded"
+	case res.Verdict == types.VerdictSystemError:
+		res.Success = false
+		log.Warn().Str("image", sj.Image).Str("command", sj.Command).Int("exit_code", run.ExitCode).Str("output", output).Msg("checker failed")
+	case res.Verdict == types.VerdictAccepted:
+		res.Score = 100
+	}
+
+	return res, nil
+}
@@ -0,0 +1,309 @@
+package judge
+
+import (
+	"bytes"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// ErrNoStatement 题目没有题面
+var ErrNoStatement = errors.New("problem has no statement")
+
+// ExampleIO 题面中的样例
+type ExampleIO struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// ProblemStatement 题面, 各部分均为Markdown, 可以使用 $...$ 和 $$...$$ 书写LaTeX公式
+type ProblemStatement struct {
+	Body         string      `json:"body"`
+	InputFormat  string      `json:"input_format,omitempty"`
+	OutputFormat string      `json:"output_format,omitempty"`
+	Constraints  string      `json:"constraints,omitempty"`
+	Examples     []ExampleIO `json:"examples,omitempty"`
+}
+
+// Markdown 将题面的各部分合并为一个Markdown文档
+func (st *ProblemStatement) Markdown() string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(st.Body))
+	b.WriteString("\n")
+
+	section := func(title, text string) {
+		if text = strings.TrimSpace(text); text != "" {
+			b.WriteString("\n## " + title + "\n\n" + text + "\n")
+		}
+	}
+	section("Input", st.InputFormat)
+	section("Output", st.OutputFormat)
+	section("Constraints", st.Constraints)
+
+	for i, ex := range st.Examples {
+		n := strconv.Itoa(i + 1)
+		b.WriteString("\n## Example " + n + "\n\n")
+		b.WriteString(codeBlock("Input", ex.Input))
+		b.WriteString(codeBlock("Output", ex.Output))
+	}
+	return b.String()
+}
+
+// codeBlock 生成带标题的代码块, 围栏长度超过内容中最长的反引号序列
+func codeBlock(title, text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return "**" + title + "**\n\n" + fence + "\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n\n"
+}
+
+// StatementStore 题面存储
+type StatementStore interface {
+	// GetStatement 读取题目的题面, 没有题面时返回 ErrNoStatement
+	GetStatement(problemID string) (*ProblemStatement, error)
+}
+
+// StatementWriter 可以写入题面的存储
+type StatementWriter interface {
+	// SaveStatement 写入题目描述, 替换原来的描述, 题面的其他部分不变
+	SaveStatement(problemID, body string) error
+}
+
+// 题面目录中的文件名
+const (
+	statementBodyFile        = "description.md"
+	statementInputFile       = "input.md"
+	statementOutputFile      = "output.md"
+	statementConstraintsFile = "constraints.md"
+	statementExamplesDir     = "examples"
+)
+
+// FileSystemStatementStore 从目录中读取题面
+//
+// 目录结构为 {Root}/{题目ID}/statement/, 其中 description.md 为题目描述(必须存在),
+// input.md, output.md 和 constraints.md 分别为输入格式, 输出格式和数据范围,
+// examples/{n}.in 和 {n}.out 为样例, n 为样例编号, 按数值排序.
+type FileSystemStatementStore struct {
+	Root string
+}
+
+var (
+	_ StatementStore  = (*FileSystemStatementStore)(nil)
+	_ StatementWriter = (*FileSystemStatementStore)(nil)
+)
+
+// NewFileSystemStatementStore 创建新的文件题面存储
+func NewFileSystemStatementStore(root string) *FileSystemStatementStore {
+	return &FileSystemStatementStore{Root: root}
+}
+
+// SaveStatement 将题目描述写入 description.md
+func (s *FileSystemStatementStore) SaveStatement(problemID, body string) error {
+	if problemID == "" || problemID != filepath.Base(problemID) || problemID == ".." {
+		return errors.New("invalid problem id " + strconv.Quote(problemID))
+	}
+	dir := filepath.Join(s.Root, problemID, "statement")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.Wrap(err, "failed to create statement directory")
+	}
+	return os.WriteFile(filepath.Join(dir, statementBodyFile), []byte(body), 0644)
+}
+
+// GetStatement 读取题目的题面
+func (s *FileSystemStatementStore) GetStatement(problemID string) (*ProblemStatement, error) {
+	if problemID == "" || problemID != filepath.Base(problemID) || problemID == ".." {
+		return nil, errors.New("invalid problem id " + strconv.Quote(problemID))
+	}
+	dir := filepath.Join(s.Root, problemID, "statement")
+
+	read := func(name string) (string, error) {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return "", nil
+			}
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	var st ProblemStatement
+	var err error
+	if st.Body, err = read(statementBodyFile); err != nil {
+		return nil, err
+	}
+	if st.Body == "" {
+		return nil, ErrNoStatement
+	}
+	if st.InputFormat, err = read(statementInputFile); err != nil {
+		return nil, err
+	}
+	if st.OutputFormat, err = read(statementOutputFile); err != nil {
+		return nil, err
+	}
+	if st.Constraints, err = read(statementConstraintsFile); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, statementExamplesDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".in") {
+			ids = append(ids, strings.TrimSuffix(e.Name(), ".in"))
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return lessTestCaseID(ids[i], ids[j]) })
+	for _, id := range ids {
+		in, err := read(filepath.Join(statementExamplesDir, id+".in"))
+		if err != nil {
+			return nil, err
+		}
+		out, err := read(filepath.Join(statementExamplesDir, id+".out"))
+		if err != nil {
+			return nil, err
+		}
+		st.Examples = append(st.Examples, ExampleIO{Input: in, Output: out})
+	}
+	return &st, nil
+}
+
+// markdown 渲染题面使用的goldmark实例, 不输出Markdown中的原始HTML
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// mathPlaceholder 渲染前替换公式的占位符前缀, 只含字母数字以免被Markdown解析
+const mathPlaceholder = "SOJMATHPLACEHOLDER"
+
+// RenderMarkdown 将题面Markdown渲染为HTML
+//
+// $...$ 和 $$...$$ 中的LaTeX公式不经过Markdown解析, 分别输出为 MathJax 默认识别的 \(...\) 和 \[...\],
+// 并包裹在 class 为 math inline 或 math display 的元素中, 单独成段的行间公式为 div, 其余为 span.
+// 代码块和行内代码中的 $ 不被视为公式, \$ 为字面的 $.
+func RenderMarkdown(src string) (string, error) {
+	text, maths := extractMath(src)
+
+	var buf bytes.Buffer
+	err := markdown.Convert([]byte(text), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	out := buf.String()
+	for i, m := range maths {
+		token := mathPlaceholder + strconv.Itoa(i) + "X"
+		tex := html.EscapeString(m.tex)
+		if m.display {
+			// 单独成段的公式输出为块级元素, 否则仍在段落中
+			if strings.Contains(out, "<p>"+token+"</p>") {
+				out = strings.Replace(out, "<p>"+token+"</p>", `<div class="math display">\[`+tex+`\]</div>`, 1)
+			} else {
+				out = strings.Replace(out, token, `<span class="math display">\[`+tex+`\]</span>`, 1)
+			}
+		} else {
+			out = strings.Replace(out, token, `<span class="math inline">\(`+tex+`\)</span>`, 1)
+		}
+	}
+	return out, nil
+}
+
+// mathSpan 从Markdown中取出的公式
+type mathSpan struct {
+	tex     string
+	display bool
+}
+
+// extractMath 将公式替换为占位符, 跳过围栏代码块和行内代码
+func extractMath(src string) (string, []mathSpan) {
+	var (
+		out   strings.Builder
+		maths []mathSpan
+		fence string
+	)
+	lines := strings.SplitAfter(src, "\n")
+	for li := 0; li < len(lines); li++ {
+		line := lines[li]
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			out.WriteString(line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			out.WriteString(line)
+			continue
+		}
+
+		for i := 0; i < len(line); i++ {
+			switch {
+			case line[i] == '\\' && i+1 < len(line) && line[i+1] == '$':
+				out.WriteString(`\$`)
+				i++
+			case line[i] == '`':
+				// 行内代码原样输出
+				n := 1
+				for i+n < len(line) && line[i+n] == '`' {
+					n++
+				}
+				ticks := line[i : i+n]
+				end := strings.Index(line[i+n:], ticks)
+				if end < 0 {
+					out.WriteString(ticks)
+					i += n - 1
+					continue
+				}
+				out.WriteString(line[i : i+n+end+n])
+				i += n + end + n - 1
+			case line[i] == '$':
+				display := i+1 < len(line) && line[i+1] == '$'
+				delim := "$"
+				if display {
+					delim = "$$"
+				}
+				rest := line[i+len(delim):]
+				end := strings.Index(rest, delim)
+				// 行间公式可以跨行
+				consumed := 0
+				if end < 0 && display {
+					for lj := li + 1; lj < len(lines); lj++ {
+						rest += lines[lj]
+						if end = strings.Index(rest, delim); end >= 0 {
+							consumed = lj - li
+							break
+						}
+					}
+				}
+				if end < 0 || (!display && end == 0) {
+					out.WriteByte('$')
+					continue
+				}
+				maths = append(maths, mathSpan{tex: strings.TrimSpace(rest[:end]), display: display})
+				out.WriteString(mathPlaceholder + strconv.Itoa(len(maths)-1) + "X")
+				if consumed > 0 {
+					// 公式结束后的剩余部分作为当前行继续处理
+					li += consumed
+					line = rest[end+len(delim):]
+					i = -1
+					continue
+				}
+				i += len(delim) + end + len(delim) - 1
+			default:
+				out.WriteByte(line[i])
+			}
+		}
+	}
+	return out.String(), maths
+}
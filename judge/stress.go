@@ -0,0 +1,152 @@
+package judge
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// MaxStressCount 对拍一次最多运行的轮数
+	MaxStressCount = 500
+	// stressMaxOutput 对拍报告中每段输入输出保留的最大长度(字节)
+	stressMaxOutput = 64 << 10
+)
+
+// StressFailure 对拍中第一个出错的数据
+type StressFailure struct {
+	Iteration int    `json:"iteration"` // 从1开始
+	Seed      int64  `json:"seed"`
+	Reason    string `json:"reason"`
+	Input     string `json:"input"`
+	// BruteOutput 和 OptimizedOutput 为两个程序的输出, 程序没有运行或没有正常结束时为空
+	BruteOutput     string `json:"brute_output,omitempty"`
+	OptimizedOutput string `json:"optimized_output,omitempty"`
+	// Diff 两个输出的差异, 见 DiffCompare
+	Diff string `json:"diff,omitempty"`
+}
+
+// StressReport 对拍结果
+type StressReport struct {
+	Count   int            `json:"count"` // 完成的轮数
+	Passed  bool           `json:"passed"`
+	Failure *StressFailure `json:"failure,omitempty"`
+	// CompileError 有程序编译失败时为 "brute", "optimized" 或 "generator", 此时 Message 为编译输出
+	CompileError string `json:"compile_error,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+// StressSources 对拍使用的三个程序的源代码, 使用同一种语言
+//
+// 生成器从标准输入读取一行种子, 将一组输入写到标准输出, 相同的种子应生成相同的输入.
+type StressSources struct {
+	Brute     []byte
+	Optimized []byte
+	Generator []byte
+}
+
+// truncateStress 截断报告中过长的输入输出
+func truncateStress(s string) string {
+	if len(s) > stressMaxOutput {
+		return s[:stressMaxOutput] + "\n... (truncated)"
+	}
+	return s
+}
+
+// StressTest 对拍: 用生成器生成 count 组随机输入, 比较暴力程序与优化程序的输出, 返回第一组出错的数据
+//
+// 暴力程序和生成器的运行时间上限为 DefaultCheckerTimeout 秒, 优化程序使用题目的时间和内存限制,
+// 超出限制或运行出错也视为出错. 输出按题目的比较方式比较, 以暴力程序的输出为标准答案.
+// 编译失败记录在报告中, 只有评测系统出错时才返回错误.
+func (e *Evaluator) StressTest(ctx context.Context, p *types.Problem, lang *LanguageConfig, src StressSources, count int) (*StressReport, error) {
+	if count <= 0 || count > MaxStressCount {
+		return nil, errors.New("count must be between 1 and " + strconv.Itoa(MaxStressCount))
+	}
+	compileLang := lang.WithCompileFlags(p.CompileFlags)
+
+	report := &StressReport{}
+	var bins [3][]byte
+	for i, s := range []struct {
+		name string
+		src  []byte
+	}{{"brute", src.Brute}, {"optimized", src.Optimized}, {"generator", src.Generator}} {
+		bin, _, err := e.Compile(ctx, s.src, compileLang)
+		if err != nil {
+			var ce *CompileError
+			if errors.As(err, &ce) {
+				report.CompileError = s.name
+				report.Message = ce.Stderr
+				return report, nil
+			}
+			return nil, errors.Wrap(err, "failed to compile "+s.name)
+		}
+		bins[i] = bin
+	}
+	brute, optimized, generator := bins[0], bins[1], bins[2]
+
+	loose := RunConfig{Language: lang, TimeLimitMs: DefaultCheckerTimeout * 1000, MemoryLimitKB: p.MemoryLimitKB}
+	strict := RunConfig{Language: lang, TimeLimitMs: p.TimeLimitMs, MemoryLimitKB: p.MemoryLimitKB, OutputLimitKB: p.OutputLimitKB}
+	checker := e.problemChecker(p)
+
+	for i := 1; i <= count; i++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		seed := rand.Int63()
+		fail := &StressFailure{Iteration: i, Seed: seed}
+
+		gen, err := e.runBinary(ctx, generator, []byte(strconv.FormatInt(seed, 10)+"\n"), &loose)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to run generator")
+		}
+		if gen.Verdict != "" {
+			fail.Reason = "generator got " + string(gen.Verdict)
+			report.Failure = fail
+			return report, nil
+		}
+		input := []byte(gen.Stdout)
+		fail.Input = truncateStress(gen.Stdout)
+
+		want, err := e.runBinary(ctx, brute, input, &loose)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to run brute solution")
+		}
+		if want.Verdict != "" {
+			fail.Reason = "brute solution got " + string(want.Verdict)
+			report.Failure = fail
+			return report, nil
+		}
+		fail.BruteOutput = truncateStress(want.Stdout)
+
+		got, err := e.runBinary(ctx, optimized, input, &strict)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to run optimized solution")
+		}
+		if got.Verdict != "" {
+			fail.Reason = "optimized solution got " + string(got.Verdict)
+			report.Failure = fail
+			return report, nil
+		}
+		fail.OptimizedOutput = truncateStress(got.Stdout)
+
+		checked, err := checker.Check(ctx, input, []byte(want.Stdout), []byte(got.Stdout))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compare outputs")
+		}
+		if checked.Verdict != types.VerdictAccepted {
+			fail.Reason = "outputs differ: " + string(checked.Verdict)
+			fail.Diff = checked.CheckerOutput
+			report.Failure = fail
+			return report, nil
+		}
+		report.Count = i
+	}
+
+	report.Passed = true
+	log.Info().Str("problem", p.Id).Int("count", report.Count).Msg("stress test passed")
+	return report, nil
+}
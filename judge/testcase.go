@@ -0,0 +1,417 @@
+package judge
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/mrhaoxx/SOJ/metrics"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// 测试点并行数
+const (
+	DefaultTestCaseParallelism = 4
+	// MaxTestCaseParallelism 单个提交同时运行的测试点数上限, 避免压垮Docker
+	MaxTestCaseParallelism = 16
+)
+
+// TestCase 测试点
+//
+// 输入和标准答案可以直接给出, 也可以通过 InputLoader/ExpectedLoader 在运行测试点时才读取,
+// 以免数据量大的题目一次性将所有测试点读入内存.
+type TestCase struct {
+	ID       string
+	Input    []byte
+	Expected []byte
+
+	InputLoader    func() ([]byte, error)
+	ExpectedLoader func() ([]byte, error)
+}
+
+// ReadInput 读取测试输入, 结果不会被缓存
+func (tc *TestCase) ReadInput() ([]byte, error) {
+	if tc.Input == nil && tc.InputLoader != nil {
+		return tc.InputLoader()
+	}
+	return tc.Input, nil
+}
+
+// ReadExpected 读取标准答案, 结果不会被缓存
+func (tc *TestCase) ReadExpected() ([]byte, error) {
+	if tc.Expected == nil && tc.ExpectedLoader != nil {
+		return tc.ExpectedLoader()
+	}
+	return tc.Expected, nil
+}
+
+// TestCaseResult 测试点评测结果
+type TestCaseResult struct {
+	ID     string             `json:"id"`
+	Result *types.JudgeResult `json:"result,omitempty"`
+	// Skipped 为 true 时, 该测试点因其他测试点出现 TLE/MLE/RE 而没有运行, Result 为nil
+	Skipped bool `json:"skipped"`
+}
+
+// Checker 比较选手输出与标准答案, SpecialJudge 实现了该接口
+type Checker interface {
+	Check(ctx context.Context, input, expected, actual []byte) (*types.JudgeResult, error)
+}
+
+// LineChecker 逐行比较输出, 忽略行末空白和末尾空行, 与 Mode 为 CompareIgnoreTrailingWhitespace 的 DiffChecker 相同
+type LineChecker struct{}
+
+// Check 比较输出
+func (LineChecker) Check(ctx context.Context, input, expected, actual []byte) (*types.JudgeResult, error) {
+	return DiffChecker{Mode: types.CompareIgnoreTrailingWhitespace}.Check(ctx, input, expected, actual)
+}
+
+// RunConfig 按测试点评测的配置
+type RunConfig struct {
+	Language *LanguageConfig
+
+	// TimeLimitMs/MemoryLimitKB 每个测试点的时间和内存限制, 运行前按语言的倍数换算
+	TimeLimitMs   int64
+	MemoryLimitKB int64
+	// OutputLimitKB 每个测试点标准输出的大小限制, 不大于0时为 DefaultOutputLimit
+	OutputLimitKB int64
+
+	// CompileFlags 追加到语言编译命令的编译选项, 来自题目定义
+	CompileFlags []string
+
+	// Parallelism 同时运行的测试点数, 不大于0时为 DefaultTestCaseParallelism, 不超过 MaxTestCaseParallelism
+	Parallelism int
+
+	// Checker 比较输出的方式, 为nil时使用 LineChecker
+	Checker Checker
+
+	// Interactor 交互器, 设置后每个测试点以 InteractiveRun 运行, 测试输入交给交互器, 不使用 Checker
+	Interactor *types.InteractorConfig
+
+	// Sandbox 运行选手程序的容器配置模板, 为nil时使用沙箱默认配置. 其中的镜像, 命令和内存限制会被覆盖.
+	Sandbox *file_transfer.RunConfig
+
+	// OnTestCase 每个测试点运行结束后调用, 调用之间不会并发, 可以为nil
+	OnTestCase func(TestCaseResult)
+
+	// Subtasks 子任务, 设置后按通过的子任务计分. 此时某个测试点 TLE/MLE/RE 不会停止其余测试点,
+	// 以便计算其他子任务的得分.
+	Subtasks []types.Subtask
+}
+
+func (cfg *RunConfig) parallelism() int {
+	switch {
+	case cfg.Parallelism <= 0:
+		return DefaultTestCaseParallelism
+	case cfg.Parallelism > MaxTestCaseParallelism:
+		return MaxTestCaseParallelism
+	}
+	return cfg.Parallelism
+}
+
+func (cfg *RunConfig) checker() Checker {
+	if cfg.Checker == nil {
+		return LineChecker{}
+	}
+	return cfg.Checker
+}
+
+// RunTestCases 并行运行所有测试点
+//
+// 每个测试点在独立的容器中运行, 同时运行的容器数不超过 cfg 的并行数.
+// 任一测试点出现 TLE/MLE/RE 时, 尚未开始的测试点不再运行, 正在运行的测试点被取消, 均标记为 Skipped (按子任务计分时除外).
+// 返回的结果与 cases 一一对应. 只有评测系统本身出错时才返回错误.
+func (e *Evaluator) RunTestCases(ctx context.Context, binary []byte, cases []TestCase, cfg RunConfig) ([]TestCaseResult, error) {
+	if cfg.Language == nil {
+		return nil, errors.New("language is not set")
+	}
+
+	results := make([]TestCaseResult, len(cases))
+	for i := range cases {
+		results[i] = TestCaseResult{ID: cases[i].ID, Skipped: true}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, cfg.parallelism())
+		// stopped 出现致命结论后已取消其余测试点, 此后因取消而失败的测试点保持 Skipped
+		stopped bool
+	)
+
+	for i := range cases {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res, err := e.runTestCase(ctx, binary, &cases[i], &cfg)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if stopped && ctx.Err() != nil {
+					return
+				}
+				if firstErr == nil {
+					firstErr = errors.Wrap(err, "test case "+cases[i].ID)
+				}
+				cancel()
+				return
+			}
+			results[i].Result = res
+			results[i].Skipped = false
+			if cfg.OnTestCase != nil {
+				cfg.OnTestCase(results[i])
+			}
+			if res.Verdict.IsFatal() && len(cfg.Subtasks) == 0 {
+				log.Debug().Str("case", cases[i].ID).Str("verdict", string(res.Verdict)).Msg("fatal verdict, stopping remaining test cases")
+				stopped = true
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// runTestCase 在新的沙箱容器中运行单个测试点并比较输出
+func (e *Evaluator) runTestCase(ctx context.Context, binary []byte, tc *TestCase, cfg *RunConfig) (*types.JudgeResult, error) {
+	input, err := tc.ReadInput()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read input")
+	}
+	if cfg.Interactor != nil {
+		return e.runInteractive(ctx, binary, input, cfg)
+	}
+
+	res, err := e.runBinary(ctx, binary, input, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if res.Verdict != "" {
+		return res, nil
+	}
+
+	expected, err := tc.ReadExpected()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read expected output")
+	}
+
+	checked, err := cfg.checker().Check(ctx, input, expected, []byte(res.Stdout))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check output")
+	}
+	res.Success = checked.Success
+	res.Verdict = checked.Verdict
+	res.Score = checked.Score
+	res.Msg = checked.Msg
+	res.CheckerOutput = checked.CheckerOutput
+	return res, nil
+}
+
+// runInteractive 以 cfg.Interactor 为交互器运行一次编译产物, input 交给交互器
+//
+// 返回选手程序的运行结果, 其结论为综合双方结果得出的最终结论.
+func (e *Evaluator) runInteractive(ctx context.Context, binary, input []byte, cfg *RunConfig) (*types.JudgeResult, error) {
+	lang := cfg.Language
+	timeLimit := lang.TimeLimit(cfg.TimeLimitMs)
+	timeout := int((timeLimit + 999) / 1000)
+	if timeout <= 0 {
+		timeout = DefaultCheckerTimeout
+	}
+
+	run, err := InteractiveRun(ctx, e.docker, &InteractiveConfig{
+		ContestantImage:       lang.Image,
+		ContestantCmd:         lang.RunCommand(),
+		ContestantFiles:       map[string][]byte{lang.BinaryFile(): binary},
+		ContestantMemoryLimit: lang.MemoryLimit(cfg.MemoryLimitKB * 1024),
+		InteractorImage:       cfg.Interactor.Image,
+		InteractorCmd:         cfg.Interactor.Command,
+		Input:                 input,
+		Timeout:               timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.ExecutionDuration.WithLabelValues(lang.ID).Observe(float64(run.Contestant.TimeUsedMs) / 1000)
+
+	res := run.Contestant
+	res.Verdict = run.Verdict
+	if res.Verdict == types.VerdictAccepted && timeLimit > 0 && res.TimeUsedMs > timeLimit {
+		res.Verdict = types.VerdictTimeLimitExceeded
+	}
+	res.Success = res.Verdict != types.VerdictSystemError
+	if res.Verdict != types.VerdictAccepted {
+		res.Score = 0
+		if res.CheckerOutput != "" {
+			res.Msg = res.CheckerOutput
+		}
+	}
+	return res, nil
+}
+
+// runBinary 在新的沙箱容器中以 input 为标准输入运行一次编译产物
+//
+// 超时, 超出内存限制或运行时错误时设置相应的结论, 正常退出时 Verdict 为空.
+func (e *Evaluator) runBinary(ctx context.Context, binary, input []byte, cfg *RunConfig) (*types.JudgeResult, error) {
+	lang := cfg.Language
+
+	sandbox := sandboxConfig("soj-run-", lang.Image)
+	if cfg.Sandbox != nil {
+		tmpl := *cfg.Sandbox
+		tmpl.Name, tmpl.Image, tmpl.Cmd, tmpl.ReadonlyRootfs = sandbox.Name, sandbox.Image, sandbox.Cmd, sandbox.ReadonlyRootfs
+		sandbox = &tmpl
+	}
+	memoryLimit := lang.MemoryLimit(cfg.MemoryLimitKB * 1024)
+	if memoryLimit > 0 {
+		sandbox.MemoryLimit = memoryLimit
+	}
+
+	cid, err := startSandbox(ctx, e.docker, sandbox, map[string][]byte{lang.BinaryFile(): binary})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start sandbox")
+	}
+	defer e.docker.CleanContainer(context.WithoutCancel(ctx), cid, file_transfer.DefaultStopGrace)
+
+	timeLimit := lang.TimeLimit(cfg.TimeLimitMs)
+	// ExecContainer 的超时以秒为单位, 向上取整后再按毫秒判断
+	timeout := int((timeLimit + 999) / 1000)
+	if timeout <= 0 {
+		timeout = DefaultCheckerTimeout
+	}
+
+	res, err := runInSandbox(ctx, e.docker, cid, lang.RunCommand(), timeout, sandbox.MemoryLimit, cfg.OutputLimitKB*1024, bytes.NewReader(input), nil)
+	if err != nil {
+		return nil, err
+	}
+	metrics.ExecutionDuration.WithLabelValues(lang.ID).Observe(float64(res.TimeUsedMs) / 1000)
+	if res.Verdict == "" && timeLimit > 0 && res.TimeUsedMs > timeLimit {
+		res.Verdict = types.VerdictTimeLimitExceeded
+	}
+	return res, nil
+}
+
+// JudgeSource 按测试点评测源代码
+//
+// 先编译源代码, 编译失败时直接返回 CE; 否则运行所有测试点, 结论为第一个未通过的测试点的结论,
+// 分数为通过的测试点所占的百分比, 时间和内存为各测试点的最大值.
+func (e *Evaluator) JudgeSource(ctx context.Context, src []byte, cases []TestCase, cfg RunConfig) (*types.JudgeResult, []TestCaseResult, error) {
+	if cfg.Language == nil {
+		return nil, nil, errors.New("language is not set")
+	}
+	return e.JudgeFiles(ctx, map[string][]byte{cfg.Language.SourceFile(): src}, cases, cfg)
+}
+
+// JudgeFiles 与 JudgeSource 相同, 但编译时使用多个文件, 见 CompileFiles
+func (e *Evaluator) JudgeFiles(ctx context.Context, files map[string][]byte, cases []TestCase, cfg RunConfig) (*types.JudgeResult, []TestCaseResult, error) {
+	if cfg.Language == nil {
+		return nil, nil, errors.New("language is not set")
+	}
+
+	binary, _, err := e.CompileFiles(ctx, files, cfg.Language.WithCompileFlags(cfg.CompileFlags))
+	if err != nil {
+		var ce *CompileError
+		if errors.As(err, &ce) {
+			return compileErrorResult(ce), nil, nil
+		}
+		return nil, nil, err
+	}
+
+	results, err := e.RunTestCases(ctx, binary, cases, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return summarizeTestCases(results, cfg.Subtasks), results, nil
+}
+
+// summarizeTestCases 汇总各测试点的结果, subtasks 不为空时按子任务计分
+func summarizeTestCases(results []TestCaseResult, subtasks []types.Subtask) *types.JudgeResult {
+	summary := &types.JudgeResult{Success: true, Verdict: types.VerdictAccepted, MaxScore: 100}
+
+	passed := 0
+	for _, r := range results {
+		if r.Skipped {
+			continue
+		}
+		summary.Time = max(summary.Time, r.Result.Time)
+		summary.TimeUsedMs = max(summary.TimeUsedMs, r.Result.TimeUsedMs)
+		summary.Memory = max(summary.Memory, r.Result.Memory)
+		summary.MemoryUsedKB = max(summary.MemoryUsedKB, r.Result.MemoryUsedKB)
+
+		if r.Result.Verdict == types.VerdictAccepted {
+			passed++
+		} else if summary.Verdict == types.VerdictAccepted {
+			summary.Verdict = r.Result.Verdict
+			summary.Msg = "test case " + r.ID + ": " + string(r.Result.Verdict)
+			summary.ExitCode = r.Result.ExitCode
+			summary.CheckerOutput = r.Result.CheckerOutput
+		}
+	}
+
+	if summary.Verdict == types.VerdictSystemError {
+		summary.Success = false
+	}
+	if len(subtasks) > 0 {
+		scoreSubtasks(summary, results, subtasks)
+	} else if len(results) > 0 {
+		summary.Score = float64(passed) / float64(len(results)) * 100
+	}
+	return summary
+}
+
+// scoreSubtasks 按子任务计分, 子任务的所有测试点都通过才得到该子任务的分值
+//
+// 子任务中的测试点不存在或被跳过都视为未通过.
+func scoreSubtasks(summary *types.JudgeResult, results []TestCaseResult, subtasks []types.Subtask) {
+	accepted := make(map[string]bool, len(results))
+	for _, r := range results {
+		accepted[r.ID] = !r.Skipped && r.Result.Verdict == types.VerdictAccepted
+	}
+
+	summary.Score = 0
+	summary.MaxScore = 0
+	summary.Subtasks = make([]types.SubtaskResult, len(subtasks))
+	for i, st := range subtasks {
+		passed := true
+		for _, id := range st.TestCases {
+			if !accepted[id] {
+				passed = false
+				break
+			}
+		}
+
+		name := st.Name
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		sr := types.SubtaskResult{Name: name, MaxPoints: st.Points, Passed: passed}
+		if passed {
+			sr.Points = st.Points
+		}
+		summary.Subtasks[i] = sr
+		summary.Score += sr.Points
+		summary.MaxScore += st.Points
+	}
+}
@@ -0,0 +1,143 @@
+package judge
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoTestCases 题目没有测试点
+var ErrNoTestCases = errors.New("no test cases found")
+
+// TestCaseStore 测试点存储
+type TestCaseStore interface {
+	// ListTestCases 按顺序返回题目的所有测试点, 测试点的数据可以是延迟读取的
+	ListTestCases(problemID string) ([]TestCase, error)
+}
+
+// TestCaseWriter 可以写入测试点的存储
+type TestCaseWriter interface {
+	// SaveTestCase 写入测试点, 已有同ID的测试点时覆盖
+	SaveTestCase(problemID, id string, input, expected []byte) error
+	// RemoveTestCase 删除测试点, 测试点不存在时不返回错误
+	RemoveTestCase(problemID, id string) error
+}
+
+// FileSystemTestCaseStore 从目录中读取测试点
+//
+// 目录结构为 {Root}/{题目ID}/tests/{n}.in 和 {n}.out, n 为测试点编号, 按数值排序.
+// 只有 .in 没有 .out 的文件会被忽略. 测试点数据在运行时才从磁盘读取.
+type FileSystemTestCaseStore struct {
+	Root string
+}
+
+var (
+	_ TestCaseStore  = (*FileSystemTestCaseStore)(nil)
+	_ TestCaseWriter = (*FileSystemTestCaseStore)(nil)
+)
+
+// NewFileSystemTestCaseStore 创建新的文件测试点存储
+func NewFileSystemTestCaseStore(root string) *FileSystemTestCaseStore {
+	return &FileSystemTestCaseStore{Root: root}
+}
+
+// ListTestCases 列出题目的所有测试点
+func (s *FileSystemTestCaseStore) ListTestCases(problemID string) ([]TestCase, error) {
+	// 题目ID来自用户输入, 不允许跳出数据目录
+	if problemID == "" || problemID != filepath.Base(problemID) || problemID == ".." {
+		return nil, errors.New("invalid problem id " + strconv.Quote(problemID))
+	}
+
+	dir := filepath.Join(s.Root, problemID, "tests")
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, ErrNoTestCases
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read test case directory")
+	}
+
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".in") {
+			continue
+		}
+		id := strings.TrimSuffix(e.Name(), ".in")
+		if _, err := os.Stat(filepath.Join(dir, id+".out")); err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil, ErrNoTestCases
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return lessTestCaseID(ids[i], ids[j]) })
+
+	cases := make([]TestCase, 0, len(ids))
+	for _, id := range ids {
+		in, out := filepath.Join(dir, id+".in"), filepath.Join(dir, id+".out")
+		cases = append(cases, TestCase{
+			ID:             id,
+			InputLoader:    func() ([]byte, error) { return os.ReadFile(in) },
+			ExpectedLoader: func() ([]byte, error) { return os.ReadFile(out) },
+		})
+	}
+
+	return cases, nil
+}
+
+// SaveTestCase 写入测试点, 先写入标准答案再写入输入, 以免读到只有一半的测试点
+func (s *FileSystemTestCaseStore) SaveTestCase(problemID, id string, input, expected []byte) error {
+	if problemID == "" || problemID != filepath.Base(problemID) || problemID == ".." {
+		return errors.New("invalid problem id " + strconv.Quote(problemID))
+	}
+	if id == "" || id != filepath.Base(id) || id == ".." {
+		return errors.New("invalid test case id " + strconv.Quote(id))
+	}
+
+	dir := filepath.Join(s.Root, problemID, "tests")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.Wrap(err, "failed to create test case directory")
+	}
+	err = os.WriteFile(filepath.Join(dir, id+".out"), expected, 0644)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, id+".in"), input, 0644)
+}
+
+// RemoveTestCase 删除测试点, 先删除输入使其不再被列出
+func (s *FileSystemTestCaseStore) RemoveTestCase(problemID, id string) error {
+	if problemID == "" || problemID != filepath.Base(problemID) || problemID == ".." {
+		return errors.New("invalid problem id " + strconv.Quote(problemID))
+	}
+	if id == "" || id != filepath.Base(id) || id == ".." {
+		return errors.New("invalid test case id " + strconv.Quote(id))
+	}
+
+	dir := filepath.Join(s.Root, problemID, "tests")
+	for _, name := range []string{id + ".in", id + ".out"} {
+		err := os.Remove(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// lessTestCaseID 按数值比较编号, 不是数字时按字符串比较
+func lessTestCaseID(x, y string) bool {
+	a, aerr := strconv.Atoi(x)
+	b, berr := strconv.Atoi(y)
+	if aerr == nil && berr == nil {
+		return a < b
+	}
+	return x < y
+}
@@ -0,0 +1,176 @@
+package judge
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/mrhaoxx/SOJ/internal/dockermock"
+	"github.com/mrhaoxx/SOJ/types"
+)
+
+// testLanguage 不需要编译的测试语言, 运行命令由 mock 的 ExecContainerFunc 解释
+var testLanguage = &LanguageConfig{ID: "test", Image: "test", RunCmd: "./main", FileExtension: ".txt"}
+
+// fakeExec 返回按标准输入决定行为的 ExecContainerFunc:
+// "re" 以退出码1结束, "hang" 一直运行到 ctx 被取消, 其余输入原样写回标准输出
+func fakeExec() func(ctx context.Context, id string, cmd string, timeout int, stdin io.Reader, stdout, stderr io.Writer, env []string, privileged bool, workdir string, user string) (int, string, error) {
+	return func(ctx context.Context, id string, cmd string, timeout int, stdin io.Reader, stdout, stderr io.Writer, env []string, privileged bool, workdir string, user string) (int, string, error) {
+		input, _ := io.ReadAll(stdin)
+		switch string(input) {
+		case "re":
+			return 1, "", nil
+		case "hang":
+			<-ctx.Done()
+			return -1, "", ctx.Err()
+		}
+		stdout.Write(input)
+		return 0, "", nil
+	}
+}
+
+func TestRunTestCasesAccepted(t *testing.T) {
+	docker := &dockermock.MockDockerService{ExecContainerFunc: fakeExec()}
+	e := NewEvaluator(nil, docker, nil)
+
+	cases := []TestCase{
+		{ID: "1", Input: []byte("1 2\n"), Expected: []byte("1 2\n")},
+		{ID: "2", Input: []byte("3 4\n"), Expected: []byte("3 5\n")},
+	}
+	results, err := e.RunTestCases(context.Background(), []byte("bin"), cases, RunConfig{Language: testLanguage, TimeLimitMs: 1000, MemoryLimitKB: 1024})
+	if err != nil {
+		t.Fatalf("RunTestCases error: %v", err)
+	}
+	if v := results[0].Result.Verdict; v != types.VerdictAccepted {
+		t.Errorf("case 1 verdict = %s, want AC", v)
+	}
+	if v := results[1].Result.Verdict; v != types.VerdictWrongAnswer {
+		t.Errorf("case 2 verdict = %s, want WA", v)
+	}
+	if n := len(docker.CallsTo("RunImage")); n != len(cases) {
+		t.Errorf("started %d sandboxes, want one per test case (%d)", n, len(cases))
+	}
+	if n := len(docker.CallsTo("CleanContainer")); n != len(cases) {
+		t.Errorf("cleaned %d sandboxes, want %d", n, len(cases))
+	}
+}
+
+func TestRunTestCasesFatalVerdictSkipsRunningCases(t *testing.T) {
+	docker := &dockermock.MockDockerService{ExecContainerFunc: fakeExec()}
+	e := NewEvaluator(nil, docker, nil)
+
+	cases := []TestCase{
+		{ID: "1", Input: []byte("hang")},
+		{ID: "2", Input: []byte("re")},
+		{ID: "3", Input: []byte("hang")},
+	}
+	results, err := e.RunTestCases(context.Background(), []byte("bin"), cases, RunConfig{Language: testLanguage, TimeLimitMs: 1000, MemoryLimitKB: 1024, Parallelism: len(cases)})
+	if err != nil {
+		t.Fatalf("RunTestCases error: %v, want the RE verdict instead of a judge failure", err)
+	}
+	if v := results[1].Result.Verdict; v != types.VerdictRuntimeError {
+		t.Errorf("case 2 verdict = %s, want RE", v)
+	}
+	for _, i := range []int{0, 2} {
+		if !results[i].Skipped {
+			t.Errorf("case %s was cancelled but not skipped: %+v", results[i].ID, results[i].Result)
+		}
+	}
+}
+
+func TestRunTestCasesOutputLimit(t *testing.T) {
+	docker := &dockermock.MockDockerService{ExecContainerFunc: fakeExec()}
+	e := NewEvaluator(nil, docker, nil)
+
+	output := strings.Repeat("x", 4096)
+	cases := []TestCase{{ID: "1", Input: []byte(output), Expected: []byte(output)}}
+	results, err := e.RunTestCases(context.Background(), []byte("bin"), cases, RunConfig{Language: testLanguage, TimeLimitMs: 1000, MemoryLimitKB: 1024, OutputLimitKB: 1})
+	if err != nil {
+		t.Fatalf("RunTestCases error: %v", err)
+	}
+	res := results[0].Result
+	if res.Verdict != types.VerdictOutputLimitExceeded {
+		t.Errorf("verdict = %s, want OLE", res.Verdict)
+	}
+	if len(res.Stdout) != 1024 {
+		t.Errorf("kept %d bytes of stdout, want 1024", len(res.Stdout))
+	}
+}
+
+func TestRunTestCasesProblemChecker(t *testing.T) {
+	exec := fakeExec()
+	docker := &dockermock.MockDockerService{
+		ExecContainerFunc: func(ctx context.Context, id string, cmd string, timeout int, stdin io.Reader, stdout, stderr io.Writer, env []string, privileged bool, workdir string, user string) (int, string, error) {
+			if cmd == "/check input.txt output.txt answer.txt" {
+				io.WriteString(stderr, "wrong answer 1st numbers differ")
+				return CheckerExitWrongAnswer, "", nil
+			}
+			return exec(ctx, id, cmd, timeout, stdin, stdout, stderr, env, privileged, workdir, user)
+		},
+	}
+	e := NewEvaluator(nil, docker, nil)
+	p := &types.Problem{Id: "checker-test", Checker: &types.CheckerConfig{Image: "checker", Command: "/check"}}
+
+	// 输出与标准答案相同, 但checker判定为答案错误
+	cases := []TestCase{{ID: "1", Input: []byte("1 2\n"), Expected: []byte("1 2\n")}}
+	results, err := e.RunTestCases(context.Background(), []byte("bin"), cases, RunConfig{Language: testLanguage, TimeLimitMs: 1000, MemoryLimitKB: 1024, Checker: e.problemChecker(p)})
+	if err != nil {
+		t.Fatalf("RunTestCases error: %v", err)
+	}
+	res := results[0].Result
+	if res.Verdict != types.VerdictWrongAnswer || res.CheckerOutput != "wrong answer 1st numbers differ" {
+		t.Errorf("result = %s %q, want WA from the checker", res.Verdict, res.CheckerOutput)
+	}
+}
+
+func TestRunTestCasesInteractive(t *testing.T) {
+	var mu sync.Mutex
+	memory := make(map[string]int64)
+	docker := &dockermock.MockDockerService{
+		RunImageFunc: func(ctx context.Context, cfg *file_transfer.RunConfig) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			memory[cfg.Image] = cfg.MemoryLimit
+			return "mock-" + cfg.Name, nil
+		},
+		// 交互器向选手发送测试输入, 选手原样返回, 交互器据此给出结论
+		ExecContainerFunc: func(ctx context.Context, id string, cmd string, timeout int, stdin io.Reader, stdout, stderr io.Writer, env []string, privileged bool, workdir string, user string) (int, string, error) {
+			if cmd == "/interact input.txt output.txt" {
+				io.WriteString(stdout, "ping\n")
+				reply, _ := io.ReadAll(stdin)
+				if string(reply) != "ping\n" {
+					io.WriteString(stderr, "unexpected reply")
+					return CheckerExitWrongAnswer, "", nil
+				}
+				return CheckerExitAccepted, "", nil
+			}
+			line, _ := bufio.NewReader(stdin).ReadString('\n')
+			io.WriteString(stdout, line)
+			return 0, "", nil
+		},
+	}
+	e := NewEvaluator(nil, docker, nil)
+	lang := *testLanguage
+	lang.MemoryMultiplier = 1
+
+	cases := []TestCase{{ID: "1", Input: []byte("1\n")}}
+	results, err := e.RunTestCases(context.Background(), []byte("bin"), cases, RunConfig{
+		Language:      &lang,
+		TimeLimitMs:   1000,
+		MemoryLimitKB: 1024,
+		Interactor:    &types.InteractorConfig{Image: "interactor", Command: "/interact"},
+	})
+	if err != nil {
+		t.Fatalf("RunTestCases error: %v", err)
+	}
+	if res := results[0].Result; res.Verdict != types.VerdictAccepted || res.Score != 100 {
+		t.Errorf("result = %s %v, want AC with full score", res.Verdict, res.Score)
+	}
+	if m := memory[lang.Image]; m != 1024*1024 {
+		t.Errorf("contestant memory limit = %d, want the problem limit %d", m, 1024*1024)
+	}
+}
@@ -2,39 +2,50 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/mrhaoxx/SOJ/contest"
 	"github.com/mrhaoxx/SOJ/file_transfer"
 	"github.com/mrhaoxx/SOJ/judge"
+	"github.com/mrhaoxx/SOJ/notify"
 	"github.com/mrhaoxx/SOJ/types"
 	"github.com/mrhaoxx/SOJ/ui"
 
 	ssh "github.com/gliderlabs/ssh"
 	"github.com/logrusorgru/aurora/v4"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	gossh "golang.org/x/crypto/ssh"
-	"gopkg.in/yaml.v3"
 )
 
+// shutdownTimeout 退出时等待进行中评测的最长时间
+const shutdownTimeout = 5 * time.Minute
+
 func main() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-	// 读取配置
-	var cfg types.Config
-	_cfg, err := os.ReadFile("config.yaml")
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to read config file")
+	// 读取配置, 路径可以由 SOJ_CONFIG 指定, 否则优先使用工作目录下的 config.yaml
+	cfgFile := os.Getenv("SOJ_CONFIG")
+	if cfgFile == "" {
+		cfgFile = types.DefaultConfigPath
+		if _, err := os.Stat("config.yaml"); err == nil {
+			cfgFile = "config.yaml"
+		}
 	}
-
-	err = yaml.Unmarshal(_cfg, &cfg)
+	_cfg, err := types.LoadConfig(cfgFile)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to parse config file")
+		log.Fatal().Err(err).Str("file", cfgFile).Msg("failed to load config")
 	}
+	cfg := *_cfg
+	log.Info().Str("file", cfgFile).Msg("loaded config")
 
 	// 解析SSH公钥
 	var pubkey gossh.PublicKey
@@ -48,11 +59,24 @@ func main() {
 	}
 
 	// 创建Docker服务
-	dockerService, err := file_transfer.NewDockerService()
+	dockerService, err := file_transfer.NewDockerServiceWithHost(cfg.DockerHost)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create docker client")
 	}
 
+	// 清理上次运行遗留的容器, 包括已停止但未被自动删除的容器
+	orphans, err := dockerService.ListContainersByLabel(context.Background(), file_transfer.LabelManaged, "true")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list orphan containers")
+	}
+	for _, id := range orphans {
+		log.Info().Str("id", id).Msg("removing orphan container")
+		err = dockerService.RemoveContainer(context.Background(), id)
+		if err != nil {
+			log.Error().Err(err).Str("id", id).Msg("failed to remove orphan container")
+		}
+	}
+
 	// 解析主机密钥
 	pk, err := gossh.ParsePrivateKey([]byte(cfg.HostKey))
 	if err != nil {
@@ -67,6 +91,10 @@ func main() {
 
 	// 初始化问题管理器
 	problemManager := judge.NewProblemManager()
+	problemManager.SetLimits(cfg.MaxTimeLimitMs, cfg.MaxMemoryLimitKB)
+	if cfg.ProblemDataDir != "" {
+		problemManager.SetTestCaseStore(judge.NewFileSystemTestCaseStore(cfg.ProblemDataDir))
+	}
 	problems := problemManager.LoadProblemDir(cfg.ProblemsDir)
 
 	// 执行全量用户扫描
@@ -75,11 +103,102 @@ func main() {
 		log.Error().Err(err).Msg("failed to perform full user scan")
 	}
 
+	// 定期计算题目难度
+	difficulty := judge.NewDifficultyTracker(dbService)
+	difficulty.Start(context.Background(), judge.DefaultDifficultyRefresh)
+	problemManager.SetDifficultyTracker(difficulty)
+
 	// 初始化评测器
 	evaluator := judge.NewEvaluator(&cfg, dockerService, dbService)
 
+	// 加载编程语言配置
+	if cfg.LanguagesFile != "" {
+		languages, err := judge.LoadLanguageRegistry(cfg.LanguagesFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load languages")
+		}
+		evaluator.SetLanguages(languages)
+		log.Info().Int("count", len(languages.ListAll())).Msg("loaded languages")
+	}
+
+	// 初始化评测队列
+	queue := judge.NewSubmissionQueue(cfg.JudgeWorkers, cfg.JudgeQueueSize, nil)
+	queue.Start(context.Background())
+
+	// 题目的限制变化后以低优先级重测
+	rejudge := judge.NewRejudgeQueue(queue, evaluator, dbService.Submissions(), problemManager, problemManager.TestCases())
+	rejudge.MaxArchiveSize = cfg.MaxArchiveSize
+	rejudge.Watch(problemManager)
+
 	// 初始化HTTP服务器
-	httpServer := ui.NewHTTPServer(dbService)
+	httpServer := ui.NewHTTPServer(dbService, evaluator, problemManager, problemManager.TestCases(), queue)
+	httpServer.SetDifficultyTracker(difficulty)
+	httpServer.SetDockerService(dockerService)
+	if cfg.ProblemDataDir != "" {
+		httpServer.SetStatementStore(judge.NewFileSystemStatementStore(cfg.ProblemDataDir))
+	}
+	httpServer.SetRejudgeQueue(rejudge)
+	httpServer.SetMaxArchiveSize(cfg.MaxArchiveSize)
+	httpServer.SetMaxSourceSize(cfg.MaxSourceSizeBytes)
+	var rdb *redis.Client
+	if cfg.RedisAddr != "" {
+		rdb = redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+		httpServer.SetRateLimiter(ui.NewRedisRateLimiter(rdb, cfg.SubmitRateLimit))
+		httpServer.SetRunRateLimiter(ui.NewRedisIntervalRateLimiter(rdb, "run", ui.DefaultRunInterval, 1))
+	} else {
+		httpServer.SetRateLimiter(ui.NewMemoryRateLimiter(cfg.SubmitRateLimit))
+	}
+	if cfg.DistributedRole != "" && rdb == nil {
+		log.Fatal().Str("role", cfg.DistributedRole).Msg("distributed judge requires RedisAddr")
+	}
+	// 收到退出信号时停止接受连接, 等待进行中的评测完成后退出
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 分布式评测的调度器和评测节点在退出时停止, 评测节点随即注销
+	distCtx, cancelDist := context.WithCancel(sigCtx)
+	defer cancelDist()
+	var worker *judge.DistributedWorker
+	switch cfg.DistributedRole {
+	case "":
+	case "dispatcher":
+		dispatcher := judge.NewDistributedDispatcher(rdb, dbService.Submissions(), httpServer.Progress())
+		err = dispatcher.Start(distCtx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to start distributed dispatcher")
+		}
+		httpServer.SetDispatcher(dispatcher)
+	case "worker":
+		worker = judge.NewDistributedWorker(rdb, "", evaluator, problemManager, problemManager.TestCases())
+		worker.MaxArchiveSize = cfg.MaxArchiveSize
+		err = worker.Start(distCtx, cfg.JudgeWorkers)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to start distributed worker")
+		}
+	default:
+		log.Fatal().Str("role", cfg.DistributedRole).Msg("invalid distributed role")
+	}
+	if cfg.ContestsDir != "" {
+		contests := contest.NewManager(dbService.Submissions())
+		contests.SetTeamStore(dbService.Teams())
+		contests.SetVirtualContestStore(dbService.VirtualContests())
+		err = contests.LoadContestDir(cfg.ContestsDir)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load contests")
+		}
+		httpServer.SetContestManager(contests)
+		httpServer.SetNotifier(notify.FromConfig(&cfg))
+
+		// 比赛结束后计算rating
+		contest.NewRatingUpdater(contests, dbService.Ratings()).Start(context.Background(), contest.DefaultRatingInterval)
+	}
+	if cfg.JWTSecret != "" {
+		jwtAuth, err := ui.NewJWTAuth(cfg.JWTSecret)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to initialize jwt auth")
+		}
+		httpServer.SetJWTAuth(jwtAuth)
+	}
 	httpServer.ServeHTTP(cfg.APIAddr)
 
 	// 初始化SSH处理器
@@ -92,7 +211,7 @@ func main() {
 			// 处理特殊的submit命令
 			cmds := s.Command()
 			if len(cmds) >= 2 && (cmds[0] == "submit" || cmds[0] == "sub") {
-				handleSubmit(s, &cfg, evaluator, problemManager, dbService, cmds)
+				handleSubmit(s, &cfg, evaluator, queue, problemManager, dbService, cmds)
 			} else {
 				sshHandler.HandleSession(s)
 			}
@@ -108,15 +227,43 @@ func main() {
 	}
 	s.AddHostKey(pk)
 
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-sigCtx.Done()
+		log.Info().Msg("shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err := s.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to shutdown ssh server")
+		}
+		err = queue.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to drain submission queue")
+		}
+		cancelDist()
+		if worker != nil {
+			err = worker.Shutdown(shutdownCtx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to drain distributed worker")
+			}
+		}
+	}()
+
 	log.Info().Str("addr", cfg.ListenAddr).Msg("listening")
 	err = s.ListenAndServe()
-	if err != nil {
+	if err != ssh.ErrServerClosed {
 		log.Fatal().Err(err).Msg("failed to listen")
 	}
+
+	<-shutdownDone
 }
 
 // handleSubmit 处理提交命令
-func handleSubmit(s ssh.Session, cfg *types.Config, evaluator *judge.Evaluator, problemManager *judge.ProblemManager, dbService *types.DatabaseService, cmds []string) {
+func handleSubmit(s ssh.Session, cfg *types.Config, evaluator *judge.Evaluator, queue *judge.SubmissionQueue, problemManager *judge.ProblemManager, dbService *types.DatabaseService, cmds []string) {
 	uf := types.Userface{
 		Buffer: bytes.NewBuffer(nil),
 		Writer: s,
@@ -163,7 +310,11 @@ func handleSubmit(s ssh.Session, cfg *types.Config, evaluator *judge.Evaluator,
 		Running: make(chan struct{}),
 	}
 
-	go evaluator.RunJudge(&ctx, &pb)
+	err := queue.Enqueue(&judge.WorkflowSubmission{Evaluator: evaluator, Ctx: &ctx, Problem: &pb})
+	if err != nil {
+		uf.Println(aurora.Red("error:"), "judge is shutting down, please try again later")
+		return
+	}
 
 	<-ctx.Running
 
@@ -173,7 +324,7 @@ func handleSubmit(s ssh.Session, cfg *types.Config, evaluator *judge.Evaluator,
 	writeResult(uf, ctx)
 
 	// 更新用户数据
-	err := dbService.UpdateUserSubmitResult(s.User(), &ctx, &pb)
+	err = dbService.UpdateUserSubmitResult(s.User(), &ctx, &pb)
 	if err != nil {
 		log.Error().Err(err).Str("user", s.User()).Msg("failed to update user submit result")
 	}
@@ -0,0 +1,42 @@
+// Package metrics 定义评测服务导出到 Prometheus 的指标
+//
+// 指标注册到默认的 Registry, 由 HTTP 服务器的 /metrics 接口导出.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// SubmissionsTotal 评测完成的提交数, 按结论分类
+	SubmissionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "judge_submissions_total",
+		Help: "Number of judged submissions by verdict.",
+	}, []string{"verdict"})
+
+	// QueueDepth 排队中(尚未开始评测)的提交数
+	QueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "judge_queue_depth",
+		Help: "Number of submissions waiting in the judge queue.",
+	})
+
+	// ExecutionDuration 选手程序每个测试点的运行时间, 按语言分类
+	ExecutionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "judge_execution_duration_seconds",
+		Help:    "Run time of user programs per test case by language.",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2, 5, 10},
+	}, []string{"language"})
+
+	// ContainerStartErrors 创建或启动容器失败的次数
+	ContainerStartErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "judge_container_start_errors_total",
+		Help: "Number of containers that failed to be created or started.",
+	})
+
+	// ExecTimeouts 容器内命令执行超时被强制结束的次数
+	ExecTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "judge_exec_timeouts_total",
+		Help: "Number of container execs killed after exceeding their timeout.",
+	})
+)
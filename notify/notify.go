@@ -0,0 +1,178 @@
+// Package notify 向比赛参赛者发送公告等通知
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// MaxRecipientsPerMail 每封邮件的收件人数上限, 超出时分多封发送
+const MaxRecipientsPerMail = 50
+
+// DefaultWebhookTimeout webhook请求的默认超时
+const DefaultWebhookTimeout = 10 * time.Second
+
+// Message 通知内容
+type Message struct {
+	Type      string    `json:"type"` // 如 "announcement"
+	ContestID string    `json:"contest_id"`
+	Subject   string    `json:"subject"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Notifier 通知发送方式
+type Notifier interface {
+	// Send 向 recipients 中的用户发送通知, recipients 为用户ID
+	Send(ctx context.Context, msg *Message, recipients []string) error
+}
+
+// Multi 依次使用多种方式发送通知, 返回所有发送失败的错误
+type Multi []Notifier
+
+// Send 依次发送通知
+func (m Multi) Send(ctx context.Context, msg *Message, recipients []string) error {
+	var errs []error
+	for _, n := range m {
+		err := n.Send(ctx, msg, recipients)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// FromConfig 按配置创建通知方式, 没有配置任何方式时返回nil
+func FromConfig(cfg *types.Config) Notifier {
+	var m Multi
+	if cfg.Email.SMTPAddr != "" {
+		m = append(m, NewEmailSender(cfg.Email))
+	}
+	if cfg.WebhookURL != "" {
+		m = append(m, NewWebhookSender(cfg.WebhookURL))
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// EmailSender 通过SMTP发送邮件, 用户的邮箱为 {用户ID}@{Domain}
+//
+// 收件人放在信封中而不是邮件头中, 收件人之间互相不可见.
+type EmailSender struct {
+	Config types.EmailConfig
+}
+
+// NewEmailSender 创建邮件发送器
+func NewEmailSender(cfg types.EmailConfig) *EmailSender {
+	return &EmailSender{Config: cfg}
+}
+
+// Send 发送邮件, 收件人较多时分多封发送
+//
+// net/smtp 不支持 context, ctx 只在每封邮件发送前检查.
+func (s *EmailSender) Send(ctx context.Context, msg *Message, recipients []string) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	var auth smtp.Auth
+	if s.Config.Username != "" {
+		host, _, err := net.SplitHostPort(s.Config.SMTPAddr)
+		if err != nil {
+			return errors.Wrap(err, "invalid smtp address")
+		}
+		auth = smtp.PlainAuth("", s.Config.Username, s.Config.Password, host)
+	}
+
+	body := s.compose(msg)
+	for start := 0; start < len(recipients); start += MaxRecipientsPerMail {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		end := min(start+MaxRecipientsPerMail, len(recipients))
+		to := make([]string, 0, end-start)
+		for _, u := range recipients[start:end] {
+			to = append(to, u+"@"+s.Config.Domain)
+		}
+		err := smtp.SendMail(s.Config.SMTPAddr, auth, s.Config.From, to, body)
+		if err != nil {
+			return errors.Wrap(err, "failed to send email to "+strconv.Itoa(len(to))+" recipients")
+		}
+	}
+	return nil
+}
+
+// compose 生成邮件内容, 主题按RFC 2047编码, 正文为UTF-8纯文本
+func (s *EmailSender) compose(msg *Message) []byte {
+	var b bytes.Buffer
+	b.WriteString("From: " + s.Config.From + "\r\n")
+	b.WriteString("To: " + s.Config.From + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + msg.CreatedAt.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	text := strings.ReplaceAll(msg.Text, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// WebhookSender 将通知以JSON的形式POST到 URL, 请求体为 Message 加上 recipients 字段
+type WebhookSender struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookSender 创建webhook发送器
+func NewWebhookSender(url string) *WebhookSender {
+	return &WebhookSender{URL: url, Client: &http.Client{Timeout: DefaultWebhookTimeout}}
+}
+
+// Send 发送webhook请求, 响应状态码不是2xx时返回错误
+func (s *WebhookSender) Send(ctx context.Context, msg *Message, recipients []string) error {
+	data, err := json.Marshal(struct {
+		*Message
+		Recipients []string `json:"recipients"`
+	}{msg, recipients})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "invalid webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send webhook")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("webhook returned status " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
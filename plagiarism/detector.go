@@ -0,0 +1,129 @@
+package plagiarism
+
+import (
+	"sort"
+	"strings"
+)
+
+// 默认配置
+const (
+	DefaultNGram     = 5
+	DefaultThreshold = 0.8
+)
+
+// Source 参与比较的源代码
+type Source struct {
+	ID       string // 提交ID
+	UserID   string
+	Language string
+	Code     string
+}
+
+// Pair 相似度超过阈值的一对提交
+type Pair struct {
+	A          string  `json:"a"`
+	UserA      string  `json:"user_a"`
+	B          string  `json:"b"`
+	UserB      string  `json:"user_b"`
+	Similarity float64 `json:"similarity"`
+}
+
+// PlagiarismDetector 基于token的结构相似度检测
+//
+// 源代码先经 Tokenize 归一化, 再取长度为 NGram 的token片段集合, 两份代码的相似度为片段集合的Jaccard系数.
+// 与逐行diff不同, 重命名变量, 修改常量, 调整空白和注释都不会降低相似度.
+type PlagiarismDetector struct {
+	// NGram 片段长度, 不大于0时使用 DefaultNGram
+	NGram int
+	// Threshold 报告的相似度下限, 取值 (0, 1], 不大于0时使用 DefaultThreshold
+	Threshold float64
+}
+
+// NewPlagiarismDetector 创建检测器
+func NewPlagiarismDetector(ngram int, threshold float64) *PlagiarismDetector {
+	return &PlagiarismDetector{NGram: ngram, Threshold: threshold}
+}
+
+func (d *PlagiarismDetector) ngram() int {
+	if d.NGram <= 0 {
+		return DefaultNGram
+	}
+	return d.NGram
+}
+
+func (d *PlagiarismDetector) threshold() float64 {
+	if d.Threshold <= 0 {
+		return DefaultThreshold
+	}
+	return d.Threshold
+}
+
+// fingerprint 源代码的token片段集合
+func (d *PlagiarismDetector) fingerprint(src Source) map[string]struct{} {
+	tokens := Tokenize(src.Code, src.Language)
+	n := d.ngram()
+
+	set := make(map[string]struct{})
+	if len(tokens) < n {
+		if len(tokens) > 0 {
+			set[strings.Join(tokens, " ")] = struct{}{}
+		}
+		return set
+	}
+	for i := 0; i+n <= len(tokens); i++ {
+		set[strings.Join(tokens[i:i+n], " ")] = struct{}{}
+	}
+	return set
+}
+
+// jaccard 计算两个集合的Jaccard系数
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	inter := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+// Check 两两比较源代码, 返回相似度不低于阈值的提交对, 按相似度降序排列
+//
+// 同一用户的提交之间不做比较.
+func (d *PlagiarismDetector) Check(sources []Source) []Pair {
+	prints := make([]map[string]struct{}, len(sources))
+	for i := range sources {
+		prints[i] = d.fingerprint(sources[i])
+	}
+
+	threshold := d.threshold()
+	var pairs []Pair
+	for i := range sources {
+		for j := i + 1; j < len(sources); j++ {
+			if sources[i].UserID != "" && sources[i].UserID == sources[j].UserID {
+				continue
+			}
+			sim := jaccard(prints[i], prints[j])
+			if sim >= threshold {
+				pairs = append(pairs, Pair{
+					A:          sources[i].ID,
+					UserA:      sources[i].UserID,
+					B:          sources[j].ID,
+					UserB:      sources[j].UserID,
+					Similarity: sim,
+				})
+			}
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Similarity > pairs[j].Similarity
+	})
+	return pairs
+}
@@ -0,0 +1,115 @@
+package plagiarism
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 归一化后的标识符和字面量
+const (
+	tokIdent  = "$id"
+	tokNumber = "$num"
+	tokString = "$str"
+)
+
+// keywords 常见语言的关键字和内置类型, 保留原样, 其余标识符一律归一化
+var keywords = func() map[string]struct{} {
+	words := []string{
+		// C / C++
+		"auto", "break", "case", "char", "const", "continue", "default", "do", "double", "else", "enum",
+		"extern", "float", "for", "goto", "if", "inline", "int", "long", "register", "return", "short",
+		"signed", "sizeof", "static", "struct", "switch", "typedef", "union", "unsigned", "void", "volatile",
+		"while", "bool", "class", "delete", "namespace", "new", "operator", "private", "protected", "public",
+		"template", "this", "throw", "try", "catch", "typename", "using", "virtual", "true", "false", "nullptr",
+		// Java
+		"abstract", "boolean", "byte", "extends", "final", "finally", "implements", "import", "instanceof",
+		"interface", "native", "package", "super", "synchronized", "throws", "transient", "null",
+		// Go
+		"chan", "defer", "fallthrough", "func", "go", "map", "range", "select", "type", "var", "nil",
+		// Python
+		"and", "as", "assert", "def", "del", "elif", "except", "from", "global", "in", "is", "lambda",
+		"nonlocal", "not", "or", "pass", "raise", "with", "yield", "None", "True", "False",
+	}
+	m := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		m[w] = struct{}{}
+	}
+	return m
+}()
+
+// hashComments 使用 # 作为行注释的语言
+func hashComments(language string) bool {
+	language = strings.ToLower(language)
+	return strings.HasPrefix(language, "py") || strings.HasPrefix(language, "ruby") || strings.HasPrefix(language, "sh")
+}
+
+// Tokenize 将源代码转换为归一化的token序列
+//
+// 去掉注释和空白, 标识符(关键字除外)替换为 $id, 数字替换为 $num, 字符串和字符字面量替换为 $str,
+// 运算符和标点保留原样. 因此重命名变量, 修改常量或注释不会改变token序列.
+// language 为语言ID, 只用于判断注释语法.
+func Tokenize(src, language string) []string {
+	hash := hashComments(language)
+	s := []rune(src)
+	var tokens []string
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case hash && c == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+
+		case !hash && c == '/' && i+1 < len(s) && s[i+1] == '/':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+
+		case !hash && c == '/' && i+1 < len(s) && s[i+1] == '*':
+			i += 2
+			for i+1 < len(s) && !(s[i] == '*' && s[i+1] == '/') {
+				i++
+			}
+			i += 2
+
+		case c == '"' || c == '\'' || c == '`':
+			quote := c
+			i++
+			for i < len(s) && s[i] != quote {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+			tokens = append(tokens, tokString)
+
+		case unicode.IsDigit(c):
+			for i < len(s) && (unicode.IsLetter(s[i]) || unicode.IsDigit(s[i]) || s[i] == '.' || s[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, tokNumber)
+
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(s) && (unicode.IsLetter(s[i]) || unicode.IsDigit(s[i]) || s[i] == '_') {
+				i++
+			}
+			word := string(s[start:i])
+			if _, ok := keywords[word]; ok {
+				tokens = append(tokens, word)
+			} else {
+				tokens = append(tokens, tokIdent)
+			}
+
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
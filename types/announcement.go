@@ -0,0 +1,55 @@
+package types
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Announcement 比赛公告
+type Announcement struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	ContestID string `gorm:"index" json:"contest_id"`
+	Text      string `json:"text"`
+	Author    string `json:"author"`
+	CreatedAt int64  `json:"created_at"` // in unix nano
+}
+
+// AnnouncementStore 比赛公告存储
+type AnnouncementStore interface {
+	CreateAnnouncement(a *Announcement) error
+	// ListAnnouncements 按发布时间倒序列出比赛的所有公告
+	ListAnnouncements(contestID string) ([]Announcement, error)
+}
+
+// SQLiteAnnouncementStore 基于 gorm 和 SQLite 的比赛公告存储
+type SQLiteAnnouncementStore struct {
+	db *gorm.DB
+}
+
+var _ AnnouncementStore = (*SQLiteAnnouncementStore)(nil)
+
+// NewSQLiteAnnouncementStore 创建比赛公告存储, 并迁移 Announcement 表结构
+func NewSQLiteAnnouncementStore(db *gorm.DB) (*SQLiteAnnouncementStore, error) {
+	err := db.AutoMigrate(&Announcement{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate announcements")
+	}
+	return &SQLiteAnnouncementStore{db: db}, nil
+}
+
+// CreateAnnouncement 创建公告, 未设置时填充发布时间
+func (s *SQLiteAnnouncementStore) CreateAnnouncement(a *Announcement) error {
+	if a.CreatedAt == 0 {
+		a.CreatedAt = time.Now().UnixNano()
+	}
+	return s.db.Create(a).Error
+}
+
+// ListAnnouncements 按发布时间倒序列出比赛的所有公告
+func (s *SQLiteAnnouncementStore) ListAnnouncements(contestID string) ([]Announcement, error) {
+	list := []Announcement{}
+	err := s.db.Where("contest_id = ?", contestID).Order("created_at desc, id desc").Find(&list).Error
+	return list, err
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// ErrClarificationNotFound 答疑请求不存在
+var ErrClarificationNotFound = errors.New("clarification not found")
+
+// Clarification 比赛中选手向裁判提出的问题
+type Clarification struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    string `gorm:"index" json:"user_id,omitempty"`
+	ContestID string `gorm:"index" json:"contest_id"`
+	ProblemID string `json:"problem_id,omitempty"` // 为空表示关于比赛的一般问题
+	Question  string `json:"question"`
+	Answer    string `json:"answer,omitempty"`
+	// Public 回答是否对所有参赛者公开, 公开的回答同时作为比赛公告发布
+	Public     bool   `json:"public"`
+	AnsweredBy string `json:"answered_by,omitempty"`
+	CreatedAt  int64  `json:"created_at"`            // in unix nano
+	AnsweredAt int64  `json:"answered_at,omitempty"` // in unix nano, 未回答时为0
+}
+
+// Answered 是否已经回答
+func (cl *Clarification) Answered() bool {
+	return cl.AnsweredAt != 0
+}
+
+// ClarificationStore 答疑请求存储
+type ClarificationStore interface {
+	CreateClarification(cl *Clarification) error
+	// AnswerClarification 回答问题, 已经回答过时覆盖原来的回答, 不存在时返回 ErrClarificationNotFound
+	AnswerClarification(id uint, answer string, public bool, answeredBy string) (*Clarification, error)
+	// GetClarification 获取答疑请求, 不存在时返回 ErrClarificationNotFound
+	GetClarification(id uint) (*Clarification, error)
+	// ListClarifications 按提问时间倒序列出比赛的所有答疑请求
+	ListClarifications(contestID string) ([]Clarification, error)
+}
+
+// SQLiteClarificationStore 基于 gorm 和 SQLite 的答疑请求存储
+type SQLiteClarificationStore struct {
+	db *gorm.DB
+}
+
+var _ ClarificationStore = (*SQLiteClarificationStore)(nil)
+
+// NewSQLiteClarificationStore 创建答疑请求存储, 并迁移 Clarification 表结构
+func NewSQLiteClarificationStore(db *gorm.DB) (*SQLiteClarificationStore, error) {
+	err := db.AutoMigrate(&Clarification{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate clarifications")
+	}
+	return &SQLiteClarificationStore{db: db}, nil
+}
+
+// CreateClarification 创建答疑请求, 未设置时填充提问时间
+func (s *SQLiteClarificationStore) CreateClarification(cl *Clarification) error {
+	if cl.CreatedAt == 0 {
+		cl.CreatedAt = time.Now().UnixNano()
+	}
+	return s.db.Create(cl).Error
+}
+
+// AnswerClarification 回答问题
+func (s *SQLiteClarificationStore) AnswerClarification(id uint, answer string, public bool, answeredBy string) (*Clarification, error) {
+	res := s.db.Model(&Clarification{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"answer":      answer,
+		"public":      public,
+		"answered_by": answeredBy,
+		"answered_at": time.Now().UnixNano(),
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrClarificationNotFound
+	}
+	return s.GetClarification(id)
+}
+
+// GetClarification 获取答疑请求
+func (s *SQLiteClarificationStore) GetClarification(id uint) (*Clarification, error) {
+	var cl Clarification
+	err := s.db.Where("id = ?", id).First(&cl).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClarificationNotFound
+		}
+		return nil, err
+	}
+	return &cl, nil
+}
+
+// ListClarifications 按提问时间倒序列出比赛的所有答疑请求
+func (s *SQLiteClarificationStore) ListClarifications(contestID string) ([]Clarification, error) {
+	list := []Clarification{}
+	err := s.db.Where("contest_id = ?", contestID).Order("created_at desc, id desc").Find(&list).Error
+	return list, err
+}
@@ -0,0 +1,178 @@
+package types
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigPath 默认的配置文件路径
+const DefaultConfigPath = "/etc/soj/config.yaml"
+
+// ConfigEnvPrefix 覆盖配置项的环境变量前缀
+//
+// 环境变量名为前缀加上配置项名的大写下划线形式, 如 JudgeWorkers 对应 SOJ_JUDGE_WORKERS,
+// SqlitePath 对应 SOJ_SQLITE_PATH. 列表类型的配置项以逗号分隔.
+const ConfigEnvPrefix = "SOJ_"
+
+// LoadConfig 读取配置文件, 使用环境变量覆盖其中的配置项, 并检查配置是否有效
+func LoadConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read config file")
+	}
+
+	var cfg Config
+	err = yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse config file "+file)
+	}
+
+	err = cfg.applyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ConfigEnvName 返回覆盖配置项 key 的环境变量名
+func ConfigEnvName(key string) string {
+	r := []rune(key)
+	var b strings.Builder
+	b.WriteString(ConfigEnvPrefix)
+	for i, c := range r {
+		// 在小写字母或数字后的大写字母前, 以及连续大写字母中最后一个(其后为小写字母)前分词,
+		// 使 APIAddr 成为 API_ADDR 而不是 A_P_I_ADDR
+		if i > 0 && unicode.IsUpper(c) {
+			prev := r[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(r) && unicode.IsLower(r[i+1])) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(c))
+	}
+	return b.String()
+}
+
+// applyEnv 使用环境变量覆盖配置项, lookup 通常为 os.LookupEnv
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) error {
+	return applyEnvFields(reflect.ValueOf(cfg).Elem(), "", lookup)
+}
+
+// applyEnvFields 使用环境变量覆盖结构体 v 的字段
+//
+// 嵌套的结构体字段对应的环境变量名为外层配置项的变量名加上内层配置项名, 如 Email.SMTPAddr 对应 SOJ_EMAIL_SMTP_ADDR.
+func applyEnvFields(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := ConfigEnvName(key)
+		if prefix != "" {
+			name = prefix + "_" + strings.TrimPrefix(name, ConfigEnvPrefix)
+		}
+
+		f := v.Field(i)
+		if f.Kind() == reflect.Struct {
+			err := applyEnvFields(f, name, lookup)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		val, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(val)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+			if err != nil {
+				return errors.Wrap(err, "invalid integer in "+name)
+			}
+			f.SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(strings.TrimSpace(val))
+			if err != nil {
+				return errors.Wrap(err, "invalid boolean in "+name)
+			}
+			f.SetBool(b)
+		case reflect.Slice:
+			if f.Type().Elem().Kind() != reflect.String {
+				return errors.New("config " + key + " cannot be set from environment")
+			}
+			var items []string
+			for _, s := range strings.Split(val, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					items = append(items, s)
+				}
+			}
+			f.Set(reflect.ValueOf(items))
+		default:
+			return errors.New("config " + key + " cannot be set from environment")
+		}
+	}
+	return nil
+}
+
+// Validate 检查必填的配置项和配置项的取值范围, 返回的错误包含所有无效的配置项
+func (cfg *Config) Validate() error {
+	var problems []string
+	required := func(key, val string) {
+		if val == "" {
+			problems = append(problems, key+" is required (set it in the config file or "+ConfigEnvName(key)+")")
+		}
+	}
+	nonNegative := func(key string, val int64) {
+		if val < 0 {
+			problems = append(problems, key+" must not be negative, got "+strconv.FormatInt(val, 10))
+		}
+	}
+
+	required("HostKey", cfg.HostKey)
+	required("ListenAddr", cfg.ListenAddr)
+	required("SqlitePath", cfg.SqlitePath)
+	required("ProblemsDir", cfg.ProblemsDir)
+
+	nonNegative("JudgeWorkers", int64(cfg.JudgeWorkers))
+	nonNegative("JudgeQueueSize", int64(cfg.JudgeQueueSize))
+	nonNegative("MaxTimeLimitMs", cfg.MaxTimeLimitMs)
+	nonNegative("MaxMemoryLimitKB", cfg.MaxMemoryLimitKB)
+
+	if cfg.Email.SMTPAddr != "" {
+		required("Email.From", cfg.Email.From)
+		required("Email.Domain", cfg.Email.Domain)
+	}
+
+	switch cfg.DistributedRole {
+	case "":
+	case "dispatcher", "worker":
+		if cfg.RedisAddr == "" {
+			problems = append(problems, "DistributedRole "+strconv.Quote(cfg.DistributedRole)+" requires RedisAddr")
+		}
+	default:
+		problems = append(problems, "DistributedRole must be \"dispatcher\", \"worker\" or empty, got "+strconv.Quote(cfg.DistributedRole))
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package types
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -13,6 +15,17 @@ import (
 type DatabaseService struct {
 	db  *gorm.DB
 	cfg *Config
+
+	submissions *SQLiteSubmissionStore
+	teams       *SQLiteTeamStore
+	hacks       *SQLiteHackStore
+	ratings     *SQLiteRatingStore
+	tags        *SQLiteTagStore
+
+	announcements   *SQLiteAnnouncementStore
+	clarifications  *SQLiteClarificationStore
+	problemSets     *SQLiteProblemSetStore
+	virtualContests *SQLiteVirtualContestStore
 }
 
 // NewDatabaseService 创建新的数据库服务
@@ -22,24 +35,151 @@ func NewDatabaseService(cfg *Config) (*DatabaseService, error) {
 		return nil, err
 	}
 
+	// WAL模式下读不会阻塞写, 评测结果写入时API仍可查询
+	err = db.Exec("PRAGMA journal_mode=WAL").Error
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to enable sqlite wal mode")
+	}
+
 	// 自动迁移数据库结构
 	db.AutoMigrate(&SubmitCtx{})
 	db.AutoMigrate(&User{})
 
+	submissions, err := NewSQLiteSubmissionStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := NewSQLiteTeamStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	hacks, err := NewSQLiteHackStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ratings, err := NewSQLiteRatingStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := NewSQLiteTagStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	announcements, err := NewSQLiteAnnouncementStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	clarifications, err := NewSQLiteClarificationStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	problemSets, err := NewSQLiteProblemSetStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	virtualContests, err := NewSQLiteVirtualContestStore(db)
+	if err != nil {
+		return nil, err
+	}
+
 	// 清理未完成的提交
 	db.Model(&SubmitCtx{}).Where("status != ? AND status != ? AND status != ?", "completed", "dead", "failed").Update("status", "dead")
 
 	return &DatabaseService{
-		db:  db,
-		cfg: cfg,
+		db:          db,
+		cfg:         cfg,
+		submissions: submissions,
+		teams:       teams,
+		hacks:       hacks,
+		ratings:     ratings,
+		tags:        tags,
+
+		announcements:   announcements,
+		clarifications:  clarifications,
+		problemSets:     problemSets,
+		virtualContests: virtualContests,
 	}, nil
 }
 
+// Submissions 获取按测试点评测的提交存储
+func (ds *DatabaseService) Submissions() SubmissionStore {
+	return ds.submissions
+}
+
+// Teams 获取队伍存储
+func (ds *DatabaseService) Teams() TeamStore {
+	return ds.teams
+}
+
+// Hacks 获取hack存储
+func (ds *DatabaseService) Hacks() HackStore {
+	return ds.hacks
+}
+
+// Ratings 获取rating存储
+func (ds *DatabaseService) Ratings() RatingStore {
+	return ds.ratings
+}
+
+// Tags 获取标签存储
+func (ds *DatabaseService) Tags() TagStore {
+	return ds.tags
+}
+
+// Announcements 获取比赛公告存储
+func (ds *DatabaseService) Announcements() AnnouncementStore {
+	return ds.announcements
+}
+
+// Clarifications 获取答疑请求存储
+func (ds *DatabaseService) Clarifications() ClarificationStore {
+	return ds.clarifications
+}
+
+// ProblemSets 获取题单存储
+func (ds *DatabaseService) ProblemSets() ProblemSetStore {
+	return ds.problemSets
+}
+
+// VirtualContests 获取虚拟参赛存储
+func (ds *DatabaseService) VirtualContests() VirtualContestStore {
+	return ds.virtualContests
+}
+
 // GetDB 获取数据库实例
 func (ds *DatabaseService) GetDB() *gorm.DB {
 	return ds.db
 }
 
+// errHealthRollback 用于回滚 CheckWritable 中的事务
+var errHealthRollback = errors.New("rollback")
+
+// CheckWritable 检查数据库是否可写
+//
+// 在事务中执行一条不修改任何行的写语句后回滚, SQLite 会为其获取写锁,
+// 数据库文件只读或被其他连接长时间锁定时返回错误.
+func (ds *DatabaseService) CheckWritable(ctx context.Context) error {
+	err := ds.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("UPDATE users SET id = id WHERE 0").Error
+		if err != nil {
+			return err
+		}
+		return errHealthRollback
+	})
+	if errors.Is(err, errHealthRollback) {
+		return nil
+	}
+	return err
+}
+
 // ===============================
 // 用户操作
 // ===============================
@@ -78,6 +218,13 @@ func (ds *DatabaseService) GetUserByID(userID string) (*User, error) {
 	return &user, nil
 }
 
+// UserExists 检查用户是否存在, 与 GetUserByID 不同, 不会创建用户
+func (ds *DatabaseService) UserExists(userID string) (bool, error) {
+	var n int64
+	err := ds.db.Model(&User{}).Where("id = ?", userID).Count(&n).Error
+	return n > 0, err
+}
+
 // GetUserByToken 根据Token获取用户
 func (ds *DatabaseService) GetUserByToken(token string) (*User, error) {
 	var user User
@@ -111,7 +258,8 @@ func (ds *DatabaseService) UpdateUserSubmitResult(userID string, submit *SubmitC
 
 	if submit.Status == "completed" && submit.JudgeResult.Success {
 		newScore := submit.JudgeResult.Score * problem.Weight
-		if user.BestScores[submit.Problem] < newScore {
+		_, hasBest := user.BestSubmits[submit.Problem]
+		if problem.ReplacesBest(hasBest, user.BestScores[submit.Problem], newScore) {
 			user.BestScores[submit.Problem] = newScore
 			user.BestSubmits[submit.Problem] = submit.ID
 			user.BestSubmitDate[submit.Problem] = submit.SubmitTime
@@ -144,7 +292,8 @@ func (ds *DatabaseService) DoFullUserScan(problems map[string]Problem) error {
 			problem, exists := problems[s.Problem]
 			if exists {
 				newScore := s.JudgeResult.Score * problem.Weight
-				if u.BestScores[s.Problem] < newScore {
+				_, hasBest := u.BestSubmits[s.Problem]
+				if problem.ReplacesBest(hasBest, u.BestScores[s.Problem], newScore) {
 					u.BestScores[s.Problem] = newScore
 					u.BestSubmits[s.Problem] = s.ID
 					u.BestSubmitDate[s.Problem] = s.SubmitTime
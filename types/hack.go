@@ -0,0 +1,124 @@
+package types
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// ErrHackNotFound hack不存在
+var ErrHackNotFound = errors.New("hack not found")
+
+// hack的状态
+const (
+	HackPending   = "pending"   // 等待运行
+	HackSucceeded = "succeeded" // 被hack的提交在hack输入上未通过
+	HackFailed    = "failed"    // 被hack的提交在hack输入上通过
+	HackInvalid   = "invalid"   // 标准程序在hack输入上出错, 输入不合法
+	HackError     = "error"     // 评测系统出错
+)
+
+// Hack 选手提交的hack, 用一组输入挑战他人已通过的提交
+type Hack struct {
+	ID           string `gorm:"primaryKey" json:"id"`
+	SubmissionID string `gorm:"index" json:"submission_id"` // 被hack的提交
+	ProblemID    string `json:"problem_id"`
+	HackerID     string `gorm:"index" json:"hacker_id"`
+	TargetUserID string `json:"target_user_id"`
+	Input        string `json:"input"`
+	Status       string `json:"status"`
+	Msg          string `json:"message"`
+	CreatedAt    int64  `json:"created_at"` // in unix nano
+}
+
+// HackStore hack存储
+type HackStore interface {
+	CreateHack(h *Hack) error
+	// UpdateHack 更新hack的状态和信息
+	UpdateHack(id, status, msg string) error
+	// GetHack 获取hack, 不存在时返回 ErrHackNotFound
+	GetHack(id string) (*Hack, error)
+}
+
+// SQLiteHackStore 基于 gorm 和 SQLite 的hack存储
+type SQLiteHackStore struct {
+	db *gorm.DB
+}
+
+var _ HackStore = (*SQLiteHackStore)(nil)
+
+// NewSQLiteHackStore 创建hack存储, 并迁移 Hack 表结构
+func NewSQLiteHackStore(db *gorm.DB) (*SQLiteHackStore, error) {
+	err := db.AutoMigrate(&Hack{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate hacks")
+	}
+	return &SQLiteHackStore{db: db}, nil
+}
+
+// CreateHack 创建hack, 未设置时填充创建时间和状态
+func (s *SQLiteHackStore) CreateHack(h *Hack) error {
+	if h.CreatedAt == 0 {
+		h.CreatedAt = time.Now().UnixNano()
+	}
+	if h.Status == "" {
+		h.Status = HackPending
+	}
+	return s.db.Create(h).Error
+}
+
+// UpdateHack 更新hack的状态和信息
+func (s *SQLiteHackStore) UpdateHack(id, status, msg string) error {
+	res := s.db.Model(&Hack{}).Where("id = ?", id).Updates(map[string]interface{}{"status": status, "msg": msg})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrHackNotFound
+	}
+	return nil
+}
+
+// GetHack 获取hack
+func (s *SQLiteHackStore) GetHack(id string) (*Hack, error) {
+	var h Hack
+	err := s.db.Where("id = ?", id).First(&h).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHackNotFound
+		}
+		return nil, err
+	}
+	return &h, nil
+}
+
+// TransferHackScore 将被hack用户的 points 分hack得分转给hacker, 并重新计算两者的总分
+//
+// 两个用户在同一事务中更新, hack得分之和不变, 互相hack的账号无法凭空刷分.
+func (ds *DatabaseService) TransferHackScore(hackerID, victimID string, points float64) error {
+	// 确保用户存在, 不存在时创建
+	for _, id := range []string{hackerID, victimID} {
+		_, err := ds.GetUserByID(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ds.db.Transaction(func(tx *gorm.DB) error {
+		for id, delta := range map[string]float64{hackerID: points, victimID: -points} {
+			var user User
+			err := tx.Where("id = ?", id).First(&user).Error
+			if err != nil {
+				return err
+			}
+			user.HackScore += delta
+			user.CalculateTotalScore()
+			err = tx.Save(&user).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,169 @@
+package types
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// MaxProblemSetDepth 题单嵌套的最大层数
+const MaxProblemSetDepth = 8
+
+// 题单操作错误
+var (
+	ErrProblemSetNotFound = errors.New("problem set not found")
+	ErrProblemSetCycle    = errors.New("problem set cannot be nested inside itself")
+	ErrProblemSetTooDeep  = errors.New("problem sets are nested too deeply")
+)
+
+// ProblemSet 题单, 比赛之外供练习的题目列表
+//
+// 题单可以嵌套, 如 "Advanced DP" 位于 "Dynamic Programming" 之下. 题单只是题目的列表,
+// 其中的提交与普通的练习提交相同, 不属于任何比赛, 不影响比赛rating.
+type ProblemSet struct {
+	ID          string   `gorm:"primaryKey" json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	ProblemIDs  JStrings `json:"problem_ids"`
+	// ParentID 上级题单, 为空表示顶层题单
+	ParentID  string `gorm:"index" json:"parent_id,omitempty"`
+	CuratorID string `json:"curator_id"`
+	CreatedAt int64  `json:"created_at"` // in unix nano
+	UpdatedAt int64  `json:"updated_at"` // in unix nano
+}
+
+// ProblemSetStore 题单存储
+type ProblemSetStore interface {
+	// CreateProblemSet 创建题单, 未设置时生成ID, 上级题单不存在时返回 ErrProblemSetNotFound
+	CreateProblemSet(ps *ProblemSet) error
+	// UpdateProblemSet 更新题单的名称, 描述, 题目和上级题单, 形成环时返回 ErrProblemSetCycle
+	UpdateProblemSet(ps *ProblemSet) error
+	// DeleteProblemSet 删除题单, 其下级题单移到被删除题单的上级之下
+	DeleteProblemSet(id string) error
+	// GetProblemSet 获取题单, 不存在时返回 ErrProblemSetNotFound
+	GetProblemSet(id string) (*ProblemSet, error)
+	// ListProblemSets 按名称顺序列出 parentID 下的题单, parentID 为空时列出顶层题单
+	ListProblemSets(parentID string) ([]ProblemSet, error)
+}
+
+// SQLiteProblemSetStore 基于 gorm 和 SQLite 的题单存储
+type SQLiteProblemSetStore struct {
+	db *gorm.DB
+}
+
+var _ ProblemSetStore = (*SQLiteProblemSetStore)(nil)
+
+// NewSQLiteProblemSetStore 创建题单存储, 并迁移 ProblemSet 表结构
+func NewSQLiteProblemSetStore(db *gorm.DB) (*SQLiteProblemSetStore, error) {
+	err := db.AutoMigrate(&ProblemSet{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate problem sets")
+	}
+	return &SQLiteProblemSetStore{db: db}, nil
+}
+
+// checkParent 检查 id 可以放在 parentID 之下: 上级题单存在, 不形成环且嵌套层数不超过 MaxProblemSetDepth
+func checkParent(tx *gorm.DB, id, parentID string) error {
+	depth := 1
+	for cur := parentID; cur != ""; depth++ {
+		if cur == id {
+			return ErrProblemSetCycle
+		}
+		if depth >= MaxProblemSetDepth {
+			return ErrProblemSetTooDeep
+		}
+		var p ProblemSet
+		err := tx.Select("id", "parent_id").Where("id = ?", cur).First(&p).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.Wrap(ErrProblemSetNotFound, "parent "+strconv.Quote(cur))
+			}
+			return err
+		}
+		cur = p.ParentID
+	}
+	return nil
+}
+
+// CreateProblemSet 创建题单
+func (s *SQLiteProblemSetStore) CreateProblemSet(ps *ProblemSet) error {
+	if ps.ID == "" {
+		ps.ID = uuid.NewString()
+	}
+	now := time.Now().UnixNano()
+	ps.CreatedAt, ps.UpdatedAt = now, now
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := checkParent(tx, ps.ID, ps.ParentID)
+		if err != nil {
+			return err
+		}
+		return tx.Create(ps).Error
+	})
+}
+
+// UpdateProblemSet 更新题单, 不修改创建者和创建时间
+func (s *SQLiteProblemSetStore) UpdateProblemSet(ps *ProblemSet) error {
+	ps.UpdatedAt = time.Now().UnixNano()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := checkParent(tx, ps.ID, ps.ParentID)
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&ProblemSet{}).Where("id = ?", ps.ID).Updates(map[string]interface{}{
+			"name":        ps.Name,
+			"description": ps.Description,
+			"problem_ids": ps.ProblemIDs,
+			"parent_id":   ps.ParentID,
+			"updated_at":  ps.UpdatedAt,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrProblemSetNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteProblemSet 删除题单
+func (s *SQLiteProblemSetStore) DeleteProblemSet(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var ps ProblemSet
+		err := tx.Where("id = ?", id).First(&ps).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProblemSetNotFound
+			}
+			return err
+		}
+		err = tx.Model(&ProblemSet{}).Where("parent_id = ?", id).Update("parent_id", ps.ParentID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&ProblemSet{}, "id = ?", id).Error
+	})
+}
+
+// GetProblemSet 获取题单
+func (s *SQLiteProblemSetStore) GetProblemSet(id string) (*ProblemSet, error) {
+	var ps ProblemSet
+	err := s.db.Where("id = ?", id).First(&ps).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProblemSetNotFound
+		}
+		return nil, err
+	}
+	return &ps, nil
+}
+
+// ListProblemSets 按名称顺序列出 parentID 下的题单
+func (s *SQLiteProblemSetStore) ListProblemSets(parentID string) ([]ProblemSet, error) {
+	list := []ProblemSet{}
+	err := s.db.Where("parent_id = ?", parentID).Order("name asc, id asc").Find(&list).Error
+	return list, err
+}
@@ -0,0 +1,114 @@
+package types
+
+import (
+	"sort"
+	"time"
+)
+
+// ActivityWeeks 活动网格包含的周数
+const ActivityWeeks = 53
+
+// UserProfile 用户的提交统计, 由用户的按测试点评测的提交汇总得到
+type UserProfile struct {
+	UserID           string `json:"user_id"`
+	TotalSubmissions int    `json:"total_submissions"`
+	AcceptedProblems int    `json:"accepted_problems"`
+	// Languages 语言ID到提交数的映射
+	Languages map[string]int `json:"languages"`
+	// Verdicts 评测结论到提交数的映射, 未评测完成的提交按状态计数
+	Verdicts map[string]int `json:"verdicts"`
+	// ScoreHistory 用户得分的变化, 每次某题的最高分提高时记录一次
+	ScoreHistory   []ScorePoint `json:"score_history"`
+	SolvedProblems []string     `json:"solved_problems"`
+	// Rating 比赛的Elo rating, 不由提交汇总得到, 由调用方填充
+	Rating int `json:"rating"`
+}
+
+// ScorePoint 得分变化记录
+type ScorePoint struct {
+	Time      int64   `json:"time"` // in unix nano
+	ProblemID string  `json:"problem_id"`
+	Score     float64 `json:"score"` // 此时各题最高分乘以题目权重之和
+}
+
+// ComputeUserProfile 汇总用户的提交, subs 需要按提交时间顺序排列
+//
+// weight 返回题目的权重, 用于计算得分.
+func ComputeUserProfile(userID string, subs []Submission, weight func(problemID string) float64) *UserProfile {
+	p := &UserProfile{
+		UserID:         userID,
+		Languages:      make(map[string]int),
+		Verdicts:       make(map[string]int),
+		ScoreHistory:   []ScorePoint{},
+		SolvedProblems: []string{},
+	}
+
+	solved := make(map[string]bool)
+	best := make(map[string]float64)
+	score := 0.0
+	for _, s := range subs {
+		p.TotalSubmissions++
+		p.Languages[s.Language]++
+		if s.Status != SubmissionCompleted {
+			p.Verdicts[s.Status]++
+			continue
+		}
+		p.Verdicts[string(s.JudgeResult.Verdict)]++
+
+		if s.JudgeResult.Verdict == VerdictAccepted && !solved[s.ProblemID] {
+			solved[s.ProblemID] = true
+			p.SolvedProblems = append(p.SolvedProblems, s.ProblemID)
+		}
+		if old := best[s.ProblemID]; s.JudgeResult.Score > old {
+			best[s.ProblemID] = s.JudgeResult.Score
+			score += (s.JudgeResult.Score - old) * weight(s.ProblemID)
+			p.ScoreHistory = append(p.ScoreHistory, ScorePoint{Time: s.SubmittedAt, ProblemID: s.ProblemID, Score: score})
+		}
+	}
+	p.AcceptedProblems = len(p.SolvedProblems)
+	sort.Strings(p.SolvedProblems)
+	return p
+}
+
+// ActivityDay 一天的提交数
+type ActivityDay struct {
+	Date  string `json:"date"` // YYYY-MM-DD
+	Count int    `json:"count"`
+}
+
+// UserActivity 类似GitHub贡献图的每日提交数网格
+type UserActivity struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Max 单日最多的提交数, 用于确定颜色深浅
+	Max int `json:"max"`
+	// Weeks 按周分列, 每周从周日开始, 最后一周只包含到今天为止的日期
+	Weeks [][]ActivityDay `json:"weeks"`
+}
+
+// ComputeActivity 统计截至 now 所在的周的最近 ActivityWeeks 周内每天的提交数, 日期按 now 的时区划分
+func ComputeActivity(subs []Submission, now time.Time) *UserActivity {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	start := today.AddDate(0, 0, -int(today.Weekday())-7*(ActivityWeeks-1))
+
+	counts := make(map[string]int)
+	for _, s := range subs {
+		counts[time.Unix(0, s.SubmittedAt).In(loc).Format(time.DateOnly)]++
+	}
+
+	a := &UserActivity{From: start.Format(time.DateOnly), To: today.Format(time.DateOnly), Weeks: [][]ActivityDay{}}
+	for d := start; !d.After(today); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() == time.Sunday {
+			a.Weeks = append(a.Weeks, []ActivityDay{})
+		}
+		date := d.Format(time.DateOnly)
+		n := counts[date]
+		if n > a.Max {
+			a.Max = n
+		}
+		w := len(a.Weeks) - 1
+		a.Weeks[w] = append(a.Weeks[w], ActivityDay{Date: date, Count: n})
+	}
+	return a
+}
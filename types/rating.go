@@ -0,0 +1,220 @@
+package types
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Elo rating 的参数
+const (
+	// InitialRating 新用户的rating, 与 User.Rating 的数据库默认值一致
+	InitialRating = 1500
+	// RatingK 一场比赛中rating变化的最大幅度
+	RatingK = 32
+)
+
+// ErrContestRated 比赛已经计算过rating
+var ErrContestRated = errors.New("contest has already been rated")
+
+// RatingChange 用户在一场比赛后的rating变化
+type RatingChange struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	UserID    string `gorm:"index" json:"user_id"`
+	ContestID string `gorm:"index" json:"contest_id"`
+	Rank      int    `json:"rank"`
+	OldRating int    `json:"old_rating"`
+	NewRating int    `json:"new_rating"`
+	RatedAt   int64  `json:"rated_at"` // in unix nano
+}
+
+// RatedContest 已经计算过rating的比赛, 保证每场比赛只计算一次
+type RatedContest struct {
+	ContestID string `gorm:"primaryKey"`
+	RatedAt   int64
+}
+
+// ContestResult 用户在比赛中的名次, 名次相同表示并列
+type ContestResult struct {
+	UserID string
+	Rank   int
+}
+
+// LeaderboardEntry 全站rating排行榜中的一行
+type LeaderboardEntry struct {
+	Rank    int    `json:"rank"`
+	UserID  string `json:"user_id"`
+	Rating  int    `json:"rating"`
+	Matches int    `json:"matches"` // 参加过的计算rating的比赛数
+}
+
+// ComputeRatings 按Elo计算一场比赛后各参赛者的新rating
+//
+// 每个参赛者与其他所有参赛者两两比较: 对参赛者 i 和 j, i 的期望得分为
+// E = 1 / (1 + 10^((Rj - Ri) / 400)), 实际得分 S 在 i 名次更靠前时为1, 并列时为0.5, 否则为0.
+// i 的新rating为 Ri + round(RatingK * Σ(S - E) / (n - 1)), n 为参赛人数.
+// ratings 中没有的用户按 InitialRating 计算. 参赛人数少于2时rating不变.
+func ComputeRatings(results []ContestResult, ratings map[string]int) map[string]int {
+	rating := func(u string) int {
+		if r, ok := ratings[u]; ok {
+			return r
+		}
+		return InitialRating
+	}
+
+	updated := make(map[string]int, len(results))
+	n := len(results)
+	for _, a := range results {
+		ra := rating(a.UserID)
+		if n < 2 {
+			updated[a.UserID] = ra
+			continue
+		}
+		sum := 0.0
+		for _, b := range results {
+			if a.UserID == b.UserID {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, float64(rating(b.UserID)-ra)/400))
+			actual := 0.0
+			switch {
+			case a.Rank < b.Rank:
+				actual = 1
+			case a.Rank == b.Rank:
+				actual = 0.5
+			}
+			sum += actual - expected
+		}
+		updated[a.UserID] = ra + int(math.Round(RatingK*sum/float64(n-1)))
+	}
+	return updated
+}
+
+// RatingStore rating存储
+type RatingStore interface {
+	// ApplyContest 按比赛名次更新参赛者的rating并记录变化, 比赛已经计算过时返回 ErrContestRated
+	ApplyContest(contestID string, results []ContestResult) ([]RatingChange, error)
+	// IsRated 比赛是否已经计算过rating
+	IsRated(contestID string) (bool, error)
+	// History 按时间顺序返回用户的rating变化
+	History(userID string) ([]RatingChange, error)
+	// Leaderboard 按rating降序列出参加过计算rating的比赛的用户, limit 为0时不限制数量
+	Leaderboard(limit int) ([]LeaderboardEntry, error)
+}
+
+// SQLiteRatingStore 基于 gorm 和 SQLite 的rating存储, 当前rating保存在 User.Rating 中
+type SQLiteRatingStore struct {
+	db *gorm.DB
+}
+
+var _ RatingStore = (*SQLiteRatingStore)(nil)
+
+// NewSQLiteRatingStore 创建rating存储, 并迁移 RatingChange 和 RatedContest 表结构
+func NewSQLiteRatingStore(db *gorm.DB) (*SQLiteRatingStore, error) {
+	err := db.AutoMigrate(&RatingChange{}, &RatedContest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate ratings")
+	}
+	return &SQLiteRatingStore{db: db}, nil
+}
+
+// ApplyContest 在一个事务中更新参赛者的rating
+func (s *SQLiteRatingStore) ApplyContest(contestID string, results []ContestResult) ([]RatingChange, error) {
+	now := time.Now().UnixNano()
+	var changes []RatingChange
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&RatedContest{ContestID: contestID, RatedAt: now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrContestRated
+		}
+
+		ids := make([]string, 0, len(results))
+		for _, r := range results {
+			ids = append(ids, r.UserID)
+		}
+		var users []User
+		err := tx.Select("id", "rating").Where("id IN ?", ids).Find(&users).Error
+		if err != nil {
+			return err
+		}
+		old := make(map[string]int, len(users))
+		for _, u := range users {
+			old[u.ID] = u.Rating
+		}
+
+		updated := ComputeRatings(results, old)
+		for _, r := range results {
+			c := RatingChange{
+				UserID:    r.UserID,
+				ContestID: contestID,
+				Rank:      r.Rank,
+				OldRating: InitialRating,
+				NewRating: updated[r.UserID],
+				RatedAt:   now,
+			}
+			if o, ok := old[r.UserID]; ok {
+				c.OldRating = o
+			}
+			err = tx.Model(&User{}).Where("id = ?", r.UserID).UpdateColumn("rating", c.NewRating).Error
+			if err != nil {
+				return err
+			}
+			changes = append(changes, c)
+		}
+		if len(changes) > 0 {
+			return tx.Create(&changes).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// IsRated 比赛是否已经计算过rating
+func (s *SQLiteRatingStore) IsRated(contestID string) (bool, error) {
+	var n int64
+	err := s.db.Model(&RatedContest{}).Where("contest_id = ?", contestID).Count(&n).Error
+	return n > 0, err
+}
+
+// History 按时间顺序返回用户的rating变化
+func (s *SQLiteRatingStore) History(userID string) ([]RatingChange, error) {
+	changes := []RatingChange{}
+	err := s.db.Where("user_id = ?", userID).Order("rated_at asc, id asc").Find(&changes).Error
+	return changes, err
+}
+
+// Leaderboard 按rating降序列出用户, rating相同的用户排名相同
+func (s *SQLiteRatingStore) Leaderboard(limit int) ([]LeaderboardEntry, error) {
+	q := s.db.Table("users").
+		Select("users.id AS user_id, users.rating AS rating, COUNT(rating_changes.id) AS matches").
+		Joins("JOIN rating_changes ON rating_changes.user_id = users.id").
+		Group("users.id").
+		Order("users.rating DESC, users.id ASC")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+
+	entries := []LeaderboardEntry{}
+	err := q.Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if i > 0 && entries[i].Rating == entries[i-1].Rating {
+			entries[i].Rank = entries[i-1].Rank
+		} else {
+			entries[i].Rank = i + 1
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,117 @@
+package types
+
+import (
+	"sort"
+	"time"
+)
+
+// FullScore 满分, 工作流评测的提交得分达到满分视为通过
+const FullScore = 100
+
+// ProblemStats 题目的提交统计
+type ProblemStats struct {
+	ProblemID string
+	// Submitters 提交过的用户数
+	Submitters int
+	// Solvers 通过的用户数
+	Solvers int
+	// MedianSolveTime 通过的用户从第一次提交到第一次通过所用时间的中位数
+	MedianSolveTime time.Duration
+	// RecentSubmissions since 之后的提交数
+	RecentSubmissions int
+}
+
+// AcceptanceRate 通过率, 即通过的用户数与提交过的用户数之比
+func (s *ProblemStats) AcceptanceRate() float64 {
+	if s.Submitters == 0 {
+		return 0
+	}
+	return float64(s.Solvers) / float64(s.Submitters)
+}
+
+// submitRecord 统计用的提交记录
+type submitRecord struct {
+	user     string
+	problem  string
+	time     int64
+	accepted bool
+}
+
+// GetProblemStats 统计所有题目的提交情况, 包括工作流评测和按测试点评测的提交
+//
+// since 用于统计近期提交数.
+func (ds *DatabaseService) GetProblemStats(since time.Time) (map[string]*ProblemStats, error) {
+	var records []submitRecord
+
+	var submits []SubmitCtx
+	err := ds.db.Select("user", "problem", "submit_time", "status", "judge_result").Find(&submits).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range submits {
+		records = append(records, submitRecord{
+			user:     s.User,
+			problem:  s.Problem,
+			time:     s.SubmitTime,
+			accepted: s.Status == "completed" && s.JudgeResult.Success && s.JudgeResult.Score >= FullScore,
+		})
+	}
+
+	var subs []Submission
+	err = ds.db.Select("user_id", "problem_id", "submitted_at", "status", "judge_result").Find(&subs).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range subs {
+		records = append(records, submitRecord{
+			user:     s.UserID,
+			problem:  s.ProblemID,
+			time:     s.SubmittedAt,
+			accepted: s.Status == SubmissionCompleted && s.JudgeResult.Verdict == VerdictAccepted,
+		})
+	}
+
+	return computeProblemStats(records, since.UnixNano()), nil
+}
+
+func computeProblemStats(records []submitRecord, since int64) map[string]*ProblemStats {
+	sort.Slice(records, func(i, j int) bool { return records[i].time < records[j].time })
+
+	type progress struct {
+		first  int64
+		solved bool
+	}
+	users := make(map[string]map[string]*progress)
+	solveTimes := make(map[string][]time.Duration)
+	stats := make(map[string]*ProblemStats)
+
+	for _, r := range records {
+		st, ok := stats[r.problem]
+		if !ok {
+			st = &ProblemStats{ProblemID: r.problem}
+			stats[r.problem] = st
+			users[r.problem] = make(map[string]*progress)
+		}
+		if r.time >= since {
+			st.RecentSubmissions++
+		}
+
+		p, ok := users[r.problem][r.user]
+		if !ok {
+			p = &progress{first: r.time}
+			users[r.problem][r.user] = p
+			st.Submitters++
+		}
+		if r.accepted && !p.solved {
+			p.solved = true
+			st.Solvers++
+			solveTimes[r.problem] = append(solveTimes[r.problem], time.Duration(r.time-p.first))
+		}
+	}
+
+	for pid, times := range solveTimes {
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		stats[pid].MedianSolveTime = times[len(times)/2]
+	}
+	return stats
+}
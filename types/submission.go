@@ -0,0 +1,282 @@
+package types
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// ErrSubmissionNotFound 提交不存在
+var ErrSubmissionNotFound = errors.New("submission not found")
+
+// ErrInvalidCursor 分页游标无效
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// 按测试点评测的提交状态
+const (
+	SubmissionPending   = "pending"   // 等待评测
+	SubmissionJudging   = "judging"   // 评测中
+	SubmissionCompleted = "completed" // 评测完成, 结果见 JudgeResult
+	SubmissionFailed    = "failed"    // 评测系统出错
+)
+
+// Submission 按测试点评测的源代码提交
+//
+// 工作流评测的提交由 SubmitCtx 记录.
+type Submission struct {
+	ID         string `gorm:"primaryKey" json:"id"`
+	UserID     string `gorm:"index" json:"user_id"`
+	ProblemID  string `gorm:"index" json:"problem_id"`
+	ContestID  string `gorm:"index" json:"contest_id,omitempty"` // 非比赛提交为空
+	BatchID    string `gorm:"index" json:"batch_id,omitempty"`   // 批量提交的批次ID, 非批量提交为空
+	TeamID     string `gorm:"index" json:"team_id,omitempty"`    // 团队赛中提交者所在的队伍, 提交时确定
+	Language   string `json:"language"`
+	SourceCode string `json:"source_code"`
+	// Archive 多文件提交的zip压缩包, 此时 SourceCode 为空, MainFile 为压缩包内主文件的路径
+	Archive     []byte      `json:"-"`
+	MainFile    string      `json:"main_file,omitempty"`
+	SubmittedAt int64       `gorm:"index" json:"submitted_at"` // in unix nano
+	Status      string      `json:"status"`
+	JudgeResult JudgeResult `json:"judge_result"`
+	// HighlightedSource 语法高亮后的源代码HTML缓存, 首次查看时生成
+	HighlightedSource string `json:"-"`
+	// VirtualContestID 虚拟参赛期间的提交所属的虚拟参赛, 此时 ContestID 为空
+	VirtualContestID string `gorm:"index" json:"virtual_contest_id,omitempty"`
+}
+
+// SubmissionStore 提交存储
+type SubmissionStore interface {
+	CreateSubmission(sub *Submission) error
+	// UpdateResult 更新提交的状态和评测结果
+	UpdateResult(id string, status string, result *JudgeResult) error
+	// GetByID 获取提交, 不存在时返回 ErrSubmissionNotFound
+	GetByID(id string) (*Submission, error)
+	// SetHighlightedSource 缓存提交源代码语法高亮后的HTML
+	SetHighlightedSource(id string, html string) error
+	// ListByProblem 按提交时间倒序列出题目的所有提交
+	ListByProblem(problemID string) ([]Submission, error)
+	// ListByContest 按提交时间顺序列出比赛的所有提交, 不读取源代码和压缩包
+	ListByContest(contestID string) ([]Submission, error)
+	// ListByUser 按提交时间顺序列出用户的所有提交, 不读取源代码和压缩包
+	ListByUser(userID string) ([]Submission, error)
+	// ListByUserPage 按提交时间倒序列出用户在游标 after 之后的至多 limit 个提交, 不读取源代码和压缩包
+	//
+	// after 为nil时从最新的提交开始.
+	ListByUserPage(userID string, after *SubmissionCursor, limit int) ([]Submission, error)
+	// ListByVirtualContest 按提交时间顺序列出虚拟参赛的所有提交, 不读取源代码和压缩包
+	ListByVirtualContest(virtualContestID string) ([]Submission, error)
+	// ListByBatch 按用户ID顺序列出批次的所有提交
+	ListByBatch(batchID string) ([]Submission, error)
+	// OnCompleted 注册回调, 提交评测完成并写入结果后调用
+	OnCompleted(fn func(sub *Submission))
+}
+
+// SQLiteSubmissionStore 基于 gorm 和 SQLite 的提交存储
+type SQLiteSubmissionStore struct {
+	db *gorm.DB
+
+	mu          sync.RWMutex
+	onCompleted []func(sub *Submission)
+}
+
+var _ SubmissionStore = (*SQLiteSubmissionStore)(nil)
+
+// NewSQLiteSubmissionStore 创建提交存储, 并迁移 Submission 表结构
+func NewSQLiteSubmissionStore(db *gorm.DB) (*SQLiteSubmissionStore, error) {
+	err := db.AutoMigrate(&Submission{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate submissions")
+	}
+	return &SQLiteSubmissionStore{db: db}, nil
+}
+
+// CreateSubmission 创建提交, 未设置时填充提交时间和状态
+func (s *SQLiteSubmissionStore) CreateSubmission(sub *Submission) error {
+	if sub.SubmittedAt == 0 {
+		sub.SubmittedAt = time.Now().UnixNano()
+	}
+	if sub.Status == "" {
+		sub.Status = SubmissionPending
+	}
+	return s.db.Create(sub).Error
+}
+
+// UpdateResult 更新提交的状态和评测结果
+//
+// 提交已被hack时新结果保留原来的hack记录, 见 JudgeResult.KeepHack, 重测不会撤销hack.
+func (s *SQLiteSubmissionStore) UpdateResult(id string, status string, result *JudgeResult) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"status": status}
+		if result != nil {
+			res := *result
+			if res.Hack == nil {
+				var cur Submission
+				err := tx.Select("judge_result").Where("id = ?", id).First(&cur).Error
+				if err != nil {
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return ErrSubmissionNotFound
+					}
+					return err
+				}
+				res.KeepHack(cur.JudgeResult.Hack)
+			}
+			updates["judge_result"] = res
+		}
+
+		res := tx.Model(&Submission{}).Where("id = ?", id).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrSubmissionNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if status == SubmissionCompleted {
+		s.notifyCompleted(id)
+	}
+	return nil
+}
+
+// SetHighlightedSource 缓存提交源代码语法高亮后的HTML
+func (s *SQLiteSubmissionStore) SetHighlightedSource(id string, html string) error {
+	res := s.db.Model(&Submission{}).Where("id = ?", id).Update("highlighted_source", html)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrSubmissionNotFound
+	}
+	return nil
+}
+
+// ListByBatch 按用户ID顺序列出批次的所有提交
+func (s *SQLiteSubmissionStore) ListByBatch(batchID string) ([]Submission, error) {
+	var subs []Submission
+	err := s.db.Where("batch_id = ?", batchID).Order("user_id asc").Find(&subs).Error
+	return subs, err
+}
+
+// OnCompleted 注册回调, 提交评测完成并写入结果后调用
+//
+// 回调在调用 UpdateResult 的goroutine中同步执行, 不应阻塞.
+func (s *SQLiteSubmissionStore) OnCompleted(fn func(sub *Submission)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onCompleted = append(s.onCompleted, fn)
+}
+
+func (s *SQLiteSubmissionStore) notifyCompleted(id string) {
+	s.mu.RLock()
+	hooks := s.onCompleted
+	s.mu.RUnlock()
+	if len(hooks) == 0 {
+		return
+	}
+
+	sub, err := s.GetByID(id)
+	if err != nil {
+		log.Warn().Err(err).Str("id", id).Msg("failed to load completed submission")
+		return
+	}
+	for _, fn := range hooks {
+		fn(sub)
+	}
+}
+
+// GetByID 获取提交
+func (s *SQLiteSubmissionStore) GetByID(id string) (*Submission, error) {
+	var sub Submission
+	err := s.db.Where("id = ?", id).First(&sub).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubmissionNotFound
+		}
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// ListByProblem 按提交时间倒序列出题目的所有提交
+func (s *SQLiteSubmissionStore) ListByProblem(problemID string) ([]Submission, error) {
+	var subs []Submission
+	err := s.db.Where("problem_id = ?", problemID).Order("submitted_at desc").Find(&subs).Error
+	return subs, err
+}
+
+// ListByUser 按提交时间顺序列出用户的所有提交, 不读取源代码和压缩包
+func (s *SQLiteSubmissionStore) ListByUser(userID string) ([]Submission, error) {
+	var subs []Submission
+	err := s.db.Omit("source_code", "archive", "highlighted_source").Where("user_id = ?", userID).Order("submitted_at asc").Find(&subs).Error
+	return subs, err
+}
+
+// ListByUserPage 按提交时间和ID倒序列出用户在游标之后的提交, 不读取源代码和压缩包
+func (s *SQLiteSubmissionStore) ListByUserPage(userID string, after *SubmissionCursor, limit int) ([]Submission, error) {
+	q := s.db.Omit("source_code", "archive", "highlighted_source").Where("user_id = ?", userID)
+	if after != nil {
+		q = q.Where("submitted_at < ? OR (submitted_at = ? AND id < ?)", after.SubmittedAt, after.SubmittedAt, after.ID)
+	}
+	subs := []Submission{}
+	err := q.Order("submitted_at desc, id desc").Limit(limit).Find(&subs).Error
+	return subs, err
+}
+
+// ListByVirtualContest 按提交时间顺序列出虚拟参赛的所有提交, 不读取源代码和压缩包
+func (s *SQLiteSubmissionStore) ListByVirtualContest(virtualContestID string) ([]Submission, error) {
+	var subs []Submission
+	err := s.db.Omit("source_code", "archive", "highlighted_source").Where("virtual_contest_id = ?", virtualContestID).Order("submitted_at asc").Find(&subs).Error
+	return subs, err
+}
+
+// ListByContest 按提交时间顺序列出比赛的所有提交, 不读取源代码和压缩包
+func (s *SQLiteSubmissionStore) ListByContest(contestID string) ([]Submission, error) {
+	var subs []Submission
+	err := s.db.Omit("source_code", "archive", "highlighted_source").Where("contest_id = ?", contestID).Order("submitted_at asc").Find(&subs).Error
+	return subs, err
+}
+
+// SubmissionCursor 按提交时间倒序分页的游标, 指向上一页的最后一个提交
+//
+// 游标同时包含提交时间和ID, 提交时间相同时按ID排序, 新的提交不会改变已有提交的位置.
+type SubmissionCursor struct {
+	SubmittedAt int64
+	ID          string
+}
+
+// CursorOf 返回指向提交 sub 的游标
+func CursorOf(sub *Submission) SubmissionCursor {
+	return SubmissionCursor{SubmittedAt: sub.SubmittedAt, ID: sub.ID}
+}
+
+// Encode 将游标编码为不透明的字符串
+func (c SubmissionCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.SubmittedAt, 10) + ":" + c.ID))
+}
+
+// ParseSubmissionCursor 解析 Encode 生成的游标, 无效时返回 ErrInvalidCursor
+func ParseSubmissionCursor(s string) (*SubmissionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	at, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &SubmissionCursor{SubmittedAt: at, ID: id}, nil
+}
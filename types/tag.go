@@ -0,0 +1,106 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxTagLength 标签的最大长度(字节)
+const MaxTagLength = 64
+
+// 标签操作错误
+var (
+	ErrTagNotFound = errors.New("tag not found")
+	ErrTagExists   = errors.New("tag already exists")
+)
+
+// NormalizeTag 去掉标签首尾的空白并转为小写
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// ValidateTag 检查标签已经规范化, 不为空且不包含逗号和控制字符, 逗号用于在查询参数中分隔多个标签
+func ValidateTag(tag string) error {
+	if tag == "" {
+		return errors.New("tag is empty")
+	}
+	if len(tag) > MaxTagLength {
+		return errors.New("tag " + strconv.Quote(tag) + " is longer than " + strconv.Itoa(MaxTagLength) + " bytes")
+	}
+	if tag != NormalizeTag(tag) {
+		return errors.New("tag " + strconv.Quote(tag) + " must be lowercase without surrounding spaces")
+	}
+	if strings.ContainsFunc(tag, func(r rune) bool { return r == ',' || unicode.IsControl(r) }) {
+		return errors.New("tag " + strconv.Quote(tag) + " contains commas or control characters")
+	}
+	return nil
+}
+
+// Tag 题目的知识点标签, 如 "dynamic programming"
+type Tag struct {
+	Name      string `gorm:"primaryKey" json:"name"`
+	CreatedAt int64  `json:"created_at"` // in unix nano
+}
+
+// TagStore 标签存储, 题目使用的标签需要先创建
+type TagStore interface {
+	// CreateTag 创建标签, 已经存在时返回 ErrTagExists
+	CreateTag(name string) (*Tag, error)
+	// ListTags 按名称顺序列出所有标签
+	ListTags() ([]Tag, error)
+	// HasTag 标签是否存在
+	HasTag(name string) (bool, error)
+}
+
+// SQLiteTagStore 基于 gorm 和 SQLite 的标签存储
+type SQLiteTagStore struct {
+	db *gorm.DB
+}
+
+var _ TagStore = (*SQLiteTagStore)(nil)
+
+// NewSQLiteTagStore 创建标签存储, 并迁移 Tag 表结构
+func NewSQLiteTagStore(db *gorm.DB) (*SQLiteTagStore, error) {
+	err := db.AutoMigrate(&Tag{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate tags")
+	}
+	return &SQLiteTagStore{db: db}, nil
+}
+
+// CreateTag 创建标签
+func (s *SQLiteTagStore) CreateTag(name string) (*Tag, error) {
+	err := ValidateTag(name)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tag{Name: name, CreatedAt: time.Now().UnixNano()}
+	res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(t)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrTagExists
+	}
+	return t, nil
+}
+
+// ListTags 按名称顺序列出所有标签
+func (s *SQLiteTagStore) ListTags() ([]Tag, error) {
+	tags := []Tag{}
+	err := s.db.Order("name asc").Find(&tags).Error
+	return tags, err
+}
+
+// HasTag 标签是否存在
+func (s *SQLiteTagStore) HasTag(name string) (bool, error) {
+	var n int64
+	err := s.db.Model(&Tag{}).Where("name = ?", name).Count(&n).Error
+	return n > 0, err
+}
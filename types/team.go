@@ -0,0 +1,219 @@
+package types
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// MaxTeamSize 队伍的最大人数
+const MaxTeamSize = 3
+
+// 队伍操作错误
+var (
+	ErrTeamNotFound  = errors.New("team not found")
+	ErrAlreadyInTeam = errors.New("user is already in a team")
+	ErrNotInTeam     = errors.New("user is not in a team")
+	ErrTeamFull      = errors.New("team is full")
+)
+
+// Team 比赛队伍, 队员在团队赛中的提交计入队伍
+//
+// 每个用户同时只能属于一个队伍, 其他用户通过邀请码加入.
+type Team struct {
+	TeamID     string `gorm:"primaryKey" json:"team_id"`
+	Name       string `json:"name"`
+	InviteCode string `gorm:"uniqueIndex" json:"invite_code"`
+	CreatedAt  int64  `json:"created_at"` // in unix nano
+	// MemberIDs 队员的用户ID, 按加入顺序排列, 从 TeamMember 表读取
+	MemberIDs []string `gorm:"-" json:"member_ids"`
+}
+
+// TeamMember 队伍成员关系
+type TeamMember struct {
+	UserID   string `gorm:"primaryKey"`
+	TeamID   string `gorm:"index"`
+	JoinedAt int64
+}
+
+// TeamStore 队伍存储
+type TeamStore interface {
+	// CreateTeam 创建队伍, 创建者成为第一个队员
+	CreateTeam(name, userID string) (*Team, error)
+	// JoinTeam 通过邀请码加入队伍, 邀请码无效时返回 ErrTeamNotFound
+	JoinTeam(inviteCode, userID string) (*Team, error)
+	// LeaveTeam 离开所在的队伍, 最后一个队员离开后队伍被删除
+	LeaveTeam(userID string) error
+	// GetTeam 获取队伍, 不存在时返回 ErrTeamNotFound
+	GetTeam(teamID string) (*Team, error)
+	// GetTeamByUser 获取用户所在的队伍, 不在队伍中时返回 ErrNotInTeam
+	GetTeamByUser(userID string) (*Team, error)
+}
+
+// SQLiteTeamStore 基于 gorm 和 SQLite 的队伍存储
+type SQLiteTeamStore struct {
+	db *gorm.DB
+}
+
+var _ TeamStore = (*SQLiteTeamStore)(nil)
+
+// NewSQLiteTeamStore 创建队伍存储, 并迁移 Team 和 TeamMember 表结构
+func NewSQLiteTeamStore(db *gorm.DB) (*SQLiteTeamStore, error) {
+	err := db.AutoMigrate(&Team{}, &TeamMember{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate teams")
+	}
+	return &SQLiteTeamStore{db: db}, nil
+}
+
+// newInviteCode 生成8位十六进制邀请码
+func newInviteCode() (string, error) {
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateTeam 创建队伍
+func (s *SQLiteTeamStore) CreateTeam(name, userID string) (*Team, error) {
+	if name == "" {
+		return nil, errors.New("team name is empty")
+	}
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano()
+	team := &Team{
+		TeamID:     uuid.New().String(),
+		Name:       name,
+		InviteCode: code,
+		CreatedAt:  now,
+		MemberIDs:  []string{userID},
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		err := tx.Model(&TeamMember{}).Where("user_id = ?", userID).Count(&n).Error
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrAlreadyInTeam
+		}
+		err = tx.Create(team).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&TeamMember{UserID: userID, TeamID: team.TeamID, JoinedAt: now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// JoinTeam 通过邀请码加入队伍
+func (s *SQLiteTeamStore) JoinTeam(inviteCode, userID string) (*Team, error) {
+	var team Team
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("invite_code = ?", inviteCode).First(&team).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTeamNotFound
+			}
+			return err
+		}
+
+		var n int64
+		err = tx.Model(&TeamMember{}).Where("user_id = ?", userID).Count(&n).Error
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrAlreadyInTeam
+		}
+		err = tx.Model(&TeamMember{}).Where("team_id = ?", team.TeamID).Count(&n).Error
+		if err != nil {
+			return err
+		}
+		if n >= MaxTeamSize {
+			return ErrTeamFull
+		}
+		return tx.Create(&TeamMember{UserID: userID, TeamID: team.TeamID, JoinedAt: time.Now().UnixNano()}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTeam(team.TeamID)
+}
+
+// LeaveTeam 离开所在的队伍
+func (s *SQLiteTeamStore) LeaveTeam(userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var m TeamMember
+		err := tx.Where("user_id = ?", userID).First(&m).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotInTeam
+			}
+			return err
+		}
+		err = tx.Delete(&m).Error
+		if err != nil {
+			return err
+		}
+
+		var n int64
+		err = tx.Model(&TeamMember{}).Where("team_id = ?", m.TeamID).Count(&n).Error
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return tx.Where("team_id = ?", m.TeamID).Delete(&Team{}).Error
+		}
+		return nil
+	})
+}
+
+// GetTeam 获取队伍
+func (s *SQLiteTeamStore) GetTeam(teamID string) (*Team, error) {
+	var team Team
+	err := s.db.Where("team_id = ?", teamID).First(&team).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, err
+	}
+
+	var members []TeamMember
+	err = s.db.Where("team_id = ?", teamID).Order("joined_at asc").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	team.MemberIDs = make([]string, len(members))
+	for i, m := range members {
+		team.MemberIDs[i] = m.UserID
+	}
+	return &team, nil
+}
+
+// GetTeamByUser 获取用户所在的队伍
+func (s *SQLiteTeamStore) GetTeamByUser(userID string) (*Team, error) {
+	var m TeamMember
+	err := s.db.Where("user_id = ?", userID).First(&m).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInTeam
+		}
+		return nil, err
+	}
+	return s.GetTeam(m.TeamID)
+}
@@ -6,9 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/logrusorgru/aurora/v4"
+	"github.com/pkg/errors"
 )
 
 // Config 全局配置
@@ -22,6 +26,11 @@ type Config struct {
 	SubmitsDir    string `yaml:"SubmitsDir"`
 	SubmitWorkDir string `yaml:"SubmitWorkDir"`
 	ProblemsDir   string `yaml:"ProblemsDir"`
+	ContestsDir   string `yaml:"ContestsDir"`   // 比赛定义文件目录, 为空时不启用比赛
+	LanguagesFile string `yaml:"LanguagesFile"` // 编程语言配置文件, 为空时不支持按语言评测
+
+	// ProblemDataDir 按测试点评测的题目数据目录, 测试点位于 {ProblemDataDir}/{题目ID}/tests/{n}.in 和 {n}.out
+	ProblemDataDir string `yaml:"ProblemDataDir"`
 
 	RealSubmitsDir    string `yaml:"RealSubmitsDir"`
 	RealSubmitWorkDir string `yaml:"RealSubmitWorkDir"`
@@ -29,14 +38,66 @@ type Config struct {
 	SqlitePath string `yaml:"SqlitePath"`
 
 	DockerCli        string `yaml:"DockerCli"`
+	DockerHost       string `yaml:"DockerHost"` // Docker守护进程地址, 如 unix:///var/run/docker.sock, 为空时使用 DOCKER_HOST 等环境变量
 	ProblemURLPrefix string `yaml:"ProblemURLPrefix"`
 
 	SubmitGid int `yaml:"SubmitGid"`
 	SubmitUid int `yaml:"SubmitUid"`
 
 	Admins []string `yaml:"Admins"`
+
+	JudgeWorkers   int `yaml:"JudgeWorkers"`   // 同时评测的提交数
+	JudgeQueueSize int `yaml:"JudgeQueueSize"` // 排队的提交数上限
+
+	MaxTimeLimitMs   int64 `yaml:"MaxTimeLimitMs"`   // 题目时间限制(毫秒)的上限, 为0时不限制
+	MaxMemoryLimitKB int64 `yaml:"MaxMemoryLimitKB"` // 题目内存限制(KB)的上限, 为0时不限制
+
+	SubmitRateLimit int    `yaml:"SubmitRateLimit"` // 每个用户每分钟通过HTTP提交的次数上限, 不大于0时使用默认值
+	RedisAddr       string `yaml:"RedisAddr"`       // 设置时限流状态保存在Redis中, 多个实例共享
+
+	// DistributedRole 分布式评测中本节点的角色, 需要设置 RedisAddr:
+	// "dispatcher" 将源代码提交写入Redis由评测节点评测, "worker" 作为评测节点运行, 为空时只在本地评测
+	DistributedRole string `yaml:"DistributedRole"`
+
+	MaxArchiveSize int64 `yaml:"MaxArchiveSize"` // 多文件提交解压后的总大小上限(字节), 不大于0时使用默认值
+
+	// MaxSourceSizeBytes 源代码提交和自定义输入运行的源代码大小上限(字节), 不大于0时使用默认值.
+	// 超出时HTTP接口在创建容器前返回413.
+	MaxSourceSizeBytes int64 `yaml:"MaxSourceSizeBytes"`
+
+	JWTSecret string `yaml:"JWTSecret"` // HTTP API 的 JWT HMAC-SHA256 密钥, 为空时只支持 Cookie 中的 token
+
+	// Email 比赛公告的邮件通知, SMTPAddr 为空时不发送邮件
+	Email EmailConfig `yaml:"Email"`
+	// WebhookURL 设置时比赛公告以JSON的形式POST到该地址
+	WebhookURL string `yaml:"WebhookURL"`
+}
+
+// EmailConfig 发送邮件使用的SMTP服务器
+type EmailConfig struct {
+	SMTPAddr string `yaml:"SMTPAddr"` // host:port, 如 smtp.example.com:587
+	Username string `yaml:"Username"` // 为空时不认证
+	Password string `yaml:"Password"`
+	From     string `yaml:"From"` // 发件人地址
+	// Domain 用户的邮箱域名, 用户的邮箱为 {用户ID}@{Domain}
+	Domain string `yaml:"Domain"`
 }
 
+// Verdict 评测结论
+type Verdict string
+
+const (
+	VerdictAccepted            Verdict = "AC"  // 答案正确
+	VerdictWrongAnswer         Verdict = "WA"  // 答案错误
+	VerdictPresentationError   Verdict = "PE"  // 格式错误
+	VerdictTimeLimitExceeded   Verdict = "TLE" // 运行超时
+	VerdictMemoryLimitExceeded Verdict = "MLE" // 超出内存限制
+	VerdictOutputLimitExceeded Verdict = "OLE" // 输出超出限制
+	VerdictRuntimeError        Verdict = "RE"  // 运行时错误, 即退出码非0
+	VerdictCompileError        Verdict = "CE"  // 编译错误
+	VerdictSystemError         Verdict = "SE"  // 评测系统错误, 如checker异常退出
+)
+
 // JudgeResult 评测结果
 type JudgeResult struct {
 	Success bool    `json:"success"`
@@ -44,6 +105,61 @@ type JudgeResult struct {
 	Msg     string  `json:"message"`
 	Memory  uint64  `json:"memory"` // in bytes
 	Time    uint64  `json:"time"`   // in ns
+
+	// 以下字段仅在按测试点评测时设置, 工作流评测由评测脚本给出结果, 不设置这些字段
+
+	Verdict       Verdict `json:"verdict,omitempty"`
+	ExitCode      int     `json:"exit_code,omitempty"`
+	TimeUsedMs    int64   `json:"time_used_ms,omitempty"`
+	MemoryUsedKB  int64   `json:"memory_used_kb,omitempty"`
+	Stdout        string  `json:"stdout,omitempty"`
+	Stderr        string  `json:"stderr,omitempty"`
+	CheckerOutput string  `json:"checker_output,omitempty"` // checker或交互器的输出
+
+	// MaxScore 满分, 按子任务计分时为各子任务分值之和
+	MaxScore float64         `json:"max_score,omitempty"`
+	Subtasks []SubtaskResult `json:"subtasks,omitempty"`
+
+	// Hack 提交被成功hack时设置, 此时 Verdict 为提交在hack输入上的结论, Score 为0
+	Hack *HackResult `json:"hack,omitempty"`
+}
+
+// KeepHack 将提交原有的hack记录带到新的评测结果上, hack 为nil或结果已有hack记录时不做改变
+//
+// 被hack的提交重测后仍保持被hack的状态: 新结果通过时结论改为hack时的结论, 得分始终为0.
+func (r *JudgeResult) KeepHack(hack *HackResult) {
+	if hack == nil || r.Hack != nil {
+		return
+	}
+	r.Hack = hack
+	if r.Verdict == VerdictAccepted {
+		r.Verdict = hack.Verdict
+	}
+	r.Score = 0
+}
+
+// HackResult 提交被hack的记录
+type HackResult struct {
+	HackID   string  `json:"hack_id"`
+	HackerID string  `json:"hacker_id"`
+	Verdict  Verdict `json:"verdict"`   // 被hack的提交在hack输入上的结论
+	HackedAt int64   `json:"hacked_at"` // in unix nano
+	// Score 被hack前的得分
+	Score float64 `json:"score"`
+}
+
+// SubtaskResult 子任务的得分
+type SubtaskResult struct {
+	Name      string  `json:"name"`
+	Points    float64 `json:"points"`
+	MaxPoints float64 `json:"max_points"`
+	// Passed 子任务的所有测试点都通过时为 true, 此时得到全部分值, 否则不得分
+	Passed bool `json:"passed"`
+}
+
+// IsFatal 结论是否说明程序没有正常运行结束或输出不完整(TLE/MLE/OLE/RE), 此时无需再比较输出
+func (v Verdict) IsFatal() bool {
+	return v == VerdictTimeLimitExceeded || v == VerdictMemoryLimitExceeded || v == VerdictOutputLimitExceeded || v == VerdictRuntimeError
 }
 
 // WorkflowResult 工作流结果
@@ -128,6 +244,8 @@ func (ctx *SubmitCtx) SetMsg(msg string) *SubmitCtx {
 }
 
 // Problem 问题定义
+//
+// 定义了 Workflow 的题目由工作流评测, 否则按测试点评测, 此时需要设置时间和内存限制.
 type Problem struct {
 	Version  int        `yaml:"version"`
 	Id       string     `yaml:"id"`
@@ -135,6 +253,267 @@ type Problem struct {
 	Weight   float64    `yaml:"weight"`
 	Submits  []Submit   `yaml:"submits"`
 	Workflow []Workflow `yaml:"workflow"`
+
+	Title       string      `yaml:"title"`
+	Statement   string      `yaml:"statement"`
+	ScoringMode ScoringMode `yaml:"scoringmode"` // 多次提交时计入成绩的提交, 默认为 max
+	CompareMode CompareMode `yaml:"comparemode"` // 比较输出的方式, 默认为 trailing
+
+	// Tags 知识点标签, 见 ValidateTag. 比赛进行中不向选手展示比赛题目的标签
+	Tags []string `yaml:"tags"`
+
+	TimeLimitMs   int64 `yaml:"timelimitms"`   // 每个测试点的时间限制(毫秒)
+	MemoryLimitKB int64 `yaml:"memorylimitkb"` // 每个测试点的内存限制(KB)
+	OutputLimitKB int64 `yaml:"outputlimitkb"` // 每个测试点标准输出的大小限制(KB), 不大于0时使用默认值
+
+	// CompileFlags 追加到语言编译命令末尾的编译选项, 如 -O2 或 -fsanitize=address, 见 ValidateCompileFlag
+	//
+	// 安全提示: 编译选项由题目作者控制, 会改变生成的程序. 例如 -static 或链接器选项可以绕开镜像中的运行时限制,
+	// -fsanitize 会改变程序的内存使用, 插件和 specs 选项可以在编译容器中执行任意代码.
+	// 评测的隔离不能依赖编译选项, 只应将修改题目的权限授予可信的管理员.
+	CompileFlags []string `yaml:"compileflags"`
+
+	// Solution 标准程序, 用于生成hack输入的标准答案, 未设置时不能hack该题的提交
+	Solution *JurySolution `yaml:"solution"`
+
+	// Generator 测试点生成器, 管理员可以用它批量生成测试点, 见 GeneratorConfig
+	Generator *GeneratorConfig `yaml:"generator"`
+
+	// Checker checker程序, 设置后按 testlib 的约定比较输出, 不再按 CompareMode 比较
+	Checker *CheckerConfig `yaml:"checker"`
+
+	// Interactor 交互器, 设置后为交互题: 选手程序与交互器交互, 由交互器给出结论, 不能与 Checker 同时设置
+	Interactor *InteractorConfig `yaml:"interactor"`
+
+	// LanguageTemplates 语言ID到代码模板的映射, 覆盖语言配置中的默认模板
+	LanguageTemplates map[string]string `yaml:"languagetemplates"`
+
+	// Subtasks 子任务, 设置后按通过的子任务计分, 否则按通过的测试点比例计分
+	Subtasks []Subtask `yaml:"subtasks"`
+
+	// DifficultyRating 根据提交历史计算的难度, 取值 1-10, 0 表示尚无足够数据. 不从定义文件读取.
+	DifficultyRating float64 `yaml:"-"`
+}
+
+// JurySolution 题目的标准程序
+type JurySolution struct {
+	Language string `yaml:"language"` // 语言ID
+	Source   string `yaml:"source"`
+}
+
+// GeneratorConfig 测试点生成器, 对区间内的每个种子运行一次生成器, 每次生成一个测试点
+//
+// 生成器的标准输出以单独一行的 Delimiter 分隔为测试输入和标准答案.
+type GeneratorConfig struct {
+	Image string `yaml:"image"`
+	// Command 生成器命令, 其中的 {seed} 会被替换为种子, 不含 {seed} 时种子作为最后一个参数追加
+	Command   string `yaml:"command"`
+	SeedFrom  int64  `yaml:"seedfrom"`
+	SeedTo    int64  `yaml:"seedto"`    // 包含在区间内
+	Delimiter string `yaml:"delimiter"` // 为空时使用 ---
+	Timeout   int    `yaml:"timeout"`   // 每次运行的超时(秒), 为0时使用默认值
+}
+
+// MaxGeneratorSeeds 生成器一次最多运行的种子数
+const MaxGeneratorSeeds = 1000
+
+// Validate 检查生成器配置
+func (g *GeneratorConfig) Validate() error {
+	if g.Image == "" {
+		return errors.New("generator image is empty")
+	}
+	if g.Command == "" {
+		return errors.New("generator command is empty")
+	}
+	if g.SeedTo < g.SeedFrom {
+		return errors.New("generator seedto must not be less than seedfrom")
+	}
+	if g.SeedTo-g.SeedFrom >= MaxGeneratorSeeds {
+		return errors.New("generator seed range exceeds " + strconv.Itoa(MaxGeneratorSeeds) + " seeds")
+	}
+	if g.Timeout < 0 {
+		return errors.New("generator timeout must not be negative")
+	}
+	return nil
+}
+
+// CheckerConfig 题目的checker程序, 以 `<Command> input.txt output.txt answer.txt` 调用, 见 judge.SpecialJudge
+type CheckerConfig struct {
+	Image   string `yaml:"image"`
+	Command string `yaml:"command"`
+}
+
+// Validate 检查checker配置
+func (c *CheckerConfig) Validate() error {
+	if c.Image == "" {
+		return errors.New("checker image is empty")
+	}
+	if c.Command == "" {
+		return errors.New("checker command is empty")
+	}
+	return nil
+}
+
+// InteractorConfig 交互题的交互器, 以 `<Command> input.txt output.txt` 调用, 见 judge.InteractiveRun
+type InteractorConfig struct {
+	Image   string `yaml:"image"`
+	Command string `yaml:"command"`
+}
+
+// Validate 检查交互器配置
+func (c *InteractorConfig) Validate() error {
+	if c.Image == "" {
+		return errors.New("interactor image is empty")
+	}
+	if c.Command == "" {
+		return errors.New("interactor command is empty")
+	}
+	return nil
+}
+
+// Subtask 子任务, 其中所有测试点都通过才能得到该子任务的分值
+type Subtask struct {
+	Name      string   `yaml:"name"`
+	Points    float64  `yaml:"points"`
+	TestCases []string `yaml:"testcases"` // 测试点ID
+}
+
+// ScoringMode 多次提交时的计分方式
+type ScoringMode string
+
+const (
+	ScoringMax   ScoringMode = "max"   // 取最高分
+	ScoringMin   ScoringMode = "min"   // 取最低分
+	ScoringFirst ScoringMode = "first" // 取第一次评测成功的提交
+)
+
+// compileFlagForbidden 编译选项中不允许出现的字符, 编译命令由 sh -c 执行, 这些字符会被shell解释
+const compileFlagForbidden = " \t\r\n;&|<>()$`\\\"'*?[]{}~#!"
+
+// ValidateCompileFlag 检查编译选项不为空且不包含空白或shell元字符
+//
+// 每个选项作为一个单独的参数追加到编译命令中, 需要带值的选项应写成 -std=c++17 这样的形式.
+func ValidateCompileFlag(flag string) error {
+	if flag == "" {
+		return errors.New("compile flag is empty")
+	}
+	if strings.ContainsAny(flag, compileFlagForbidden) {
+		return errors.New("compile flag " + strconv.Quote(flag) + " contains whitespace or shell metacharacters")
+	}
+	for _, c := range flag {
+		if c < 0x20 || c == 0x7f {
+			return errors.New("compile flag " + strconv.Quote(flag) + " contains control characters")
+		}
+	}
+	return nil
+}
+
+// CompareMode 比较选手输出与标准答案的方式
+type CompareMode string
+
+const (
+	CompareExact                    CompareMode = "exact"      // 逐字节比较
+	CompareIgnoreTrailingWhitespace CompareMode = "trailing"   // 忽略行末空白和末尾空行
+	CompareIgnoreAllWhitespace      CompareMode = "whitespace" // 忽略所有空白字符
+	CompareTokens                   CompareMode = "tokens"     // 按空白分词后比较词序列
+)
+
+// HasTag 题目是否有标签 tag
+func (p *Problem) HasTag(tag string) bool {
+	return slices.Contains(p.Tags, tag)
+}
+
+// IsWorkflow 题目是否由工作流评测
+func (p *Problem) IsWorkflow() bool {
+	return len(p.Workflow) > 0
+}
+
+// Validate 检查题目定义是否完整
+func (p *Problem) Validate() error {
+	if p.Id == "" {
+		return errors.New("problem id is empty")
+	}
+
+	switch p.ScoringMode {
+	case "", ScoringMax, ScoringMin, ScoringFirst:
+	default:
+		return errors.New("invalid scoring mode " + strconv.Quote(string(p.ScoringMode)))
+	}
+	switch p.CompareMode {
+	case "", CompareExact, CompareIgnoreTrailingWhitespace, CompareIgnoreAllWhitespace, CompareTokens:
+	default:
+		return errors.New("invalid compare mode " + strconv.Quote(string(p.CompareMode)))
+	}
+
+	for _, t := range p.Tags {
+		err := ValidateTag(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.IsWorkflow() {
+		return nil
+	}
+	for _, f := range p.CompileFlags {
+		err := ValidateCompileFlag(f)
+		if err != nil {
+			return err
+		}
+	}
+	if p.TimeLimitMs <= 0 {
+		return errors.New("timelimitms must be positive")
+	}
+	if p.MemoryLimitKB <= 0 {
+		return errors.New("memorylimitkb must be positive")
+	}
+	if p.Generator != nil {
+		err := p.Generator.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if p.Checker != nil {
+		err := p.Checker.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if p.Interactor != nil {
+		if p.Checker != nil {
+			return errors.New("checker and interactor cannot both be set")
+		}
+		err := p.Interactor.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	for i, st := range p.Subtasks {
+		if st.Points <= 0 {
+			return errors.New("subtask " + strconv.Itoa(i) + " must have positive points")
+		}
+		if len(st.TestCases) == 0 {
+			return errors.New("subtask " + strconv.Itoa(i) + " has no test cases")
+		}
+	}
+	return nil
+}
+
+// ReplacesBest 按计分方式判断得分为 score 的提交是否应取代当前计入成绩的提交
+//
+// hasBest 为 false 表示用户尚没有计入成绩的提交, 此时 best 无意义.
+func (p *Problem) ReplacesBest(hasBest bool, best, score float64) bool {
+	if !hasBest {
+		return true
+	}
+	switch p.ScoringMode {
+	case ScoringMin:
+		return score < best
+	case ScoringFirst:
+		return false
+	default:
+		return score > best
+	}
 }
 
 // Submit 提交定义
@@ -154,6 +533,23 @@ type Workflow struct {
 	PrivilegedSteps []int    `yaml:"privilegedsteps"`
 	NetworkHostMode bool     `yaml:"networkhostmode"`
 	Mounts          []Mount  `yaml:"mounts"`
+	Workdir         string   `yaml:"workdir"` // 步骤执行的工作目录, 为空时使用 /work
+
+	// Tmpfs 容器内路径到tmpfs挂载选项的映射, 如 /tmp: "size=64m,mode=1777", 占用计入内存上限
+	Tmpfs map[string]string `yaml:"tmpfs"`
+
+	CPUQuota    int64   `yaml:"cpuquota"`    // 每个CPU周期内可用的CPU时间(微秒)
+	CPUPeriod   int64   `yaml:"cpuperiod"`   // CPU周期(微秒)
+	CPUs        float64 `yaml:"cpus"`        // 可用CPU个数, 如 0.5, 不能与 cpuquota/cpuperiod 同时使用
+	MemoryLimit int64   `yaml:"memorylimit"` // 内存上限(字节)
+	PidsLimit   int64   `yaml:"pidslimit"`   // 进程数上限
+
+	// Seccomp seccomp配置: "default" 为内置的评测配置, "unconfined" 为不启用,
+	// 其他非空值为配置文件路径, 为空时使用Docker的默认配置
+	Seccomp string `yaml:"seccomp"`
+
+	// AppArmor AppArmor配置名, 需预先在宿主机上加载, 为空时使用Docker的默认行为
+	AppArmor string `yaml:"apparmor"`
 }
 
 // Mount 挂载定义
@@ -171,11 +567,15 @@ type User struct {
 	BestScores     JMapStrFloat64 `json:"best_scores"`
 	BestSubmits    JMapStrString  `json:"best_submits"`
 	BestSubmitDate JMapStrInt64   `json:"best_submit_date"`
-	TotalScore     float64        `json:"total_score"`
+	// HackScore 比赛中hack他人提交获得的分数减去被他人hack扣除的分数, 计入 TotalScore, 可以为负
+	HackScore  float64 `json:"hack_score"`
+	TotalScore float64 `json:"total_score"`
+	// Rating 比赛的Elo rating, 见 ComputeRatings. 默认值须与 InitialRating 一致
+	Rating int `gorm:"default:1500" json:"rating"`
 }
 
 func (u *User) CalculateTotalScore() {
-	var total float64
+	total := u.HackScore
 	for _, s := range u.BestScores {
 		total += s
 	}
@@ -227,6 +627,9 @@ func ColorizeStatus(status string) aurora.Value {
 type JMapStrFloat64 map[string]float64
 type JMapStrString map[string]string
 type JMapStrInt64 map[string]int64
+
+// JStrings 以JSON数组保存在数据库中的字符串列表
+type JStrings []string
 type SubmitsHashes []SubmitHash
 type WorkflowResults []WorkflowResult
 
@@ -339,3 +742,20 @@ func (u *JMapStrInt64) Scan(value interface{}) error {
 	}
 	return json.Unmarshal(b, u)
 }
+
+func (u JStrings) Value() (driver.Value, error) {
+	return json.Marshal(u)
+}
+
+func (u *JStrings) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, u)
+	case string:
+		return json.Unmarshal([]byte(v), u)
+	case nil:
+		*u = nil
+		return nil
+	}
+	return errors.New("unsupported type for JStrings")
+}
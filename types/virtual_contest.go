@@ -0,0 +1,103 @@
+package types
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrVirtualContestNotFound 虚拟参赛记录不存在
+	ErrVirtualContestNotFound = errors.New("virtual contest not found")
+	// ErrVirtualContestExists 用户已经虚拟参加过该比赛
+	ErrVirtualContestExists = errors.New("virtual contest already started")
+)
+
+// VirtualContest 用户对一场已结束比赛的虚拟参赛
+//
+// 虚拟参赛的计时从用户加入时开始, 时长与原比赛相同. 期间的提交正常评测, 记录在 Submission.VirtualContestID 中,
+// 不计入原比赛的排行榜和rating. 每个用户每场比赛只能虚拟参赛一次.
+type VirtualContest struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	ContestID string    `gorm:"uniqueIndex:idx_virtual_contest_user" json:"contest_id"`
+	UserID    string    `gorm:"uniqueIndex:idx_virtual_contest_user;index" json:"user_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// IsRunning 虚拟参赛在 t 时刻是否进行中
+func (vc *VirtualContest) IsRunning(t time.Time) bool {
+	return !t.Before(vc.StartTime) && t.Before(vc.EndTime)
+}
+
+// VirtualContestStore 虚拟参赛存储
+type VirtualContestStore interface {
+	// CreateVirtualContest 创建虚拟参赛, 用户已经虚拟参加过该比赛时返回 ErrVirtualContestExists
+	CreateVirtualContest(vc *VirtualContest) error
+	// GetVirtualContest 获取虚拟参赛, 不存在时返回 ErrVirtualContestNotFound
+	GetVirtualContest(id string) (*VirtualContest, error)
+	// FindVirtualContest 获取用户对比赛的虚拟参赛, 不存在时返回 ErrVirtualContestNotFound
+	FindVirtualContest(contestID, userID string) (*VirtualContest, error)
+	// ListVirtualContests 按开始时间顺序列出比赛的所有虚拟参赛
+	ListVirtualContests(contestID string) ([]VirtualContest, error)
+}
+
+// SQLiteVirtualContestStore 基于 gorm 和 SQLite 的虚拟参赛存储
+type SQLiteVirtualContestStore struct {
+	db *gorm.DB
+}
+
+var _ VirtualContestStore = (*SQLiteVirtualContestStore)(nil)
+
+// NewSQLiteVirtualContestStore 创建虚拟参赛存储, 并迁移 VirtualContest 表结构
+func NewSQLiteVirtualContestStore(db *gorm.DB) (*SQLiteVirtualContestStore, error) {
+	err := db.AutoMigrate(&VirtualContest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate virtual contests")
+	}
+	return &SQLiteVirtualContestStore{db: db}, nil
+}
+
+// CreateVirtualContest 创建虚拟参赛
+func (s *SQLiteVirtualContestStore) CreateVirtualContest(vc *VirtualContest) error {
+	res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(vc)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrVirtualContestExists
+	}
+	return nil
+}
+
+// GetVirtualContest 获取虚拟参赛
+func (s *SQLiteVirtualContestStore) GetVirtualContest(id string) (*VirtualContest, error) {
+	return s.first(s.db.Where("id = ?", id))
+}
+
+// FindVirtualContest 获取用户对比赛的虚拟参赛
+func (s *SQLiteVirtualContestStore) FindVirtualContest(contestID, userID string) (*VirtualContest, error) {
+	return s.first(s.db.Where("contest_id = ? AND user_id = ?", contestID, userID))
+}
+
+// first 返回查询到的第一个虚拟参赛
+func (s *SQLiteVirtualContestStore) first(q *gorm.DB) (*VirtualContest, error) {
+	var vc VirtualContest
+	err := q.First(&vc).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVirtualContestNotFound
+		}
+		return nil, err
+	}
+	return &vc, nil
+}
+
+// ListVirtualContests 按开始时间顺序列出比赛的所有虚拟参赛
+func (s *SQLiteVirtualContestStore) ListVirtualContests(contestID string) ([]VirtualContest, error) {
+	list := []VirtualContest{}
+	err := s.db.Where("contest_id = ?", contestID).Order("start_time asc").Find(&list).Error
+	return list, err
+}
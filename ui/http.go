@@ -5,25 +5,98 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/contest"
+	"github.com/mrhaoxx/SOJ/file_transfer"
+	"github.com/mrhaoxx/SOJ/judge"
+	"github.com/mrhaoxx/SOJ/notify"
 	"github.com/mrhaoxx/SOJ/types"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 )
 
 // HTTPServer HTTP服务器
 type HTTPServer struct {
 	dbService *types.DatabaseService
+	evaluator *judge.Evaluator
+	problems  judge.ProblemStore
+	testCases judge.TestCaseStore
+	queue     *judge.SubmissionQueue
+	progress  *judge.ProgressHub
+	jwt       *JWTAuth
+	docker    file_transfer.DockerServiceInterface
+
+	// statements 题面存储, 为nil时只使用题目定义中的题面
+	statements judge.StatementStore
+
+	// profiles 用户资料的缓存
+	profiles *profileCache
+
+	// search 题目搜索的索引, 搜索时与题目存储同步
+	search *judge.ProblemIndex
+
+	// notifier 比赛公告的通知方式, 为nil时不发送通知
+	notifier notify.Notifier
+
+	// limiter 提交接口的限流器, runLimiter 自定义输入运行接口的限流器, 后者更严格
+	limiter    RateLimiter
+	runLimiter RateLimiter
+
+	dispatcher *judge.DistributedDispatcher
+	rejudge    *judge.RejudgeQueue
+
+	contests   *contest.Manager
+	rankings   *contest.RankingCache
+	difficulty *judge.DifficultyTracker
+
+	maxArchiveSize int64
+	maxSourceSize  int64
 }
 
 // NewHTTPServer 创建新的HTTP服务器
-func NewHTTPServer(dbService *types.DatabaseService) *HTTPServer {
+//
+// testCases 为nil或评测器未加载语言配置时, 不接受源代码提交.
+func NewHTTPServer(dbService *types.DatabaseService, evaluator *judge.Evaluator, problems judge.ProblemStore, testCases judge.TestCaseStore, queue *judge.SubmissionQueue) *HTTPServer {
 	return &HTTPServer{
 		dbService: dbService,
+		evaluator: evaluator,
+		problems:  problems,
+		testCases: testCases,
+		queue:     queue,
+		progress:  judge.NewProgressHub(),
+		limiter:   NewMemoryRateLimiter(DefaultSubmitRateLimit),
+		profiles:  newProfileCache(ProfileCacheTTL),
+		search:    judge.NewProblemIndex(),
+
+		runLimiter: NewMemoryIntervalRateLimiter(DefaultRunInterval, 1),
 	}
 }
 
+// SetRateLimiter 设置提交接口的限流器, 需要在 ServeHTTP 之前调用
+func (s *HTTPServer) SetRateLimiter(limiter RateLimiter) {
+	s.limiter = limiter
+}
+
+// Progress 返回推送评测进度的分发器
+func (s *HTTPServer) Progress() *judge.ProgressHub {
+	return s.progress
+}
+
+// SetJWTAuth 启用 JWT 认证, 需要在 ServeHTTP 之前调用
+func (s *HTTPServer) SetJWTAuth(auth *JWTAuth) {
+	s.jwt = auth
+}
+
 // AuthMiddleware 认证中间件
+//
+// 启用 JWT 认证且请求带有 Bearer token 时使用 JWTMiddleware, 否则使用 Cookie 中的 token.
 func (s *HTTPServer) AuthMiddleware() gin.HandlerFunc {
+	jwtAuth := s.JWTMiddleware()
 	return func(c *gin.Context) {
+		if _, ok := bearerToken(c); ok && s.jwt != nil {
+			jwtAuth(c)
+			return
+		}
+
 		token, err := c.Cookie("token")
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -191,12 +264,82 @@ func (s *HTTPServer) ServeHTTP(addr string) {
 		log.Fatal().Err(err).Msg("failed to set trusted proxies")
 		return
 	}
+	router.Use(RequestIDMiddleware())
+
+	router.GET("/healthz", s.healthz)
+	router.GET("/readyz", s.readyz)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	auth := router.Group("/api/v1", s.AuthMiddleware())
 	auth.GET("rank", s.listRank)
 	auth.GET("list", s.listSubmits)
 	auth.GET("my", s.getUserSummary)
 	auth.GET("status/:id", s.getSubmitDetail)
+	auth.GET("problems", s.listProblems)
+	auth.GET("problems/trending", s.listTrendingProblems)
+	auth.GET("problems/tags", s.listProblemTags)
+	auth.GET("problems/search", s.searchProblems)
+	auth.GET("problems/:id/statement", s.getProblemStatement)
+	auth.GET("languages/:id/template", s.getLanguageTemplate)
+	auth.POST("submissions", RateLimitMiddleware(s.limiter), s.createSubmission)
+	auth.GET("submissions/diff", s.diffSubmissions)
+	auth.GET("submissions/:id", s.getSubmission)
+	auth.GET("submissions/:id/stream", s.streamSubmission)
+	auth.GET("submissions/:id/source", s.getSubmissionSource)
+	auth.POST("submissions/:id/hack", RateLimitMiddleware(s.runLimiter), s.hackSubmission)
+	auth.POST("run", RateLimitMiddleware(s.runLimiter), s.runCustom)
+	auth.GET("users/:id", s.getUserProfile)
+	auth.GET("users/:id/activity", s.getUserActivity)
+	auth.GET("users/:id/submissions", s.listUserSubmissions)
+	auth.GET("users/:id/rating-history", s.getUserRatingHistory)
+	auth.GET("leaderboard", s.getLeaderboard)
+	auth.GET("problem-sets", s.listProblemSets)
+	auth.GET("problem-sets/:id", s.getProblemSet)
+	auth.GET("contests", s.listOpenContests)
+	auth.GET("contests/:id/standings", s.getStandings)
+	auth.GET("contests/:id/announcements", s.listAnnouncements)
+	auth.GET("contests/:id/clarifications", s.listClarifications)
+	auth.POST("contests/:id/clarifications", s.createClarification)
+	auth.POST("virtual-contests/:id", s.startVirtualContest)
+	auth.GET("virtual-contests/:id/my-standings", s.getMyVirtualStandings)
+	auth.GET("virtual-contests/:id/standings", s.getVirtualStandings)
+	auth.GET("teams/my", s.getMyTeam)
+	auth.POST("teams", s.createTeam)
+	auth.POST("teams/join", s.joinTeam)
+	auth.POST("teams/leave", s.leaveTeam)
+
+	// 运维管理接口, 需要带有 admin 声明的 JWT
+	manage := router.Group("/admin", s.AdminJWTMiddleware())
+	manage.GET("problems/:id", s.getProblemDefinition)
+	manage.POST("problems", s.createProblem)
+	manage.POST("problems/import", s.importProblems)
+	manage.PUT("problems/:id", s.updateProblem)
+	manage.DELETE("problems/:id", s.deleteProblem)
+	manage.POST("problems/:id/rejudge", s.rejudgeProblem)
+	manage.GET("problems/:id/rejudge-status", s.getRejudgeStatus)
+	manage.POST("submissions/:id/replay", s.replaySubmission)
+	manage.POST("problems/:id/generate-tests", s.generateTests)
+	manage.POST("problems/:id/stress-test", s.stressTest)
+	manage.POST("problems/:id/check-plagiarism", s.checkPlagiarism)
+	manage.POST("problems/:id/tags", s.addProblemTag)
+	manage.DELETE("problems/:id/tags/:tag", s.removeProblemTag)
+	manage.GET("tags", s.listTags)
+	manage.POST("tags", s.createTag)
+	manage.GET("languages", s.listLanguageConfigs)
+	manage.POST("languages", s.createLanguage)
+	manage.PUT("languages/:id", s.updateLanguage)
+	manage.DELETE("languages/:id", s.deleteLanguage)
+	manage.POST("contests/:id/unfreeze", s.unfreezeStandings)
+	manage.GET("contests/:id/export", s.exportContestResults)
+	manage.POST("contests/:id/announcements", s.createAnnouncement)
+	manage.PUT("clarifications/:id", s.answerClarification)
+	manage.POST("problem-sets", s.createProblemSet)
+	manage.PUT("problem-sets/:id", s.updateProblemSet)
+	manage.DELETE("problem-sets/:id", s.deleteProblemSet)
+	manage.POST("batch-submissions", s.createBatchSubmission)
+	manage.GET("batch-submissions/:id", s.getBatchSubmission)
+	manage.GET("batch-submissions/:id/export", s.exportBatchSubmission)
+	manage.GET("system", s.getSystemInfo)
 
 	go func() {
 		log.Info().Str("addr", addr).Msg("HTTP server started")
@@ -0,0 +1,856 @@
+package ui
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/judge"
+	"github.com/mrhaoxx/SOJ/plagiarism"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// plagiarismRequest 查重参数, 均可省略
+type plagiarismRequest struct {
+	NGram     int     `json:"ngram"`
+	Threshold float64 `json:"threshold"`
+}
+
+// checkPlagiarism 对题目每个用户的最后一次源代码提交查重
+func (s *HTTPServer) checkPlagiarism(c *gin.Context) {
+	var req plagiarismRequest
+	if c.Request.ContentLength > 0 {
+		err := c.ShouldBindJSON(&req)
+		if err != nil || req.Threshold > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Invalid parameter",
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	pid := c.Param("id")
+	if _, ok := s.problems.GetProblem(pid); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Problem not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	subs, err := s.dbService.Submissions().ListByProblem(pid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	// ListByProblem 按提交时间倒序, 每个用户只取第一个即最后一次提交
+	seen := make(map[string]bool)
+	var sources []plagiarism.Source
+	for _, sub := range subs {
+		if seen[sub.UserID] {
+			continue
+		}
+		seen[sub.UserID] = true
+		sources = append(sources, plagiarism.Source{
+			ID:       sub.ID,
+			UserID:   sub.UserID,
+			Language: sub.Language,
+			Code:     sub.SourceCode,
+		})
+	}
+
+	pairs := plagiarism.NewPlagiarismDetector(req.NGram, req.Threshold).Check(sources)
+	if pairs == nil {
+		pairs = []plagiarism.Pair{}
+	}
+
+	reqLog(c).Info().Str("problem", pid).Int("sources", len(sources)).Int("pairs", len(pairs)).Msg("plagiarism check finished")
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data": gin.H{
+			"sources": len(sources),
+			"pairs":   pairs,
+		},
+	})
+}
+
+// maxDefinitionSize 管理接口中题目和语言定义请求体的大小上限
+const maxDefinitionSize = 1 << 20
+
+// bindYAML 以YAML解析请求体, JSON是YAML的子集, 因此也接受JSON, 字段名与定义文件相同
+func bindYAML(c *gin.Context, v any) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxDefinitionSize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxDefinitionSize {
+		return errors.New("request body is too large")
+	}
+	return yaml.Unmarshal(body, v)
+}
+
+// problemEditor 返回可修改的问题存储, 不支持修改时返回 501
+func (s *HTTPServer) problemEditor(c *gin.Context) (judge.ProblemEditor, bool) {
+	editor, ok := s.problems.(judge.ProblemEditor)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"code":    1,
+			"message": "Problem store is read-only",
+			"data":    nil,
+		})
+	}
+	return editor, ok
+}
+
+// getProblemDefinition 获取题目的完整定义
+func (s *HTTPServer) getProblemDefinition(c *gin.Context) {
+	p, ok := s.problems.GetProblem(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Problem not found",
+			"data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    p,
+	})
+}
+
+// saveProblem 创建(create 为 true)或更新题目
+func (s *HTTPServer) saveProblem(c *gin.Context, create bool) {
+	editor, ok := s.problemEditor(c)
+	if !ok {
+		return
+	}
+
+	var p types.Problem
+	err := bindYAML(c, &p)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid problem: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	if !create {
+		id := c.Param("id")
+		if p.Id == "" {
+			p.Id = id
+		}
+		if p.Id != id {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Problem id does not match",
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	_, exists := editor.GetProblem(p.Id)
+	if create && exists {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    1,
+			"message": "Problem already exists",
+			"data":    nil,
+		})
+		return
+	}
+	if !create && !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Problem not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	err = editor.SaveProblem(p)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid problem: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("problem", p.Id).Bool("created", create).Msg("problem saved by admin")
+
+	status := http.StatusOK
+	if create {
+		status = http.StatusCreated
+	}
+	saved, _ := editor.GetProblem(p.Id)
+	c.JSON(status, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    saved,
+	})
+}
+
+// createProblem 创建题目, 请求体为题目定义(YAML或JSON)
+func (s *HTTPServer) createProblem(c *gin.Context) {
+	s.saveProblem(c, true)
+}
+
+// updateProblem 替换题目定义
+func (s *HTTPServer) updateProblem(c *gin.Context) {
+	s.saveProblem(c, false)
+}
+
+// deleteProblem 删除题目, 已有的提交记录保留
+func (s *HTTPServer) deleteProblem(c *gin.Context) {
+	editor, ok := s.problemEditor(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	err := editor.DeleteProblem(id)
+	if err != nil {
+		if errors.Is(err, judge.ErrProblemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Problem not found",
+				"data":    nil,
+			})
+			return
+		}
+		reqLog(c).Err(err).Str("problem", id).Msg("failed to delete problem")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to delete problem",
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("problem", id).Msg("problem deleted by admin")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    nil,
+	})
+}
+
+// importProblems 从表单文件 archive 中的zip压缩包批量导入题目, 返回每个题目的导入结果
+//
+// 压缩包的结构见 judge.ProblemImporter, 已有的题目按ID更新, 并在后台重测其已有的提交.
+func (s *HTTPServer) importProblems(c *gin.Context) {
+	editor, ok := s.problemEditor(c)
+	if !ok {
+		return
+	}
+	if _, ok := s.testCases.(judge.TestCaseWriter); !ok {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Test case storage is not writable",
+			"data":    nil,
+		})
+		return
+	}
+
+	fh, err := c.FormFile("archive")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: archive",
+			"data":    nil,
+		})
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		reqLog(c).Err(err).Msg("failed to open uploaded archive")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to read archive",
+			"data":    nil,
+		})
+		return
+	}
+	defer f.Close()
+
+	im := &judge.ProblemImporter{Problems: editor, TestCases: s.testCases}
+	if w, ok := s.statements.(judge.StatementWriter); ok {
+		im.Statements = w
+	}
+	report, err := im.Import(f, fh.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid archive: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	for _, r := range report.Problems {
+		if r.Status == judge.ImportUpdated {
+			s.rejudgeTestsChanged(c, r.ID, "test cases imported")
+		}
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Int("imported", report.Imported).Int("failed", report.Failed).Msg("problems imported by admin")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    report,
+	})
+}
+
+// languageRegistry 返回语言配置表, 未加载语言配置时返回 503
+func (s *HTTPServer) languageRegistry(c *gin.Context) (*judge.LanguageRegistry, bool) {
+	if s.evaluator == nil || s.evaluator.Languages() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Source submissions are not enabled",
+			"data":    nil,
+		})
+		return nil, false
+	}
+	return s.evaluator.Languages(), true
+}
+
+// listLanguageConfigs 列出所有语言的完整配置
+func (s *HTTPServer) listLanguageConfigs(c *gin.Context) {
+	langs, ok := s.languageRegistry(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    langs.ListAll(),
+	})
+}
+
+// saveLanguage 创建(create 为 true)或更新语言配置
+func (s *HTTPServer) saveLanguage(c *gin.Context, create bool) {
+	langs, ok := s.languageRegistry(c)
+	if !ok {
+		return
+	}
+
+	var l judge.LanguageConfig
+	err := bindYAML(c, &l)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid language: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	if !create {
+		id := c.Param("id")
+		if l.ID == "" {
+			l.ID = id
+		}
+		if l.ID != id {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Language id does not match",
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	_, exists := langs.GetByID(l.ID)
+	if create && exists {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    1,
+			"message": "Language already exists",
+			"data":    nil,
+		})
+		return
+	}
+	if !create && !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Language not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	err = langs.Put(l)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid language: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("language", l.ID).Bool("created", create).Msg("language saved by admin")
+
+	status := http.StatusOK
+	if create {
+		status = http.StatusCreated
+	}
+	saved, _ := langs.GetByID(l.ID)
+	c.JSON(status, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    saved,
+	})
+}
+
+// createLanguage 创建语言配置, 请求体为语言配置(YAML或JSON)
+func (s *HTTPServer) createLanguage(c *gin.Context) {
+	s.saveLanguage(c, true)
+}
+
+// updateLanguage 替换语言配置
+func (s *HTTPServer) updateLanguage(c *gin.Context) {
+	s.saveLanguage(c, false)
+}
+
+// deleteLanguage 删除语言配置
+func (s *HTTPServer) deleteLanguage(c *gin.Context) {
+	langs, ok := s.languageRegistry(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	err := langs.Delete(id)
+	if err != nil {
+		if errors.Is(err, judge.ErrLanguageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Language not found",
+				"data":    nil,
+			})
+			return
+		}
+		reqLog(c).Err(err).Str("language", id).Msg("failed to delete language")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to delete language",
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("language", id).Msg("language deleted by admin")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    nil,
+	})
+}
+
+// getSystemInfo 返回Docker宿主机, 评测队列和分布式评测节点的状态
+//
+// 某一项获取失败时该项为 null, 其余项照常返回.
+func (s *HTTPServer) getSystemInfo(c *gin.Context) {
+	data := gin.H{}
+
+	if s.docker != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+		info, err := s.docker.Info(ctx)
+		cancel()
+		if err != nil {
+			reqLog(c).Err(err).Msg("failed to get docker info")
+			data["docker"] = nil
+		} else {
+			data["docker"] = gin.H{
+				"server_version":     info.ServerVersion,
+				"os":                 info.OperatingSystem,
+				"kernel_version":     info.KernelVersion,
+				"ncpu":               info.NCPU,
+				"mem_total":          info.MemTotal,
+				"cgroup_version":     info.CgroupVersion,
+				"containers_running": info.ContainersRunning,
+			}
+		}
+	}
+
+	if s.queue != nil {
+		data["queue"] = gin.H{
+			"depth":        s.queue.Len(),
+			"workers":      s.queue.Workers(),
+			"idle_workers": s.queue.IdleWorkers(),
+		}
+	}
+
+	if s.dispatcher != nil {
+		workers, err := s.dispatcher.LiveWorkers(c.Request.Context())
+		if err != nil {
+			reqLog(c).Err(err).Msg("failed to list judge workers")
+		}
+		data["distributed_workers"] = workers
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    data,
+	})
+}
+
+// SetRejudgeQueue 启用重测接口, 需要在 ServeHTTP 之前调用
+func (s *HTTPServer) SetRejudgeQueue(rejudge *judge.RejudgeQueue) {
+	s.rejudge = rejudge
+}
+
+// rejudgeProblem 重测题目所有评测完成的提交, 用于更新测试点数据之后
+func (s *HTTPServer) rejudgeProblem(c *gin.Context) {
+	if s.rejudge == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Rejudge is not enabled",
+			"data":    nil,
+		})
+		return
+	}
+
+	id := c.Param("id")
+	st, err := s.rejudge.Rejudge(id, "requested by admin")
+	if err != nil {
+		if errors.Is(err, judge.ErrProblemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Problem not found",
+				"data":    nil,
+			})
+			return
+		}
+		reqLog(c).Err(err).Str("problem", id).Msg("failed to start rejudge")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to start rejudge",
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("problem", id).Int("total", st.Total).Msg("rejudge requested by admin")
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    st,
+	})
+}
+
+// rejudgeTestsChanged 题目的测试点被写入后在后台重测, 未启用重测时不做任何事
+func (s *HTTPServer) rejudgeTestsChanged(c *gin.Context, problemID, reason string) {
+	if s.rejudge == nil {
+		return
+	}
+	_, err := s.rejudge.Rejudge(problemID, reason)
+	if err != nil {
+		reqLog(c).Err(err).Str("problem", problemID).Msg("failed to start rejudge")
+	}
+}
+
+// getRejudgeStatus 返回题目最近一次重测的进度
+func (s *HTTPServer) getRejudgeStatus(c *gin.Context) {
+	if s.rejudge == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Rejudge is not enabled",
+			"data":    nil,
+		})
+		return
+	}
+
+	st, ok := s.rejudge.Status(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "No rejudge for this problem",
+			"data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    st,
+	})
+}
+
+// replaySubmission 使用当前的测试点和评测配置重新评测提交, 返回新的评测结果
+//
+// 表单字段 confirm 为true时用新的结果覆盖提交原来的结果, 否则提交保持不变.
+// 请求会等待重放结束后返回, 请求提前结束时重放仍会继续运行.
+func (s *HTTPServer) replaySubmission(c *gin.Context) {
+	if s.evaluator == nil || s.evaluator.Languages() == nil || s.testCases == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Source submissions are not enabled",
+			"data":    nil,
+		})
+		return
+	}
+
+	confirm := false
+	if v := c.PostForm("confirm"); v != "" {
+		var err error
+		confirm, err = strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Invalid parameter: confirm",
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	sub, ok := s.loadSubmission(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if sub.Status != types.SubmissionCompleted && sub.Status != types.SubmissionFailed {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    1,
+			"message": "Submission is still being judged",
+			"data":    nil,
+		})
+		return
+	}
+	problem, ok := s.problems.GetProblem(sub.ProblemID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Problem not found",
+			"data":    nil,
+		})
+		return
+	}
+	lang, ok := s.evaluator.Languages().GetByID(sub.Language)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    1,
+			"message": "Language " + sub.Language + " is no longer available",
+			"data":    nil,
+		})
+		return
+	}
+
+	run := judge.NewReplayRun(judge.SourceSubmission{
+		Evaluator:  s.evaluator,
+		Store:      s.submissions(),
+		TestCases:  s.testCases,
+		Submission: sub,
+		Problem:    &problem,
+		Language:   lang,
+
+		MaxArchiveSize: s.maxArchiveSize,
+	}, confirm)
+	err := s.queue.Enqueue(run)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Judge is shutting down",
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("id", sub.ID).Bool("confirm", confirm).Msg("submission replay requested")
+
+	report, err := run.Wait(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusAccepted, gin.H{
+			"code":    0,
+			"message": "Replay is still running",
+			"data":    gin.H{"id": sub.ID},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    report,
+	})
+}
+
+// generateTests 用题目的生成器生成测试点, 请求在生成结束后返回每个种子的结果
+//
+// 有测试点被写入时在后台重测题目已有的提交.
+func (s *HTTPServer) generateTests(c *gin.Context) {
+	store, ok := s.testCases.(judge.TestCaseWriter)
+	if !ok || s.evaluator == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Test case storage is not writable",
+			"data":    nil,
+		})
+		return
+	}
+
+	id := c.Param("id")
+	problem, ok := s.problems.GetProblem(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Problem not found",
+			"data":    nil,
+		})
+		return
+	}
+	if problem.Generator == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Problem has no generator",
+			"data":    nil,
+		})
+		return
+	}
+
+	report, err := s.evaluator.GenerateTests(c.Request.Context(), &problem, store)
+	if err != nil {
+		reqLog(c).Err(err).Str("problem", id).Msg("failed to generate tests")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to generate tests",
+			"data":    nil,
+		})
+		return
+	}
+
+	if report.Saved > 0 {
+		s.rejudgeTestsChanged(c, id, "test cases generated")
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("problem", id).Int("saved", report.Saved).Int("failed", report.Failed).Msg("tests generated by admin")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    report,
+	})
+}
+
+// stressTest 对拍题目的暴力程序和优化程序
+//
+// 表单字段 brute_source, optimized_source 和 generator_source 为三个程序的源代码(也可以以文件上传),
+// language 为它们的语言, count 为轮数. 请求在对拍结束后返回, 报告中包含第一组出错的数据.
+func (s *HTTPServer) stressTest(c *gin.Context) {
+	if s.evaluator == nil || s.evaluator.Languages() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Source submissions are not enabled",
+			"data":    nil,
+		})
+		return
+	}
+
+	id := c.Param("id")
+	problem, ok := s.problems.GetProblem(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Problem not found",
+			"data":    nil,
+		})
+		return
+	}
+	if problem.IsWorkflow() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Workflow problems cannot be stress tested",
+			"data":    nil,
+		})
+		return
+	}
+	if problem.Interactor != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Interactive problems cannot be stress tested",
+			"data":    nil,
+		})
+		return
+	}
+
+	lang, ok := s.evaluator.Languages().GetByID(c.PostForm("language"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: language",
+			"data":    nil,
+		})
+		return
+	}
+	count, err := strconv.Atoi(c.PostForm("count"))
+	if err != nil || count <= 0 || count > judge.MaxStressCount {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: count",
+			"data":    nil,
+		})
+		return
+	}
+
+	var srcs [3]string
+	for i, name := range []string{"brute_source", "optimized_source", "generator_source"} {
+		v, ok := formText(c, name)
+		if !ok || v == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Invalid parameter: " + name,
+				"data":    nil,
+			})
+			return
+		}
+		srcs[i] = v
+	}
+
+	report, err := s.evaluator.StressTest(c.Request.Context(), &problem, lang, judge.StressSources{
+		Brute:     []byte(srcs[0]),
+		Optimized: []byte(srcs[1]),
+		Generator: []byte(srcs[2]),
+	}, count)
+	if err != nil {
+		reqLog(c).Err(err).Str("problem", id).Msg("failed to run stress test")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to run stress test",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    report,
+	})
+}
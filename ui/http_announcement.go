@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/contest"
+	"github.com/mrhaoxx/SOJ/notify"
+	"github.com/mrhaoxx/SOJ/types"
+)
+
+// announcementNotifyTimeout 发送公告通知的超时
+const announcementNotifyTimeout = 2 * time.Minute
+
+// SetNotifier 设置比赛公告的通知方式, 需要在 ServeHTTP 之前调用, 未设置时不发送通知
+func (s *HTTPServer) SetNotifier(n notify.Notifier) {
+	s.notifier = n
+}
+
+// createAnnouncement 发布比赛公告, 表单字段 text 为公告内容, 见 publishAnnouncement
+func (s *HTTPServer) createAnnouncement(c *gin.Context) {
+	if s.contests == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+	ct, ok := s.contests.GetContest(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	text := strings.TrimSpace(c.PostForm("text"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: text",
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	a, err := s.publishAnnouncement(c, ct, text, user.(string))
+	if err != nil {
+		reqLog(c).Err(err).Str("contest", ct.Id).Msg("failed to create announcement")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    a,
+	})
+}
+
+// publishAnnouncement 保存比赛公告, 设置了通知方式时在后台向参赛者发送通知, 通知失败不影响公告的发布
+func (s *HTTPServer) publishAnnouncement(c *gin.Context, ct *contest.Contest, text, author string) (*types.Announcement, error) {
+	a := &types.Announcement{ContestID: ct.Id, Text: text, Author: author}
+	err := s.dbService.Announcements().CreateAnnouncement(a)
+	if err != nil {
+		return nil, err
+	}
+	l := reqLog(c)
+	l.Info().Str("user", author).Str("contest", ct.Id).Uint("announcement", a.ID).Msg("announcement created")
+
+	if s.notifier == nil {
+		return a, nil
+	}
+	recipients, err := s.contests.Participants(ct.Id)
+	if err != nil {
+		l.Err(err).Str("contest", ct.Id).Msg("failed to list contest participants")
+		return a, nil
+	}
+	msg := &notify.Message{
+		Type:      "announcement",
+		ContestID: ct.Id,
+		Subject:   "[" + ct.Title + "] Announcement",
+		Text:      a.Text,
+		CreatedAt: time.Unix(0, a.CreatedAt),
+	}
+	// 通知在请求结束后发送, 不能使用 c
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), announcementNotifyTimeout)
+		defer cancel()
+		err := s.notifier.Send(ctx, msg, recipients)
+		if err != nil {
+			l.Err(err).Str("contest", msg.ContestID).Msg("failed to send announcement notifications")
+			return
+		}
+		l.Info().Str("contest", msg.ContestID).Int("recipients", len(recipients)).Msg("announcement notifications sent")
+	}()
+	return a, nil
+}
+
+// listAnnouncements 按发布时间倒序列出比赛的公告
+func (s *HTTPServer) listAnnouncements(c *gin.Context) {
+	if s.contests == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+	id := c.Param("id")
+	if _, ok := s.contests.GetContest(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	list, err := s.dbService.Announcements().ListAnnouncements(id)
+	if err != nil {
+		reqLog(c).Err(err).Str("contest", id).Msg("failed to list announcements")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    list,
+	})
+}
@@ -0,0 +1,239 @@
+package ui
+
+import (
+	"encoding/csv"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mrhaoxx/SOJ/types"
+)
+
+// maxBatchSubmissions 一个批次中提交的数量上限, 与源代码的大小上限一起决定请求体的大小上限
+const maxBatchSubmissions = 1000
+
+// readFormFile 读取上传的文件
+func readFormFile(fh *multipart.FileHeader) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// createBatchSubmission 批量提交源代码
+//
+// 请求为 multipart 表单, 包含 problem, language 字段, 每个学生的源代码作为一个文件上传,
+// 文件的字段名为学生ID. 所有提交创建后立即返回批次ID, 提交在后台依次加入评测队列.
+// 至多包含 maxBatchSubmissions 个文件, 每个文件不能超过源代码的大小上限.
+func (s *HTTPServer) createBatchSubmission(c *gin.Context) {
+	// 在解析表单之前限制请求体的大小, 过大的请求不会被完整读取
+	if !limitRequestBody(c, maxBatchSubmissions*(s.sourceSizeLimit()+formOverhead)) {
+		return
+	}
+	problem, lang, ok := s.sourceTarget(c)
+	if !ok {
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: no source files",
+			"data":    nil,
+		})
+		return
+	}
+	if len(form.File) > maxBatchSubmissions {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"code":    1,
+			"message": "Too many source files, the limit is " + strconv.Itoa(maxBatchSubmissions),
+			"data":    nil,
+		})
+		return
+	}
+
+	students := make([]string, 0, len(form.File))
+	for student, files := range form.File {
+		if student == "" || len(files) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Invalid parameter: each student must have exactly one source file",
+				"data":    nil,
+			})
+			return
+		}
+		if files[0].Size > s.sourceSizeLimit() {
+			s.sourceTooLarge(c)
+			return
+		}
+		students = append(students, student)
+	}
+	sort.Strings(students)
+
+	batchID := uuid.NewString()
+	store := s.dbService.Submissions()
+	subs := make([]*types.Submission, 0, len(students))
+	for _, student := range students {
+		src, err := readFormFile(form.File[student][0])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Invalid parameter: " + student,
+				"data":    nil,
+			})
+			return
+		}
+		subs = append(subs, &types.Submission{
+			ID:         uuid.NewString(),
+			UserID:     student,
+			ProblemID:  problem.Id,
+			BatchID:    batchID,
+			Language:   lang.ID,
+			SourceCode: string(src),
+		})
+	}
+
+	for _, sub := range subs {
+		err = store.CreateSubmission(sub)
+		if err != nil {
+			reqLog(c).Err(err).Str("batch", batchID).Msg("failed to create batch submission")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    1,
+				"message": "Database error",
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	// 队列满时 Enqueue 会阻塞, 在后台入队以免请求超时; 请求结束后不能使用 c
+	l := reqLog(c)
+	go func() {
+		var err error
+		for _, sub := range subs {
+			// 入队失败说明评测队列已关闭, 其余提交也无法评测, 直接标记为失败以免批次无法完成
+			if err != nil {
+				store.UpdateResult(sub.ID, types.SubmissionFailed, nil)
+				continue
+			}
+			err = s.enqueueSource(store, sub, &problem, lang)
+		}
+		if err != nil {
+			l.Err(err).Str("batch", batchID).Msg("failed to enqueue batch submissions")
+		}
+	}()
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("batch", batchID).Str("user", user.(string)).Str("problem", problem.Id).Int("count", len(subs)).Msg("batch submission created")
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    0,
+		"message": "success",
+		"data": gin.H{
+			"id":    batchID,
+			"count": len(subs),
+		},
+	})
+}
+
+// batchResult 批次中一个学生的评测结果
+type batchResult struct {
+	StudentID    string        `json:"student_id"`
+	SubmissionID string        `json:"submission_id"`
+	Status       string        `json:"status"`
+	Verdict      types.Verdict `json:"verdict,omitempty"`
+	Score        float64       `json:"score"`
+	TimeUsedMs   int64         `json:"time_used_ms"`
+	MemoryUsedKB int64         `json:"memory_used_kb"`
+	Message      string        `json:"message,omitempty"`
+}
+
+// batchResults 读取批次的评测结果, 批次不存在时写入错误响应
+func (s *HTTPServer) batchResults(c *gin.Context) ([]batchResult, bool) {
+	subs, err := s.dbService.Submissions().ListByBatch(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return nil, false
+	}
+	if len(subs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Batch not found",
+			"data":    nil,
+		})
+		return nil, false
+	}
+
+	results := make([]batchResult, len(subs))
+	for i, sub := range subs {
+		results[i] = batchResult{
+			StudentID:    sub.UserID,
+			SubmissionID: sub.ID,
+			Status:       sub.Status,
+			Verdict:      sub.JudgeResult.Verdict,
+			Score:        sub.JudgeResult.Score,
+			TimeUsedMs:   sub.JudgeResult.TimeUsedMs,
+			MemoryUsedKB: sub.JudgeResult.MemoryUsedKB,
+			Message:      sub.JudgeResult.Msg,
+		}
+	}
+	return results, true
+}
+
+// getBatchSubmission 获取批次中每个学生的评测结果
+func (s *HTTPServer) getBatchSubmission(c *gin.Context) {
+	results, ok := s.batchResults(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    results,
+	})
+}
+
+// exportBatchSubmission 以CSV格式导出批次的评测结果
+//
+// 评测信息包含选手程序的输出, 与学生ID一起经过 csvText 转义.
+func (s *HTTPServer) exportBatchSubmission(c *gin.Context) {
+	results, ok := s.batchResults(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="batch-`+c.Param("id")+`.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"student_id", "submission_id", "status", "verdict", "score", "time_used_ms", "memory_used_kb", "message"})
+	for _, r := range results {
+		w.Write([]string{
+			csvText(r.StudentID),
+			r.SubmissionID,
+			r.Status,
+			string(r.Verdict),
+			strconv.FormatFloat(r.Score, 'f', 2, 64),
+			strconv.FormatInt(r.TimeUsedMs, 10),
+			strconv.FormatInt(r.MemoryUsedKB, 10),
+			csvText(r.Message),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		reqLog(c).Warn().Err(err).Msg("failed to write csv")
+	}
+}
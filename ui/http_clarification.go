@@ -0,0 +1,224 @@
+package ui
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/contest"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// MaxClarificationLength 问题和回答的长度上限(字节)
+const MaxClarificationLength = 4096
+
+// createClarification 比赛进行中向裁判提问, 表单字段 question 为问题, problem 为相关的题目(可选)
+func (s *HTTPServer) createClarification(c *gin.Context) {
+	if s.contests == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+	ct, ok := s.contests.GetContest(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	question := strings.TrimSpace(c.PostForm("question"))
+	if question == "" || len(question) > MaxClarificationLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: question",
+			"data":    nil,
+		})
+		return
+	}
+	problem := c.PostForm("problem")
+
+	user, _ := c.Get("user")
+	var err error
+	switch {
+	case !ct.IsRunning(time.Now()):
+		err = contest.ErrContestNotRunning
+	case !ct.HasParticipant(user.(string)):
+		err = contest.ErrNotParticipant
+	case problem != "" && !ct.HasProblem(problem):
+		err = contest.ErrProblemNotInContest
+	}
+	if err != nil {
+		c.JSON(contestErrorStatus(err), gin.H{
+			"code":    1,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	cl := &types.Clarification{UserID: user.(string), ContestID: ct.Id, ProblemID: problem, Question: question}
+	err = s.dbService.Clarifications().CreateClarification(cl)
+	if err != nil {
+		reqLog(c).Err(err).Str("contest", ct.Id).Msg("failed to create clarification")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	reqLog(c).Info().Str("user", cl.UserID).Str("contest", ct.Id).Uint("clarification", cl.ID).Msg("clarification requested")
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    cl,
+	})
+}
+
+// listClarifications 列出比赛的答疑
+//
+// 管理员可以看到所有问题, 其他用户只能看到自己的问题和公开的回答, 后者不包含提问者.
+func (s *HTTPServer) listClarifications(c *gin.Context) {
+	if s.contests == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+	id := c.Param("id")
+	if _, ok := s.contests.GetContest(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	list, err := s.dbService.Clarifications().ListClarifications(id)
+	if err != nil {
+		reqLog(c).Err(err).Str("contest", id).Msg("failed to list clarifications")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	admin, _ := c.Get("is_admin")
+	user, _ := c.Get("user")
+	if !admin.(bool) {
+		visible := list[:0]
+		for _, cl := range list {
+			switch {
+			case cl.UserID == user.(string):
+				visible = append(visible, cl)
+			case cl.Public && cl.Answered():
+				// 不公开其他用户的提问者
+				cl.UserID = ""
+				visible = append(visible, cl)
+			}
+		}
+		list = visible
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    list,
+	})
+}
+
+// answerClarification 回答问题, 表单字段 answer 为回答, public 为 true 时回答公开并作为比赛公告发布
+func (s *HTTPServer) answerClarification(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Clarification not found",
+			"data":    nil,
+		})
+		return
+	}
+	answer := strings.TrimSpace(c.PostForm("answer"))
+	if answer == "" || len(answer) > MaxClarificationLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: answer",
+			"data":    nil,
+		})
+		return
+	}
+	public := false
+	if v := c.PostForm("public"); v != "" {
+		public, err = strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Invalid parameter: public",
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	user, _ := c.Get("user")
+	cl, err := s.dbService.Clarifications().AnswerClarification(uint(id), answer, public, user.(string))
+	if err != nil {
+		if errors.Is(err, types.ErrClarificationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Clarification not found",
+				"data":    nil,
+			})
+			return
+		}
+		reqLog(c).Err(err).Uint64("clarification", id).Msg("failed to answer clarification")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+	reqLog(c).Info().Str("user", cl.AnsweredBy).Uint("clarification", cl.ID).Bool("public", public).Msg("clarification answered")
+
+	if public && s.contests != nil {
+		if ct, ok := s.contests.GetContest(cl.ContestID); ok {
+			_, err = s.publishAnnouncement(c, ct, clarificationAnnouncement(cl), cl.AnsweredBy)
+			if err != nil {
+				reqLog(c).Err(err).Uint("clarification", cl.ID).Msg("failed to announce clarification")
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    cl,
+	})
+}
+
+// clarificationAnnouncement 公开回答时发布的公告内容
+func clarificationAnnouncement(cl *types.Clarification) string {
+	var b strings.Builder
+	b.WriteString("Clarification")
+	if cl.ProblemID != "" {
+		b.WriteString(" on problem " + cl.ProblemID)
+	}
+	b.WriteString("\n\nQ: " + cl.Question + "\n\nA: " + cl.Answer)
+	return b.String()
+}
@@ -0,0 +1,277 @@
+package ui
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/contest"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// SetContestManager 启用比赛, 需要在 ServeHTTP 之前调用
+//
+// 启用后源代码提交经由比赛管理器创建, 比赛提交会被检查比赛时间, 题目和参赛者.
+func (s *HTTPServer) SetContestManager(m *contest.Manager) {
+	s.contests = m
+	s.rankings = contest.NewRankingCache(m)
+
+	err := s.rankings.WarmAll()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to warm ranking cache")
+	}
+}
+
+// submissions 返回创建提交使用的存储
+func (s *HTTPServer) submissions() types.SubmissionStore {
+	if s.contests != nil {
+		return s.contests
+	}
+	return s.dbService.Submissions()
+}
+
+// contestErrorStatus 将比赛校验错误转换为HTTP状态码, 不是比赛校验错误时返回0
+func contestErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, contest.ErrContestNotFound),
+		errors.Is(err, types.ErrVirtualContestNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, contest.ErrContestNotRunning),
+		errors.Is(err, contest.ErrProblemNotInContest),
+		errors.Is(err, contest.ErrNotParticipant):
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// listOpenContests 列出进行中的比赛
+func (s *HTTPServer) listOpenContests(c *gin.Context) {
+	contests := []*contest.Contest{}
+	if s.contests != nil {
+		if open := s.contests.ListOpenContests(time.Now()); open != nil {
+			contests = open
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    contests,
+	})
+}
+
+// standingsMaxAge 排行榜响应的缓存时间
+const standingsMaxAge = "max-age=5"
+
+// getStandings 获取比赛排行榜
+func (s *HTTPServer) getStandings(c *gin.Context) {
+	if s.contests == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	standings, err := s.rankings.GetStandings(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, contest.ErrContestNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Contest not found",
+				"data":    nil,
+			})
+			return
+		}
+		reqLog(c).Err(err).Msg("failed to compute standings")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "private, "+standingsMaxAge)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    standings,
+	})
+}
+
+// exportFlushRows 导出比赛成绩时每写入多少行刷新一次响应
+const exportFlushRows = 100
+
+// exportContestResults 导出比赛成绩册, 查询参数 format 为 csv(默认)或 json
+//
+// CSV 的列为 Rank, UserID, Username, TotalScore, PenaltyTime 和按比赛题目顺序的各题得分,
+// JSON 为 contest.Result 的数组. 成绩边生成边写入响应, 不在内存中生成完整的文件.
+func (s *HTTPServer) exportContestResults(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: format",
+			"data":    nil,
+		})
+		return
+	}
+
+	var ct *contest.Contest
+	if s.contests != nil {
+		ct, _ = s.contests.GetContest(c.Param("id"))
+	}
+	if ct == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	results, err := s.contests.Results(ct.Id)
+	if err != nil {
+		reqLog(c).Err(err).Str("contest", ct.Id).Msg("failed to compute contest results")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	if format == "json" {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	}
+	c.Header("Content-Disposition", `attachment; filename="contest-`+ct.Id+`.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	if format == "json" {
+		err = writeResultsJSON(c.Writer, results)
+	} else {
+		err = writeResultsCSV(c.Writer, ct.ProblemIDs, results)
+	}
+	if err != nil {
+		reqLog(c).Warn().Err(err).Str("contest", ct.Id).Msg("failed to write contest results")
+	}
+}
+
+// csvText 转义可能被电子表格当作公式执行的单元格, 以 = + - @ 开头时在前面加上 '
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeResultsCSV 以CSV格式写入比赛成绩, 每 exportFlushRows 行刷新一次
+//
+// 用户ID和队伍名称由用户决定, 写入前经过 csvText 转义.
+func writeResultsCSV(w gin.ResponseWriter, problemIDs []string, results []contest.Result) error {
+	cw := csv.NewWriter(w)
+	header := []string{"Rank", "UserID", "Username", "TotalScore", "PenaltyTime"}
+	for _, pid := range problemIDs {
+		header = append(header, csvText(pid))
+	}
+	cw.Write(header)
+
+	row := make([]string, len(header))
+	for i, r := range results {
+		row[0] = strconv.Itoa(r.Rank)
+		row[1] = csvText(r.UserID)
+		row[2] = csvText(r.Username)
+		row[3] = strconv.FormatFloat(r.TotalScore, 'f', 2, 64)
+		row[4] = strconv.FormatInt(r.PenaltyTime, 10)
+		for j, pid := range problemIDs {
+			row[5+j] = strconv.FormatFloat(r.Scores[pid], 'f', 2, 64)
+		}
+		cw.Write(row)
+		if (i+1)%exportFlushRows == 0 {
+			cw.Flush()
+			w.Flush()
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeResultsJSON 以JSON数组写入比赛成绩, 逐个编码每一行, 每 exportFlushRows 行刷新一次
+func writeResultsJSON(w gin.ResponseWriter, results []contest.Result) error {
+	enc := json.NewEncoder(w)
+	_, err := w.WriteString("[")
+	if err != nil {
+		return err
+	}
+	for i := range results {
+		if i > 0 {
+			_, err = w.WriteString(",")
+			if err != nil {
+				return err
+			}
+		}
+		err = enc.Encode(&results[i])
+		if err != nil {
+			return err
+		}
+		if (i+1)%exportFlushRows == 0 {
+			w.Flush()
+		}
+	}
+	_, err = w.WriteString("]\n")
+	return err
+}
+
+// unfreezeStandings 比赛结束后解封排行榜
+func (s *HTTPServer) unfreezeStandings(c *gin.Context) {
+	if s.contests == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	err := s.contests.UnfreezeStandings(c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, contest.ErrContestNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Contest not found",
+				"data":    nil,
+			})
+		case errors.Is(err, contest.ErrContestNotEnded):
+			c.JSON(http.StatusConflict, gin.H{
+				"code":    1,
+				"message": "Contest has not ended yet",
+				"data":    nil,
+			})
+		default:
+			reqLog(c).Err(err).Msg("failed to unfreeze standings")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    1,
+				"message": "Failed to unfreeze standings",
+				"data":    nil,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    nil,
+	})
+}
@@ -0,0 +1,153 @@
+package ui
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffContextLines 每个差异块前后保留的未修改行数
+const diffContextLines = 3
+
+// DiffHunk 统一格式(unified diff)中的一个差异块
+//
+// OldStart/NewStart 为起始行号(从1开始), 块中没有旧(新)文件的行时为前一行的行号.
+// Text 为差异块的内容, 每行以 ' ', '-' 或 '+' 开头, 不包含 @@ 头.
+type DiffHunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Text     string `json:"text"`
+}
+
+// diffLine 逐行差异中的一行
+type diffLine struct {
+	op   diffmatchpatch.Operation
+	text string
+}
+
+// UnifiedDiff 按行比较 old 和 new, 返回统一格式的差异块, 两者相同时返回空切片
+func UnifiedDiff(old, new string) []DiffHunk {
+	dmp := diffmatchpatch.New()
+	r1, r2, lines := dmp.DiffLinesToRunes(old, new)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes(r1, r2, false), lines)
+
+	var ops []diffLine
+	for _, d := range diffs {
+		for _, l := range strings.SplitAfter(d.Text, "\n") {
+			if l != "" {
+				ops = append(ops, diffLine{op: d.Type, text: l})
+			}
+		}
+	}
+
+	// oldNo/newNo 第 i 行之前旧文件和新文件的行数
+	oldNo := make([]int, len(ops)+1)
+	newNo := make([]int, len(ops)+1)
+	var changed []int
+	for i, l := range ops {
+		oldNo[i+1], newNo[i+1] = oldNo[i], newNo[i]
+		if l.op != diffmatchpatch.DiffInsert {
+			oldNo[i+1]++
+		}
+		if l.op != diffmatchpatch.DiffDelete {
+			newNo[i+1]++
+		}
+		if l.op != diffmatchpatch.DiffEqual {
+			changed = append(changed, i)
+		}
+	}
+
+	hunks := make([]DiffHunk, 0)
+	for i := 0; i < len(changed); {
+		// 合并上下文重叠的修改
+		j := i
+		for j+1 < len(changed) && changed[j+1]-changed[j] <= 2*diffContextLines {
+			j++
+		}
+		start := max(0, changed[i]-diffContextLines)
+		end := min(len(ops), changed[j]+diffContextLines+1)
+
+		h := DiffHunk{
+			OldStart: oldNo[start] + 1,
+			OldLines: oldNo[end] - oldNo[start],
+			NewStart: newNo[start] + 1,
+			NewLines: newNo[end] - newNo[start],
+		}
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+
+		var b strings.Builder
+		for _, l := range ops[start:end] {
+			switch l.op {
+			case diffmatchpatch.DiffEqual:
+				b.WriteByte(' ')
+			case diffmatchpatch.DiffDelete:
+				b.WriteByte('-')
+			case diffmatchpatch.DiffInsert:
+				b.WriteByte('+')
+			}
+			b.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		h.Text = b.String()
+		hunks = append(hunks, h)
+		i = j + 1
+	}
+	return hunks
+}
+
+// diffSubmissions 比较两个提交的源代码
+//
+// 查询参数 a 和 b 为提交ID, 返回从 a 到 b 的差异块. 普通用户只能比较自己的提交.
+func (s *HTTPServer) diffSubmissions(c *gin.Context) {
+	idA, idB := c.Query("a"), c.Query("b")
+	if idA == "" || idB == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: a and b are required",
+			"data":    nil,
+		})
+		return
+	}
+
+	subA, ok := s.loadSubmission(c, idA)
+	if !ok {
+		return
+	}
+	subB, ok := s.loadSubmission(c, idB)
+	if !ok {
+		return
+	}
+
+	srcA, _, errA := s.submissionSource(subA)
+	srcB, _, errB := s.submissionSource(subB)
+	if errA != nil || errB != nil {
+		reqLog(c).Error().AnErr("a", errA).AnErr("b", errB).Msg("failed to read submission source")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to read source",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data": gin.H{
+			"a":     subA.ID,
+			"b":     subB.ID,
+			"hunks": UnifiedDiff(srcA, srcB),
+		},
+	})
+}
@@ -0,0 +1,185 @@
+package ui
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mrhaoxx/SOJ/judge"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// hackSubmission 用表单字段 input 中的输入hack他人已通过的提交
+//
+// input 也可以以文件上传. 请求会等待hack运行结束后返回hack记录, 请求提前结束时hack仍会继续运行.
+// hack成功时被hack的提交得分清零. 比赛中的hack成功时, 被hack的用户还会将 judge.HackReward
+// 乘以题目权重的hack得分转给hacker; 比赛之外的hack不计分, 以免用小号刷分.
+func (s *HTTPServer) hackSubmission(c *gin.Context) {
+	// 在解析表单之前限制请求体的大小, 过大的请求不会被完整读取
+	if !limitRequestBody(c, judge.HackMaxInputSize+formOverhead) {
+		return
+	}
+	if s.evaluator == nil || s.evaluator.Languages() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Source submissions are not enabled",
+			"data":    nil,
+		})
+		return
+	}
+
+	target, err := s.dbService.Submissions().GetByID(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, types.ErrSubmissionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Submission not found",
+				"data":    nil,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	hacker := user.(string)
+	if target.UserID == hacker {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    1,
+			"message": "You cannot hack your own submission",
+			"data":    nil,
+		})
+		return
+	}
+	if target.Status != types.SubmissionCompleted || target.JudgeResult.Verdict != types.VerdictAccepted || target.JudgeResult.Hack != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    1,
+			"message": "Only accepted submissions can be hacked",
+			"data":    nil,
+		})
+		return
+	}
+
+	problem, ok := s.problems.GetProblem(target.ProblemID)
+	// 交互题没有可以比较的标准输出
+	if !ok || problem.Solution == nil || problem.Interactor != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    1,
+			"message": "Problem does not support hacks",
+			"data":    nil,
+		})
+		return
+	}
+	lang, ok := s.evaluator.Languages().GetByID(target.Language)
+	juryLang, juryOk := s.evaluator.Languages().GetByID(problem.Solution.Language)
+	if !ok || !juryOk {
+		reqLog(c).Error().Str("id", target.ID).Str("language", target.Language).Str("jury_language", problem.Solution.Language).Msg("language for hack not found")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Language not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 比赛中的提交只能由参赛者在比赛期间hack
+	inContest := false
+	if target.ContestID != "" && s.contests != nil {
+		ct, ok := s.contests.GetContest(target.ContestID)
+		if ok {
+			err = ct.CheckSubmission(hacker, target.ProblemID, time.Now())
+			if err != nil {
+				c.JSON(contestErrorStatus(err), gin.H{
+					"code":    1,
+					"message": err.Error(),
+					"data":    nil,
+				})
+				return
+			}
+			inContest = true
+		}
+	}
+
+	input, ok := formText(c, "input")
+	if !ok || input == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: input",
+			"data":    nil,
+		})
+		return
+	}
+	if len(input) > judge.HackMaxInputSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"code":    1,
+			"message": "Hack input is too large",
+			"data":    nil,
+		})
+		return
+	}
+
+	hack := &types.Hack{
+		ID:           uuid.NewString(),
+		SubmissionID: target.ID,
+		ProblemID:    target.ProblemID,
+		HackerID:     hacker,
+		TargetUserID: target.UserID,
+		Input:        input,
+	}
+	err = s.dbService.Hacks().CreateHack(hack)
+	if err != nil {
+		reqLog(c).Err(err).Msg("failed to create hack")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	run := judge.NewHackRun(s.evaluator, s.submissions(), s.dbService.Hacks(), hack, target, &problem, lang, juryLang)
+	run.MaxArchiveSize = s.maxArchiveSize
+	if inContest {
+		// hack可能在请求结束后才完成, 不能在回调中使用 c
+		l := reqLog(c)
+		run.OnHacked = func(h *types.Hack) {
+			err := s.dbService.TransferHackScore(h.HackerID, h.TargetUserID, judge.HackReward*problem.Weight)
+			if err != nil {
+				l.Err(err).Str("hack", h.ID).Msg("failed to transfer hack score")
+			}
+		}
+	}
+	err = s.queue.Enqueue(run)
+	if err != nil {
+		s.dbService.Hacks().UpdateHack(hack.ID, types.HackError, "judge is shutting down")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Judge is shutting down",
+			"data":    nil,
+		})
+		return
+	}
+
+	res, err := run.Wait(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusAccepted, gin.H{
+			"code":    0,
+			"message": "Hack is still running",
+			"data":    gin.H{"id": hack.ID},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    res,
+	})
+}
@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/file_transfer"
+)
+
+// readinessTimeout 单项就绪检查的超时时间
+const readinessTimeout = 2 * time.Second
+
+// SetDockerService 设置就绪检查使用的Docker服务, 需要在 ServeHTTP 之前调用
+func (s *HTTPServer) SetDockerService(docker file_transfer.DockerServiceInterface) {
+	s.docker = docker
+}
+
+// healthz 存活检查, 进程能处理请求即返回 200
+func (s *HTTPServer) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    gin.H{"status": "ok"},
+	})
+}
+
+// readinessCheck 单项就绪检查的结果
+type readinessCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func checkResult(err error) readinessCheck {
+	if err != nil {
+		return readinessCheck{Error: err.Error()}
+	}
+	return readinessCheck{OK: true}
+}
+
+// readyz 就绪检查
+//
+// 依次检查Docker守护进程可以访问, 至少有一个空闲的评测worker, 以及数据库可写.
+// 全部通过时返回 200, 否则返回 503, data 中包含每一项的结果.
+func (s *HTTPServer) readyz(c *gin.Context) {
+	checks := make(map[string]readinessCheck)
+
+	if s.docker != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+		checks["docker"] = checkResult(s.docker.Ping(ctx))
+		cancel()
+	}
+
+	if s.queue != nil {
+		if s.queue.IdleWorkers() > 0 {
+			checks["workers"] = readinessCheck{OK: true}
+		} else {
+			checks["workers"] = readinessCheck{Error: "no idle judge worker"}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	checks["database"] = checkResult(s.dbService.CheckWritable(ctx))
+	cancel()
+
+	ready := true
+	for name, check := range checks {
+		if !check.OK {
+			ready = false
+			reqLog(c).Warn().Str("check", name).Str("error", check.Error).Msg("readiness check failed")
+		}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Service is not ready",
+			"data":    checks,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    checks,
+	})
+}
@@ -0,0 +1,469 @@
+package ui
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mrhaoxx/SOJ/contest"
+	"github.com/mrhaoxx/SOJ/judge"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// createSubmission 提交源代码
+//
+// 请求为 multipart 表单, 包含 problem, language 字段和名为 source 的源代码文件,
+// 比赛提交还需包含 contest 字段, 虚拟参赛的提交还需包含 virtual_contest 字段(原比赛ID). 多文件提交以名为 archive 的zip压缩包代替 source,
+// 并在 main 字段中给出主文件在压缩包内的路径. 源代码文件超过 sourceSizeLimit, 压缩包超过 archiveSizeLimit 时返回413.
+func (s *HTTPServer) createSubmission(c *gin.Context) {
+	// 在解析表单之前限制请求体的大小, 过大的请求不会被完整读取
+	if !limitRequestBody(c, max(s.sourceSizeLimit(), s.archiveSizeLimit())+formOverhead) {
+		return
+	}
+	problem, lang, ok := s.sourceTarget(c)
+	if !ok {
+		return
+	}
+
+	var src, archive []byte
+	mainFile := c.PostForm("main")
+	if fh, err := c.FormFile("archive"); err == nil {
+		if fh.Size > s.archiveSizeLimit() {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"code":    1,
+				"message": "Archive is too large, the limit is " + strconv.FormatInt(s.archiveSizeLimit(), 10) + " bytes",
+				"data":    nil,
+			})
+			return
+		}
+		archive, err = readFormFile(fh)
+		if err == nil {
+			err = s.checkArchive(archive, mainFile, lang)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Invalid parameter: archive: " + err.Error(),
+				"data":    nil,
+			})
+			return
+		}
+	} else {
+		fh, err := c.FormFile("source")
+		if err == nil && fh.Size > s.sourceSizeLimit() {
+			s.sourceTooLarge(c)
+			return
+		}
+		if err == nil {
+			src, err = readFormFile(fh)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Invalid parameter: source",
+				"data":    nil,
+			})
+			return
+		}
+		mainFile = ""
+	}
+
+	user, _ := c.Get("user")
+	sub := &types.Submission{
+		ID:         uuid.NewString(),
+		UserID:     user.(string),
+		ProblemID:  problem.Id,
+		ContestID:  c.PostForm("contest"),
+		Language:   lang.ID,
+		SourceCode: string(src),
+		Archive:    archive,
+		MainFile:   mainFile,
+	}
+
+	var err error
+	store := s.submissions()
+	if id := c.PostForm("virtual_contest"); id != "" && sub.ContestID == "" {
+		// 虚拟参赛的提交以原比赛ID指定, 记录为用户对该比赛的虚拟参赛
+		var vc *types.VirtualContest
+		vc, err = s.dbService.VirtualContests().FindVirtualContest(id, sub.UserID)
+		if err == nil {
+			sub.VirtualContestID = vc.ID
+		}
+	}
+	switch {
+	case err != nil:
+	case (sub.ContestID != "" || sub.VirtualContestID != "") && s.contests == nil:
+		err = contest.ErrContestNotFound
+	default:
+		err = store.CreateSubmission(sub)
+	}
+	if status := contestErrorStatus(err); status != 0 {
+		c.JSON(status, gin.H{
+			"code":    1,
+			"message": err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+	if err != nil {
+		reqLog(c).Err(err).Msg("failed to create submission")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	err = s.enqueueSource(store, sub, &problem, lang)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Judge is shutting down",
+			"data":    nil,
+		})
+		return
+	}
+
+	reqLog(c).Info().Str("id", sub.ID).Str("user", sub.UserID).Str("problem", sub.ProblemID).Str("language", sub.Language).Msg("submission created")
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    gin.H{"id": sub.ID},
+	})
+}
+
+// sourceTarget 读取并检查源代码提交的 problem 和 language 字段, 不合法时写入错误响应
+func (s *HTTPServer) sourceTarget(c *gin.Context) (types.Problem, *judge.LanguageConfig, bool) {
+	if s.evaluator == nil || s.evaluator.Languages() == nil || s.testCases == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Source submissions are not enabled",
+			"data":    nil,
+		})
+		return types.Problem{}, nil, false
+	}
+
+	problem, ok := s.problems.GetProblem(c.PostForm("problem"))
+	if !ok || problem.IsWorkflow() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: problem",
+			"data":    nil,
+		})
+		return types.Problem{}, nil, false
+	}
+
+	lang, ok := s.evaluator.Languages().GetByID(c.PostForm("language"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: language",
+			"data":    nil,
+		})
+		return types.Problem{}, nil, false
+	}
+
+	return problem, lang, true
+}
+
+// SetMaxArchiveSize 设置多文件提交解压后的总大小上限, 不大于0时使用默认值
+func (s *HTTPServer) SetMaxArchiveSize(size int64) {
+	s.maxArchiveSize = size
+}
+
+// archiveSizeLimit 返回上传的多文件提交压缩包的大小上限, 与解压后的总大小上限相同
+func (s *HTTPServer) archiveSizeLimit() int64 {
+	if s.maxArchiveSize <= 0 {
+		return judge.DefaultMaxArchiveSize
+	}
+	return s.maxArchiveSize
+}
+
+// formOverhead 请求体中除上传的文件之外, 其他表单字段和 multipart 头部允许占用的大小
+const formOverhead = 64 << 10
+
+// limitRequestBody 将请求体限制为 limit 字节并解析表单, 超出时写入413响应并返回 false
+//
+// 表单格式错误时不在这里报错, 由读取字段的代码返回400.
+func limitRequestBody(c *gin.Context, limit int64) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	// ParseMultipartForm 会忽略 urlencoded 表单的读取错误, 因此先单独解析
+	err := c.Request.ParseForm()
+	if err == nil {
+		_, err = c.MultipartForm()
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"code":    1,
+			"message": "Request body is too large, the limit is " + strconv.FormatInt(limit, 10) + " bytes",
+			"data":    nil,
+		})
+		return false
+	}
+	return true
+}
+
+// DefaultMaxSourceSize 源代码大小的默认上限
+const DefaultMaxSourceSize = 256 << 10
+
+// SetMaxSourceSize 设置源代码的大小上限, 不大于0时使用 DefaultMaxSourceSize
+func (s *HTTPServer) SetMaxSourceSize(size int64) {
+	s.maxSourceSize = size
+}
+
+// sourceSizeLimit 返回源代码的大小上限
+func (s *HTTPServer) sourceSizeLimit() int64 {
+	if s.maxSourceSize <= 0 {
+		return DefaultMaxSourceSize
+	}
+	return s.maxSourceSize
+}
+
+// sourceTooLarge 写入源代码超出大小上限的错误响应
+func (s *HTTPServer) sourceTooLarge(c *gin.Context) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"code":    1,
+		"message": "Source code is too large, the limit is " + strconv.FormatInt(s.sourceSizeLimit(), 10) + " bytes",
+		"data":    nil,
+	})
+}
+
+// checkArchive 检查多文件提交能否解压并用于编译
+func (s *HTTPServer) checkArchive(archive []byte, mainFile string, lang *judge.LanguageConfig) error {
+	if !lang.NeedsCompile() {
+		return errors.New("multi-file submissions require a compiled language")
+	}
+	mf, err := judge.ParseMultiFileSubmission(archive, mainFile, s.maxArchiveSize)
+	if err != nil {
+		return err
+	}
+	_, err = mf.SandboxFiles(lang)
+	return err
+}
+
+// SetDispatcher 启用分布式评测, 需要在 ServeHTTP 之前调用
+func (s *HTTPServer) SetDispatcher(dispatcher *judge.DistributedDispatcher) {
+	s.dispatcher = dispatcher
+}
+
+// enqueueSource 将已创建的提交加入评测队列, 失败时将提交标记为 failed
+//
+// 启用分布式评测时优先交给评测节点, 没有在线的评测节点或调度失败时在本地评测.
+func (s *HTTPServer) enqueueSource(store types.SubmissionStore, sub *types.Submission, problem *types.Problem, lang *judge.LanguageConfig) error {
+	if s.dispatcher != nil {
+		err := s.dispatcher.Dispatch(context.Background(), sub)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, judge.ErrNoLiveWorkers) {
+			log.Err(err).Str("id", sub.ID).Msg("failed to dispatch submission, judging locally")
+		}
+	}
+
+	err := s.queue.Enqueue(&judge.SourceSubmission{
+		Evaluator:  s.evaluator,
+		Store:      store,
+		TestCases:  s.testCases,
+		Submission: sub,
+		Problem:    problem,
+		Language:   lang,
+		Progress:   s.progress,
+
+		MaxArchiveSize: s.maxArchiveSize,
+	})
+	if err != nil {
+		store.UpdateResult(sub.ID, types.SubmissionFailed, nil)
+	}
+	return err
+}
+
+// loadSubmission 读取路径参数 id 指定的提交, 只有管理员可以读取其他用户的提交
+//
+// 失败时已经写入错误响应, 返回 false.
+func (s *HTTPServer) loadSubmission(c *gin.Context, id string) (*types.Submission, bool) {
+	sub, err := s.dbService.Submissions().GetByID(id)
+	if err != nil {
+		if errors.Is(err, types.ErrSubmissionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Submission not found",
+				"data":    nil,
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return nil, false
+	}
+
+	admin, _ := c.Get("is_admin")
+	user, _ := c.Get("user")
+	if !admin.(bool) && sub.UserID != user.(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    1,
+			"message": "You are not allowed to view this submission",
+			"data":    nil,
+		})
+		return nil, false
+	}
+	return sub, true
+}
+
+// getSubmission 获取源代码提交及其评测结果
+func (s *HTTPServer) getSubmission(c *gin.Context) {
+	sub, ok := s.loadSubmission(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    sub,
+	})
+}
+
+// problemSummary 题目列表中的题目信息
+type problemSummary struct {
+	ID            string  `json:"id"`
+	Title         string  `json:"title"`
+	Weight        float64 `json:"weight"`
+	Workflow      bool    `json:"workflow"`
+	TimeLimitMs   int64   `json:"time_limit_ms,omitempty"`
+	MemoryLimitKB int64   `json:"memory_limit_kb,omitempty"`
+	// DifficultyRating 1-10, 0 表示尚无足够数据
+	DifficultyRating float64 `json:"difficulty_rating"`
+	// Tags 知识点标签, 比赛进行中对选手隐藏
+	Tags []string `json:"tags,omitempty"`
+}
+
+// listProblems 列出所有题目
+//
+// 查询参数 tags 为逗号分隔的标签, 设置时只列出包含所有这些标签的题目.
+func (s *HTTPServer) listProblems(c *gin.Context) {
+	filter := parseTagsQuery(c)
+	hidden := s.hiddenTagProblems(c)
+
+	ids := s.problems.GetProblemList()
+	problems := make([]problemSummary, 0, len(ids))
+	for _, id := range ids {
+		p, ok := s.problems.GetProblem(id)
+		if !ok {
+			continue
+		}
+		tags := p.Tags
+		if hidden[id] {
+			tags = nil
+		}
+		if slices.ContainsFunc(filter, func(t string) bool { return !slices.Contains(tags, t) }) {
+			continue
+		}
+		problems = append(problems, problemSummary{
+			ID:            p.Id,
+			Title:         p.Title,
+			Weight:        p.Weight,
+			Workflow:      p.IsWorkflow(),
+			TimeLimitMs:   p.TimeLimitMs,
+			MemoryLimitKB: p.MemoryLimitKB,
+
+			DifficultyRating: p.DifficultyRating,
+			Tags:             tags,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    problems,
+	})
+}
+
+// trendingProblem 近期热门题目
+type trendingProblem struct {
+	judge.TrendingProblem
+	Title string `json:"title"`
+}
+
+// SetDifficultyTracker 设置难度计算器, 未设置时热门题目列表为空
+func (s *HTTPServer) SetDifficultyTracker(t *judge.DifficultyTracker) {
+	s.difficulty = t
+}
+
+// listTrendingProblems 按近期提交速度列出题目
+func (s *HTTPServer) listTrendingProblems(c *gin.Context) {
+	problems := []trendingProblem{}
+	if s.difficulty != nil {
+		for _, t := range s.difficulty.Trending() {
+			p, ok := s.problems.GetProblem(t.ProblemID)
+			if !ok {
+				continue
+			}
+			problems = append(problems, trendingProblem{TrendingProblem: t, Title: p.Title})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    problems,
+	})
+}
+
+// getLanguageTemplate 获取语言的代码模板, 用于预填编辑器
+//
+// 设置查询参数 problem 时优先返回该题目为此语言指定的模板.
+func (s *HTTPServer) getLanguageTemplate(c *gin.Context) {
+	if s.evaluator == nil || s.evaluator.Languages() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Source submissions are not enabled",
+			"data":    nil,
+		})
+		return
+	}
+
+	lang, ok := s.evaluator.Languages().GetByID(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Language not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	var problem *types.Problem
+	if id := c.Query("problem"); id != "" {
+		p, ok := s.problems.GetProblem(id)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Problem not found",
+				"data":    nil,
+			})
+			return
+		}
+		problem = &p
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data": gin.H{
+			"language": lang.ID,
+			"source":   lang.TemplateFor(problem),
+		},
+	})
+}
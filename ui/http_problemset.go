@@ -0,0 +1,260 @@
+package ui
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// 题单中题目的完成状态
+const (
+	solveStatusSolved    = "solved"
+	solveStatusAttempted = "attempted"
+)
+
+// problemSetRequest 创建或更新题单的请求
+type problemSetRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	ProblemIDs  []string `json:"problem_ids"`
+	ParentID    string   `json:"parent_id"`
+}
+
+// problemSetProblem 题单中的题目及当前用户的完成状态
+type problemSetProblem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Status 为 solved, attempted 或空(没有提交过)
+	Status string `json:"status"`
+}
+
+// problemSetDetail 题单详情
+type problemSetDetail struct {
+	*types.ProblemSet
+	Problems []problemSetProblem `json:"problems"`
+	Children []types.ProblemSet  `json:"children"`
+}
+
+// problemSetError 将题单存储的错误写入响应
+func problemSetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, types.ErrProblemSetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": err.Error(),
+			"data":    nil,
+		})
+	case errors.Is(err, types.ErrProblemSetCycle), errors.Is(err, types.ErrProblemSetTooDeep):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": err.Error(),
+			"data":    nil,
+		})
+	default:
+		reqLog(c).Err(err).Msg("problem set operation failed")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+	}
+}
+
+// solveStatus 返回用户各题的完成状态, 包括工作流评测的最高分和源代码提交的结论
+func (s *HTTPServer) solveStatus(userID string) (map[string]string, error) {
+	status := make(map[string]string)
+
+	user, err := s.dbService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	for pid, score := range user.BestScores {
+		if score >= types.FullScore {
+			status[pid] = solveStatusSolved
+		} else {
+			status[pid] = solveStatusAttempted
+		}
+	}
+
+	subs, err := s.dbService.Submissions().ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subs {
+		if sub.Status == types.SubmissionCompleted && sub.JudgeResult.Verdict == types.VerdictAccepted {
+			status[sub.ProblemID] = solveStatusSolved
+		} else if status[sub.ProblemID] == "" {
+			status[sub.ProblemID] = solveStatusAttempted
+		}
+	}
+	return status, nil
+}
+
+// bindProblemSet 解析并检查题单请求, 失败时写入400响应
+func (s *HTTPServer) bindProblemSet(c *gin.Context) (*problemSetRequest, bool) {
+	var req problemSetRequest
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			err = errors.New("name is empty")
+		}
+	}
+	if err == nil {
+		for _, pid := range req.ProblemIDs {
+			if _, ok := s.problems.GetProblem(pid); !ok {
+				err = errors.New("problem " + pid + " not found")
+				break
+			}
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid problem set: " + err.Error(),
+			"data":    nil,
+		})
+		return nil, false
+	}
+	return &req, true
+}
+
+// listProblemSets 列出题单, 查询参数 parent 为上级题单ID, 省略时列出顶层题单
+func (s *HTTPServer) listProblemSets(c *gin.Context) {
+	list, err := s.dbService.ProblemSets().ListProblemSets(c.Query("parent"))
+	if err != nil {
+		problemSetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    list,
+	})
+}
+
+// getProblemSet 获取题单, 包括其中的题目, 当前用户的完成状态和下级题单
+func (s *HTTPServer) getProblemSet(c *gin.Context) {
+	ps, err := s.dbService.ProblemSets().GetProblemSet(c.Param("id"))
+	if err != nil {
+		problemSetError(c, err)
+		return
+	}
+	children, err := s.dbService.ProblemSets().ListProblemSets(ps.ID)
+	if err != nil {
+		problemSetError(c, err)
+		return
+	}
+
+	user, _ := c.Get("user")
+	status, err := s.solveStatus(user.(string))
+	if err != nil {
+		reqLog(c).Err(err).Msg("failed to get solve status")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	problems := make([]problemSetProblem, 0, len(ps.ProblemIDs))
+	for _, pid := range ps.ProblemIDs {
+		// 已删除的题目不显示
+		p, ok := s.problems.GetProblem(pid)
+		if !ok {
+			continue
+		}
+		problems = append(problems, problemSetProblem{ID: pid, Title: p.Title, Status: status[pid]})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    problemSetDetail{ProblemSet: ps, Problems: problems, Children: children},
+	})
+}
+
+// createProblemSet 创建题单, 当前用户成为题单的维护者
+func (s *HTTPServer) createProblemSet(c *gin.Context) {
+	req, ok := s.bindProblemSet(c)
+	if !ok {
+		return
+	}
+
+	user, _ := c.Get("user")
+	ps := &types.ProblemSet{
+		Name:        req.Name,
+		Description: req.Description,
+		ProblemIDs:  req.ProblemIDs,
+		ParentID:    req.ParentID,
+		CuratorID:   user.(string),
+	}
+	err := s.dbService.ProblemSets().CreateProblemSet(ps)
+	if err != nil {
+		problemSetError(c, err)
+		return
+	}
+
+	reqLog(c).Info().Str("user", ps.CuratorID).Str("problem_set", ps.ID).Msg("problem set created")
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    ps,
+	})
+}
+
+// updateProblemSet 替换题单的名称, 描述, 题目和上级题单
+func (s *HTTPServer) updateProblemSet(c *gin.Context) {
+	req, ok := s.bindProblemSet(c)
+	if !ok {
+		return
+	}
+
+	ps := &types.ProblemSet{
+		ID:          c.Param("id"),
+		Name:        req.Name,
+		Description: req.Description,
+		ProblemIDs:  req.ProblemIDs,
+		ParentID:    req.ParentID,
+	}
+	err := s.dbService.ProblemSets().UpdateProblemSet(ps)
+	if err != nil {
+		problemSetError(c, err)
+		return
+	}
+	saved, err := s.dbService.ProblemSets().GetProblemSet(ps.ID)
+	if err != nil {
+		problemSetError(c, err)
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("problem_set", ps.ID).Msg("problem set updated")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    saved,
+	})
+}
+
+// deleteProblemSet 删除题单, 下级题单移到其上级之下
+func (s *HTTPServer) deleteProblemSet(c *gin.Context) {
+	id := c.Param("id")
+	err := s.dbService.ProblemSets().DeleteProblemSet(id)
+	if err != nil {
+		problemSetError(c, err)
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("problem_set", id).Msg("problem set deleted")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    nil,
+	})
+}
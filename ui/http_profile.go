@@ -0,0 +1,280 @@
+package ui
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/types"
+)
+
+// ProfileCacheTTL 用户资料缓存的有效期
+const ProfileCacheTTL = 60 * time.Second
+
+// 用户提交记录分页的每页数量
+const (
+	DefaultSubmissionPageSize = 50
+	MaxSubmissionPageSize     = 200
+)
+
+// profileEntry 缓存的用户资料
+type profileEntry struct {
+	profile *types.UserProfile
+	expires time.Time
+}
+
+// profileCache 按用户缓存汇总后的资料, 过期后在下次请求时重新计算
+type profileCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]profileEntry
+}
+
+func newProfileCache(ttl time.Duration) *profileCache {
+	return &profileCache{ttl: ttl, entries: make(map[string]profileEntry)}
+}
+
+func (pc *profileCache) get(userID string, now time.Time) (*types.UserProfile, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	e, ok := pc.entries[userID]
+	if !ok || now.After(e.expires) {
+		return nil, false
+	}
+	return e.profile, true
+}
+
+func (pc *profileCache) put(userID string, p *types.UserProfile, now time.Time) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	// 顺便清理过期的条目, 以免缓存随用户数增长
+	for id, e := range pc.entries {
+		if now.After(e.expires) {
+			delete(pc.entries, id)
+		}
+	}
+	pc.entries[userID] = profileEntry{profile: p, expires: now.Add(pc.ttl)}
+}
+
+// lookupUser 检查路径中的用户是否存在, 不存在时写入404响应
+func (s *HTTPServer) lookupUser(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	ok, err := s.dbService.UserExists(id)
+	if err != nil {
+		reqLog(c).Err(err).Str("user_id", id).Msg("failed to look up user")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return "", false
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "User not found",
+			"data":    nil,
+		})
+		return "", false
+	}
+	return id, true
+}
+
+// getUserProfile 获取用户的提交统计, 结果缓存 ProfileCacheTTL
+func (s *HTTPServer) getUserProfile(c *gin.Context) {
+	id, ok := s.lookupUser(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	profile, ok := s.profiles.get(id, now)
+	if !ok {
+		subs, err := s.dbService.Submissions().ListByUser(id)
+		if err != nil {
+			reqLog(c).Err(err).Str("user_id", id).Msg("failed to list user submissions")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    1,
+				"message": "Database error",
+				"data":    nil,
+			})
+			return
+		}
+		profile = types.ComputeUserProfile(id, subs, func(problemID string) float64 {
+			if p, ok := s.problems.GetProblem(problemID); ok {
+				return p.Weight
+			}
+			return 0
+		})
+		user, err := s.dbService.GetUserByID(id)
+		if err != nil {
+			reqLog(c).Err(err).Str("user_id", id).Msg("failed to get user")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    1,
+				"message": "Database error",
+				"data":    nil,
+			})
+			return
+		}
+		profile.Rating = user.Rating
+		s.profiles.put(id, profile, now)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    profile,
+	})
+}
+
+// getUserActivity 获取用户最近一年每天的提交数
+func (s *HTTPServer) getUserActivity(c *gin.Context) {
+	id, ok := s.lookupUser(c)
+	if !ok {
+		return
+	}
+
+	subs, err := s.dbService.Submissions().ListByUser(id)
+	if err != nil {
+		reqLog(c).Err(err).Str("user_id", id).Msg("failed to list user submissions")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    types.ComputeActivity(subs, time.Now()),
+	})
+}
+
+// listUserSubmissions 按提交时间倒序分页列出用户的提交, 不包含源代码
+//
+// 查询参数 after 为上一页返回的 next_cursor, 省略时从最新的提交开始; limit 为每页数量.
+// 没有更多提交时 next_cursor 为空. 只有管理员可以查看其他用户的提交.
+func (s *HTTPServer) listUserSubmissions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultSubmissionPageSize)))
+	if err != nil || limit <= 0 || limit > MaxSubmissionPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: limit",
+			"data":    nil,
+		})
+		return
+	}
+	var after *types.SubmissionCursor
+	if v := c.Query("after"); v != "" {
+		after, err = types.ParseSubmissionCursor(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1,
+				"message": "Invalid parameter: after",
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	admin, _ := c.Get("is_admin")
+	user, _ := c.Get("user")
+	if !admin.(bool) && c.Param("id") != user.(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    1,
+			"message": "You are not allowed to view these submissions",
+			"data":    nil,
+		})
+		return
+	}
+	id, ok := s.lookupUser(c)
+	if !ok {
+		return
+	}
+
+	// 多取一个提交以判断是否还有下一页
+	subs, err := s.dbService.Submissions().ListByUserPage(id, after, limit+1)
+	if err != nil {
+		reqLog(c).Err(err).Str("user_id", id).Msg("failed to list user submissions")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+	next := ""
+	if len(subs) > limit {
+		subs = subs[:limit]
+		next = types.CursorOf(&subs[limit-1]).Encode()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data": gin.H{
+			"submissions": subs,
+			"next_cursor": next,
+		},
+	})
+}
+
+// getUserRatingHistory 按时间顺序返回用户每场比赛后的rating变化
+func (s *HTTPServer) getUserRatingHistory(c *gin.Context) {
+	id, ok := s.lookupUser(c)
+	if !ok {
+		return
+	}
+
+	history, err := s.dbService.Ratings().History(id)
+	if err != nil {
+		reqLog(c).Err(err).Str("user_id", id).Msg("failed to get rating history")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    history,
+	})
+}
+
+// getLeaderboard 全站rating排行榜, 查询参数 limit 为返回的行数, 默认100
+func (s *HTTPServer) getLeaderboard(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: limit",
+			"data":    nil,
+		})
+		return
+	}
+
+	entries, err := s.dbService.Ratings().Leaderboard(limit)
+	if err != nil {
+		reqLog(c).Err(err).Msg("failed to get leaderboard")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    entries,
+	})
+}
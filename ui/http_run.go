@@ -0,0 +1,123 @@
+package ui
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/judge"
+)
+
+// SetRunRateLimiter 设置自定义输入运行接口的限流器, 需要在 ServeHTTP 之前调用
+func (s *HTTPServer) SetRunRateLimiter(limiter RateLimiter) {
+	s.runLimiter = limiter
+}
+
+// formText 读取表单中的文本字段, 也可以以同名文件上传
+func formText(c *gin.Context, name string) (string, bool) {
+	if v, ok := c.GetPostForm(name); ok {
+		return v, true
+	}
+	fh, err := c.FormFile(name)
+	if err != nil {
+		return "", false
+	}
+	b, err := readFormFile(fh)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// formTextSize 返回表单文本字段或同名上传文件的大小(字节), 不读取文件内容, 字段不存在时返回0
+func formTextSize(c *gin.Context, name string) int64 {
+	if v, ok := c.GetPostForm(name); ok {
+		return int64(len(v))
+	}
+	if fh, err := c.FormFile(name); err == nil {
+		return fh.Size
+	}
+	return 0
+}
+
+// runCustom 以用户提供的输入运行源代码
+//
+// 请求为表单, 包含 source, language 和 custom_input 字段, source 和 custom_input 也可以以文件上传.
+// 源代码超过 sourceSizeLimit 或自定义输入超过 judge.CustomRunMaxInputSize 时返回413.
+// 运行经过评测队列, 请求会等待运行结束后返回标准输出和标准错误, 不与标准答案比较.
+func (s *HTTPServer) runCustom(c *gin.Context) {
+	if s.evaluator == nil || s.evaluator.Languages() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Source submissions are not enabled",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 在解析表单之前限制请求体的大小, 过大的请求不会被完整读取
+	if !limitRequestBody(c, s.sourceSizeLimit()+judge.CustomRunMaxInputSize+formOverhead) {
+		return
+	}
+
+	lang, ok := s.evaluator.Languages().GetByID(c.PostForm("language"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: language",
+			"data":    nil,
+		})
+		return
+	}
+	if formTextSize(c, "source") > s.sourceSizeLimit() {
+		s.sourceTooLarge(c)
+		return
+	}
+	if formTextSize(c, "custom_input") > judge.CustomRunMaxInputSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"code":    1,
+			"message": "Custom input is too large, the limit is " + strconv.Itoa(judge.CustomRunMaxInputSize) + " bytes",
+			"data":    nil,
+		})
+		return
+	}
+
+	src, ok := formText(c, "source")
+	if !ok || src == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: source",
+			"data":    nil,
+		})
+		return
+	}
+	input, _ := formText(c, "custom_input")
+
+	run := judge.NewCustomRun(s.evaluator, lang, []byte(src), []byte(input))
+	err := s.queue.Enqueue(run)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Judge is shutting down",
+			"data":    nil,
+		})
+		return
+	}
+
+	res, err := run.Wait(c.Request.Context())
+	if err != nil {
+		reqLog(c).Err(err).Str("id", run.ID()).Msg("custom run failed")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Run failed",
+			"data":    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    res,
+	})
+}
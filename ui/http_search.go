@@ -0,0 +1,182 @@
+package ui
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/types"
+)
+
+// defaultSearchLevel 用户没有通过有难度评级的题目时, 估计的水平
+const defaultSearchLevel = 1.0
+
+// searchResult 题目搜索结果
+type searchResult struct {
+	problemSummary
+	// TagMatches 题目包含的查询标签数
+	TagMatches int `json:"tag_matches"`
+	// Relevance 标题和题面与关键词的相关度, 没有关键词时为0
+	Relevance float64 `json:"relevance"`
+}
+
+// searchSummary 返回建立搜索索引使用的题面摘要
+func (s *HTTPServer) searchSummary(p *types.Problem) string {
+	st, err := s.problemStatement(p.Id)
+	if err != nil {
+		return ""
+	}
+	return st.Body
+}
+
+// estimatedLevel 估计用户的水平, 为用户通过的有难度评级的题目的平均难度
+func (s *HTTPServer) estimatedLevel(userID string) (float64, error) {
+	status, err := s.solveStatus(userID)
+	if err != nil {
+		return 0, err
+	}
+	sum, n := 0.0, 0
+	for pid, st := range status {
+		if st != solveStatusSolved {
+			continue
+		}
+		p, ok := s.problems.GetProblem(pid)
+		if !ok || p.DifficultyRating == 0 {
+			continue
+		}
+		sum += p.DifficultyRating
+		n++
+	}
+	if n == 0 {
+		return defaultSearchLevel, nil
+	}
+	return sum / float64(n), nil
+}
+
+// parseDifficulty 读取难度查询参数, 省略时返回 def
+func parseDifficulty(c *gin.Context, key string, def float64) (float64, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return def, true
+	}
+	d, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(d) || d < 0 || d > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: " + key,
+			"data":    nil,
+		})
+		return 0, false
+	}
+	return d, true
+}
+
+// searchProblems 按关键词, 标签和难度搜索题目
+//
+// 查询参数 q 为关键词, 设置时只返回标题或题面摘要包含所有关键词的题目; tags 为逗号分隔的标签,
+// 设置时只返回至少包含其中一个标签的题目; min_difficulty 和 max_difficulty 为难度范围, 设置时不返回尚无难度评级的题目.
+// 结果按包含的查询标签数降序, 难度与用户估计水平的差距升序, 关键词相关度降序排列.
+func (s *HTTPServer) searchProblems(c *gin.Context) {
+	minDifficulty, ok := parseDifficulty(c, "min_difficulty", 0)
+	if !ok {
+		return
+	}
+	maxDifficulty, ok := parseDifficulty(c, "max_difficulty", 10)
+	if !ok {
+		return
+	}
+	ranged := c.Query("min_difficulty") != "" || c.Query("max_difficulty") != ""
+	filter := parseTagsQuery(c)
+	hidden := s.hiddenTagProblems(c)
+
+	s.search.Sync(s.problems.GetAllProblems(), s.searchSummary)
+	var relevance map[string]float64
+	q := c.Query("q")
+	if q != "" {
+		relevance = s.search.Search(q)
+	}
+
+	user, _ := c.Get("user")
+	level, err := s.estimatedLevel(user.(string))
+	if err != nil {
+		reqLog(c).Err(err).Msg("failed to estimate user level")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	results := []searchResult{}
+	for _, id := range s.problems.GetProblemList() {
+		p, ok := s.problems.GetProblem(id)
+		if !ok {
+			continue
+		}
+		if q != "" {
+			if _, ok := relevance[id]; !ok {
+				continue
+			}
+		}
+		if ranged && (p.DifficultyRating == 0 || p.DifficultyRating < minDifficulty || p.DifficultyRating > maxDifficulty) {
+			continue
+		}
+		tags := p.Tags
+		if hidden[id] {
+			tags = nil
+		}
+		matches := 0
+		for _, t := range filter {
+			if slices.Contains(tags, t) {
+				matches++
+			}
+		}
+		if len(filter) > 0 && matches == 0 {
+			continue
+		}
+
+		results = append(results, searchResult{
+			problemSummary: problemSummary{
+				ID:            p.Id,
+				Title:         p.Title,
+				Weight:        p.Weight,
+				Workflow:      p.IsWorkflow(),
+				TimeLimitMs:   p.TimeLimitMs,
+				MemoryLimitKB: p.MemoryLimitKB,
+
+				DifficultyRating: p.DifficultyRating,
+				Tags:             tags,
+			},
+			TagMatches: matches,
+			Relevance:  relevance[id],
+		})
+	}
+
+	// 尚无难度评级的题目排在有评级的题目之后
+	distance := func(r *searchResult) float64 {
+		if r.DifficultyRating == 0 {
+			return math.Inf(1)
+		}
+		return math.Abs(r.DifficultyRating - level)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := &results[i], &results[j]
+		if a.TagMatches != b.TagMatches {
+			return a.TagMatches > b.TagMatches
+		}
+		if da, db := distance(a), distance(b); da != db {
+			return da < db
+		}
+		return a.Relevance > b.Relevance
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    results,
+	})
+}
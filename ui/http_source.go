@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/judge"
+	"github.com/mrhaoxx/SOJ/types"
+)
+
+// highlightStyle 源代码高亮使用的chroma样式, 样式以内联的方式写入HTML, 前端不需要额外的CSS
+const highlightStyle = "github"
+
+// HighlightSource 将源代码渲染为带行号和语法高亮的HTML片段
+//
+// 按语言ID选择词法分析器, 找不到时依次按文件名和内容猜测, 都失败时不高亮.
+func HighlightSource(src, language, filename string) (string, error) {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Match(filename)
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(src)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	it, err := lexer.Tokenise(nil, src)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	err = chromahtml.New(chromahtml.WithLineNumbers(true)).Format(&b, styles.Get(highlightStyle), it)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// submissionSource 返回提交的源代码和文件名, 多文件提交返回主文件
+func (s *HTTPServer) submissionSource(sub *types.Submission) (string, string, error) {
+	filename := ""
+	if s.evaluator != nil && s.evaluator.Languages() != nil {
+		if lang, ok := s.evaluator.Languages().GetByID(sub.Language); ok {
+			filename = lang.SourceFile()
+		}
+	}
+	if sub.Archive == nil {
+		return sub.SourceCode, filename, nil
+	}
+
+	mf, err := judge.ParseMultiFileSubmission(sub.Archive, sub.MainFile, s.maxArchiveSize)
+	if err != nil {
+		return "", "", err
+	}
+	return string(mf.Files[mf.MainFile]), mf.MainFile, nil
+}
+
+// getSubmissionSource 获取提交的源代码
+//
+// 按 Accept 头返回: text/html(默认)返回语法高亮后的HTML片段, text/plain 返回原始源代码.
+// 高亮结果缓存在提交存储中, 之后的请求不再重新渲染.
+func (s *HTTPServer) getSubmissionSource(c *gin.Context) {
+	sub, ok := s.loadSubmission(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	format := c.NegotiateFormat(gin.MIMEHTML, gin.MIMEPlain)
+	if format == "" {
+		c.JSON(http.StatusNotAcceptable, gin.H{
+			"code":    1,
+			"message": "Only text/html and text/plain are supported",
+			"data":    nil,
+		})
+		return
+	}
+
+	if format == gin.MIMEHTML && sub.HighlightedSource != "" {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(sub.HighlightedSource))
+		return
+	}
+
+	src, filename, err := s.submissionSource(sub)
+	if err != nil {
+		reqLog(c).Err(err).Str("id", sub.ID).Msg("failed to read submission source")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to read source",
+			"data":    nil,
+		})
+		return
+	}
+
+	if format == gin.MIMEPlain {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(src))
+		return
+	}
+
+	html, err := HighlightSource(src, sub.Language, filename)
+	if err != nil {
+		reqLog(c).Err(err).Str("id", sub.ID).Msg("failed to highlight source")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to highlight source",
+			"data":    nil,
+		})
+		return
+	}
+	err = s.dbService.Submissions().SetHighlightedSource(sub.ID, html)
+	if err != nil {
+		reqLog(c).Warn().Err(err).Str("id", sub.ID).Msg("failed to cache highlighted source")
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
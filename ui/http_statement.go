@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/judge"
+	"github.com/pkg/errors"
+)
+
+// mimeMarkdown Markdown的MIME类型
+const mimeMarkdown = "text/markdown"
+
+// SetStatementStore 设置题面存储, 需要在 ServeHTTP 之前调用
+//
+// 未设置或题目在存储中没有题面时, 使用题目定义中的 statement 或 text 作为题面.
+func (s *HTTPServer) SetStatementStore(store judge.StatementStore) {
+	s.statements = store
+}
+
+// problemStatement 读取题目的题面
+func (s *HTTPServer) problemStatement(problemID string) (*judge.ProblemStatement, error) {
+	if s.statements != nil {
+		st, err := s.statements.GetStatement(problemID)
+		if !errors.Is(err, judge.ErrNoStatement) {
+			return st, err
+		}
+	}
+
+	p, ok := s.problems.GetProblem(problemID)
+	if !ok {
+		return nil, judge.ErrNoStatement
+	}
+	body := p.Statement
+	if body == "" {
+		body = p.Text
+	}
+	if body == "" {
+		return nil, judge.ErrNoStatement
+	}
+	return &judge.ProblemStatement{Body: body}, nil
+}
+
+// getProblemStatement 获取题面
+//
+// 按 Accept 头返回: text/html(默认)返回渲染后的HTML片段, text/markdown 或 text/plain 返回Markdown原文,
+// application/json 返回题面的各个部分.
+func (s *HTTPServer) getProblemStatement(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := s.problems.GetProblem(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Problem not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	format := c.NegotiateFormat(gin.MIMEHTML, mimeMarkdown, gin.MIMEPlain, gin.MIMEJSON)
+	if format == "" {
+		c.JSON(http.StatusNotAcceptable, gin.H{
+			"code":    1,
+			"message": "Only text/html, text/markdown, text/plain and application/json are supported",
+			"data":    nil,
+		})
+		return
+	}
+
+	st, err := s.problemStatement(id)
+	if err != nil {
+		if errors.Is(err, judge.ErrNoStatement) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Problem has no statement",
+				"data":    nil,
+			})
+			return
+		}
+		reqLog(c).Err(err).Str("problem", id).Msg("failed to read statement")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to read statement",
+			"data":    nil,
+		})
+		return
+	}
+
+	switch format {
+	case gin.MIMEJSON:
+		c.JSON(http.StatusOK, gin.H{
+			"code":    0,
+			"message": "success",
+			"data":    st,
+		})
+		return
+	case mimeMarkdown, gin.MIMEPlain:
+		c.Data(http.StatusOK, format+"; charset=utf-8", []byte(st.Markdown()))
+		return
+	}
+
+	html, err := judge.RenderMarkdown(st.Markdown())
+	if err != nil {
+		reqLog(c).Err(err).Str("problem", id).Msg("failed to render statement")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to render statement",
+			"data":    nil,
+		})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
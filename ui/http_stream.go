@@ -0,0 +1,116 @@
+package ui
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/mrhaoxx/SOJ/judge"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// streamWriteTimeout 向WebSocket写入单条消息的超时时间
+const streamWriteTimeout = 10 * time.Second
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// streamSubmission 通过WebSocket推送提交的评测进度
+//
+// 每个测试点结束时推送一条 testcase 消息, 评测结束时推送 done 消息并关闭连接.
+// 连接时提交已经评测结束的, 直接推送 done 消息.
+func (s *HTTPServer) streamSubmission(c *gin.Context) {
+	id := c.Param("id")
+
+	// 先订阅再查询状态, 避免查询后评测恰好结束而错过 done 事件
+	events, unsubscribe := s.progress.Subscribe(id)
+	defer unsubscribe()
+
+	sub, err := s.dbService.Submissions().GetByID(id)
+	if err != nil {
+		if errors.Is(err, types.ErrSubmissionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1,
+				"message": "Submission not found",
+				"data":    nil,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+
+	admin, _ := c.Get("is_admin")
+	user, _ := c.Get("user")
+	if !admin.(bool) && sub.UserID != user.(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    1,
+			"message": "You are not allowed to view this submission",
+			"data":    nil,
+		})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		reqLog(c).Debug().Err(err).Msg("failed to upgrade websocket")
+		return
+	}
+	defer conn.Close()
+
+	// 读取并丢弃客户端消息, 以便及时发现连接关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(ev judge.ProgressEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		return conn.WriteJSON(ev)
+	}
+	finish := func(ev judge.ProgressEvent) {
+		if send(ev) != nil {
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}
+
+	if sub.Status == types.SubmissionCompleted || sub.Status == types.SubmissionFailed {
+		finish(judge.ProgressEvent{Type: judge.ProgressDone, Status: sub.Status, Result: &sub.JudgeResult})
+		return
+	}
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ev.Type == judge.ProgressDone {
+				finish(ev)
+				return
+			}
+			if send(ev) != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
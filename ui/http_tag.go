@@ -0,0 +1,211 @@
+package ui
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// tagCount 标签及使用该标签的题目数
+type tagCount struct {
+	Name     string `json:"name"`
+	Problems int    `json:"problems"`
+}
+
+// hiddenTagProblems 返回标签对当前用户隐藏的题目, 即进行中的比赛的题目, 管理员返回nil
+func (s *HTTPServer) hiddenTagProblems(c *gin.Context) map[string]bool {
+	admin, _ := c.Get("is_admin")
+	if admin.(bool) || s.contests == nil {
+		return nil
+	}
+	hidden := make(map[string]bool)
+	for _, ct := range s.contests.ListOpenContests(time.Now()) {
+		for _, pid := range ct.ProblemIDs {
+			hidden[pid] = true
+		}
+	}
+	return hidden
+}
+
+// parseTagsQuery 解析逗号分隔的 tags 查询参数
+func parseTagsQuery(c *gin.Context) []string {
+	var tags []string
+	for _, t := range strings.Split(c.Query("tags"), ",") {
+		if t = types.NormalizeTag(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// listProblemTags 列出所有标签及使用该标签的题目数, 对当前用户隐藏的标签不计数
+func (s *HTTPServer) listProblemTags(c *gin.Context) {
+	counts := make(map[string]int)
+	tags, err := s.dbService.Tags().ListTags()
+	if err != nil {
+		reqLog(c).Err(err).Msg("failed to list tags")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+	for _, t := range tags {
+		counts[t.Name] = 0
+	}
+
+	hidden := s.hiddenTagProblems(c)
+	for id, p := range s.problems.GetAllProblems() {
+		if hidden[id] {
+			continue
+		}
+		for _, t := range p.Tags {
+			counts[t]++
+		}
+	}
+
+	result := make([]tagCount, 0, len(counts))
+	for name, n := range counts {
+		result = append(result, tagCount{Name: name, Problems: n})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    result,
+	})
+}
+
+// listTags 列出所有已创建的标签
+func (s *HTTPServer) listTags(c *gin.Context) {
+	tags, err := s.dbService.Tags().ListTags()
+	if err != nil {
+		reqLog(c).Err(err).Msg("failed to list tags")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    tags,
+	})
+}
+
+// createTag 创建标签, 表单字段 name 为标签名, 会被规范化为小写
+func (s *HTTPServer) createTag(c *gin.Context) {
+	tag, err := s.dbService.Tags().CreateTag(types.NormalizeTag(c.PostForm("name")))
+	if err != nil {
+		if errors.Is(err, types.ErrTagExists) {
+			c.JSON(http.StatusConflict, gin.H{
+				"code":    1,
+				"message": "Tag already exists",
+				"data":    nil,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid tag: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("tag", tag.Name).Msg("tag created by admin")
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    tag,
+	})
+}
+
+// addProblemTag 为题目添加标签, 表单字段 tag 为已创建的标签
+func (s *HTTPServer) addProblemTag(c *gin.Context) {
+	tag := types.NormalizeTag(c.PostForm("tag"))
+	ok, err := s.dbService.Tags().HasTag(tag)
+	if err != nil {
+		reqLog(c).Err(err).Msg("failed to look up tag")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Tag not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	s.editProblemTags(c, func(tags []string) []string {
+		if slices.Contains(tags, tag) {
+			return tags
+		}
+		return append(tags, tag)
+	})
+}
+
+// removeProblemTag 移除题目的标签
+func (s *HTTPServer) removeProblemTag(c *gin.Context) {
+	tag := types.NormalizeTag(c.Param("tag"))
+	s.editProblemTags(c, func(tags []string) []string {
+		return slices.DeleteFunc(tags, func(t string) bool { return t == tag })
+	})
+}
+
+// editProblemTags 用 edit 修改题目的标签并保存题目
+func (s *HTTPServer) editProblemTags(c *gin.Context, edit func(tags []string) []string) {
+	editor, ok := s.problemEditor(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	p, ok := editor.GetProblem(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Problem not found",
+			"data":    nil,
+		})
+		return
+	}
+
+	// 题目可能被其他goroutine持有, 不能修改原来的切片
+	p.Tags = edit(slices.Clone(p.Tags))
+	err := editor.SaveProblem(p)
+	if err != nil {
+		reqLog(c).Err(err).Str("problem", id).Msg("failed to save problem tags")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Failed to save problem",
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	reqLog(c).Info().Str("user", user.(string)).Str("problem", id).Strs("tags", p.Tags).Msg("problem tags updated by admin")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    p.Tags,
+	})
+}
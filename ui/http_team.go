@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// teamError 将队伍操作的错误转换为响应
+func teamError(c *gin.Context, err error) {
+	var status int
+	var msg string
+	switch {
+	case errors.Is(err, types.ErrTeamNotFound):
+		status, msg = http.StatusNotFound, "Team not found"
+	case errors.Is(err, types.ErrNotInTeam):
+		status, msg = http.StatusNotFound, "You are not in a team"
+	case errors.Is(err, types.ErrAlreadyInTeam):
+		status, msg = http.StatusConflict, "You are already in a team"
+	case errors.Is(err, types.ErrTeamFull):
+		status, msg = http.StatusConflict, "Team is full"
+	default:
+		reqLog(c).Err(err).Msg("team operation failed")
+		status, msg = http.StatusInternalServerError, "Database error"
+	}
+	c.JSON(status, gin.H{
+		"code":    1,
+		"message": msg,
+		"data":    nil,
+	})
+}
+
+// getMyTeam 获取当前用户所在的队伍, 包含邀请码
+func (s *HTTPServer) getMyTeam(c *gin.Context) {
+	user, _ := c.Get("user")
+	team, err := s.dbService.Teams().GetTeamByUser(user.(string))
+	if err != nil {
+		teamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    team,
+	})
+}
+
+// createTeam 创建队伍, 表单字段 name 为队名
+func (s *HTTPServer) createTeam(c *gin.Context) {
+	name := c.PostForm("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: name",
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	team, err := s.dbService.Teams().CreateTeam(name, user.(string))
+	if err != nil {
+		teamError(c, err)
+		return
+	}
+	reqLog(c).Info().Str("team", team.TeamID).Str("user", user.(string)).Msg("team created")
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    team,
+	})
+}
+
+// joinTeam 通过表单字段 invite_code 中的邀请码加入队伍
+func (s *HTTPServer) joinTeam(c *gin.Context) {
+	code := c.PostForm("invite_code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1,
+			"message": "Invalid parameter: invite_code",
+			"data":    nil,
+		})
+		return
+	}
+
+	user, _ := c.Get("user")
+	team, err := s.dbService.Teams().JoinTeam(code, user.(string))
+	if err != nil {
+		teamError(c, err)
+		return
+	}
+	reqLog(c).Info().Str("team", team.TeamID).Str("user", user.(string)).Msg("team joined")
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    team,
+	})
+}
+
+// leaveTeam 离开当前所在的队伍, 已经提交的团队赛提交仍计入原队伍
+func (s *HTTPServer) leaveTeam(c *gin.Context) {
+	user, _ := c.Get("user")
+	err := s.dbService.Teams().LeaveTeam(user.(string))
+	if err != nil {
+		teamError(c, err)
+		return
+	}
+	reqLog(c).Info().Str("user", user.(string)).Msg("team left")
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    nil,
+	})
+}
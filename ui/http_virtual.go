@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mrhaoxx/SOJ/contest"
+	"github.com/mrhaoxx/SOJ/types"
+	"github.com/pkg/errors"
+)
+
+// virtualContestError 将虚拟参赛的错误写入响应
+func virtualContestError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, contest.ErrContestNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "Contest not found",
+			"data":    nil,
+		})
+	case errors.Is(err, types.ErrVirtualContestNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1,
+			"message": "You have not started a virtual contest for this contest",
+			"data":    nil,
+		})
+	case errors.Is(err, contest.ErrContestNotEnded):
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    1,
+			"message": "Contest has not ended yet",
+			"data":    nil,
+		})
+	case errors.Is(err, types.ErrVirtualContestExists):
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    1,
+			"message": "Virtual contest already started",
+			"data":    nil,
+		})
+	case errors.Is(err, contest.ErrVirtualNotEnabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    1,
+			"message": "Virtual contests are not enabled",
+			"data":    nil,
+		})
+	default:
+		reqLog(c).Err(err).Msg("virtual contest operation failed")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1,
+			"message": "Database error",
+			"data":    nil,
+		})
+	}
+}
+
+// startVirtualContest 开始对已结束比赛的虚拟参赛, 计时从现在开始
+//
+// 虚拟参赛期间的提交以 virtual_contest 字段提交, 不计入原比赛的排行榜和rating.
+func (s *HTTPServer) startVirtualContest(c *gin.Context) {
+	if s.contests == nil {
+		virtualContestError(c, contest.ErrContestNotFound)
+		return
+	}
+
+	user, _ := c.Get("user")
+	vc, err := s.contests.StartVirtual(c.Param("id"), user.(string), time.Now())
+	if err != nil {
+		virtualContestError(c, err)
+		return
+	}
+
+	reqLog(c).Info().Str("user", vc.UserID).Str("contest", vc.ContestID).Time("end", vc.EndTime).Msg("virtual contest started")
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    vc,
+	})
+}
+
+// getMyVirtualStandings 获取当前用户的虚拟参赛成绩, 及以此成绩参加原比赛时的名次
+func (s *HTTPServer) getMyVirtualStandings(c *gin.Context) {
+	if s.contests == nil {
+		virtualContestError(c, contest.ErrContestNotFound)
+		return
+	}
+
+	user, _ := c.Get("user")
+	res, err := s.contests.VirtualResult(c.Param("id"), user.(string))
+	if err != nil {
+		virtualContestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    res,
+	})
+}
+
+// getVirtualStandings 获取比赛所有虚拟参赛者的排行榜
+func (s *HTTPServer) getVirtualStandings(c *gin.Context) {
+	if s.contests == nil {
+		virtualContestError(c, contest.ErrContestNotFound)
+		return
+	}
+
+	standings, err := s.contests.VirtualStandings(c.Param("id"))
+	if err != nil {
+		virtualContestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    standings,
+	})
+}
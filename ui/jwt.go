@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// JWTAuth 使用 HMAC-SHA256 签名的 JWT 认证
+type JWTAuth struct {
+	secret []byte
+}
+
+// NewJWTAuth 创建 JWT 认证
+func NewJWTAuth(secret string) (*JWTAuth, error) {
+	if secret == "" {
+		return nil, errors.New("jwt secret is empty")
+	}
+	return &JWTAuth{secret: []byte(secret)}, nil
+}
+
+// JWTClaims token 中的声明
+type JWTClaims struct {
+	jwt.RegisteredClaims
+	// Admin 是否可以访问 /admin 下的管理接口, 与数据库中的管理员身份相互独立
+	Admin bool `json:"admin,omitempty"`
+}
+
+// GenerateToken 为用户签发有效期为 expiry 的 token
+func (a *JWTAuth) GenerateToken(userID string, expiry time.Duration) (string, error) {
+	return a.generate(userID, expiry, false)
+}
+
+// GenerateAdminToken 为运维人员签发有效期为 expiry, 带有 admin 声明的 token
+func (a *JWTAuth) GenerateAdminToken(userID string, expiry time.Duration) (string, error) {
+	return a.generate(userID, expiry, true)
+}
+
+func (a *JWTAuth) generate(userID string, expiry time.Duration, admin bool) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+		},
+		Admin: admin,
+	})
+	return token.SignedString(a.secret)
+}
+
+// ParseToken 验证 token 并返回其中的声明
+func (a *JWTAuth) ParseToken(tokenString string) (*JWTClaims, error) {
+	var claims JWTClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return &claims, nil
+}
+
+// bearerToken 从 Authorization 头中取出 Bearer token
+func bearerToken(c *gin.Context) (string, bool) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return strings.TrimSpace(token), ok
+}
+
+// authenticateJWT 验证 Authorization 头中的 Bearer token, 失败时返回 401 并中止请求
+func (s *HTTPServer) authenticateJWT(c *gin.Context) (*JWTClaims, bool) {
+	token, ok := bearerToken(c)
+	if !ok || token == "" || s.jwt == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    0,
+			"message": "Token is required",
+			"data":    nil,
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	claims, err := s.jwt.ParseToken(token)
+	if err != nil {
+		reqLog(c).Debug().Err(err).Msg("invalid jwt")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    0,
+			"message": "Invalid Token",
+			"data":    nil,
+		})
+		c.Abort()
+		return nil, false
+	}
+	return claims, true
+}
+
+// JWTMiddleware JWT认证中间件
+//
+// 验证 Authorization 头中的 Bearer token, 将 sub 中的用户ID保存到 context 中.
+func (s *HTTPServer) JWTMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := s.authenticateJWT(c)
+		if !ok {
+			return
+		}
+
+		c.Set("user", claims.Subject)
+		c.Set("is_admin", s.dbService.IsAdmin(claims.Subject))
+
+		c.Next()
+	}
+}
+
+// AdminJWTMiddleware 管理接口的认证中间件
+//
+// 只接受带有 admin 声明的 JWT, 不接受 Cookie 中的 token, 也不使用数据库中的管理员身份.
+func (s *HTTPServer) AdminJWTMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := s.authenticateJWT(c)
+		if !ok {
+			return
+		}
+		if !claims.Admin {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    1,
+				"message": "Admin token is required",
+				"data":    nil,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("user", claims.Subject)
+		c.Set("is_admin", true)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,46 @@
+package ui
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestIDHeader 请求ID所在的HTTP头
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware 为每个请求分配请求ID
+//
+// 请求已带有 X-Request-ID 时沿用, 否则生成新的ID. ID会写回响应头,
+// 并附加到请求 context 中的 zerolog logger 上, 处理函数可通过 zerolog.Ctx(c.Request.Context()) 获取.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = uuid.NewString()
+		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+
+		l := log.With().Str("request_id", id).Logger()
+		c.Request = c.Request.WithContext(l.WithContext(c.Request.Context()))
+
+		start := time.Now()
+		c.Next()
+
+		l.Debug().
+			Str("method", c.Request.Method).
+			Str("path", c.FullPath()).
+			Int("status", c.Writer.Status()).
+			Dur("duration", time.Since(start)).
+			Msg("http request")
+	}
+}
+
+// reqLog 返回带有请求ID的logger
+func reqLog(c *gin.Context) *zerolog.Logger {
+	return zerolog.Ctx(c.Request.Context())
+}
@@ -0,0 +1,173 @@
+package ui
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+// 默认限流配置
+const (
+	// DefaultSubmitRateLimit 每个用户每分钟的默认提交次数上限
+	DefaultSubmitRateLimit = 10
+	// DefaultRunInterval 每个用户两次自定义输入运行的最小间隔
+	DefaultRunInterval = 5 * time.Second
+)
+
+// RateLimiter 按键限流
+type RateLimiter interface {
+	// Allow 消耗一个令牌. 令牌不足时返回 false 以及需要等待的时间.
+	Allow(ctx context.Context, key string) (bool, time.Duration, error)
+}
+
+// MemoryRateLimiter 进程内的令牌桶限流器
+type MemoryRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewMemoryRateLimiter 创建进程内限流器, 每个键每分钟最多 perMinute 次
+func NewMemoryRateLimiter(perMinute int) *MemoryRateLimiter {
+	if perMinute <= 0 {
+		perMinute = DefaultSubmitRateLimit
+	}
+	return NewMemoryIntervalRateLimiter(time.Minute/time.Duration(perMinute), perMinute)
+}
+
+// NewMemoryIntervalRateLimiter 创建进程内限流器, 每个键每隔 interval 补充一个令牌, 最多积累 burst 个
+func NewMemoryIntervalRateLimiter(interval time.Duration, burst int) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		limit:    rate.Every(interval),
+		burst:    max(burst, 1),
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// Allow 消耗一个令牌
+func (l *MemoryRateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	l.mu.Lock()
+	lim, ok := l.limiters[key]
+	if !ok {
+		lim = rate.NewLimiter(l.limit, l.burst)
+		l.limiters[key] = lim
+	}
+	l.mu.Unlock()
+
+	r := lim.Reserve()
+	if d := r.Delay(); d > 0 {
+		r.Cancel()
+		return false, d, nil
+	}
+	return true, 0, nil
+}
+
+// redisTokenBucket 在Redis中原子地更新令牌桶
+//
+// KEYS[1] 桶的键; ARGV 依次为 每毫秒补充的令牌数, 桶容量, 当前时间(毫秒).
+// 返回 {是否允许, 需要等待的毫秒数}.
+var redisTokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate))
+return {allowed, wait}
+`)
+
+// RedisRateLimiter 基于Redis的令牌桶限流器, 多个实例共享限流状态
+type RedisRateLimiter struct {
+	client redis.UniversalClient
+	prefix string
+	perMs  float64
+	burst  int
+}
+
+// NewRedisRateLimiter 创建提交接口的Redis限流器, 每个键每分钟最多 perMinute 次
+func NewRedisRateLimiter(client redis.UniversalClient, perMinute int) *RedisRateLimiter {
+	if perMinute <= 0 {
+		perMinute = DefaultSubmitRateLimit
+	}
+	return NewRedisIntervalRateLimiter(client, "submit", time.Minute/time.Duration(perMinute), perMinute)
+}
+
+// NewRedisIntervalRateLimiter 创建Redis限流器, 每个键每隔 interval 补充一个令牌, 最多积累 burst 个
+//
+// name 用于区分不同接口的限流状态.
+func NewRedisIntervalRateLimiter(client redis.UniversalClient, name string, interval time.Duration, burst int) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		client: client,
+		prefix: "soj:ratelimit:" + name + ":",
+		perMs:  float64(time.Millisecond) / float64(interval),
+		burst:  max(burst, 1),
+	}
+}
+
+// Allow 消耗一个令牌
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	res, err := redisTokenBucket.Run(ctx, l.client, []string{l.prefix + key},
+		strconv.FormatFloat(l.perMs, 'g', -1, 64), l.burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// RateLimitMiddleware 按用户限流, 需要在 AuthMiddleware 之后使用
+//
+// 超出限制时返回 429 并设置 Retry-After. 限流器出错时放行, 以免Redis故障导致无法提交.
+func RateLimitMiddleware(limiter RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := c.Get("user")
+		uid, _ := user.(string)
+
+		ok, wait, err := limiter.Allow(c.Request.Context(), uid)
+		if err != nil {
+			reqLog(c).Warn().Err(err).Str("user", uid).Msg("rate limiter failed, allowing request")
+			c.Next()
+			return
+		}
+		if !ok {
+			retry := int(math.Ceil(wait.Seconds()))
+			reqLog(c).Info().Str("user", uid).Str("path", c.FullPath()).Int("retry_after", retry).Msg("request throttled")
+			c.Header("Retry-After", strconv.Itoa(retry))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"code":    1,
+				"message": "Too many requests, please retry later",
+				"data":    nil,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}